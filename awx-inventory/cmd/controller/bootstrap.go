@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/exitcode"
+)
+
+// bootstrapPollInterval is how often project and inventory updates are polled
+const bootstrapPollInterval = 5 * time.Second
+
+// runBootstrap creates an SCM project and an inventory source reading an
+// inventory from it, and syncs the source
+func runBootstrap(args []string) {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	project := flags.String("project", "", "name of the project to create or update (required)")
+	scmURL := flags.String("scm-url", "", "Git URL of the project (required)")
+	scmBranch := flags.String("scm-branch", "", "branch, tag or commit of the project, empty for the default branch")
+	scmCredential := flags.String("scm-credential", "", "name of the Source Control credential of the project")
+	inventory := flags.String("inventory", "", "name of the inventory of the source, created if missing (required)")
+	source := flags.String("source", "", "name of the inventory source (default: the project name)")
+	sourcePath := flags.String("source-path", "", "inventory file or directory in the project, empty for the project root")
+	description := flags.String("description", "Created by awx-inventory bootstrap", "description of created objects")
+	sync := flags.Bool("sync", true, "sync the inventory source and wait for it to finish")
+	timeout := flags.Duration("timeout", 10*time.Minute, "how long to wait for the project update and the inventory sync")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s bootstrap [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Creates or updates a Git project and an inventory source reading an inventory\n")
+		fmt.Fprintf(flags.Output(), "from it in ORGANIZATION, then syncs the source. AWX settings are read from the\n")
+		fmt.Fprintf(flags.Output(), "same environment as the controller.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *project == "" || *scmURL == "" || *inventory == "" {
+		flags.Usage()
+		exit(exitcode.Config, "-project, -scm-url and -inventory are required")
+	}
+	if *source == "" {
+		*source = *project
+	}
+
+	requireAWXAuth()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	client := newCommandAWXClient(ctx)
+	orgName := getEnv("ORGANIZATION", "Default")
+	orgID, err := client.GetOrganizationID(ctx, orgName)
+	if errors.Is(err, awx.ErrOrganizationNotFound) && getEnv("CREATE_ORGANIZATION", "false") == "true" {
+		log.Printf("Creating organization '%s'", orgName)
+		orgID, err = client.CreateOrganization(ctx, orgName)
+	}
+	if err != nil {
+		exit(exitcode.For(err), "Failed to get organization '%s': %v", orgName, err)
+	}
+
+	credentialID := 0
+	if *scmCredential != "" {
+		credentialID, err = client.GetCredentialID(ctx, *scmCredential, orgID)
+		if err != nil {
+			exit(exitcode.For(err), "Failed to get credential '%s': %v", *scmCredential, err)
+		}
+		if credentialID == 0 {
+			exit(exitcode.Config, "Credential '%s' not found in organization '%s'", *scmCredential, orgName)
+		}
+	}
+
+	projectID, err := client.CreateOrUpdateProject(ctx, *project, *description, orgID, *scmURL, *scmBranch, credentialID)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to create project '%s': %v", *project, err)
+	}
+	log.Printf("Project '%s' has ID %d, updating it from %s", *project, projectID, *scmURL)
+
+	// The source path is only known to AWX once the project was checked out
+	updateID, err := client.UpdateProject(ctx, projectID)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to update project '%s': %v", *project, err)
+	}
+	if err := waitForUpdate(ctx, client.GetProjectUpdate, updateID); err != nil {
+		exit(exitcode.For(err), "Project update %d of '%s' failed: %v", updateID, *project, err)
+	}
+	log.Printf("Project '%s' updated", *project)
+
+	invID, err := client.CreateInventory(ctx, *inventory, *description, orgID)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to create inventory '%s': %v", *inventory, err)
+	}
+	sourceID, err := client.CreateOrUpdateInventorySource(ctx, invID, *source, *description, projectID, *sourcePath)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to create inventory source '%s': %v", *source, err)
+	}
+	log.Printf("Inventory source '%s' of inventory '%s' has ID %d", *source, *inventory, sourceID)
+
+	if !*sync {
+		return
+	}
+	updateID, err = client.UpdateInventorySource(ctx, sourceID)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to sync inventory source '%s': %v", *source, err)
+	}
+	if err := waitForUpdate(ctx, client.GetInventoryUpdate, updateID); err != nil {
+		exit(exitcode.For(err), "Inventory update %d of '%s' failed: %v", updateID, *source, err)
+	}
+	log.Printf("Bootstrap complete: inventory '%s' synced from project '%s'", *inventory, *project)
+}
+
+// waitForUpdate polls a project or inventory update until it finishes,
+// failing unless it was successful
+func waitForUpdate(ctx context.Context, get func(context.Context, int) (*awx.Job, error), updateID int) error {
+	ticker := time.NewTicker(bootstrapPollInterval)
+	defer ticker.Stop()
+
+	for {
+		update, err := get(ctx, updateID)
+		if err != nil {
+			return err
+		}
+		if update.IsFinished() {
+			if update.Status != "successful" {
+				return fmt.Errorf("finished with status '%s'", update.Status)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not finished: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/controller"
+)
+
+// configPollInterval is how often CONFIG_FILE is checked for changes. Polling
+// also catches the symlink swap Kubernetes uses to update mounted ConfigMaps.
+const configPollInterval = 10 * time.Second
+
+// fileConfig holds the values read from CONFIG_FILE, which take precedence
+// over the environment
+var fileConfig struct {
+	sync.RWMutex
+	values map[string]string
+}
+
+// loadConfigFile reads KEY=VALUE lines, ignoring blank lines and # comments
+func loadConfigFile(path string) (map[string]string, [sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("invalid config file line %d: expected KEY=VALUE", line)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values, sha256.Sum256(data), nil
+}
+
+// setFileConfig replaces the values read from CONFIG_FILE
+func setFileConfig(values map[string]string) {
+	fileConfig.Lock()
+	defer fileConfig.Unlock()
+	fileConfig.values = values
+}
+
+// reloadableSettings reads the settings that can change without a restart
+func reloadableSettings() (controller.Settings, error) {
+	selector := getEnv("VM_LABEL_SELECTOR", "")
+	if _, err := labels.Parse(selector); err != nil {
+		return controller.Settings{}, fmt.Errorf("invalid VM_LABEL_SELECTOR: %w", err)
+	}
+	return controller.Settings{
+		VMLabelSelector: selector,
+		GroupByClass:    getEnv("GROUP_BY_CLASS", "false") == "true",
+		GroupByNode:     getEnv("GROUP_BY_NODE", "false") == "true",
+		GroupByZone:     getEnv("GROUP_BY_ZONE", "false") == "true",
+		GroupLabels:     splitList(getEnv("GROUP_LABELS", "")),
+	}, nil
+}
+
+// watchConfigFile reloads the controller settings on SIGHUP or when the
+// content of the config file changes. Other settings still need a restart.
+func watchConfigFile(path string, hash [sha256.Size]byte, ctrl *controller.Controller) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		forced := false
+		select {
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading %s", path)
+			forced = true
+		case <-ticker.C:
+		}
+
+		values, newHash, err := loadConfigFile(path)
+		if err != nil {
+			log.Printf("ERROR: failed to reload configuration: %v", err)
+			continue
+		}
+		if newHash == hash && !forced {
+			continue
+		}
+		hash = newHash
+
+		setFileConfig(values)
+		settings, err := reloadableSettings()
+		if err != nil {
+			log.Printf("ERROR: failed to reload configuration, keeping the previous settings: %v", err)
+			continue
+		}
+		ctrl.Reload(settings)
+	}
+}
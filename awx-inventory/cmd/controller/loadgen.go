@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/controller"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/exitcode"
+)
+
+// runLoadgen feeds synthetic VM events into the sync pipeline and reports throughput
+func runLoadgen(args []string) {
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	vms := flags.Int("vms", 1000, "number of synthetic VMs")
+	namespaces := flags.Int("namespaces", 5, "number of namespaces the VMs are spread across")
+	namespacePrefix := flags.String("namespace-prefix", "loadgen-", "prefix of synthetic namespace names")
+	mutations := flags.Int("mutations", 1, "MODIFIED events per VM after it was added")
+	concurrency := flags.Int("concurrency", 1, "number of events processed in parallel")
+	cleanup := flags.Bool("cleanup", true, "send DELETED events for every VM at the end")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s loadgen [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Feeds synthetic VirtualMachine events directly into the controller pipeline\n")
+		fmt.Fprintf(flags.Output(), "and reports sync throughput and latency. No cluster is required; AWX\n")
+		fmt.Fprintf(flags.Output(), "settings are read from the same environment as the controller.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *vms <= 0 || *namespaces <= 0 || *concurrency <= 0 {
+		exit(exitcode.Config, "-vms, -namespaces and -concurrency must be positive")
+	}
+
+	requireAWXAuth()
+	awxHeaders, err := parseHeaders(getEnv("AWX_EXTRA_HEADERS", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid AWX_EXTRA_HEADERS: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctrl, err := controller.New(controller.Config{
+		AWXURL:               getEnv("AWX_URL", "https://awx.example.com"),
+		AWXToken:             getEnv("AWX_TOKEN", ""),
+		AWXTokenFile:         getEnv("AWX_TOKEN_FILE", ""),
+		AWXUsername:          getEnv("AWX_USERNAME", ""),
+		AWXPassword:          getEnv("AWX_PASSWORD", ""),
+		AWXOAuthClientID:     getEnv("AWX_OAUTH_CLIENT_ID", ""),
+		AWXOAuthClientSecret: getEnv("AWX_OAUTH_CLIENT_SECRET", ""),
+		AWXTLS:               awxTLSOptions(),
+		AWXHeaders:           awxHeaders,
+		InventoryPrefix:      getEnv("INVENTORY_PREFIX", ""),
+		Organization:         getEnv("ORGANIZATION", "Default"),
+		NoKubernetes:         true,
+	})
+	if err != nil {
+		exit(exitcode.For(err), "Failed to create controller: %v", err)
+	}
+	if err := ctrl.Initialize(ctx); err != nil {
+		exit(exitcode.For(err), "Failed to initialize controller: %v", err)
+	}
+
+	objects := make([]*unstructured.Unstructured, *vms)
+	for i := range objects {
+		objects[i] = syntheticVM(fmt.Sprintf("%s%d", *namespacePrefix, i%*namespaces), fmt.Sprintf("loadgen-vm-%d", i), i, 0)
+	}
+
+	log.Printf("Generating load: %d VMs in %d namespaces, %d mutations each, concurrency %d", *vms, *namespaces, *mutations, *concurrency)
+
+	runPhase(ctx, ctrl, "ADDED", watch.Added, objects, *concurrency)
+	for m := 1; m <= *mutations; m++ {
+		for i, obj := range objects {
+			objects[i] = syntheticVM(obj.GetNamespace(), obj.GetName(), i, m)
+		}
+		runPhase(ctx, ctrl, fmt.Sprintf("MODIFIED #%d", m), watch.Modified, objects, *concurrency)
+	}
+	if *cleanup {
+		runPhase(ctx, ctrl, "DELETED", watch.Deleted, objects, *concurrency)
+	}
+}
+
+// runPhase sends one event per object and prints latency statistics
+func runPhase(ctx context.Context, ctrl *controller.Controller, name string, eventType watch.EventType, objects []*unstructured.Unstructured, concurrency int) {
+	latencies := make([]time.Duration, len(objects))
+	var errCount int
+	var mu sync.Mutex
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				t := time.Now()
+				err := ctrl.HandleEvent(ctx, watch.Event{Type: eventType, Object: objects[i]}, objects[i])
+				latencies[i] = time.Since(t)
+				if err != nil {
+					mu.Lock()
+					errCount++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range objects {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("%-12s events=%d errors=%d elapsed=%v throughput=%.1f/s p50=%v p90=%v p99=%v max=%v\n",
+		name, len(objects), errCount, elapsed.Round(time.Millisecond),
+		float64(len(objects))/elapsed.Seconds(),
+		percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.99),
+		latencies[len(latencies)-1].Round(time.Microsecond))
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i].Round(time.Microsecond)
+}
+
+// syntheticVM builds a VirtualMachine object; generation changes its labels
+func syntheticVM(namespace, name string, index, generation int) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "virtualization.deckhouse.io/v1alpha2",
+			"kind":       "VirtualMachine",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+				"labels": map[string]interface{}{
+					"app":        "loadgen",
+					"generation": fmt.Sprintf("%d", generation),
+				},
+			},
+			"status": map[string]interface{}{
+				"ipAddress": fmt.Sprintf("10.%d.%d.%d", (index>>16)&0xff, (index>>8)&0xff, index&0xff),
+			},
+		},
+	}
+}
@@ -1,39 +1,818 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/audit"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
 	"github.com/fl64/ansible-demo/awx-inventory/internal/controller"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/exitcode"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/faults"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/notify"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/rundeck"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/runner"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/schedule"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/server"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/snapshot"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/synthetic"
 )
 
 func main() {
-	// Get configuration from environment
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "loadgen":
+			runLoadgen(os.Args[2:])
+			return
+		case "bootstrap":
+			runBootstrap(os.Args[2:])
+			return
+		}
+	}
+
+	runController()
+}
+
+// runController runs the inventory controller until it is stopped
+func runController() {
+	// Get configuration from environment, overlaid with CONFIG_FILE
+	configFile := os.Getenv("CONFIG_FILE")
+	var configHash [sha256.Size]byte
+	if configFile != "" {
+		values, hash, err := loadConfigFile(configFile)
+		if err != nil {
+			exit(exitcode.Config, "Invalid CONFIG_FILE: %v", err)
+		}
+		setFileConfig(values)
+		configHash = hash
+	}
+	settings, err := reloadableSettings()
+	if err != nil {
+		exit(exitcode.Config, "Invalid configuration: %v", err)
+	}
+
 	awxURL := getEnv("AWX_URL", "https://awx.example.com")
 	awxToken := getEnv("AWX_TOKEN", "")
 	inventoryPrefix := getEnv("INVENTORY_PREFIX", "")
+	mergeStrategy := getEnv("HOSTVARS_MERGE_STRATEGY", controller.MergeReplace)
+	switch mergeStrategy {
+	case controller.MergeReplace, controller.MergeShallow, controller.MergeDeep, controller.MergeManagedKeys:
+	default:
+		exit(exitcode.Config, "Invalid HOSTVARS_MERGE_STRATEGY '%s'", mergeStrategy)
+	}
+	namespacePolicy := getEnv("NAMESPACE_DELETION_POLICY", controller.NamespaceOrphan)
+	switch namespacePolicy {
+	case controller.NamespaceOrphan, controller.NamespaceDelete, controller.NamespaceRename:
+	default:
+		exit(exitcode.Config, "Invalid NAMESPACE_DELETION_POLICY '%s'", namespacePolicy)
+	}
+	winRMVars, err := newWinRMVars()
+	if err != nil {
+		exit(exitcode.Config, "Invalid configuration: %v", err)
+	}
+	groupVars, err := loadGroupVars(getEnv("GROUP_VARS_FILE", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid GROUP_VARS_FILE: %v", err)
+	}
+	groupParents, err := parseGroupParents(getEnv("GROUP_PARENTS", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid GROUP_PARENTS: %v", err)
+	}
+	smartInventories, err := parseSmartInventories(getEnv("SMART_INVENTORIES", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid SMART_INVENTORIES: %v", err)
+	}
+	readinessPort, readinessTimeout, readinessRetries, err := readinessSettings()
+	if err != nil {
+		exit(exitcode.Config, "Invalid configuration: %v", err)
+	}
+	singleInventory := ""
+	switch mode := getEnv("INVENTORY_MODE", "namespace"); mode {
+	case "namespace":
+	case "single":
+		singleInventory = getEnv("INVENTORY_NAME", "kubernetes")
+	default:
+		exit(exitcode.Config, "Invalid INVENTORY_MODE '%s', expected namespace or single", mode)
+	}
+	nameTemplate, err := newTemplate("inventory_name", getEnv("INVENTORY_NAME_TEMPLATE", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid INVENTORY_NAME_TEMPLATE: %v", err)
+	}
+	hostnameTemplate, err := newTemplate("hostname", getEnv("HOSTNAME_TEMPLATE", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid HOSTNAME_TEMPLATE: %v", err)
+	}
 	orgName := getEnv("ORGANIZATION", "Default")
-	namespace := getEnv("NAMESPACE", "")
+	namespaces := splitList(getEnv("NAMESPACE", ""))
+	ansibleJobs := getEnv("ANSIBLE_JOBS_ENABLED", "false") == "true"
+	ansibleJobsInterval, err := time.ParseDuration(getEnv("ANSIBLE_JOBS_SYNC_INTERVAL", "15s"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid ANSIBLE_JOBS_SYNC_INTERVAL: %v", err)
+	}
+
+	awxHeaders, err := parseHeaders(getEnv("AWX_EXTRA_HEADERS", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid AWX_EXTRA_HEADERS: %v", err)
+	}
+
+	awxRateLimit, err := strconv.ParseFloat(getEnv("AWX_RATE_LIMIT", "0"), 64)
+	if err != nil || awxRateLimit < 0 {
+		exit(exitcode.Config, "Invalid AWX_RATE_LIMIT: must be a non-negative number of requests per second")
+	}
+	awxRateBurst, err := strconv.Atoi(getEnv("AWX_RATE_BURST", "10"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid AWX_RATE_BURST: %v", err)
+	}
+	awxWaitTimeout, err := parseSeconds(getEnv("AWX_WAIT_TIMEOUT", "5m"))
+	if err != nil || awxWaitTimeout < 0 {
+		exit(exitcode.Config, "Invalid AWX_WAIT_TIMEOUT: must be a non-negative duration or number of seconds")
+	}
+	awxWaitInterval, err := parseSeconds(getEnv("AWX_WAIT_INTERVAL", "5s"))
+	if err != nil || awxWaitInterval <= 0 {
+		exit(exitcode.Config, "Invalid AWX_WAIT_INTERVAL: must be a positive duration or number of seconds")
+	}
+	awxResponseCache, err := strconv.Atoi(getEnv("AWX_RESPONSE_CACHE", "256"))
+	if err != nil || awxResponseCache < 0 {
+		exit(exitcode.Config, "Invalid AWX_RESPONSE_CACHE: must be a non-negative number of responses")
+	}
 
-	if awxToken == "" {
-		log.Fatal("AWX_TOKEN environment variable is required")
+	useAWX, backends, err := newBackends()
+	if err != nil {
+		exit(exitcode.Config, "Invalid backend configuration: %v", err)
+	}
+	tokenSecret := getEnv("AWX_TOKEN_SECRET_NAME", "")
+	tokenNamespace := getEnv("AWX_TOKEN_SECRET_NAMESPACE", getEnv("POD_NAMESPACE", ""))
+	if tokenSecret != "" && tokenNamespace == "" {
+		exit(exitcode.Config, "POD_NAMESPACE or AWX_TOKEN_SECRET_NAMESPACE environment variable is required with AWX_TOKEN_SECRET_NAME")
+	}
+
+	// AWXInventorySyncs can bring their own token
+	inventorySyncs := getEnv("INVENTORY_SYNCS", "false") == "true"
+	if useAWX && !inventorySyncs {
+		requireAWXAuth()
+	}
+
+	snapshotStore, snapshotInterval, err := newSnapshotStore()
+	if err != nil {
+		exit(exitcode.Config, "Invalid snapshot configuration: %v", err)
+	}
+
+	var auditLog *audit.Log
+	if path := getEnv("AUDIT_LOG", ""); path != "" {
+		auditLog, err = audit.Open(path)
+		if err != nil {
+			exit(exitcode.Config, "Invalid AUDIT_LOG: %v", err)
+		}
+	}
+
+	var notifier *notify.Notifier
+	if webhookURL := getEnv("NOTIFY_WEBHOOK_URL", ""); webhookURL != "" {
+		notifier, err = notify.New(notify.Config{
+			URL:     webhookURL,
+			Format:  getEnv("NOTIFY_FORMAT", notify.FormatSlack),
+			Events:  splitList(getEnv("NOTIFY_EVENTS", "")),
+			Cluster: getEnv("CLUSTER_NAME", ""),
+		})
+		if err != nil {
+			exit(exitcode.Config, "Invalid notification configuration: %v", err)
+		}
+	}
+	notifyThreshold, err := strconv.Atoi(getEnv("NOTIFY_FAILURE_THRESHOLD", "3"))
+	if err != nil || notifyThreshold <= 0 {
+		exit(exitcode.Config, "Invalid NOTIFY_FAILURE_THRESHOLD: must be a positive number")
+	}
+
+	faultCfg, err := faults.FromEnv()
+	if err != nil {
+		exit(exitcode.Config, "Invalid fault injection configuration: %v", err)
+	}
+
+	source, err := newSource()
+	if err != nil {
+		exit(exitcode.Config, "Invalid source configuration: %v", err)
+	}
+
+	cacheSize, err := strconv.Atoi(getEnv("CACHE_SIZE", "1000"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid CACHE_SIZE: %v", err)
+	}
+
+	workerCount, err := strconv.Atoi(getEnv("WORKERS", "4"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid WORKERS: %v", err)
+	}
+	coalesceWindow, err := time.ParseDuration(getEnv("EVENT_COALESCE_WINDOW", "0s"))
+	if err != nil || coalesceWindow < 0 {
+		exit(exitcode.Config, "Invalid EVENT_COALESCE_WINDOW: must be a non-negative duration")
+	}
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil || shutdownTimeout <= 0 {
+		exit(exitcode.Config, "Invalid SHUTDOWN_TIMEOUT: must be a positive duration")
+	}
+
+	leakThreshold, err := strconv.Atoi(getEnv("GOROUTINE_LEAK_THRESHOLD", "500"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid GOROUTINE_LEAK_THRESHOLD: %v", err)
+	}
+
+	hostTTL, err := time.ParseDuration(getEnv("HOST_TTL", "0s"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid HOST_TTL: %v", err)
+	}
+
+	pruneInterval, err := time.ParseDuration(getEnv("PRUNE_INTERVAL", "0s"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid PRUNE_INTERVAL: %v", err)
+	}
+
+	blackoutWindows, err := schedule.ParseWindows(getEnv("BLACKOUT_WINDOWS", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid BLACKOUT_WINDOWS: %v", err)
+	}
+
+	var resources []kubernetes.VMResource
+	if source == nil {
+		if resources, err = vmResources(); err != nil {
+			exit(exitcode.Config, "Invalid source configuration: %v", err)
+		}
+	}
+
+	inventoryMap := getEnv("INVENTORY_MAP_CONFIGMAP", "")
+	inventoryMapNamespace := getEnv("POD_NAMESPACE", "")
+	if inventoryMap != "" && inventoryMapNamespace == "" {
+		exit(exitcode.Config, "POD_NAMESPACE environment variable is required with INVENTORY_MAP_CONFIGMAP")
+	}
+	inventoryMapInterval, err := time.ParseDuration(getEnv("INVENTORY_MAP_INTERVAL", "1m"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid INVENTORY_MAP_INTERVAL: %v", err)
+	}
+
+	queueCheckpoint := getEnv("QUEUE_CHECKPOINT_CONFIGMAP", "")
+	if queueCheckpoint != "" && inventoryMapNamespace == "" {
+		exit(exitcode.Config, "POD_NAMESPACE environment variable is required with QUEUE_CHECKPOINT_CONFIGMAP")
+	}
+
+	deprovisionTimeout, err := time.ParseDuration(getEnv("DEPROVISION_TIMEOUT", "10m"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid DEPROVISION_TIMEOUT: %v", err)
+	}
+
+	jobRetries, err := strconv.Atoi(getEnv("JOB_RETRIES", "0"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid JOB_RETRIES: %v", err)
+	}
+	jobRetryBackoff, err := time.ParseDuration(getEnv("JOB_RETRY_BACKOFF", "1m"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid JOB_RETRY_BACKOFF: %v", err)
+	}
+	pingHosts := getEnv("PING_HOSTS", "false") == "true"
+	if pingHosts && getEnv("PING_CREDENTIAL", "") == "" && getEnv("SSH_CREDENTIALS", "false") != "true" {
+		exit(exitcode.Config, "PING_CREDENTIAL or SSH_CREDENTIALS=true is required with PING_HOSTS")
+	}
+
+	cfg := controller.Config{
+		AWXURL:                 awxURL,
+		AWXToken:               awxToken,
+		AWXTokenFile:           getEnv("AWX_TOKEN_FILE", ""),
+		AWXTokenSecret:         tokenSecret,
+		AWXTokenSecretKey:      getEnv("AWX_TOKEN_SECRET_KEY", "token"),
+		AWXTokenNamespace:      tokenNamespace,
+		AWXUsername:            getEnv("AWX_USERNAME", ""),
+		AWXPassword:            getEnv("AWX_PASSWORD", ""),
+		AWXOAuthClientID:       getEnv("AWX_OAUTH_CLIENT_ID", ""),
+		AWXOAuthClientSecret:   getEnv("AWX_OAUTH_CLIENT_SECRET", ""),
+		AWXTLS:                 awxTLSOptions(),
+		AWXHeaders:             awxHeaders,
+		AWXRateLimit:           awxRateLimit,
+		AWXRateBurst:           awxRateBurst,
+		AWXWaitTimeout:         awxWaitTimeout,
+		AWXWaitInterval:        awxWaitInterval,
+		SkipAWXWait:            awxWaitTimeout == 0,
+		PermissionCheck:        getEnv("AWX_PERMISSION_CHECK", "true") == "true",
+		AWXResponseCache:       awxResponseCache,
+		InventoryPrefix:        inventoryPrefix,
+		Organization:           orgName,
+		CreateOrganization:     getEnv("CREATE_ORGANIZATION", "false") == "true",
+		InventoryNameTemplate:  nameTemplate,
+		SingleInventory:        singleInventory,
+		ClusterName:            getEnv("CLUSTER_NAME", ""),
+		HostnameTemplate:       hostnameTemplate,
+		HostVarsPrefix:         getEnv("HOSTVARS_ANNOTATION_PREFIX", ""),
+		HostVarsInclude:        splitList(getEnv("HOSTVARS_INCLUDE", "")),
+		HostVarsExclude:        splitList(getEnv("HOSTVARS_EXCLUDE", "")),
+		HostVarsRedact:         hostVarsRedact(),
+		MergeStrategy:          mergeStrategy,
+		WinRMVars:              winRMVars,
+		ReadinessPort:          readinessPort,
+		ReadinessTimeout:       readinessTimeout,
+		ReadinessRetries:       readinessRetries,
+		SyncPhases:             splitList(getEnv("SYNC_PHASES", "")),
+		DisableStopped:         getEnv("STOPPED_HOSTS", "remove") == "disable",
+		PruneInterval:          pruneInterval,
+		NamespacePolicy:        namespacePolicy,
+		AnnotateHostID:         getEnv("HOST_ID_ANNOTATION", "false") == "true",
+		Finalizer:              getEnv("FINALIZER", "false") == "true",
+		Events:                 getEnv("EVENTS", "true") == "true",
+		StatusAnnotation:       getEnv("STATUS_ANNOTATION", "false") == "true",
+		ProvisionJobTemplate:   getEnv("PROVISION_JOB_TEMPLATE", ""),
+		DeprovisionJobTemplate: getEnv("DEPROVISION_JOB_TEMPLATE", ""),
+		DeprovisionTimeout:     deprovisionTimeout,
+		JobRetries:             jobRetries,
+		JobRetryBackoff:        jobRetryBackoff,
+		PingHosts:              pingHosts,
+		PingCredential:         getEnv("PING_CREDENTIAL", ""),
+		Namespaces:             namespaces,
+		VMLabelSelector:        settings.VMLabelSelector,
+		VMResources:            resources,
+		AnsibleJobs:            ansibleJobs,
+		AnsibleJobsInterval:    ansibleJobsInterval,
+		SnapshotStore:          snapshotStore,
+		SnapshotInterval:       snapshotInterval,
+		ShadowAWXURL:           getEnv("SHADOW_AWX_URL", ""),
+		ShadowAWXToken:         getEnv("SHADOW_AWX_TOKEN", ""),
+		Faults:                 faultCfg,
+		NoKubernetes:           source != nil,
+		Source:                 source,
+		CacheSize:              cacheSize,
+		Workers:                workerCount,
+		CoalesceWindow:         coalesceWindow,
+		ShutdownTimeout:        shutdownTimeout,
+		GoroutineLeakThreshold: leakThreshold,
+		DisableAWX:             !useAWX,
+		Backends:               backends,
+		GroupByClass:           settings.GroupByClass,
+		GroupByNode:            settings.GroupByNode,
+		GroupByZone:            settings.GroupByZone,
+		GroupLabels:            settings.GroupLabels,
+		CloudInitVars:          getEnv("CLOUDINIT_VARS", "false") == "true",
+		SSHCredentials:         getEnv("SSH_CREDENTIALS", "false") == "true",
+		CredentialSecrets:      getEnv("CREDENTIAL_SECRETS", "false") == "true",
+		CredentialTemplates:    getEnv("CREDENTIAL_JOB_TEMPLATES", "false") == "true",
+		InventoryVars:          getEnv("INVENTORY_VARS", "false") == "true",
+		GroupVars:              groupVars,
+		GroupVarsConfigMaps:    getEnv("GROUP_VARS_CONFIGMAPS", "false") == "true",
+		GroupParents:           groupParents,
+		SmartInventories:       smartInventories,
+		ConstructedInventory:   getEnv("CONSTRUCTED_INVENTORY", ""),
+		HostTTL:                hostTTL,
+		BlackoutWindows:        blackoutWindows,
+		InventoryMapConfigMap:  inventoryMap,
+		InventoryMapNamespace:  inventoryMapNamespace,
+		InventoryMapInterval:   inventoryMapInterval,
+		CheckpointConfigMap:    queueCheckpoint,
+		CheckpointNamespace:    inventoryMapNamespace,
+		StartupGC:              getEnv("STARTUP_GC", "false") == "true",
+		StartupBulkCreate:      getEnv("STARTUP_BULK_CREATE", "false") == "true",
+		AuditLog:               auditLog,
+		Notifier:               notifier,
+		NotifyFailureThreshold: notifyThreshold,
+	}
+
+	if inventorySyncs {
+		runOperator(cfg)
+		return
 	}
 
 	// Create controller
-	ctrl, err := controller.New(awxURL, awxToken, inventoryPrefix, orgName, namespace)
+	ctrl, err := controller.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create controller: %v", err)
+		exit(exitcode.For(err), "Failed to create controller: %v", err)
+	}
+
+	serveHTTP(ctrl.HealthHandler(), ctrl.ReadyHandler(), ctrl.StartupHandler(), ctrl.StatusHandler(), ctrl.AdminHandler())
+
+	if configFile != "" {
+		go watchConfigFile(configFile, configHash, ctrl)
 	}
 
 	// Start controller
-	if err := ctrl.Start(); err != nil {
-		log.Fatalf("Controller error: %v", err)
+	if err := ctrl.Start(); exitcode.For(err) != exitcode.OK {
+		exit(exitcode.For(err), "Controller error: %v", err)
+	}
+	log.Printf("Controller stopped")
+}
+
+// serveHTTP starts the metrics, health and status listeners, the status
+// listener only if status is not nil, and the admin listener if admin is not
+// nil and ADMIN_ADDR is set
+func serveHTTP(health, ready, startup, status, admin http.Handler) {
+	opts := server.Options{
+		TLSCertFile:   getEnv("HTTP_TLS_CERT_FILE", ""),
+		TLSKeyFile:    getEnv("HTTP_TLS_KEY_FILE", ""),
+		AuthToken:     getEnv("HTTP_AUTH_TOKEN", ""),
+		AuthTokenFile: getEnv("HTTP_AUTH_TOKEN_FILE", ""),
+	}
+	listeners := server.NewGroup(opts)
+
+	metricsSrv, err := listeners.Listener("metrics", getEnv("METRICS_ADDR", ":8080"))
+	if err != nil {
+		exit(exitcode.Config, "Failed to create metrics listener: %v", err)
+	}
+	if metricsSrv != nil {
+		metricsSrv.Handle("/metrics", promhttp.Handler())
+		metricsSrv.HandleDebug()
+	}
+
+	healthSrv, err := listeners.Listener("health", getEnv("HEALTH_ADDR", ":8081"))
+	if err != nil {
+		exit(exitcode.Config, "Failed to create health listener: %v", err)
+	}
+	if healthSrv != nil {
+		healthSrv.HandlePublic("/healthz", health)
+		healthSrv.HandlePublic("/readyz", ready)
+		if startup != nil {
+			healthSrv.HandlePublic("/startupz", startup)
+		}
+	}
+
+	if status != nil {
+		statusSrv, err := listeners.Listener("status", getEnv("STATUS_ADDR", ":8082"))
+		if err != nil {
+			exit(exitcode.Config, "Failed to create status listener: %v", err)
+		}
+		if statusSrv != nil {
+			statusSrv.Handle("/status", status)
+		}
+	}
+
+	if admin != nil {
+		adminSrv, err := listeners.Listener("admin", getEnv("ADMIN_ADDR", server.Disabled))
+		if err != nil {
+			exit(exitcode.Config, "Failed to create admin listener: %v", err)
+		}
+		if adminSrv != nil {
+			// The admin API changes state, it is never served without a token
+			if opts.AuthToken == "" && opts.AuthTokenFile == "" {
+				exit(exitcode.Config, "Invalid ADMIN_ADDR: the admin API requires HTTP_AUTH_TOKEN or HTTP_AUTH_TOKEN_FILE")
+			}
+			adminSrv.Handle("/admin/", admin)
+		}
+	}
+
+	go func() {
+		if err := listeners.ListenAndServe(); err != nil {
+			exit(exitcode.Runtime, "HTTP server error: %v", err)
+		}
+	}()
+}
+
+// newBackends parses BACKEND, a comma-separated list of awx, runner and rundeck
+// ("both" is kept as an alias of "awx,runner")
+func newBackends() (useAWX bool, backends []controller.Backend, err error) {
+	value := getEnv("BACKEND", "awx")
+	if value == "both" {
+		value = "awx,runner"
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "awx":
+			useAWX = true
+		case "runner":
+			localRunner, err := runner.New(runner.Config{
+				DataDir:    getEnv("RUNNER_DATA_DIR", "/tmp/awx-inventory-runner"),
+				ProjectDir: getEnv("RUNNER_PROJECT_DIR", ""),
+				Playbook:   getEnv("RUNNER_PLAYBOOK", ""),
+				Command:    getEnv("RUNNER_COMMAND", "ansible-runner"),
+			})
+			if err != nil {
+				return false, nil, fmt.Errorf("runner: %w", err)
+			}
+			backends = append(backends, localRunner)
+		case "rundeck":
+			sourceIndex, err := strconv.Atoi(getEnv("RUNDECK_SOURCE_INDEX", "1"))
+			if err != nil {
+				return false, nil, fmt.Errorf("invalid RUNDECK_SOURCE_INDEX: %w", err)
+			}
+			interval, err := time.ParseDuration(getEnv("RUNDECK_SYNC_INTERVAL", "10s"))
+			if err != nil {
+				return false, nil, fmt.Errorf("invalid RUNDECK_SYNC_INTERVAL: %w", err)
+			}
+			rd, err := rundeck.New(rundeck.Config{
+				URL:          getEnv("RUNDECK_URL", ""),
+				Token:        getEnv("RUNDECK_TOKEN", ""),
+				Project:      getEnv("RUNDECK_PROJECT", ""),
+				SourceIndex:  sourceIndex,
+				SyncInterval: interval,
+			})
+			if err != nil {
+				return false, nil, fmt.Errorf("rundeck: %w", err)
+			}
+			backends = append(backends, rd)
+		default:
+			return false, nil, fmt.Errorf("unknown backend '%s'", name)
+		}
+	}
+
+	return useAWX, backends, nil
+}
+
+// newSource builds the VM source selected by SOURCE, returning nil for Kubernetes sources
+func newSource() (controller.VMSource, error) {
+	switch getEnv("SOURCE", "kubernetes") {
+	case "synthetic":
+		count, err := strconv.Atoi(getEnv("SYNTHETIC_VM_COUNT", "10"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SYNTHETIC_VM_COUNT: %w", err)
+		}
+		churn, err := time.ParseDuration(getEnv("SYNTHETIC_CHURN_INTERVAL", "0s"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SYNTHETIC_CHURN_INTERVAL: %w", err)
+		}
+		labels, err := synthetic.ParseLabelTemplates(getEnv("SYNTHETIC_LABELS", "app=demo-{{ mod .Index 3 }}"))
+		if err != nil {
+			return nil, err
+		}
+		return synthetic.NewSource(synthetic.Config{
+			Count:          count,
+			Namespaces:     splitList(getEnv("SYNTHETIC_NAMESPACES", "demo")),
+			NameTemplate:   getEnv("SYNTHETIC_NAME_TEMPLATE", ""),
+			IPTemplate:     getEnv("SYNTHETIC_IP_TEMPLATE", ""),
+			LabelTemplates: labels,
+			ChurnInterval:  churn,
+		})
+	default:
+		// Kubernetes sources are built by vmResources
+		return nil, nil
+	}
+}
+
+// newSnapshotStore builds the snapshot store, returning nil if snapshots are disabled
+func newSnapshotStore() (*snapshot.Store, time.Duration, error) {
+	bucket := getEnv("SNAPSHOT_S3_BUCKET", "")
+	if bucket == "" {
+		return nil, 0, nil
+	}
+
+	interval, err := time.ParseDuration(getEnv("SNAPSHOT_INTERVAL", "1h"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid SNAPSHOT_INTERVAL: %w", err)
+	}
+
+	retain, err := strconv.Atoi(getEnv("SNAPSHOT_RETAIN", "24"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid SNAPSHOT_RETAIN: %w", err)
+	}
+
+	s3, err := snapshot.NewS3Client(snapshot.S3Config{
+		Endpoint:        getEnv("SNAPSHOT_S3_ENDPOINT", "https://s3.amazonaws.com"),
+		Region:          getEnv("SNAPSHOT_S3_REGION", "us-east-1"),
+		Bucket:          bucket,
+		AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snapshot.NewStore(s3, getEnv("SNAPSHOT_S3_PREFIX", "awx-inventory/"), retain), interval, nil
+}
+
+// newWinRMVars returns the connection variables of Windows VMs, nil if disabled
+func newWinRMVars() (map[string]interface{}, error) {
+	if getEnv("WINRM_ENABLED", "true") != "true" {
+		return nil, nil
+	}
+	port, err := strconv.Atoi(getEnv("WINRM_PORT", "5986"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WINRM_PORT: %w", err)
+	}
+	return map[string]interface{}{
+		"ansible_connection":                   "winrm",
+		"ansible_port":                         port,
+		"ansible_winrm_transport":              getEnv("WINRM_TRANSPORT", "ntlm"),
+		"ansible_winrm_server_cert_validation": getEnv("WINRM_CERT_VALIDATION", "validate"),
+	}, nil
+}
+
+// loadGroupVars reads a YAML file mapping group names to their variables,
+// nil if path is empty
+func loadGroupVars(path string) (map[string]map[string]interface{}, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
+	var groupVars map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &groupVars); err != nil {
+		return nil, err
+	}
+	return groupVars, nil
+}
+
+// parseGroupParents parses a comma-separated list of parent=pattern items,
+// a parent listed several times gets all its patterns
+func parseGroupParents(value string) (map[string][]string, error) {
+	var parents map[string][]string
+	for _, item := range splitList(value) {
+		parent, pattern, found := strings.Cut(item, "=")
+		parent, pattern = strings.TrimSpace(parent), strings.TrimSpace(pattern)
+		if !found || parent == "" || pattern == "" {
+			return nil, fmt.Errorf("expected parent=pattern, got '%s'", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if parents == nil {
+			parents = make(map[string][]string)
+		}
+		parents[parent] = append(parents[parent], pattern)
+	}
+	return parents, nil
+}
+
+// parseSmartInventories parses a semicolon-separated list of name=selector
+// items, the selectors being comma-separated label selectors themselves
+func parseSmartInventories(value string) (map[string]string, error) {
+	var inventories map[string]string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, selector, found := strings.Cut(item, "=")
+		name, selector = strings.TrimSpace(name), strings.TrimSpace(selector)
+		if !found || name == "" || selector == "" {
+			return nil, fmt.Errorf("expected name=selector, got '%s'", item)
+		}
+		if _, err := labels.Parse(selector); err != nil {
+			return nil, fmt.Errorf("invalid selector of '%s': %w", name, err)
+		}
+		if inventories == nil {
+			inventories = make(map[string]string)
+		}
+		inventories[name] = selector
+	}
+	return inventories, nil
+}
+
+// parseSeconds parses a duration like "90s" or "5m", or a plain number of
+// seconds as in earlier versions
+func parseSeconds(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// readinessSettings returns the readiness probe settings, port 0 if disabled
+func readinessSettings() (port int, timeout time.Duration, retries int, err error) {
+	if getEnv("READINESS_PROBE", "false") != "true" {
+		return 0, 0, 0, nil
+	}
+	if port, err = strconv.Atoi(getEnv("READINESS_PORT", "22")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid READINESS_PORT: %w", err)
+	}
+	if timeout, err = time.ParseDuration(getEnv("READINESS_TIMEOUT", "2s")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid READINESS_TIMEOUT: %w", err)
+	}
+	if retries, err = strconv.Atoi(getEnv("READINESS_RETRIES", "3")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid READINESS_RETRIES: %w", err)
+	}
+	return port, timeout, retries, nil
+}
+
+// defaultRedactPatterns match the keys of secret-like host variables
+const defaultRedactPatterns = "*password*,*passwd*,*secret*,*token*,*private_key*,*api_key*,*apikey*"
+
+// hostVarsRedact returns the HOSTVARS_REDACT patterns, none if set to "none"
+func hostVarsRedact() []string {
+	patterns := getEnv("HOSTVARS_REDACT", defaultRedactPatterns)
+	if patterns == "none" {
+		return nil
+	}
+	return splitList(patterns)
+}
+
+// newTemplate parses a name template, nil if text is empty
+func newTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// exit logs the message and terminates the process with code (see internal/exitcode)
+func exit(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(code)
+}
+
+// requireAWXAuth exits unless a token, token file or Secret, basic auth or OAuth2
+// application credentials are configured for AWX
+func requireAWXAuth() {
+	for _, key := range []string{"AWX_TOKEN", "AWX_TOKEN_FILE", "AWX_TOKEN_SECRET_NAME", "AWX_USERNAME", "AWX_OAUTH_CLIENT_ID"} {
+		if getEnv(key, "") != "" {
+			return
+		}
+	}
+	exit(exitcode.Config, "AWX_TOKEN, AWX_TOKEN_FILE, AWX_TOKEN_SECRET_NAME, AWX_USERNAME or AWX_OAUTH_CLIENT_ID environment variable is required")
+}
+
+// newCommandAWXClient builds the AWX client of the restore and bootstrap
+// commands from the same environment as the controller
+func newCommandAWXClient(ctx context.Context) *awx.Client {
+	client := awx.NewClient(getEnv("AWX_URL", "https://awx.example.com"), getEnv("AWX_TOKEN", ""))
+	if err := client.SetTLS(awxTLSOptions()); err != nil {
+		exit(exitcode.Config, "Invalid AWX TLS configuration: %v", err)
+	}
+	headers, err := parseHeaders(getEnv("AWX_EXTRA_HEADERS", ""))
+	if err != nil {
+		exit(exitcode.Config, "Invalid AWX_EXTRA_HEADERS: %v", err)
+	}
+	client.SetHeaders(headers)
+	switch {
+	case getEnv("AWX_OAUTH_CLIENT_ID", "") != "":
+		client.SetOAuth2(getEnv("AWX_OAUTH_CLIENT_ID", ""), getEnv("AWX_OAUTH_CLIENT_SECRET", ""))
+	case getEnv("AWX_USERNAME", "") != "":
+		client.SetBasicAuth(getEnv("AWX_USERNAME", ""), getEnv("AWX_PASSWORD", ""))
+	case getEnv("AWX_TOKEN_FILE", "") != "":
+		if err := client.SetTokenFile(getEnv("AWX_TOKEN_FILE", "")); err != nil {
+			exit(exitcode.Config, "Invalid AWX_TOKEN_FILE: %v", err)
+		}
+	}
+	if _, err := client.DetectPlatform(ctx); err != nil {
+		log.Printf("WARN: failed to detect the AWX platform, assuming classic AWX: %v", err)
+	}
+	return client
+}
+
+// awxTLSOptions reads the TLS settings for AWX connections
+func awxTLSOptions() awx.TLSOptions {
+	return awx.TLSOptions{
+		CACertFile:         getEnv("AWX_CA_CERT_FILE", ""),
+		CertFile:           getEnv("AWX_CLIENT_CERT_FILE", ""),
+		KeyFile:            getEnv("AWX_CLIENT_KEY_FILE", ""),
+		InsecureSkipVerify: getEnv("AWX_INSECURE_SKIP_VERIFY", "false") == "true",
+	}
+}
+
+// vmResources builds the resources of the Kubernetes sources listed in SOURCES,
+// which defaults to SOURCE
+func vmResources() ([]kubernetes.VMResource, error) {
+	var resources []kubernetes.VMResource
+	for _, name := range splitList(getEnv("SOURCES", getEnv("SOURCE", "kubernetes"))) {
+		resource, err := kubernetes.NewResource(name, getEnv)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// parseHeaders parses a comma-separated list of Name=value headers
+func parseHeaders(value string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, item := range splitList(value) {
+		name, headerValue, found := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("expected Name=value, got '%s'", item)
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
 }
 
 func getEnv(key, defaultValue string) string {
+	fileConfig.RLock()
+	value, exists := fileConfig.values[key]
+	fileConfig.RUnlock()
+	if exists && value != "" {
+		return value
+	}
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// splitList splits a comma-separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/controller"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/exitcode"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/operator"
+)
+
+// runOperator runs a controller per AWXInventorySync resource, each with
+// base overridden by the spec of the resource
+func runOperator(base controller.Config) {
+	interval, err := time.ParseDuration(getEnv("INVENTORY_SYNC_INTERVAL", "30s"))
+	if err != nil {
+		exit(exitcode.Config, "Invalid INVENTORY_SYNC_INTERVAL: %v", err)
+	}
+
+	client, err := kubernetes.NewClient()
+	if err != nil {
+		exit(exitcode.For(err), "Failed to create Kubernetes client: %v", err)
+	}
+
+	op := operator.New(operator.Config{
+		Kubernetes: client,
+		Base:       base,
+		Interval:   interval,
+	})
+	serveHTTP(op.HealthHandler(), op.ReadyHandler(), nil, nil, nil)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if err := op.Run(ctx); err != nil {
+		exit(exitcode.Runtime, "Operator error: %v", err)
+	}
+	log.Printf("Operator stopped")
+}
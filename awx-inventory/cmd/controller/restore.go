@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/exitcode"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/snapshot"
+)
+
+// runRestore re-creates AWX inventories from a snapshot
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	key := flags.String("snapshot", "", "snapshot key in S3 (default: latest)")
+	file := flags.String("file", "", "read the snapshot from a local file instead of S3")
+	list := flags.Bool("list", false, "list available snapshots and exit")
+	dryRun := flags.Bool("dry-run", false, "show what would be restored without changing AWX")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s restore [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Restores hosts, groups and variables from a snapshot.\n")
+		fmt.Fprintf(flags.Output(), "AWX and S3 settings are read from the same environment as the controller.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	snap, err := loadSnapshot(*file, *key, *list)
+	if err != nil {
+		exit(exitcode.For(err), "Failed to load snapshot: %v", err)
+	}
+	if snap == nil {
+		return
+	}
+
+	requireAWXAuth()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := newCommandAWXClient(ctx)
+
+	log.Printf("Restoring snapshot taken at %s (%d inventories)", snap.Timestamp.Format("2006-01-02 15:04:05 MST"), len(snap.Inventories))
+	stats, err := snapshot.Restore(ctx, client, snap, *dryRun)
+	if err != nil {
+		exit(exitcode.For(err), "Restore failed: %v", err)
+	}
+
+	log.Printf("Restore complete: %d inventories, %d hosts, %d groups", stats.Inventories, stats.Hosts, stats.Groups)
+}
+
+// loadSnapshot reads the requested snapshot from a file or S3.
+// It returns nil after printing the available snapshots if list is set.
+func loadSnapshot(file, key string, list bool) (*snapshot.Snapshot, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var snap snapshot.Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot file: %w", err)
+		}
+		return &snap, nil
+	}
+
+	store, _, err := newSnapshotStore()
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, fmt.Errorf("SNAPSHOT_S3_BUCKET environment variable is required without -file")
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if list {
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		return nil, nil
+	}
+
+	if key == "" {
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no snapshots found")
+		}
+		key = keys[len(keys)-1]
+	}
+
+	log.Printf("Loading snapshot '%s'", key)
+	return store.Load(key)
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionLaunch = "launch"
+)
+
+// Record is one change made in AWX
+type Record struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Object is the kind of AWX object, e.g. host or inventory
+	Object string `json:"object"`
+	ID     int    `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Inventory is the ID of the inventory of hosts and groups
+	Inventory int `json:"inventory,omitempty"`
+	// Related is the ID of the other object of an association, e.g. the
+	// group a host was added to
+	Related int `json:"related,omitempty"`
+	// Changes is the difference of the variables, by variable name
+	Changes map[string]Change `json:"changes,omitempty"`
+	// Fields holds other values written, e.g. enabled
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Error is set if AWX rejected the change
+	Error string `json:"error,omitempty"`
+}
+
+// Change is the value of a variable before and after a change. A missing
+// Before means the variable was added, a missing After that it was removed.
+type Change struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Log writes records as JSON lines. Every record is written with a single
+// write, so records from concurrent workers never interleave.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Open opens the audit log at path for appending, creating it if needed.
+// "-" writes to stdout.
+func Open(path string) (*Log, error) {
+	if path == "-" {
+		return New(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return New(f), nil
+}
+
+// New returns a log writing to w
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Write appends a record, setting its time if it is zero
+func (l *Log) Write(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Diff returns the variables that differ between before and after
+func Diff(before, after map[string]interface{}) map[string]Change {
+	before, after = normalize(before), normalize(after)
+
+	changes := make(map[string]Change)
+	for key, value := range before {
+		if newValue, exists := after[key]; !exists {
+			changes[key] = Change{Before: value}
+		} else if !reflect.DeepEqual(value, newValue) {
+			changes[key] = Change{Before: value, After: newValue}
+		}
+	}
+	for key, value := range after {
+		if _, exists := before[key]; !exists {
+			changes[key] = Change{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// ParseVariables decodes variables as stored by AWX, in YAML or JSON
+func ParseVariables(data string) (map[string]interface{}, error) {
+	var vars map[string]interface{}
+	if strings.TrimSpace(data) == "" {
+		return vars, nil
+	}
+	if err := yaml.Unmarshal([]byte(data), &vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// normalize converts vars to their JSON form, so values read back from AWX
+// compare equal to the values written, e.g. int and float64 numbers
+func normalize(vars map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return vars
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return vars
+	}
+	return normalized
+}
@@ -0,0 +1,144 @@
+package awx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// tokenExpiryMargin is how long before expiry an OAuth2 token is replaced
+const tokenExpiryMargin = time.Minute
+
+// SetTokenFile reads the token from path, e.g. a mounted Secret. The file is
+// reread when it changes and after AWX rejects the token, so a rotated token
+// is picked up without a restart.
+func (c *Client) SetTokenFile(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokenFile = path
+	return c.loadTokenFile(true)
+}
+
+// SetToken replaces the static token, e.g. with one read from a watched Secret
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// SetBasicAuth authenticates with a username and password instead of a token
+func (c *Client) SetBasicAuth(username, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.username = username
+	c.password = password
+}
+
+// SetOAuth2 requests tokens for an AWX OAuth2 application with the
+// client-credentials grant and requests a new one before it expires
+func (c *Client) SetOAuth2(clientID, clientSecret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.oauthClientID = clientID
+	c.oauthClientSecret = clientSecret
+	c.token = ""
+}
+
+// authorization returns the Authorization header for a request. With refresh
+// set, after AWX rejected the previous header, file and OAuth2 tokens are
+// renewed even if they look current.
+func (c *Client) authorization(ctx context.Context, refresh bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.oauthClientID != "":
+		if refresh || c.token == "" || time.Now().After(c.tokenExpiry) {
+			if err := c.requestOAuth2Token(ctx); err != nil {
+				return "", err
+			}
+		}
+	case c.username != "":
+		req := http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(c.username, c.password)
+		return req.Header.Get("Authorization"), nil
+	case c.tokenFile != "":
+		// Keep using the previous token if the file is briefly missing during a Secret update
+		if err := c.loadTokenFile(refresh); err != nil {
+			log.Printf("WARN: %v", err)
+		}
+	}
+	return "Bearer " + c.token, nil
+}
+
+// loadTokenFile rereads the token file if it changed since it was last read,
+// or unconditionally if force is set. c.mu must be held.
+func (c *Client) loadTokenFile(force bool) error {
+	info, err := os.Stat(c.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read AWX token file: %w", err)
+	}
+	if !force && info.ModTime().Equal(c.tokenModTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read AWX token file: %w", err)
+	}
+	c.token = strings.TrimSpace(string(data))
+	c.tokenModTime = info.ModTime()
+	return nil
+}
+
+// requestOAuth2Token obtains a new access token from the token endpoint of
+// the platform, /api/o/token/ on AWX. c.mu must be held.
+func (c *Client) requestOAuth2Token(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+c.Platform().TokenPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	c.addHeaders(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.oauthClientID, c.oauthClientSecret)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		return fmt.Errorf("%w: OAuth2 token request returned HTTP %d", ErrUnauthorized, resp.StatusCode)
+	default:
+		return fmt.Errorf("failed to request OAuth2 token: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode OAuth2 token: %w", err)
+	}
+	if result.AccessToken == "" {
+		return fmt.Errorf("OAuth2 token response contains no access_token")
+	}
+
+	c.token = result.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return nil
+}
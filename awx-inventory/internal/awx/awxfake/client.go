@@ -0,0 +1,1085 @@
+// Package awxfake provides an in-memory AWX for testing the controller
+// without a live AWX instance.
+package awxfake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// Client is an in-memory implementation of the AWX API used by the
+// controller. It is safe for concurrent use.
+type Client struct {
+	// Err, if set, is called before every method with the method name and can
+	// return an error to fail the call, e.g. an *awx.APIError
+	Err func(method string) error
+
+	mu          sync.Mutex
+	nextID      int
+	calls       map[string]int
+	orgs        map[string]int
+	inventories map[int]*inventory
+	hosts       map[int]*host
+	groups      map[int]*group
+	credentials map[int]*Credential
+	templates   map[string]int
+	// Inventory and credentials of job templates by template ID
+	templateInventories map[int]int
+	templateCredentials map[int][]int
+	jobs                map[int]*awx.Job
+	launches            []Launch
+	adHoc               []AdHocCommand
+	noBulk              bool
+	// Permissions reported by CheckPermissions, see Restrict
+	noCreate bool
+	readOnly map[string]bool
+}
+
+// AdHocCommand records a call of LaunchAdHocCommand. Its state is kept
+// with the jobs, FinishJob finishes it.
+type AdHocCommand struct {
+	ID         int
+	Inventory  int
+	Credential int
+	Limit      string
+	Module     string
+	Args       string
+}
+
+// Launch records a call of LaunchJobTemplate
+type Launch struct {
+	TemplateID int
+	JobID      int
+	Inventory  int
+	Limit      string
+	ExtraVars  map[string]interface{}
+}
+
+type inventory struct {
+	awx.Inventory
+	orgID     int
+	variables string
+	// Source variables and input inventories of constructed inventories
+	sourceVars map[string]interface{}
+	inputs     map[int]bool
+}
+
+type host struct {
+	awx.Host
+	invID int
+}
+
+type group struct {
+	awx.Group
+	invID    int
+	hosts    map[int]bool
+	children map[int]bool
+}
+
+// Credential is a Machine credential stored by the fake
+type Credential struct {
+	ID           int
+	Name         string
+	Description  string
+	Organization int
+	Username     string
+	PrivateKey   string
+}
+
+// New creates an empty fake AWX with the given organizations
+func New(organizations ...string) *Client {
+	c := &Client{
+		calls:               make(map[string]int),
+		orgs:                make(map[string]int),
+		inventories:         make(map[int]*inventory),
+		hosts:               make(map[int]*host),
+		groups:              make(map[int]*group),
+		credentials:         make(map[int]*Credential),
+		templates:           make(map[string]int),
+		templateInventories: make(map[int]int),
+		templateCredentials: make(map[int][]int),
+		jobs:                make(map[int]*awx.Job),
+	}
+	for _, name := range organizations {
+		c.orgs[name] = c.id()
+	}
+	return c
+}
+
+// id returns the next object ID. c.mu must be held.
+func (c *Client) id() int {
+	c.nextID++
+	return c.nextID
+}
+
+// call records a call of method and returns the injected error, if any. c.mu must be held.
+func (c *Client) call(method string) error {
+	c.calls[method]++
+	if c.Err != nil {
+		return c.Err(method)
+	}
+	return nil
+}
+
+// Calls returns how often method was called
+func (c *Client) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+// DisableBulk makes the fake behave like an AWX without the bulk API
+func (c *Client) DisableBulk() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noBulk = true
+}
+
+// Restrict limits the permissions reported by CheckPermissions, which are
+// those of an inventory admin of every organization otherwise. The fake
+// does not enforce them.
+func (c *Client) Restrict(canCreateInventories bool, readOnlyInventories ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noCreate = !canCreateInventories
+	c.readOnly = make(map[string]bool)
+	for _, name := range readOnlyInventories {
+		c.readOnly[name] = true
+	}
+}
+
+// AddJobTemplate registers a job template that can be launched
+func (c *Client) AddJobTemplate(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.id()
+	c.templates[name] = id
+	return id
+}
+
+// SetJobTemplateInventory sets the inventory of a job template
+func (c *Client) SetJobTemplateInventory(templateID, invID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templateInventories[templateID] = invID
+}
+
+// JobTemplateCredentials returns the credential IDs attached to a job template
+func (c *Client) JobTemplateCredentials(templateID int) []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.templateCredentials[templateID]...)
+}
+
+// Launches returns the launched jobs in launch order
+func (c *Client) Launches() []Launch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Launch(nil), c.launches...)
+}
+
+// AdHocCommands returns the launched ad hoc commands in launch order
+func (c *Client) AdHocCommands() []AdHocCommand {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]AdHocCommand(nil), c.adHoc...)
+}
+
+// FinishJob marks a launched job as finished
+func (c *Client) FinishJob(jobID int, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if job, exists := c.jobs[jobID]; exists {
+		job.Status = "successful"
+		if failed {
+			job.Status = "failed"
+		}
+		job.Failed = failed
+		job.Finished = time.Now()
+	}
+}
+
+// HostVars returns the decoded variables of a host, nil if it does not exist
+func (c *Client) HostVars(inventoryName, hostName string) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.findHost(c.inventoryID(inventoryName), hostName)
+	if h == nil {
+		return nil
+	}
+	var vars map[string]interface{}
+	json.Unmarshal([]byte(h.Variables), &vars)
+	return vars
+}
+
+// HostNames returns the sorted host names of an inventory
+func (c *Client) HostNames(inventoryName string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	invID := c.inventoryID(inventoryName)
+	var names []string
+	for _, h := range c.hosts {
+		if h.invID == invID {
+			names = append(names, h.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostGroups returns the sorted group names a host is a member of
+func (c *Client) HostGroups(inventoryName, hostName string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.findHost(c.inventoryID(inventoryName), hostName)
+	if h == nil {
+		return nil
+	}
+	var names []string
+	for _, g := range c.groups {
+		if g.hosts[h.ID] {
+			names = append(names, g.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConstructedInventory returns the source variables and the sorted names of
+// the input inventories of a constructed inventory
+func (c *Client) ConstructedInventory(name string) (map[string]interface{}, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inv, exists := c.inventories[c.inventoryID(name)]
+	if !exists {
+		return nil, nil
+	}
+	var inputs []string
+	for id := range inv.inputs {
+		if input, exists := c.inventories[id]; exists {
+			inputs = append(inputs, input.Name)
+		}
+	}
+	sort.Strings(inputs)
+	return inv.sourceVars, inputs
+}
+
+// GroupChildren returns the sorted names of the child groups of a group
+func (c *Client) GroupChildren(inventoryName, groupName string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	invID := c.inventoryID(inventoryName)
+	var names []string
+	for _, g := range c.groups {
+		if g.invID != invID || g.Name != groupName {
+			continue
+		}
+		for id := range g.children {
+			if child, exists := c.groups[id]; exists {
+				names = append(names, child.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CredentialByName returns a stored credential, nil if it does not exist
+func (c *Client) CredentialByName(name string) *Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cred := range c.credentials {
+		if cred.Name == name {
+			copied := *cred
+			return &copied
+		}
+	}
+	return nil
+}
+
+// inventoryID returns the ID of an inventory by name, 0 if unknown. c.mu must be held.
+func (c *Client) inventoryID(name string) int {
+	for id, inv := range c.inventories {
+		if inv.Name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// findHost returns a host by name in an inventory. c.mu must be held.
+func (c *Client) findHost(invID int, name string) *host {
+	for _, h := range c.hosts {
+		if h.invID == invID && h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// notFound returns the error AWX answers for a missing object
+func notFound(method, url string) error {
+	return &awx.APIError{StatusCode: http.StatusNotFound, Method: method, URL: url, Detail: "Not found."}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.call("Ping")
+}
+
+func (c *Client) WaitForAWX(ctx context.Context, timeout, interval time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.call("WaitForAWX")
+}
+
+func (c *Client) GetOrganizationID(ctx context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetOrganizationID"); err != nil {
+		return 0, err
+	}
+	id, exists := c.orgs[name]
+	if !exists {
+		return 0, fmt.Errorf("%w: '%s'", awx.ErrOrganizationNotFound, name)
+	}
+	return id, nil
+}
+
+func (c *Client) CreateOrganization(ctx context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateOrganization"); err != nil {
+		return 0, err
+	}
+	if id, exists := c.orgs[name]; exists {
+		return id, nil
+	}
+	c.orgs[name] = c.id()
+	return c.orgs[name], nil
+}
+
+func (c *Client) GetInventoryID(ctx context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetInventoryID"); err != nil {
+		return 0, err
+	}
+	return c.inventoryID(name), nil
+}
+
+func (c *Client) GetInventory(ctx context.Context, name string) (*awx.Inventory, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetInventory"); err != nil {
+		return nil, err
+	}
+	inv, exists := c.inventories[c.inventoryID(name)]
+	if !exists {
+		return nil, nil
+	}
+	result := inv.Inventory
+	return &result, nil
+}
+
+func (c *Client) UpdateInventory(ctx context.Context, invID int, name, description string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("UpdateInventory"); err != nil {
+		return err
+	}
+	inv, exists := c.inventories[invID]
+	if !exists {
+		return notFound("PATCH", fmt.Sprintf("/api/v2/inventories/%d/", invID))
+	}
+	if id := c.inventoryID(name); id != 0 && id != invID {
+		return &awx.APIError{StatusCode: http.StatusBadRequest, Method: "PATCH", URL: fmt.Sprintf("/api/v2/inventories/%d/", invID),
+			Fields: map[string][]string{"__all__": {"Inventory with this Name and Organization already exists."}}}
+	}
+	inv.Name = name
+	inv.Description = description
+	return nil
+}
+
+func (c *Client) CreateInventory(ctx context.Context, name, description string, orgID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateInventory"); err != nil {
+		return 0, err
+	}
+	if id := c.inventoryID(name); id != 0 {
+		return id, nil
+	}
+	id := c.id()
+	c.inventories[id] = &inventory{Inventory: awx.Inventory{ID: id, Name: name, Description: description}, orgID: orgID}
+	return id, nil
+}
+
+func (c *Client) CreateOrUpdateSmartInventory(ctx context.Context, name, description string, orgID int, hostFilter string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateOrUpdateSmartInventory"); err != nil {
+		return 0, err
+	}
+	if inv, exists := c.inventories[c.inventoryID(name)]; exists {
+		if inv.Kind != awx.InventoryKindSmart {
+			return 0, fmt.Errorf("inventory '%s' exists and is not a smart inventory", name)
+		}
+		inv.Description, inv.HostFilter = description, hostFilter
+		return inv.ID, nil
+	}
+	id := c.id()
+	c.inventories[id] = &inventory{Inventory: awx.Inventory{ID: id, Name: name, Description: description, Kind: awx.InventoryKindSmart, HostFilter: hostFilter}, orgID: orgID}
+	return id, nil
+}
+
+func (c *Client) CreateOrUpdateConstructedInventory(ctx context.Context, name, description string, orgID int, sourceVars map[string]interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateOrUpdateConstructedInventory"); err != nil {
+		return 0, err
+	}
+	if inv, exists := c.inventories[c.inventoryID(name)]; exists {
+		if inv.Kind != awx.InventoryKindConstructed {
+			return 0, fmt.Errorf("inventory '%s' exists and is not a constructed inventory", name)
+		}
+		inv.Description, inv.sourceVars = description, sourceVars
+		return inv.ID, nil
+	}
+	id := c.id()
+	c.inventories[id] = &inventory{Inventory: awx.Inventory{ID: id, Name: name, Description: description, Kind: awx.InventoryKindConstructed}, orgID: orgID, sourceVars: sourceVars, inputs: make(map[int]bool)}
+	return id, nil
+}
+
+func (c *Client) AddInputInventory(ctx context.Context, constructedID, invID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AddInputInventory"); err != nil {
+		return err
+	}
+	inv, exists := c.inventories[constructedID]
+	if !exists || inv.Kind != awx.InventoryKindConstructed {
+		return notFound("POST", fmt.Sprintf("/api/v2/constructed_inventories/%d/input_inventories/", constructedID))
+	}
+	if _, exists := c.inventories[invID]; !exists {
+		return notFound("POST", fmt.Sprintf("/api/v2/constructed_inventories/%d/input_inventories/", constructedID))
+	}
+	inv.inputs[invID] = true
+	return nil
+}
+
+func (c *Client) ForEachInventory(ctx context.Context, orgID int, fn func(awx.Inventory) error) error {
+	c.mu.Lock()
+	if err := c.call("ForEachInventory"); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	var inventories []awx.Inventory
+	for _, inv := range c.inventories {
+		if inv.orgID == orgID {
+			inventories = append(inventories, inv.Inventory)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(inventories, func(i, j int) bool { return inventories[i].ID < inventories[j].ID })
+	for _, inv := range inventories {
+		if err := fn(inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) CheckPermissions(ctx context.Context, orgID int) (*awx.Permissions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CheckPermissions"); err != nil {
+		return nil, err
+	}
+	perms := &awx.Permissions{Username: "awxfake", CanCreateInventories: !c.noCreate}
+	for _, inv := range c.inventories {
+		if inv.orgID == orgID {
+			perms.Inventories = append(perms.Inventories, awx.InventoryPermission{Inventory: inv.Inventory, Edit: !c.readOnly[inv.Name]})
+		}
+	}
+	sort.Slice(perms.Inventories, func(i, j int) bool { return perms.Inventories[i].ID < perms.Inventories[j].ID })
+	return perms, nil
+}
+
+func (c *Client) GetInventoryVariables(ctx context.Context, invID int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetInventoryVariables"); err != nil {
+		return "", err
+	}
+	inv, exists := c.inventories[invID]
+	if !exists {
+		return "", notFound("GET", fmt.Sprintf("/api/v2/inventories/%d/", invID))
+	}
+	return inv.variables, nil
+}
+
+func (c *Client) SetInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("SetInventoryVariables"); err != nil {
+		return err
+	}
+	inv, exists := c.inventories[invID]
+	if !exists {
+		return notFound("PATCH", fmt.Sprintf("/api/v2/inventories/%d/", invID))
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	inv.variables = string(data)
+	return nil
+}
+
+func (c *Client) GetHostID(ctx context.Context, invID int, hostName string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetHostID"); err != nil {
+		return 0, err
+	}
+	if h := c.findHost(invID, hostName); h != nil {
+		return h.ID, nil
+	}
+	return 0, nil
+}
+
+func (c *Client) GetHost(ctx context.Context, invID int, hostName string) (*awx.Host, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetHost"); err != nil {
+		return nil, err
+	}
+	if h := c.findHost(invID, hostName); h != nil {
+		copied := h.Host
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (c *Client) ListHosts(ctx context.Context, invID int) ([]awx.Host, error) {
+	var hosts []awx.Host
+	err := c.ForEachHost(ctx, invID, func(h awx.Host) error {
+		hosts = append(hosts, h)
+		return nil
+	})
+	return hosts, err
+}
+
+func (c *Client) ForEachHost(ctx context.Context, invID int, fn func(awx.Host) error) error {
+	c.mu.Lock()
+	if err := c.call("ForEachHost"); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	var hosts []awx.Host
+	for _, h := range c.hosts {
+		if h.invID == invID {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].ID < hosts[j].ID })
+	for _, h := range hosts {
+		if err := fn(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) CreateOrUpdateHost(ctx context.Context, invID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateOrUpdateHost"); err != nil {
+		return 0, err
+	}
+	return c.upsertHost(invID, hostName, hostVars, enabled, description)
+}
+
+// upsertHost creates or updates a host and returns its ID. c.mu must be held.
+func (c *Client) upsertHost(invID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) (int, error) {
+	if _, exists := c.inventories[invID]; !exists {
+		return 0, notFound("POST", fmt.Sprintf("/api/v2/inventories/%d/hosts/", invID))
+	}
+	data, err := json.Marshal(hostVars)
+	if err != nil {
+		return 0, err
+	}
+
+	if h := c.findHost(invID, hostName); h != nil {
+		h.Variables = string(data)
+		h.Enabled = enabled
+		h.Description = description
+		return h.ID, nil
+	}
+	id := c.id()
+	c.hosts[id] = &host{Host: awx.Host{ID: id, Name: hostName, Description: description, Variables: string(data), Enabled: enabled, Inventory: invID}, invID: invID}
+	return id, nil
+}
+
+func (c *Client) UpdateHost(ctx context.Context, hostID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("UpdateHost"); err != nil {
+		return err
+	}
+	h, exists := c.hosts[hostID]
+	if !exists {
+		return notFound("PATCH", fmt.Sprintf("/api/v2/hosts/%d/", hostID))
+	}
+	data, err := json.Marshal(hostVars)
+	if err != nil {
+		return err
+	}
+	h.Name = hostName
+	h.Variables = string(data)
+	h.Enabled = enabled
+	h.Description = description
+	return nil
+}
+
+func (c *Client) GetHostByID(ctx context.Context, hostID int) (*awx.Host, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetHostByID"); err != nil {
+		return nil, err
+	}
+	h, exists := c.hosts[hostID]
+	if !exists {
+		return nil, nil
+	}
+	copied := h.Host
+	return &copied, nil
+}
+
+func (c *Client) DeleteHostByID(ctx context.Context, hostID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteHostByID"); err != nil {
+		return err
+	}
+	delete(c.hosts, hostID)
+	for _, g := range c.groups {
+		delete(g.hosts, hostID)
+	}
+	return nil
+}
+
+func (c *Client) DeleteHost(ctx context.Context, invID int, hostName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteHost"); err != nil {
+		return err
+	}
+	if h := c.findHost(invID, hostName); h != nil {
+		delete(c.hosts, h.ID)
+		for _, g := range c.groups {
+			delete(g.hosts, h.ID)
+		}
+	}
+	return nil
+}
+
+func (c *Client) DeleteGroup(ctx context.Context, groupID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteGroup"); err != nil {
+		return err
+	}
+	delete(c.groups, groupID)
+	return nil
+}
+
+func (c *Client) DeleteInventory(ctx context.Context, invID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteInventory"); err != nil {
+		return err
+	}
+	delete(c.inventories, invID)
+	for id, h := range c.hosts {
+		if h.invID == invID {
+			delete(c.hosts, id)
+		}
+	}
+	for id, g := range c.groups {
+		if g.invID == invID {
+			delete(c.groups, id)
+		}
+	}
+	return nil
+}
+
+func (c *Client) UpdateHostEnabled(ctx context.Context, invID int, hostName string, enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("UpdateHostEnabled"); err != nil {
+		return err
+	}
+	if h := c.findHost(invID, hostName); h != nil {
+		h.Enabled = enabled
+	}
+	return nil
+}
+
+func (c *Client) SetHostEnabled(ctx context.Context, hostID int, enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("SetHostEnabled"); err != nil {
+		return err
+	}
+	h, exists := c.hosts[hostID]
+	if !exists {
+		return notFound("PATCH", fmt.Sprintf("/api/v2/hosts/%d/", hostID))
+	}
+	h.Enabled = enabled
+	return nil
+}
+
+func (c *Client) SupportsBulkHostCreate(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("SupportsBulkHostCreate"); err != nil {
+		return false, err
+	}
+	return !c.noBulk, nil
+}
+
+func (c *Client) BulkCreateHosts(ctx context.Context, invID int, hosts []awx.BulkHost, fn func([]awx.BulkHost)) error {
+	c.mu.Lock()
+	if err := c.call("BulkCreateHosts"); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	for _, h := range hosts {
+		if c.findHost(invID, h.Name) != nil {
+			c.mu.Unlock()
+			return &awx.APIError{StatusCode: http.StatusBadRequest, Method: "POST", URL: "/api/v2/bulk/host_create/",
+				Fields: map[string][]string{"__all__": {fmt.Sprintf("Hostnames must be unique in an inventory: %s", h.Name)}}}
+		}
+	}
+	for _, h := range hosts {
+		if _, err := c.upsertHost(invID, h.Name, h.Variables, true, h.Description); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.mu.Unlock()
+
+	if len(hosts) > 0 {
+		fn(hosts)
+	}
+	return nil
+}
+
+func (c *Client) ListGroups(ctx context.Context, invID int) ([]awx.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("ListGroups"); err != nil {
+		return nil, err
+	}
+	var groups []awx.Group
+	for _, g := range c.groups {
+		if g.invID == invID {
+			groups = append(groups, g.Group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (c *Client) ListGroupHosts(ctx context.Context, groupID int) ([]awx.Host, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("ListGroupHosts"); err != nil {
+		return nil, err
+	}
+	g, exists := c.groups[groupID]
+	if !exists {
+		return nil, notFound("GET", fmt.Sprintf("/api/v2/groups/%d/hosts/", groupID))
+	}
+	var hosts []awx.Host
+	for id := range g.hosts {
+		hosts = append(hosts, c.hosts[id].Host)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].ID < hosts[j].ID })
+	return hosts, nil
+}
+
+func (c *Client) GetOrCreateGroup(ctx context.Context, invID int, groupName, description string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetOrCreateGroup"); err != nil {
+		return 0, err
+	}
+	for id, g := range c.groups {
+		if g.invID == invID && g.Name == groupName {
+			return id, nil
+		}
+	}
+	if _, exists := c.inventories[invID]; !exists {
+		return 0, notFound("POST", fmt.Sprintf("/api/v2/inventories/%d/groups/", invID))
+	}
+	id := c.id()
+	c.groups[id] = &group{Group: awx.Group{ID: id, Name: groupName, Description: description}, invID: invID, hosts: make(map[int]bool), children: make(map[int]bool)}
+	return id, nil
+}
+
+func (c *Client) SetGroupVariables(ctx context.Context, groupID int, vars map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("SetGroupVariables"); err != nil {
+		return err
+	}
+	g, exists := c.groups[groupID]
+	if !exists {
+		return notFound("PATCH", fmt.Sprintf("/api/v2/groups/%d/", groupID))
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	g.Variables = string(data)
+	return nil
+}
+
+func (c *Client) AddHostToGroup(ctx context.Context, groupID, hostID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AddHostToGroup"); err != nil {
+		return err
+	}
+	g, exists := c.groups[groupID]
+	if !exists {
+		return notFound("POST", fmt.Sprintf("/api/v2/groups/%d/hosts/", groupID))
+	}
+	g.hosts[hostID] = true
+	return nil
+}
+
+func (c *Client) AddGroupToGroup(ctx context.Context, parentID, childID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AddGroupToGroup"); err != nil {
+		return err
+	}
+	parent, exists := c.groups[parentID]
+	if !exists {
+		return notFound("POST", fmt.Sprintf("/api/v2/groups/%d/children/", parentID))
+	}
+	if _, exists := c.groups[childID]; !exists {
+		return notFound("POST", fmt.Sprintf("/api/v2/groups/%d/children/", parentID))
+	}
+	parent.children[childID] = true
+	return nil
+}
+
+func (c *Client) ListGroupChildren(ctx context.Context, groupID int) ([]awx.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("ListGroupChildren"); err != nil {
+		return nil, err
+	}
+	g, exists := c.groups[groupID]
+	if !exists {
+		return nil, notFound("GET", fmt.Sprintf("/api/v2/groups/%d/children/", groupID))
+	}
+	var groups []awx.Group
+	for id := range g.children {
+		if child, exists := c.groups[id]; exists {
+			groups = append(groups, child.Group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (c *Client) ListHostGroups(ctx context.Context, hostID int) ([]awx.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("ListHostGroups"); err != nil {
+		return nil, err
+	}
+	var groups []awx.Group
+	for _, g := range c.groups {
+		if g.hosts[hostID] {
+			groups = append(groups, g.Group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (c *Client) DisassociateHostFromGroup(ctx context.Context, groupID, hostID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DisassociateHostFromGroup"); err != nil {
+		return err
+	}
+	if g, exists := c.groups[groupID]; exists {
+		delete(g.hosts, hostID)
+	}
+	return nil
+}
+
+func (c *Client) CreateOrUpdateMachineCredential(ctx context.Context, name, description string, orgID int, username, privateKey string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateOrUpdateMachineCredential"); err != nil {
+		return 0, err
+	}
+	for id, cred := range c.credentials {
+		if cred.Name == name && cred.Organization == orgID {
+			cred.Description, cred.Username, cred.PrivateKey = description, username, privateKey
+			return id, nil
+		}
+	}
+	id := c.id()
+	c.credentials[id] = &Credential{ID: id, Name: name, Description: description, Organization: orgID, Username: username, PrivateKey: privateKey}
+	return id, nil
+}
+
+func (c *Client) GetCredentialID(ctx context.Context, name string, orgID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetCredentialID"); err != nil {
+		return 0, err
+	}
+	for id, cred := range c.credentials {
+		if cred.Name == name && cred.Organization == orgID {
+			return id, nil
+		}
+	}
+	return 0, nil
+}
+
+func (c *Client) DeleteCredential(ctx context.Context, credentialID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteCredential"); err != nil {
+		return err
+	}
+	delete(c.credentials, credentialID)
+	for templateID, ids := range c.templateCredentials {
+		c.templateCredentials[templateID] = slices.DeleteFunc(ids, func(id int) bool { return id == credentialID })
+	}
+	return nil
+}
+
+func (c *Client) ListJobTemplateIDs(ctx context.Context, invID int) ([]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("ListJobTemplateIDs"); err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, id := range c.templates {
+		if c.templateInventories[id] == invID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (c *Client) AttachJobTemplateCredential(ctx context.Context, templateID, credentialID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AttachJobTemplateCredential"); err != nil {
+		return err
+	}
+	if !slices.Contains(c.templateCredentials[templateID], credentialID) {
+		c.templateCredentials[templateID] = append(c.templateCredentials[templateID], credentialID)
+	}
+	return nil
+}
+
+func (c *Client) GetJobTemplateID(ctx context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetJobTemplateID"); err != nil {
+		return 0, err
+	}
+	id, exists := c.templates[name]
+	if !exists {
+		return 0, fmt.Errorf("job template '%s' not found", name)
+	}
+	return id, nil
+}
+
+func (c *Client) LaunchJobTemplate(ctx context.Context, templateID, invID int, limit string, extraVars map[string]interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("LaunchJobTemplate"); err != nil {
+		return 0, err
+	}
+	id := c.id()
+	c.jobs[id] = &awx.Job{ID: id, Status: "running", Started: time.Now()}
+	c.launches = append(c.launches, Launch{TemplateID: templateID, JobID: id, Inventory: invID, Limit: limit, ExtraVars: extraVars})
+	return id, nil
+}
+
+func (c *Client) GetJob(ctx context.Context, jobID int) (*awx.Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetJob"); err != nil {
+		return nil, err
+	}
+	job, exists := c.jobs[jobID]
+	if !exists {
+		return nil, notFound("GET", fmt.Sprintf("/api/v2/jobs/%d/", jobID))
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (c *Client) LaunchAdHocCommand(ctx context.Context, invID, credentialID int, limit, module, args string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("LaunchAdHocCommand"); err != nil {
+		return 0, err
+	}
+	id := c.id()
+	c.jobs[id] = &awx.Job{ID: id, Status: "running", Started: time.Now()}
+	c.adHoc = append(c.adHoc, AdHocCommand{ID: id, Inventory: invID, Credential: credentialID, Limit: limit, Module: module, Args: args})
+	return id, nil
+}
+
+func (c *Client) GetAdHocCommand(ctx context.Context, commandID int) (*awx.Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetAdHocCommand"); err != nil {
+		return nil, err
+	}
+	job, exists := c.jobs[commandID]
+	if !exists {
+		return nil, notFound("GET", fmt.Sprintf("/api/v2/ad_hoc_commands/%d/", commandID))
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (c *Client) JobURL(jobID int) string {
+	return fmt.Sprintf("awxfake://jobs/%d", jobID)
+}
+
+func (c *Client) HostURL(invID, hostID int) string {
+	return fmt.Sprintf("awxfake://inventories/%d/hosts/%d", invID, hostID)
+}
@@ -0,0 +1,459 @@
+// Package awxtest runs a fake AWX API server for end-to-end tests of the
+// AWX client and the controller. It implements the v2 endpoints used by
+// awx.Client for ping, the current user, organizations, inventories, hosts,
+// groups and bulk host creation, and the named URLs of hosts.
+package awxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// Token is the bearer token accepted by the server
+const Token = "awxtest-token"
+
+// defaultPageSize matches AWX's default page size
+const defaultPageSize = 25
+
+// Server is a fake AWX API backed by httptest
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	nextID      int
+	requests    map[string]int
+	orgs        map[int]*object
+	inventories map[int]*object
+	hosts       map[int]*object
+	groups      map[int]*object
+	// Group memberships, by group ID
+	members map[int]map[int]bool
+}
+
+// object is the stored form of every AWX object
+type object struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Variables   string `json:"variables,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"`
+	// Parent inventory or organization ID
+	Inventory    int `json:"inventory,omitempty"`
+	Organization int `json:"organization,omitempty"`
+}
+
+// NewServer starts a fake AWX with the given organizations. Call Close when done.
+func NewServer(organizations ...string) *Server {
+	s := &Server{
+		requests:    make(map[string]int),
+		orgs:        make(map[int]*object),
+		inventories: make(map[int]*object),
+		hosts:       make(map[int]*object),
+		groups:      make(map[int]*object),
+		members:     make(map[int]map[int]bool),
+	}
+	for _, name := range organizations {
+		id := s.id()
+		s.orgs[id] = &object{ID: id, Name: name}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns an AWX client authenticated against the server
+func (s *Server) Client() *awx.Client {
+	return awx.NewClient(s.URL, Token)
+}
+
+// Requests returns how many requests were made with method to path patterns
+// like "POST /api/v2/inventories/{id}/hosts/"
+func (s *Server) Requests(pattern string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[pattern]
+}
+
+// HostNames returns the sorted host names of an inventory
+func (s *Server) HostNames(inventoryName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invID := findByName(s.inventories, inventoryName, nil)
+	var names []string
+	for _, h := range s.hosts {
+		if h.Inventory == invID {
+			names = append(names, h.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostGroups returns the sorted group names a host is a member of
+func (s *Server) HostGroups(inventoryName, hostName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invID := findByName(s.inventories, inventoryName, nil)
+	hostID := findByName(s.hosts, hostName, func(o *object) bool { return o.Inventory == invID })
+	var names []string
+	for groupID, hosts := range s.members {
+		if hosts[hostID] {
+			names = append(names, s.groups[groupID].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedHostID returns the ID of the host with a named URL segment like
+// web-1++vms++Default, 0 if there is none
+func (s *Server) namedHostID(segment string) int {
+	names := strings.Split(segment, "++")
+	if len(names) != 3 {
+		return 0
+	}
+	orgID := findByName(s.orgs, names[2], nil)
+	invID := findByName(s.inventories, names[1], func(o *object) bool { return o.Organization == orgID })
+	return findByName(s.hosts, names[0], func(o *object) bool { return o.Inventory == invID })
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// findByName returns the ID of the first object named name that matches filter, 0 if none
+func findByName(objects map[int]*object, name string, filter func(*object) bool) int {
+	for id, o := range objects {
+		if o.Name == name && (filter == nil || filter(o)) {
+			return id
+		}
+	}
+	return 0
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Authentication credentials were not provided."})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Replace numeric path segments and named URLs of hosts so routes can be
+	// matched as patterns
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var ids []int
+	for i, segment := range segments {
+		if id, err := strconv.Atoi(segment); err == nil {
+			ids = append(ids, id)
+			segments[i] = "{id}"
+		} else if i == 3 && segments[2] == "hosts" && strings.Contains(segment, "++") {
+			ids = append(ids, s.namedHostID(segment))
+			segments[i] = "{id}"
+		}
+	}
+	pattern := r.Method + " /" + strings.Join(segments, "/") + "/"
+	s.requests[pattern]++
+
+	query := r.URL.Query()
+	switch pattern {
+	case "GET /api/v2/ping/":
+		writeJSON(w, http.StatusOK, map[string]string{"version": "awxtest"})
+	case "GET /api/v2/me/":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"count": 1, "results": []map[string]interface{}{{"id": 1, "username": "admin", "is_superuser": true}}})
+	case "GET /api/v2/organizations/":
+		s.list(w, r, s.orgs, func(o *object) bool { return matches(query, "name", o.Name) })
+	case "POST /api/v2/organizations/":
+		var body object
+		if !decode(w, r, &body) {
+			return
+		}
+		if findByName(s.orgs, body.Name, nil) != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"Organization with this Name already exists."}})
+			return
+		}
+		s.create(w, s.orgs, &body)
+	case "GET /api/v2/inventories/":
+		s.list(w, r, s.inventories, func(o *object) bool {
+			return matches(query, "name", o.Name) && matches(query, "organization", strconv.Itoa(o.Organization))
+		})
+	case "POST /api/v2/inventories/":
+		var body object
+		if !decode(w, r, &body) {
+			return
+		}
+		if findByName(s.inventories, body.Name, nil) != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"__all__": {"Inventory with this Name and Organization already exists."}})
+			return
+		}
+		s.create(w, s.inventories, &body)
+	case "GET /api/v2/inventories/{id}/":
+		inv := s.inventories[ids[0]]
+		if inv == nil {
+			notFound(w)
+			return
+		}
+		org := s.orgs[inv.Organization]
+		if org == nil {
+			org = &object{}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			*object
+			Related map[string]string `json:"related"`
+		}{inv, map[string]string{
+			"named_url": "/api/v2/inventories/" + url.PathEscape(inv.Name) + "++" + url.PathEscape(org.Name) + "/",
+		}})
+	case "PATCH /api/v2/inventories/{id}/":
+		s.patch(w, r, s.inventories, ids[0])
+	case "GET /api/v2/inventories/{id}/hosts/":
+		s.list(w, r, s.hosts, func(o *object) bool { return o.Inventory == ids[0] && matches(query, "name", o.Name) })
+	case "POST /api/v2/inventories/{id}/hosts/":
+		var body object
+		if !decode(w, r, &body) {
+			return
+		}
+		if s.inventories[ids[0]] == nil {
+			notFound(w)
+			return
+		}
+		if findByName(s.hosts, body.Name, func(o *object) bool { return o.Inventory == ids[0] }) != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"__all__": {"Host with this Name and Inventory already exists."}})
+			return
+		}
+		body.Inventory = ids[0]
+		if body.Enabled == nil {
+			enabled := true
+			body.Enabled = &enabled
+		}
+		s.create(w, s.hosts, &body)
+	case "GET /api/v2/inventories/{id}/groups/":
+		s.list(w, r, s.groups, func(o *object) bool { return o.Inventory == ids[0] && matches(query, "name", o.Name) })
+	case "POST /api/v2/inventories/{id}/groups/":
+		var body object
+		if !decode(w, r, &body) {
+			return
+		}
+		if s.inventories[ids[0]] == nil {
+			notFound(w)
+			return
+		}
+		body.Inventory = ids[0]
+		s.create(w, s.groups, &body)
+		s.members[body.ID] = make(map[int]bool)
+	case "GET /api/v2/bulk/":
+		writeJSON(w, http.StatusOK, map[string]string{"host_create": "/api/v2/bulk/host_create/"})
+	case "POST /api/v2/bulk/host_create/":
+		var body struct {
+			Inventory int      `json:"inventory"`
+			Hosts     []object `json:"hosts"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		if s.inventories[body.Inventory] == nil {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"inventory": {"Invalid pk - object does not exist."}})
+			return
+		}
+		for _, h := range body.Hosts {
+			if findByName(s.hosts, h.Name, func(o *object) bool { return o.Inventory == body.Inventory }) != 0 {
+				writeJSON(w, http.StatusBadRequest, map[string][]string{"__all__": {"Hosts with names " + h.Name + " already exist in inventory."}})
+				return
+			}
+		}
+		created := make([]*object, 0, len(body.Hosts))
+		for _, h := range body.Hosts {
+			enabled := true
+			o := &object{ID: s.id(), Name: h.Name, Description: h.Description, Variables: h.Variables, Enabled: &enabled, Inventory: body.Inventory}
+			s.hosts[o.ID] = o
+			created = append(created, o)
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"hosts": created})
+	case "PATCH /api/v2/hosts/{id}/":
+		s.patch(w, r, s.hosts, ids[0])
+	case "DELETE /api/v2/hosts/{id}/":
+		if s.hosts[ids[0]] == nil {
+			notFound(w)
+			return
+		}
+		delete(s.hosts, ids[0])
+		for _, hosts := range s.members {
+			delete(hosts, ids[0])
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE /api/v2/inventories/{id}/":
+		if s.inventories[ids[0]] == nil {
+			notFound(w)
+			return
+		}
+		delete(s.inventories, ids[0])
+		for id, o := range s.hosts {
+			if o.Inventory == ids[0] {
+				delete(s.hosts, id)
+			}
+		}
+		for id, o := range s.groups {
+			if o.Inventory == ids[0] {
+				delete(s.groups, id)
+				delete(s.members, id)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case "DELETE /api/v2/groups/{id}/":
+		if s.groups[ids[0]] == nil {
+			notFound(w)
+			return
+		}
+		delete(s.groups, ids[0])
+		delete(s.members, ids[0])
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /api/v2/hosts/{id}/":
+		s.get(w, s.hosts, ids[0])
+	case "GET /api/v2/hosts/{id}/groups/":
+		s.list(w, r, s.groups, func(o *object) bool { return s.members[o.ID][ids[0]] })
+	case "PATCH /api/v2/groups/{id}/":
+		s.patch(w, r, s.groups, ids[0])
+	case "GET /api/v2/groups/{id}/hosts/":
+		s.list(w, r, s.hosts, func(o *object) bool { return s.members[ids[0]][o.ID] })
+	case "POST /api/v2/groups/{id}/hosts/":
+		var body struct {
+			ID           int  `json:"id"`
+			Disassociate bool `json:"disassociate"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		if s.groups[ids[0]] == nil || s.hosts[body.ID] == nil {
+			notFound(w)
+			return
+		}
+		if body.Disassociate {
+			delete(s.members[ids[0]], body.ID)
+		} else {
+			s.members[ids[0]][body.ID] = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		notFound(w)
+	}
+}
+
+// matches reports whether the query parameter key is unset or equals value
+func matches(query url.Values, key, value string) bool {
+	want := query.Get(key)
+	return want == "" || want == value
+}
+
+// list writes a page of the objects matching filter, ordered by ID
+func (s *Server) list(w http.ResponseWriter, r *http.Request, objects map[int]*object, filter func(*object) bool) {
+	var results []*object
+	for _, o := range objects {
+		if filter(o) {
+			results = append(results, o)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+
+	query := r.URL.Query()
+	pageSize, err := strconv.Atoi(query.Get("page_size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*pageSize, len(results))
+	end := min(start+pageSize, len(results))
+	var next *string
+	if end < len(results) {
+		query.Set("page", strconv.Itoa(page+1))
+		link := r.URL.Path + "?" + query.Encode()
+		next = &link
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":   len(results),
+		"next":    next,
+		"results": append([]*object{}, results[start:end]...),
+	})
+}
+
+func (s *Server) get(w http.ResponseWriter, objects map[int]*object, id int) {
+	o, exists := objects[id]
+	if !exists {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) create(w http.ResponseWriter, objects map[int]*object, o *object) {
+	if o.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"This field is required."}})
+		return
+	}
+	o.ID = s.id()
+	objects[o.ID] = o
+	writeJSON(w, http.StatusCreated, o)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, objects map[int]*object, id int) {
+	o, exists := objects[id]
+	if !exists {
+		notFound(w)
+		return
+	}
+	var body struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Variables   *string `json:"variables"`
+		Enabled     *bool   `json:"enabled"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	if body.Name != nil {
+		o.Name = *body.Name
+	}
+	if body.Description != nil {
+		o.Description = *body.Description
+	}
+	if body.Variables != nil {
+		o.Variables = *body.Variables
+	}
+	if body.Enabled != nil && o.Enabled != nil {
+		enabled := *body.Enabled
+		o.Enabled = &enabled
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+// decode reads a JSON request body, answering 400 if it is invalid
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": fmt.Sprintf("JSON parse error - %v", err)})
+		return false
+	}
+	return true
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
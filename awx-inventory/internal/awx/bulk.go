@@ -0,0 +1,96 @@
+package awx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// bulkHostCreateLimit is the largest batch AWX accepts in one bulk request
+const bulkHostCreateLimit = 100
+
+// BulkHost is a host created by BulkCreateHosts
+type BulkHost struct {
+	Name        string
+	Description string
+	Variables   map[string]interface{}
+}
+
+// SupportsBulkHostCreate reports whether AWX offers /api/v2/bulk/host_create/ (AWX 22.0+)
+func (c *Client) SupportsBulkHostCreate(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL()+"/bulk/", nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to get bulk API: %w", newAPIError(resp))
+	}
+
+	var endpoints map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return false, fmt.Errorf("failed to decode bulk API: %w", err)
+	}
+	_, ok := endpoints["host_create"]
+	return ok, nil
+}
+
+// BulkCreateHosts creates hosts in batches. AWX rejects a whole batch if any
+// of its hosts already exists, so callers should only pass new hosts. fn is
+// called with the hosts of each batch that was created.
+func (c *Client) BulkCreateHosts(ctx context.Context, invID int, hosts []BulkHost, fn func([]BulkHost)) error {
+	for start := 0; start < len(hosts); start += bulkHostCreateLimit {
+		batch := hosts[start:min(start+bulkHostCreateLimit, len(hosts))]
+
+		payloadHosts := make([]map[string]interface{}, 0, len(batch))
+		for _, h := range batch {
+			varsJSON, err := json.Marshal(h.Variables)
+			if err != nil {
+				return err
+			}
+			payloadHosts = append(payloadHosts, map[string]interface{}{
+				"name":        h.Name,
+				"description": h.Description,
+				"variables":   string(varsJSON),
+			})
+		}
+
+		jsonData, err := json.Marshal(map[string]interface{}{
+			"inventory": invID,
+			"hosts":     payloadHosts,
+		})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL()+"/bulk/host_create/", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusCreated {
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+			return fmt.Errorf("failed to bulk create hosts: %w", apiErr)
+		}
+		resp.Body.Close()
+		fn(batch)
+	}
+	return nil
+}
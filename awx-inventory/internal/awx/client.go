@@ -2,136 +2,325 @@ package awx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cache"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
 )
 
 // Client handles communication with AWX API
 type Client struct {
 	baseURL string
-	token   string
-	client  *http.Client
+	// detected is the platform found by DetectPlatform, nil until then
+	detected atomic.Pointer[Platform]
+	client   *http.Client
+	// headers are added to every request, e.g. for an authenticating proxy
+	headers http.Header
+	// limiter paces all requests, nil if unlimited
+	limiter *rate.Limiter
+	// responses are revalidated with conditional requests, nil if disabled,
+	// see conditional.go
+	responses *cache.LRU[string, cachedResponse]
+	// namedInventories caches the named URL segment of inventories by ID,
+	// see namedurl.go
+	namedInventories sync.Map
+
+	// Authentication state, see auth.go
+	mu    sync.Mutex
+	token string
+	// tokenFile is reread when it changes, empty if the token is static
+	tokenFile    string
+	tokenModTime time.Time
+	// Basic auth credentials, used instead of a token when username is set
+	username string
+	password string
+	// OAuth2 application credentials, tokens are requested from the token
+	// endpoint of the platform
+	oauthClientID     string
+	oauthClientSecret string
+	tokenExpiry       time.Time
 }
 
 // NewClient creates a new AWX client
 func NewClient(baseURL, token string) *Client {
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY select a proxy
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
 	return &Client{
 		baseURL: baseURL,
 		token:   token,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
 	}
 }
 
-// WaitForAWX waits for AWX to become available
-func (c *Client) WaitForAWX(timeout, interval time.Duration) error {
-	deadline := time.Now().Add(timeout)
-	attempt := 0
+// SetHeaders adds static headers to every AWX request. They cannot override
+// the Authorization header set by the client.
+func (c *Client) SetHeaders(headers http.Header) {
+	c.headers = headers.Clone()
+}
+
+// addHeaders sets the configured static headers on req
+func (c *Client) addHeaders(req *http.Request) {
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+}
+
+// SetRateLimit limits AWX requests to rps per second with bursts of up to
+// burst requests, 0 disables the limit
+func (c *Client) SetRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		c.limiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	c.limiter = rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// WrapTransport wraps the HTTP transport used for AWX requests
+func (c *Client) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	c.client.Transport = wrap(c.client.Transport)
+}
+
+// do sends the request, answering read-mostly GETs from the response
+// cache if AWX reports them unchanged
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.conditional(req) {
+		return c.doConditional(req)
+	}
+	return c.send(req)
+}
+
+// send authenticates and sends the request, retrying it when AWX is rate
+// limiting, and turns authentication failures into errors
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// Without GetBody the request body cannot be sent twice
+	replayable := req.Body == nil || req.GetBody != nil
+	refreshed := false
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			req = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
 
-	for time.Now().Before(deadline) {
-		attempt++
-		req, err := http.NewRequest("GET", c.baseURL+"/api/v2/ping/", nil)
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		auth, err := c.authorization(ctx, false)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		req.Header.Set("Authorization", "Bearer "+c.token)
+		c.addHeaders(req)
+		req.Header.Set("Authorization", auth)
 
 		resp, err := c.client.Do(req)
-		if err == nil && resp.StatusCode == 200 {
-			resp.Body.Close()
-			return nil
+		if err != nil {
+			return nil, err
 		}
-		if resp != nil {
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && replayable && !refreshed:
+			// The token may have been rotated or expired early; retry once with a new one
+			refreshed = true
+			if newAuth, err := c.authorization(ctx, true); err == nil && newAuth != auth {
+				resp.Body.Close()
+				continue
+			}
+		case resp.StatusCode == http.StatusTooManyRequests && replayable && attempt < maxRateLimitRetries:
+			delay := retryAfter(resp, attempt)
 			resp.Body.Close()
+			metrics.AWXRateLimitedTotal.Inc()
+			log.Printf("WARN: AWX rate limited %s %s, retrying in %v", req.Method, req.URL.Path, delay)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
 		}
 
-		time.Sleep(interval)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			defer resp.Body.Close()
+			return nil, newAPIError(resp)
+		}
+		return resp, nil
 	}
-
-	return fmt.Errorf("AWX did not become available within %v", timeout)
 }
 
-// GetOrganizationID retrieves organization ID by name
-func (c *Client) GetOrganizationID(name string) (int, error) {
-	urlStr := c.baseURL + "/api/v2/organizations/?name=" + url.QueryEscape(name)
-	req, err := http.NewRequest("GET", urlStr, nil)
+// Ping checks that AWX is reachable and accepts the token
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL()+"/ping/", nil)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return 0, fmt.Errorf("failed to get organization: HTTP %d", resp.StatusCode)
+		return fmt.Errorf("AWX ping failed: %w", newAPIError(resp))
 	}
+	return nil
+}
 
-	var result struct {
-		Results []struct {
-			ID int `json:"id"`
-		} `json:"results"`
+// CheckCredentials verifies that AWX accepts the credentials. The ping
+// endpoint answers without them, so a bad token only shows on other requests.
+func (c *Client) CheckCredentials(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL()+"/me/", nil)
+	if err != nil {
+		return err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to get current user: %w", newAPIError(resp))
 	}
+	return nil
+}
 
-	if len(result.Results) == 0 {
-		return 0, fmt.Errorf("organization '%s' not found", name)
+// WaitForAWX waits until AWX answers pings and accepts the credentials,
+// checking every interval. It gives up after timeout, or right away on the
+// first failure if timeout is 0, and fails without waiting if the
+// credentials are rejected.
+func (c *Client) WaitForAWX(ctx context.Context, timeout, interval time.Duration) error {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	return result.Results[0].ID, nil
+	for {
+		// Until the API root answers, the paths of classic AWX are tried
+		if c.detected.Load() == nil {
+			if platform, err := c.DetectPlatform(ctx); err == nil {
+				log.Printf("Detected %s API at %s", platform.Name, platform.APIPath)
+			}
+		}
+		err := c.Ping(ctx)
+		if err == nil {
+			err = c.CheckCredentials(ctx)
+		}
+		if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+			// Waiting does not fix bad credentials
+			return fmt.Errorf("AWX rejected the credentials: %w", err)
+		}
+		if err == nil {
+			return nil
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("AWX is not available: %w", err)
+		}
+		log.Printf("AWX is not available yet, retrying in %v: %v", interval, err)
+
+		select {
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			return fmt.Errorf("AWX did not become available within %v: %w", timeout, err)
+		case <-time.After(interval):
+		}
+	}
 }
 
-// GetInventoryID retrieves inventory ID by name
-func (c *Client) GetInventoryID(name string) (int, error) {
-	urlStr := c.baseURL + "/api/v2/inventories/?name=" + url.QueryEscape(name)
-	req, err := http.NewRequest("GET", urlStr, nil)
+// GetOrganizationID retrieves organization ID by name
+func (c *Client) GetOrganizationID(ctx context.Context, name string) (int, error) {
+	id, err := c.findID(ctx, c.apiURL()+"/organizations/?name="+url.QueryEscape(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get organization: %w", err)
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("%w: '%s'", ErrOrganizationNotFound, name)
+	}
+	return id, nil
+}
+
+// CreateOrganization creates a new organization, which needs a system administrator token
+func (c *Client) CreateOrganization(ctx context.Context, name string) (int, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{"name": name})
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	resp, err := c.client.Do(req)
+	urlStr := c.apiURL() + "/organizations/"
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
 
-	if resp.StatusCode != 200 {
-		return 0, fmt.Errorf("failed to get inventory: HTTP %d", resp.StatusCode)
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
 	}
+	defer resp.Body.Close()
 
-	var result struct {
-		Results []struct {
+	if resp.StatusCode == 201 {
+		var result struct {
 			ID int `json:"id"`
-		} `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return 0, err
+		}
+		return result.ID, nil
+	} else if resp.StatusCode == 400 {
+		// Organization might have been created meanwhile, try to get it
+		return c.GetOrganizationID(ctx, name)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
-	}
+	return 0, fmt.Errorf("failed to create organization: %w", newAPIError(resp))
+}
 
-	if len(result.Results) == 0 {
-		return 0, nil
+// GetInventoryID retrieves inventory ID by name
+func (c *Client) GetInventoryID(ctx context.Context, name string) (int, error) {
+	id, err := c.findID(ctx, c.apiURL()+"/inventories/?name="+url.QueryEscape(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inventory: %w", err)
 	}
-
-	return result.Results[0].ID, nil
+	return id, nil
 }
 
 // CreateInventory creates a new inventory
-func (c *Client) CreateInventory(name string, orgID int) (int, error) {
+func (c *Client) CreateInventory(ctx context.Context, name, description string, orgID int) (int, error) {
 	payload := map[string]interface{}{
 		"name":         name,
+		"description":  description,
 		"organization": orgID,
 	}
 
@@ -140,15 +329,14 @@ func (c *Client) CreateInventory(name string, orgID int) (int, error) {
 		return 0, err
 	}
 
-	urlStr := c.baseURL + "/api/v2/inventories/"
-	req, err := http.NewRequest("POST", urlStr, bytes.NewBuffer(jsonData))
+	urlStr := c.apiURL() + "/inventories/"
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -164,84 +352,224 @@ func (c *Client) CreateInventory(name string, orgID int) (int, error) {
 		return result.ID, nil
 	} else if resp.StatusCode == 400 {
 		// Inventory might already exist, try to get it
-		return c.GetInventoryID(name)
+		return c.GetInventoryID(ctx, name)
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return 0, fmt.Errorf("failed to create inventory: HTTP %d, body: %s", resp.StatusCode, string(body))
+	return 0, fmt.Errorf("failed to create inventory: %w", newAPIError(resp))
 }
 
-// GetHostID retrieves host ID by name in inventory
-func (c *Client) GetHostID(invID int, hostName string) (int, error) {
-	urlStr := fmt.Sprintf("%s/api/v2/inventories/%d/hosts/?name=%s", c.baseURL, invID, url.QueryEscape(hostName))
-	req, err := http.NewRequest("GET", urlStr, nil)
+// CreateOrUpdateSmartInventory creates a smart inventory, or updates the host
+// filter and description of an existing one, and returns its ID
+func (c *Client) CreateOrUpdateSmartInventory(ctx context.Context, name, description string, orgID int, hostFilter string) (int, error) {
+	inv, err := c.GetInventory(ctx, name)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	if inv == nil {
+		return c.saveObject(ctx, "POST", c.apiURL()+"/inventories/", map[string]interface{}{
+			"name":         name,
+			"description":  description,
+			"organization": orgID,
+			"kind":         InventoryKindSmart,
+			"host_filter":  hostFilter,
+		}, "smart inventory")
+	}
+	if inv.Kind != InventoryKindSmart {
+		return 0, fmt.Errorf("inventory '%s' exists and is not a smart inventory", name)
+	}
+	if inv.HostFilter == hostFilter && inv.Description == description {
+		return inv.ID, nil
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	return c.saveObject(ctx, "PATCH", fmt.Sprintf("%s/inventories/%d/", c.apiURL(), inv.ID), map[string]interface{}{
+		"description": description,
+		"host_filter": hostFilter,
+	}, "smart inventory")
+}
 
-	resp, err := c.client.Do(req)
+// CreateOrUpdateConstructedInventory creates a constructed inventory, or
+// updates the source variables and description of an existing one, and
+// returns its ID. Constructed inventories need AWX 22 or AAP 2.4.
+func (c *Client) CreateOrUpdateConstructedInventory(ctx context.Context, name, description string, orgID int, sourceVars map[string]interface{}) (int, error) {
+	varsJSON, err := json.Marshal(sourceVars)
 	if err != nil {
 		return 0, err
 	}
+	inv, err := c.GetInventory(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	if inv == nil {
+		return c.saveObject(ctx, "POST", c.apiURL()+"/constructed_inventories/", map[string]interface{}{
+			"name":         name,
+			"description":  description,
+			"organization": orgID,
+			"source_vars":  string(varsJSON),
+		}, "constructed inventory")
+	}
+	if inv.Kind != InventoryKindConstructed {
+		return 0, fmt.Errorf("inventory '%s' exists and is not a constructed inventory", name)
+	}
+	return c.saveObject(ctx, "PATCH", fmt.Sprintf("%s/constructed_inventories/%d/", c.apiURL(), inv.ID), map[string]interface{}{
+		"description": description,
+		"source_vars": string(varsJSON),
+	}, "constructed inventory")
+}
+
+// AddInputInventory adds an inventory to the input inventories of a
+// constructed inventory. Adding an existing input is a no-op in AWX.
+func (c *Client) AddInputInventory(ctx context.Context, constructedID, invID int) error {
+	jsonData, err := json.Marshal(map[string]int{"id": invID})
+	if err != nil {
+		return err
+	}
+
+	urlStr := fmt.Sprintf("%s/constructed_inventories/%d/input_inventories/", c.apiURL(), constructedID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return 0, nil
+	if resp.StatusCode == 201 || resp.StatusCode == 204 {
+		return nil
 	}
+	return fmt.Errorf("failed to add input inventory: %w", newAPIError(resp))
+}
 
-	var result struct {
-		Results []struct {
-			ID int `json:"id"`
-		} `json:"results"`
+// saveObject POSTs or PATCHes payload to urlStr and returns the ID of the
+// created or updated object
+func (c *Client) saveObject(ctx context.Context, method, urlStr string, payload map[string]interface{}, object string) (int, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
 		return 0, err
 	}
+	defer resp.Body.Close()
 
-	if len(result.Results) == 0 {
-		return 0, nil
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return 0, fmt.Errorf("failed to save %s: %w", object, newAPIError(resp))
+	}
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
 	}
+	return result.ID, nil
+}
 
-	return result.Results[0].ID, nil
+// GetInventory retrieves an inventory by name, returning nil if it does not exist
+func (c *Client) GetInventory(ctx context.Context, name string) (*Inventory, error) {
+	var inventory *Inventory
+	err := forEach(ctx, c, c.apiURL()+"/inventories/?name="+url.QueryEscape(name), func(inv Inventory) error {
+		inventory = &inv
+		return errStopPaging
+	})
+	if errors.Is(err, errStopPaging) {
+		err = nil
+	}
+	return inventory, err
 }
 
-// GetOrCreateGroup gets or creates a group in inventory
-func (c *Client) GetOrCreateGroup(invID int, groupName string) (int, error) {
-	// Try to get existing group
-	urlStr := fmt.Sprintf("%s/api/v2/inventories/%d/groups/?name=%s", c.baseURL, invID, url.QueryEscape(groupName))
-	req, err := http.NewRequest("GET", urlStr, nil)
+// UpdateInventory renames an inventory and replaces its description
+func (c *Client) UpdateInventory(ctx context.Context, invID int, name, description string) error {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name":        name,
+		"description": description,
+	})
 	if err != nil {
-		return 0, err
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	resp, err := c.client.Do(req)
+	urlStr := fmt.Sprintf("%s/inventories/%d/", c.apiURL(), invID)
+	req, err := http.NewRequestWithContext(ctx, "PATCH", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return 0, err
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 200 {
-		var result struct {
-			Results []struct {
-				ID int `json:"id"`
-			} `json:"results"`
-		}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to update inventory: %w", newAPIError(resp))
+	}
+	c.namedInventories.Delete(invID)
 
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			return 0, err
-		}
+	return nil
+}
+
+// GetHostID retrieves host ID by name in inventory
+func (c *Client) GetHostID(ctx context.Context, invID int, hostName string) (int, error) {
+	urlStr := fmt.Sprintf("%s/inventories/%d/hosts/?name=%s", c.apiURL(), invID, url.QueryEscape(hostName))
+	id, err := c.findID(ctx, urlStr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get host: %w", err)
+	}
+	return id, nil
+}
 
-		if len(result.Results) > 0 {
-			return result.Results[0].ID, nil
+// GetHost retrieves a host by name in inventory, returning nil if it does not exist
+func (c *Client) GetHost(ctx context.Context, invID int, hostName string) (*Host, error) {
+	named := c.hostNamedURL(ctx, invID, hostName)
+	if named != "" {
+		host, err := c.getHost(ctx, named)
+		if err != nil || host != nil {
+			return host, err
 		}
 	}
 
+	var host *Host
+	urlStr := fmt.Sprintf("%s/inventories/%d/hosts/?name=%s", c.apiURL(), invID, url.QueryEscape(hostName))
+	err := forEach(ctx, c, urlStr, func(h Host) error {
+		host = &h
+		return errStopPaging
+	})
+	if errors.Is(err, errStopPaging) {
+		err = nil
+	}
+	if host != nil && named != "" {
+		c.staleNamedURL(invID, hostName)
+	}
+	return host, err
+}
+
+// GetOrCreateGroup gets or creates a group in inventory, setting the
+// description of new groups
+func (c *Client) GetOrCreateGroup(ctx context.Context, invID int, groupName, description string) (int, error) {
+	// Try to get existing group
+	urlStr := fmt.Sprintf("%s/inventories/%d/groups/?name=%s", c.apiURL(), invID, url.QueryEscape(groupName))
+	groupID, err := c.findID(ctx, urlStr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get group: %w", err)
+	}
+	if groupID > 0 {
+		return groupID, nil
+	}
+
 	// Create group
 	payload := map[string]interface{}{
-		"name": groupName,
+		"name":        groupName,
+		"description": description,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -249,15 +577,14 @@ func (c *Client) GetOrCreateGroup(invID int, groupName string) (int, error) {
 		return 0, err
 	}
 
-	urlStr = fmt.Sprintf("%s/api/v2/inventories/%d/groups/", c.baseURL, invID)
-	req, err = http.NewRequest("POST", urlStr, bytes.NewBuffer(jsonData))
+	urlStr = fmt.Sprintf("%s/inventories/%d/groups/", c.apiURL(), invID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err = c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -273,43 +600,27 @@ func (c *Client) GetOrCreateGroup(invID int, groupName string) (int, error) {
 		return result.ID, nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return 0, fmt.Errorf("failed to create group: HTTP %d, body: %s", resp.StatusCode, string(body))
+	return 0, fmt.Errorf("failed to create group: %w", newAPIError(resp))
 }
 
 // AddHostToGroup adds a host to a group
-func (c *Client) AddHostToGroup(groupID, hostID int) error {
+func (c *Client) AddHostToGroup(ctx context.Context, groupID, hostID int) error {
 	// Check if host is already in group
-	urlStr := fmt.Sprintf("%s/api/v2/groups/%d/hosts/", c.baseURL, groupID)
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 200 {
-		var result struct {
-			Results []struct {
-				ID int `json:"id"`
-			} `json:"results"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			return err
-		}
-
-		for _, host := range result.Results {
-			if host.ID == hostID {
-				// Host already in group
-				return nil
-			}
+	urlStr := fmt.Sprintf("%s/groups/%d/hosts/", c.apiURL(), groupID)
+	member := false
+	err := forEach(ctx, c, urlStr+"?page_size=200", func(h Host) error {
+		if h.ID == hostID {
+			member = true
+			return errStopPaging
 		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopPaging) {
+		return fmt.Errorf("failed to list group hosts: %w", err)
+	}
+	if member {
+		// Host already in group
+		return nil
 	}
 
 	// Add host to group
@@ -322,14 +633,13 @@ func (c *Client) AddHostToGroup(groupID, hostID int) error {
 		return err
 	}
 
-	req, err = http.NewRequest("POST", urlStr, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err = c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -342,111 +652,944 @@ func (c *Client) AddHostToGroup(groupID, hostID int) error {
 		return nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return fmt.Errorf("failed to add host to group: HTTP %d, body: %s", resp.StatusCode, string(body))
+	return fmt.Errorf("failed to add host to group: %w", newAPIError(resp))
 }
 
-// CreateOrUpdateHost creates or updates a host in inventory
-func (c *Client) CreateOrUpdateHost(invID int, hostName string, hostVars map[string]interface{}) error {
-	hostID, _ := c.GetHostID(invID, hostName)
+// AddGroupToGroup makes a group a child of another group. Adding an existing
+// child is a no-op in AWX.
+func (c *Client) AddGroupToGroup(ctx context.Context, parentID, childID int) error {
+	jsonData, err := json.Marshal(map[string]int{"id": childID})
+	if err != nil {
+		return err
+	}
 
-	// Convert hostVars to JSON string
-	varsJSON, err := json.Marshal(hostVars)
+	urlStr := fmt.Sprintf("%s/groups/%d/children/", c.apiURL(), parentID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	if hostID > 0 {
-		// Update existing host
-		payload := map[string]interface{}{
-			"name":      hostName,
-			"variables": string(varsJSON),
-		}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			return err
-		}
+	if resp.StatusCode == 201 || resp.StatusCode == 204 {
+		return nil
+	}
+	return fmt.Errorf("failed to add child group: %w", newAPIError(resp))
+}
 
-		urlStr := fmt.Sprintf("%s/api/v2/hosts/%d/", c.baseURL, hostID)
-		req, err := http.NewRequest("PATCH", urlStr, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Authorization", "Bearer "+c.token)
-		req.Header.Set("Content-Type", "application/json")
+// CreateOrUpdateHost creates or updates a host in inventory, sets its
+// enabled flag and description, and returns its ID. Existing hosts are
+// updated through their named URL, without looking up their ID first.
+func (c *Client) CreateOrUpdateHost(ctx context.Context, invID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) (int, error) {
+	payload, err := hostPayload(hostName, hostVars, enabled, description)
+	if err != nil {
+		return 0, err
+	}
 
-		resp, err := c.client.Do(req)
-		if err != nil {
-			return err
+	named := c.hostNamedURL(ctx, invID, hostName)
+	if named != "" {
+		hostID, err := c.patchHost(ctx, named, payload)
+		if !IsNotFound(err) {
+			return hostID, err
 		}
-		defer resp.Body.Close()
+	}
 
-		if resp.StatusCode != 200 {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("failed to update host: HTTP %d, body: %s", resp.StatusCode, string(body))
+	hostID, err := c.GetHostID(ctx, invID, hostName)
+	if err != nil {
+		return 0, err
+	}
+	if hostID > 0 {
+		if named != "" {
+			c.staleNamedURL(invID, hostName)
 		}
-
-		return nil
+		_, err := c.patchHost(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID), payload)
+		return hostID, err
 	}
 
 	// Create new host
-	payload := map[string]interface{}{
-		"name":      hostName,
-		"inventory": invID,
-		"variables": string(varsJSON),
-	}
-
+	payload["inventory"] = invID
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	urlStr := fmt.Sprintf("%s/api/v2/inventories/%d/hosts/", c.baseURL, invID)
-	req, err := http.NewRequest("POST", urlStr, bytes.NewBuffer(jsonData))
+	urlStr := fmt.Sprintf("%s/inventories/%d/hosts/", c.apiURL(), invID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err
+		return 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create host: HTTP %d, body: %s", resp.StatusCode, string(body))
+		return 0, fmt.Errorf("failed to create host: %w", newAPIError(resp))
 	}
 
-	return nil
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
 }
 
-// DeleteHost deletes a host from inventory
-func (c *Client) DeleteHost(invID int, hostName string) error {
-	hostID, err := c.GetHostID(invID, hostName)
-	if err != nil || hostID == 0 {
-		return nil // Host not found, nothing to delete
+// UpdateHost updates a host by ID. It returns a NotFound error if the host
+// was deleted in AWX.
+func (c *Client) UpdateHost(ctx context.Context, hostID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) error {
+	payload, err := hostPayload(hostName, hostVars, enabled, description)
+	if err != nil {
+		return err
 	}
+	_, err = c.patchHost(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID), payload)
+	return err
+}
 
-	urlStr := fmt.Sprintf("%s/api/v2/hosts/%d/", c.baseURL, hostID)
-	req, err := http.NewRequest("DELETE", urlStr, nil)
+// hostPayload returns the fields of a host set by the controller
+func hostPayload(hostName string, hostVars map[string]interface{}, enabled bool, description string) (map[string]interface{}, error) {
+	// AWX takes variables as a JSON or YAML string
+	varsJSON, err := json.Marshal(hostVars)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	return map[string]interface{}{
+		"name":        hostName,
+		"description": description,
+		"variables":   string(varsJSON),
+		"enabled":     enabled,
+	}, nil
+}
 
-	resp, err := c.client.Do(req)
+// patchHost PATCHes the host at urlStr and returns its ID
+func (c *Client) patchHost(ctx context.Context, urlStr string, payload map[string]interface{}) (int, error) {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 204 && resp.StatusCode != 404 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to delete host: HTTP %d, body: %s", resp.StatusCode, string(body))
+	req, err := http.NewRequestWithContext(ctx, "PATCH", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("failed to update host: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// GetHostByID retrieves a host by ID, returning nil if it does not exist
+func (c *Client) GetHostByID(ctx context.Context, hostID int) (*Host, error) {
+	return c.getHost(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID))
+}
+
+// getHost retrieves the host at urlStr, returning nil if it does not exist
+func (c *Client) getHost(ctx context.Context, urlStr string) (*Host, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to get host: %w", newAPIError(resp))
+	}
+
+	var host Host
+	if err := json.NewDecoder(resp.Body).Decode(&host); err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+// DeleteHostByID deletes a host by ID
+func (c *Client) DeleteHostByID(ctx context.Context, hostID int) error {
+	return c.deleteObject(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID), "host")
+}
+
+// DeleteHost deletes a host from inventory, through its named URL if AWX
+// supports them
+func (c *Client) DeleteHost(ctx context.Context, invID int, hostName string) error {
+	named := c.hostNamedURL(ctx, invID, hostName)
+	if named != "" {
+		found, err := c.deleteHost(ctx, named)
+		if err != nil || found {
+			return err
+		}
+	}
+
+	hostID, err := c.GetHostID(ctx, invID, hostName)
+	if err != nil || hostID == 0 {
+		return err // Host not found, nothing to delete
+	}
+	if named != "" {
+		c.staleNamedURL(invID, hostName)
+	}
+	_, err = c.deleteHost(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID))
+	return err
+}
+
+// deleteHost deletes the host at urlStr, reporting whether it was found
+func (c *Client) deleteHost(ctx context.Context, urlStr string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", urlStr, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 404 {
+		return false, fmt.Errorf("failed to delete host: %w", newAPIError(resp))
+	}
+
+	return resp.StatusCode != 404, nil
+}
+
+// DeleteGroup deletes a group. Its hosts stay in the inventory.
+func (c *Client) DeleteGroup(ctx context.Context, groupID int) error {
+	return c.deleteObject(ctx, fmt.Sprintf("%s/groups/%d/", c.apiURL(), groupID), "group")
+}
+
+// DeleteInventory deletes an inventory with all its hosts and groups. AWX
+// finishes the deletion in the background.
+func (c *Client) DeleteInventory(ctx context.Context, invID int) error {
+	c.namedInventories.Delete(invID)
+	return c.deleteObject(ctx, fmt.Sprintf("%s/inventories/%d/", c.apiURL(), invID), "inventory")
+}
+
+// deleteObject sends a DELETE to urlStr, treating a missing object as deleted
+func (c *Client) deleteObject(ctx context.Context, urlStr, kind string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", urlStr, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 202 && resp.StatusCode != 204 && resp.StatusCode != 404 {
+		return fmt.Errorf("failed to delete %s: %w", kind, newAPIError(resp))
+	}
+
+	return nil
+}
+
+// GetJobTemplateID retrieves job template ID by name
+func (c *Client) GetJobTemplateID(ctx context.Context, name string) (int, error) {
+	id, err := c.findID(ctx, c.apiURL()+"/job_templates/?name="+url.QueryEscape(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get job template: %w", err)
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("job template '%s' not found", name)
+	}
+	return id, nil
+}
+
+// LaunchJobTemplate launches a job template and returns the job ID. invID
+// overrides the inventory of the template if it is not 0, which needs
+// "Prompt on launch" for the inventory.
+func (c *Client) LaunchJobTemplate(ctx context.Context, templateID, invID int, limit string, extraVars map[string]interface{}) (int, error) {
+	payload := map[string]interface{}{}
+	if invID != 0 {
+		payload["inventory"] = invID
+	}
+	if limit != "" {
+		payload["limit"] = limit
+	}
+	if len(extraVars) > 0 {
+		payload["extra_vars"] = extraVars
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	urlStr := fmt.Sprintf("%s/job_templates/%d/launch/", c.apiURL(), templateID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return 0, fmt.Errorf("failed to launch job template: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		ID  int `json:"id"`
+		Job int `json:"job"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+
+	if result.Job != 0 {
+		return result.Job, nil
+	}
+	return result.ID, nil
+}
+
+// Job represents the state of an AWX job
+type Job struct {
+	ID       int       `json:"id"`
+	Status   string    `json:"status"`
+	Failed   bool      `json:"failed"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// IsFinished reports whether the job reached a terminal state
+func (j *Job) IsFinished() bool {
+	switch j.Status {
+	case "successful", "failed", "error", "canceled":
+		return true
+	}
+	return false
+}
+
+// GetJob retrieves a job by ID
+func (c *Client) GetJob(ctx context.Context, jobID int) (*Job, error) {
+	urlStr := fmt.Sprintf("%s/jobs/%d/", c.apiURL(), jobID)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to get job: %w", newAPIError(resp))
+	}
+
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// LaunchAdHocCommand runs module against the hosts of an inventory matching
+// limit, with the given Machine credential, and returns the command ID
+func (c *Client) LaunchAdHocCommand(ctx context.Context, invID, credentialID int, limit, module, args string) (int, error) {
+	payload := map[string]interface{}{
+		"inventory":   invID,
+		"credential":  credentialID,
+		"limit":       limit,
+		"module_name": module,
+		"module_args": args,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL()+"/ad_hoc_commands/", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return 0, fmt.Errorf("failed to launch ad hoc command: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// GetAdHocCommand retrieves an ad hoc command by ID, which reports its state
+// like a job
+func (c *Client) GetAdHocCommand(ctx context.Context, commandID int) (*Job, error) {
+	urlStr := fmt.Sprintf("%s/ad_hoc_commands/%d/", c.apiURL(), commandID)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to get ad hoc command: %w", newAPIError(resp))
+	}
+
+	var command Job
+	if err := json.NewDecoder(resp.Body).Decode(&command); err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// JobURL returns the AWX UI URL of a job
+func (c *Client) JobURL(jobID int) string {
+	if c.Platform().Name == PlatformGateway {
+		return fmt.Sprintf("%s/execution/jobs/playbook/%d/output", c.baseURL, jobID)
+	}
+	return fmt.Sprintf("%s/#/jobs/playbook/%d/output", c.baseURL, jobID)
+}
+
+// HostURL returns the AWX UI URL of a host
+func (c *Client) HostURL(invID, hostID int) string {
+	if c.Platform().Name == PlatformGateway {
+		return fmt.Sprintf("%s/execution/infrastructure/inventories/inventory/%d/hosts/%d/details", c.baseURL, invID, hostID)
+	}
+	return fmt.Sprintf("%s/#/inventories/inventory/%d/hosts/%d/details", c.baseURL, invID, hostID)
+}
+
+// Inventory represents an AWX inventory
+type Inventory struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Kind is empty for regular inventories
+	Kind       string `json:"kind"`
+	HostFilter string `json:"host_filter"`
+}
+
+// Kinds of inventories whose hosts are those of other inventories: smart
+// inventories hold the hosts of the organization matching their host
+// filter, constructed inventories those of their input inventories
+const (
+	InventoryKindSmart       = "smart"
+	InventoryKindConstructed = "constructed"
+)
+
+// Host represents an AWX host
+type Host struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Variables   string `json:"variables"`
+	Enabled     bool   `json:"enabled"`
+	Inventory   int    `json:"inventory"`
+}
+
+// Group represents an AWX group
+type Group struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Variables   string `json:"variables"`
+}
+
+// getPaged fetches urlStr and every following page, decoding results into page
+func (c *Client) getPaged(ctx context.Context, urlStr string, page func(results json.RawMessage) error) error {
+	for urlStr != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != 200 {
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+			return fmt.Errorf("failed to list %s: %w", urlStr, apiErr)
+		}
+
+		var result struct {
+			Next    string          `json:"next"`
+			Results json.RawMessage `json:"results"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := page(result.Results); err != nil {
+			return err
+		}
+
+		// next is a path relative to the AWX host
+		urlStr = ""
+		if result.Next != "" {
+			urlStr = c.baseURL + result.Next
+		}
+	}
+
+	return nil
+}
+
+// ForEachInventory streams all inventories of an organization page by page
+func (c *Client) ForEachInventory(ctx context.Context, orgID int, fn func(Inventory) error) error {
+	urlStr := fmt.Sprintf("%s/inventories/?organization=%d&page_size=200", c.apiURL(), orgID)
+	return forEach(ctx, c, urlStr, fn)
+}
+
+// ListHosts lists all hosts in inventory
+func (c *Client) ListHosts(ctx context.Context, invID int) ([]Host, error) {
+	var hosts []Host
+	err := c.ForEachHost(ctx, invID, func(h Host) error {
+		hosts = append(hosts, h)
+		return nil
+	})
+	return hosts, err
+}
+
+// ForEachHost streams all hosts in inventory page by page
+func (c *Client) ForEachHost(ctx context.Context, invID int, fn func(Host) error) error {
+	urlStr := fmt.Sprintf("%s/inventories/%d/hosts/?page_size=200", c.apiURL(), invID)
+	return forEach(ctx, c, urlStr, fn)
+}
+
+// ListGroups lists all groups in inventory
+func (c *Client) ListGroups(ctx context.Context, invID int) ([]Group, error) {
+	var groups []Group
+	err := c.ForEachGroup(ctx, invID, func(g Group) error {
+		groups = append(groups, g)
+		return nil
+	})
+	return groups, err
+}
+
+// ForEachGroup streams all groups in inventory page by page
+func (c *Client) ForEachGroup(ctx context.Context, invID int, fn func(Group) error) error {
+	urlStr := fmt.Sprintf("%s/inventories/%d/groups/?page_size=200", c.apiURL(), invID)
+	return forEach(ctx, c, urlStr, fn)
+}
+
+// ListGroupHosts lists all hosts that are direct members of a group
+func (c *Client) ListGroupHosts(ctx context.Context, groupID int) ([]Host, error) {
+	var hosts []Host
+	urlStr := fmt.Sprintf("%s/groups/%d/hosts/?page_size=200", c.apiURL(), groupID)
+	err := forEach(ctx, c, urlStr, func(h Host) error {
+		hosts = append(hosts, h)
+		return nil
+	})
+	return hosts, err
+}
+
+// ListGroupChildren lists the direct child groups of a group
+func (c *Client) ListGroupChildren(ctx context.Context, groupID int) ([]Group, error) {
+	var groups []Group
+	urlStr := fmt.Sprintf("%s/groups/%d/children/?page_size=200", c.apiURL(), groupID)
+	err := forEach(ctx, c, urlStr, func(g Group) error {
+		groups = append(groups, g)
+		return nil
+	})
+	return groups, err
+}
+
+// errStopPaging ends a forEach early without reporting an error
+var errStopPaging = errors.New("stop paging")
+
+// findID returns the ID of the first object listed at urlStr, or 0 if there is none
+func (c *Client) findID(ctx context.Context, urlStr string) (int, error) {
+	var id int
+	err := forEach(ctx, c, urlStr, func(obj struct {
+		ID int `json:"id"`
+	}) error {
+		id = obj.ID
+		return errStopPaging
+	})
+	if errors.Is(err, errStopPaging) {
+		err = nil
+	}
+	return id, err
+}
+
+// forEach decodes every item of every page at urlStr and passes it to fn
+func forEach[T any](ctx context.Context, c *Client, urlStr string, fn func(T) error) error {
+	return c.getPaged(ctx, urlStr, func(results json.RawMessage) error {
+		var page []T
+		if err := json.Unmarshal(results, &page); err != nil {
+			return err
+		}
+		for _, item := range page {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetInventoryVariables retrieves the variables of an inventory
+func (c *Client) GetInventoryVariables(ctx context.Context, invID int) (string, error) {
+	urlStr := fmt.Sprintf("%s/inventories/%d/", c.apiURL(), invID)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("failed to get inventory: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		Variables string `json:"variables"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.Variables, nil
+}
+
+// SetInventoryVariables replaces the variables of an inventory
+func (c *Client) SetInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error {
+	urlStr := fmt.Sprintf("%s/inventories/%d/", c.apiURL(), invID)
+	return c.patchVariables(ctx, urlStr, vars, "inventory")
+}
+
+// SetGroupVariables replaces the variables of a group
+func (c *Client) SetGroupVariables(ctx context.Context, groupID int, vars map[string]interface{}) error {
+	urlStr := fmt.Sprintf("%s/groups/%d/", c.apiURL(), groupID)
+	return c.patchVariables(ctx, urlStr, vars, "group")
+}
+
+// patchVariables PATCHes the variables field of the object at urlStr
+func (c *Client) patchVariables(ctx context.Context, urlStr string, vars map[string]interface{}, kind string) error {
+	varsJSON, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"variables": string(varsJSON),
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to update %s variables: %w", kind, newAPIError(resp))
+	}
+
+	return nil
+}
+
+// ListHostGroups lists the groups a host is a direct member of
+func (c *Client) ListHostGroups(ctx context.Context, hostID int) ([]Group, error) {
+	var groups []Group
+	urlStr := fmt.Sprintf("%s/hosts/%d/groups/?page_size=200", c.apiURL(), hostID)
+	err := forEach(ctx, c, urlStr, func(g Group) error {
+		groups = append(groups, g)
+		return nil
+	})
+	return groups, err
+}
+
+// DisassociateHostFromGroup removes a host from a group without deleting it
+func (c *Client) DisassociateHostFromGroup(ctx context.Context, groupID, hostID int) error {
+	payload := map[string]interface{}{
+		"id":           hostID,
+		"disassociate": true,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	urlStr := fmt.Sprintf("%s/groups/%d/hosts/", c.apiURL(), groupID)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		return fmt.Errorf("failed to remove host from group: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// DeleteCredential deletes a credential
+func (c *Client) DeleteCredential(ctx context.Context, credentialID int) error {
+	return c.deleteObject(ctx, fmt.Sprintf("%s/credentials/%d/", c.apiURL(), credentialID), "credential")
+}
+
+// ListJobTemplateIDs lists the IDs of the job templates using an inventory
+func (c *Client) ListJobTemplateIDs(ctx context.Context, invID int) ([]int, error) {
+	var ids []int
+	urlStr := fmt.Sprintf("%s/job_templates/?inventory=%d&page_size=200", c.apiURL(), invID)
+	err := forEach(ctx, c, urlStr, func(obj struct {
+		ID int `json:"id"`
+	}) error {
+		ids = append(ids, obj.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job templates: %w", err)
+	}
+	return ids, nil
+}
+
+// AttachJobTemplateCredential adds a credential to a job template unless it
+// already has it. AWX refuses a second credential of the same type.
+func (c *Client) AttachJobTemplateCredential(ctx context.Context, templateID, credentialID int) error {
+	urlStr := fmt.Sprintf("%s/job_templates/%d/credentials/", c.apiURL(), templateID)
+	attached := false
+	err := forEach(ctx, c, urlStr+"?page_size=200", func(obj struct {
+		ID int `json:"id"`
+	}) error {
+		if obj.ID == credentialID {
+			attached = true
+			return errStopPaging
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopPaging) {
+		return fmt.Errorf("failed to list job template credentials: %w", err)
+	}
+	if attached {
+		return nil
+	}
+
+	jsonData, err := json.Marshal(map[string]int{"id": credentialID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		return fmt.Errorf("failed to attach credential to job template: %w", newAPIError(resp))
+	}
+	return nil
+}
+
+// GetMachineCredentialTypeID retrieves the ID of the built-in Machine credential type
+func (c *Client) GetMachineCredentialTypeID(ctx context.Context) (int, error) {
+	id, err := c.findID(ctx, c.apiURL()+"/credential_types/?kind=ssh&managed=true")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get credential types: %w", err)
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("machine credential type not found")
+	}
+	return id, nil
+}
+
+// GetCredentialID retrieves credential ID by name in organization
+func (c *Client) GetCredentialID(ctx context.Context, name string, orgID int) (int, error) {
+	id, err := c.findID(ctx, fmt.Sprintf("%s/credentials/?name=%s&organization=%d", c.apiURL(), url.QueryEscape(name), orgID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get credential: %w", err)
+	}
+	return id, nil
+}
+
+// CreateOrUpdateMachineCredential creates or updates a Machine credential and returns its ID
+func (c *Client) CreateOrUpdateMachineCredential(ctx context.Context, name, description string, orgID int, username, privateKey string) (int, error) {
+	credID, err := c.GetCredentialID(ctx, name, orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	inputs := map[string]interface{}{
+		"username":     username,
+		"ssh_key_data": privateKey,
+	}
+
+	var method, urlStr string
+	payload := map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"inputs":      inputs,
+	}
+	if credID > 0 {
+		method = "PATCH"
+		urlStr = fmt.Sprintf("%s/credentials/%d/", c.apiURL(), credID)
+	} else {
+		typeID, err := c.GetMachineCredentialTypeID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		method = "POST"
+		urlStr = c.apiURL() + "/credentials/"
+		payload["organization"] = orgID
+		payload["credential_type"] = typeID
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return 0, fmt.Errorf("failed to save credential: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+
+	return result.ID, nil
+}
+
+// UpdateHostEnabled enables or disables a host by name, doing nothing if the
+// host is not in the inventory
+func (c *Client) UpdateHostEnabled(ctx context.Context, invID int, hostName string, enabled bool) error {
+	named := c.hostNamedURL(ctx, invID, hostName)
+	if named != "" {
+		err := c.setHostEnabled(ctx, named, enabled)
+		if !IsNotFound(err) {
+			return err
+		}
+	}
+
+	hostID, err := c.GetHostID(ctx, invID, hostName)
+	if err != nil || hostID == 0 {
+		return err
+	}
+	if named != "" {
+		c.staleNamedURL(invID, hostName)
+	}
+	return c.SetHostEnabled(ctx, hostID, enabled)
+}
+
+// SetHostEnabled enables or disables a host
+func (c *Client) SetHostEnabled(ctx context.Context, hostID int, enabled bool) error {
+	return c.setHostEnabled(ctx, fmt.Sprintf("%s/hosts/%d/", c.apiURL(), hostID), enabled)
+}
+
+// setHostEnabled enables or disables the host at urlStr
+func (c *Client) setHostEnabled(ctx context.Context, urlStr string, enabled bool) error {
+	jsonData, err := json.Marshal(map[string]interface{}{"enabled": enabled})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", urlStr, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to update host: %w", newAPIError(resp))
 	}
 
 	return nil
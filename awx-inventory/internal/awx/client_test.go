@@ -0,0 +1,294 @@
+package awx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx/awxtest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newInventory starts a fake AWX with an inventory named vms in the
+// organization Default and returns its ID
+func newInventory(t *testing.T) (*awxtest.Server, *awx.Client, int) {
+	t.Helper()
+	srv := awxtest.NewServer("Default")
+	t.Cleanup(srv.Close)
+	client := srv.Client()
+
+	ctx := context.Background()
+	orgID, err := client.GetOrganizationID(ctx, "Default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invID, err := client.CreateInventory(ctx, "vms", "", orgID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client, invID
+}
+
+func bulkHosts(n int) []awx.BulkHost {
+	hosts := make([]awx.BulkHost, n)
+	for i := range hosts {
+		hosts[i] = awx.BulkHost{
+			Name:      fmt.Sprintf("vm-%03d", i),
+			Variables: map[string]interface{}{"ansible_host": fmt.Sprintf("10.0.%d.%d", i/256, i%256)},
+		}
+	}
+	return hosts
+}
+
+func TestBulkCreateHostsInBatches(t *testing.T) {
+	srv, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	var batches []int
+	err := client.BulkCreateHosts(ctx, invID, bulkHosts(250), func(created []awx.BulkHost) {
+		batches = append(batches, len(created))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(batches) != "[100 100 50]" {
+		t.Errorf("created batches of %v hosts, want [100 100 50]", batches)
+	}
+	if n := srv.Requests("POST /api/v2/bulk/host_create/"); n != 3 {
+		t.Errorf("sent %d bulk requests, want 3", n)
+	}
+	host, err := client.GetHost(ctx, invID, "vm-249")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host == nil || host.Variables != `{"ansible_host":"10.0.0.249"}` {
+		t.Errorf("unexpected host %+v", host)
+	}
+}
+
+func TestBulkCreateHostsRejectsExisting(t *testing.T) {
+	_, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	if err := client.BulkCreateHosts(ctx, invID, bulkHosts(1), func([]awx.BulkHost) {}); err != nil {
+		t.Fatal(err)
+	}
+	err := client.BulkCreateHosts(ctx, invID, bulkHosts(1), func([]awx.BulkHost) {
+		t.Error("fn called for a rejected batch")
+	})
+
+	var apiErr *awx.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an *awx.APIError", err)
+	}
+	if apiErr.StatusCode != 400 || len(apiErr.Fields["__all__"]) != 1 {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestSupportsBulkHostCreate(t *testing.T) {
+	_, client, _ := newInventory(t)
+
+	supported, err := client.SupportsBulkHostCreate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !supported {
+		t.Error("bulk host creation not detected")
+	}
+}
+
+func TestListHostsFollowsPages(t *testing.T) {
+	srv, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	if err := client.BulkCreateHosts(ctx, invID, bulkHosts(450), func([]awx.BulkHost) {}); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := client.ListHosts(ctx, invID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hosts) != 450 {
+		t.Fatalf("listed %d hosts, want 450", len(hosts))
+	}
+	seen := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		seen[h.Name] = true
+	}
+	if len(seen) != 450 {
+		t.Errorf("listed %d distinct hosts, want 450", len(seen))
+	}
+	// 200 hosts per page
+	if n := srv.Requests("GET /api/v2/inventories/{id}/hosts/"); n != 3 {
+		t.Errorf("read %d pages, want 3", n)
+	}
+}
+
+func TestGetHostUsesNamedURL(t *testing.T) {
+	srv, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	if _, err := client.CreateOrUpdateHost(ctx, invID, "web-1", map[string]interface{}{"ansible_host": "10.0.0.1"}, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	named := srv.Requests("GET /api/v2/hosts/{id}/")
+	searches := srv.Requests("GET /api/v2/inventories/{id}/hosts/")
+
+	for i := 0; i < 2; i++ {
+		host, err := client.GetHost(ctx, invID, "web-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host == nil || host.Name != "web-1" {
+			t.Fatalf("unexpected host %+v", host)
+		}
+	}
+
+	if n := srv.Requests("GET /api/v2/hosts/{id}/") - named; n != 2 {
+		t.Errorf("read the host %d times by its named URL, want 2", n)
+	}
+	if n := srv.Requests("GET /api/v2/inventories/{id}/hosts/") - searches; n != 0 {
+		t.Errorf("searched the host by name %d times, want 0", n)
+	}
+	if n := srv.Requests("GET /api/v2/inventories/{id}/"); n != 1 {
+		t.Errorf("looked up the named URL of the inventory %d times, want it cached", n)
+	}
+}
+
+func TestGetHostAfterInventoryRename(t *testing.T) {
+	_, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	if _, err := client.CreateOrUpdateHost(ctx, invID, "web-1", nil, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetHost(ctx, invID, "web-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateInventory(ctx, invID, "vms-renamed", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := client.GetHost(ctx, invID, "web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host == nil {
+		t.Fatal("host not found after its inventory was renamed")
+	}
+}
+
+func TestGetHostMissing(t *testing.T) {
+	_, client, invID := newInventory(t)
+
+	host, err := client.GetHost(context.Background(), invID, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != nil {
+		t.Errorf("got %+v for a missing host", host)
+	}
+}
+
+func TestCreateOrUpdateHostUpdatesExisting(t *testing.T) {
+	srv, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	first, err := client.CreateOrUpdateHost(ctx, invID, "web-1", map[string]interface{}{"ansible_host": "10.0.0.1"}, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.CreateOrUpdateHost(ctx, invID, "web-1", map[string]interface{}{"ansible_host": "10.0.0.2"}, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Errorf("got host %d, then %d", first, second)
+	}
+	if hosts := srv.HostNames("vms"); len(hosts) != 1 {
+		t.Errorf("got hosts %v, want one", hosts)
+	}
+	host, err := client.GetHostByID(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Variables != `{"ansible_host":"10.0.0.2"}` {
+		t.Errorf("variables: got %s", host.Variables)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv, client, invID := newInventory(t)
+	ctx := context.Background()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		err := awx.NewClient(srv.URL, "wrong").Ping(ctx)
+		if !errors.Is(err, awx.ErrUnauthorized) {
+			t.Errorf("got %v, want ErrUnauthorized", err)
+		}
+	})
+	t.Run("unknown organization", func(t *testing.T) {
+		_, err := client.GetOrganizationID(ctx, "missing")
+		if !errors.Is(err, awx.ErrOrganizationNotFound) {
+			t.Errorf("got %v, want ErrOrganizationNotFound", err)
+		}
+	})
+	t.Run("missing host", func(t *testing.T) {
+		err := client.UpdateHost(ctx, 9999, "web-1", nil, true, "")
+		if !awx.IsNotFound(err) {
+			t.Errorf("got %v, want a 404 error", err)
+		}
+	})
+	t.Run("missing inventory", func(t *testing.T) {
+		_, err := client.CreateOrUpdateHost(ctx, invID+9999, "web-1", nil, true, "")
+		if !awx.IsNotFound(err) {
+			t.Errorf("got %v, want a 404 error", err)
+		}
+	})
+	t.Run("existing inventory", func(t *testing.T) {
+		id, err := client.CreateInventory(ctx, "vms", "", 0)
+		if err != nil || id != invID {
+			t.Errorf("got %d, %v, want the existing inventory %d", id, err, invID)
+		}
+	})
+}
+
+// TestHostLookupErrors checks that a failed host lookup is not mistaken for
+// a missing host
+func TestHostLookupErrors(t *testing.T) {
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	client := awx.NewClient(srv.URL, awxtest.Token)
+	ctx := context.Background()
+
+	if err := client.DeleteHost(ctx, 1, "web-1"); err == nil {
+		t.Error("DeleteHost succeeded although the host lookup failed")
+	}
+	if _, err := client.CreateOrUpdateHost(ctx, 1, "web-1", nil, true, ""); err == nil {
+		t.Error("CreateOrUpdateHost succeeded although the host lookup failed")
+	}
+	if posts != 0 {
+		t.Errorf("created the host after a failed lookup")
+	}
+}
@@ -0,0 +1,119 @@
+package awx
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cache"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// maxCachedResponse bounds the body of a cached response
+const maxCachedResponse = 1 << 20
+
+// cachedResponse is a GET response kept to revalidate with a conditional request
+type cachedResponse struct {
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// SetResponseCache keeps up to size GET responses of organizations,
+// inventories and groups, and revalidates them with If-None-Match and
+// If-Modified-Since. AWX answers 304 Not Modified without a body for
+// unchanged objects. 0 disables the cache.
+func (c *Client) SetResponseCache(size int) {
+	if size <= 0 {
+		c.responses = nil
+		return
+	}
+	c.responses = cache.NewLRU[string, cachedResponse]("awx_response", size)
+}
+
+// conditional reports whether the response to req is cached, which is the
+// case for GETs of read-mostly objects. Hosts change all the time and
+// are left out.
+func (c *Client) conditional(req *http.Request) bool {
+	if c.responses == nil || req.Method != http.MethodGet {
+		return false
+	}
+	path := strings.TrimPrefix(req.URL.Path, c.Platform().APIPath)
+	if strings.Contains(path, "/hosts/") {
+		return false
+	}
+	for _, prefix := range []string{"/organizations/", "/inventories/", "/groups/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// doConditional sends a GET with the validators of its cached response, if
+// any, and answers from the cache if AWX reports it unchanged
+func (c *Client) doConditional(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	cached, exists := c.responses.Get(key)
+	if exists {
+		req = req.Clone(req.Context())
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && exists:
+		resp.Body.Close()
+		metrics.AWXNotModifiedTotal.Inc()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header = cached.header.Clone()
+		resp.Body = io.NopCloser(bytes.NewReader(cached.body))
+		resp.ContentLength = int64(len(cached.body))
+		return resp, nil
+	case resp.StatusCode != http.StatusOK:
+		c.responses.Remove(key)
+		return resp, nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		c.responses.Remove(key)
+		return resp, nil
+	}
+	original := resp.Body
+	body, err := io.ReadAll(io.LimitReader(original, maxCachedResponse+1))
+	if err != nil {
+		original.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedResponse {
+		// Too large to cache, hand out what was read and the rest
+		c.responses.Remove(key)
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), original), original}
+		return resp, nil
+	}
+	original.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	c.responses.Add(key, cachedResponse{
+		etag:         etag,
+		lastModified: lastModified,
+		header:       resp.Header.Clone(),
+		body:         body,
+	})
+	return resp, nil
+}
@@ -0,0 +1,120 @@
+package awx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is returned when AWX rejects the token (HTTP 401)
+	ErrUnauthorized = errors.New("AWX rejected the credentials")
+	// ErrForbidden is returned when the token lacks permissions (HTTP 403)
+	ErrForbidden = errors.New("AWX denied access")
+	// ErrOrganizationNotFound is returned when no organization has the requested name
+	ErrOrganizationNotFound = errors.New("organization not found")
+)
+
+// maxErrorBody bounds how much of an error response is kept
+const maxErrorBody = 4096
+
+// APIError is an unexpected AWX response
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Detail is the "detail" message of the AWX error body, if any
+	Detail string
+	// Fields holds per-field validation errors, e.g. {"name": ["already exists"]}
+	Fields map[string][]string
+	// Body is the raw response body, truncated
+	Body string
+}
+
+// newAPIError reads the error body of resp
+func newAPIError(resp *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.Path,
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e.Body = string(data)
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return e
+	}
+	for name, raw := range fields {
+		var message string
+		var messages []string
+		switch {
+		case json.Unmarshal(raw, &message) == nil:
+			messages = []string{message}
+		case json.Unmarshal(raw, &messages) == nil:
+		default:
+			continue
+		}
+		if name == "detail" && len(messages) > 0 {
+			e.Detail = messages[0]
+			continue
+		}
+		if e.Fields == nil {
+			e.Fields = make(map[string][]string)
+		}
+		e.Fields[name] = messages
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("HTTP %d from %s %s", e.StatusCode, e.Method, e.URL)
+	switch {
+	case e.Detail != "":
+		return msg + ": " + e.Detail
+	case len(e.Fields) > 0:
+		names := make([]string, 0, len(e.Fields))
+		for name := range e.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var parts []string
+		for _, name := range names {
+			parts = append(parts, name+": "+strings.Join(e.Fields[name], ", "))
+		}
+		return msg + ": " + strings.Join(parts, "; ")
+	case e.Body != "":
+		return msg + ", body: " + e.Body
+	}
+	return msg
+}
+
+// Unwrap keeps errors.Is working with ErrUnauthorized and ErrForbidden
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	}
+	return nil
+}
+
+// StatusCode returns the HTTP status of an AWX API error, 0 if err is not one
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether AWX answered 404
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
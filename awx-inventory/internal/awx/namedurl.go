@@ -0,0 +1,76 @@
+package awx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// namedURLSeparator joins the names identifying an object in its named URL
+const namedURLSeparator = "++"
+
+// hostNamedURL returns the named URL of a host, e.g.
+// /api/v2/hosts/web-1++vms++Default/, which addresses it without looking up
+// its ID. It returns "" if AWX has no named URLs or the host name cannot be
+// used in one, and callers then fall back to the ID.
+func (c *Client) hostNamedURL(ctx context.Context, invID int, hostName string) string {
+	if hostName == "" || strings.ContainsAny(hostName, "+/") {
+		return ""
+	}
+	inventory := c.inventoryNamedURL(ctx, invID)
+	if inventory == "" {
+		return ""
+	}
+	return c.apiURL() + "/hosts/" + url.PathEscape(hostName) + namedURLSeparator + inventory + "/"
+}
+
+// inventoryNamedURL returns the last segment of the named URL of an
+// inventory, e.g. vms++Default, looking it up once per inventory
+func (c *Client) inventoryNamedURL(ctx context.Context, invID int) string {
+	if named, exists := c.namedInventories.Load(invID); exists {
+		return named.(string)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/inventories/%d/", c.apiURL(), invID), nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var inventory struct {
+		Related struct {
+			NamedURL string `json:"named_url"`
+		} `json:"related"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inventory); err != nil {
+		return ""
+	}
+	// AWX without named URLs leaves the link out, remember that too
+	named := ""
+	if inventory.Related.NamedURL != "" {
+		named = path.Base(strings.TrimSuffix(inventory.Related.NamedURL, "/"))
+	}
+	c.namedInventories.Store(invID, named)
+	return named
+}
+
+// staleNamedURL is called when the named URL of a host was not found but
+// its ID was, since the inventory or organization was renamed. The named
+// URL of the inventory is looked up again next time.
+func (c *Client) staleNamedURL(invID int, hostName string) {
+	if _, exists := c.namedInventories.LoadAndDelete(invID); exists {
+		log.Printf("WARN: named URL of host '%s' in inventory %d not found, looking it up again", hostName, invID)
+	}
+}
@@ -0,0 +1,105 @@
+package awx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Permissions are what the authenticated user may do with the inventories
+// of an organization
+type Permissions struct {
+	Username  string
+	Superuser bool
+	// CanCreateInventories is true if AWX offers the user to create
+	// inventories, in at least one organization
+	CanCreateInventories bool
+	// Inventories are the inventories of the organization the user can see
+	Inventories []InventoryPermission
+}
+
+// InventoryPermission tells whether the user may change an inventory and its hosts
+type InventoryPermission struct {
+	Inventory
+	Edit bool
+}
+
+// currentUser is the user of /api/v2/me/
+type currentUser struct {
+	Username  string `json:"username"`
+	Superuser bool   `json:"is_superuser"`
+}
+
+// inventoryAccess is an inventory with the capabilities of the user
+type inventoryAccess struct {
+	Inventory
+	SummaryFields struct {
+		UserCapabilities struct {
+			Edit bool `json:"edit"`
+		} `json:"user_capabilities"`
+	} `json:"summary_fields"`
+}
+
+// CheckPermissions reads the current user and what it may do with the
+// inventories of an organization. Nothing is changed in AWX: creating
+// inventories is checked with an OPTIONS request, changing them with the
+// capabilities AWX reports for each inventory.
+func (c *Client) CheckPermissions(ctx context.Context, orgID int) (*Permissions, error) {
+	var perms Permissions
+	err := forEach(ctx, c, c.apiURL()+"/me/", func(user currentUser) error {
+		perms.Username, perms.Superuser = user.Username, user.Superuser
+		return errStopPaging
+	})
+	if err != nil && !errors.Is(err, errStopPaging) {
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	perms.CanCreateInventories = perms.Superuser
+	if !perms.Superuser {
+		perms.CanCreateInventories, err = c.allows(ctx, c.apiURL()+"/inventories/", "POST")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = forEach(ctx, c, fmt.Sprintf("%s/inventories/?organization=%d", c.apiURL(), orgID), func(inv inventoryAccess) error {
+		perms.Inventories = append(perms.Inventories, InventoryPermission{
+			Inventory: inv.Inventory,
+			Edit:      perms.Superuser || inv.SummaryFields.UserCapabilities.Edit,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inventories: %w", err)
+	}
+	return &perms, nil
+}
+
+// allows reports whether the OPTIONS of urlStr offer method to the user
+func (c *Client) allows(ctx context.Context, urlStr, method string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "OPTIONS", urlStr, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to get options of %s: %w", urlStr, newAPIError(resp))
+	}
+
+	var options struct {
+		Actions map[string]json.RawMessage `json:"actions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&options); err != nil {
+		return false, err
+	}
+	_, allowed := options.Actions[method]
+	return allowed, nil
+}
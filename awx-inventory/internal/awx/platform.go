@@ -0,0 +1,98 @@
+package awx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Platforms serving the controller API
+const (
+	PlatformAWX        = "awx"
+	PlatformController = "controller"
+	PlatformGateway    = "gateway"
+)
+
+// Platform describes where the controller API of an AWX or AAP installation
+// lives. Classic AWX and the AAP 2.4 controller serve it at /api/v2/, the
+// AAP 2.5 gateway proxies it at /api/controller/v2/ and issues OAuth2 tokens
+// itself.
+type Platform struct {
+	Name string
+	// APIPath is the path of the v2 API, without a trailing slash
+	APIPath string
+	// TokenPath is the OAuth2 token endpoint
+	TokenPath string
+}
+
+// defaultPlatform is assumed until DetectPlatform succeeds
+var defaultPlatform = Platform{
+	Name:      PlatformAWX,
+	APIPath:   "/api/v2",
+	TokenPath: "/api/o/token/",
+}
+
+// Platform returns the platform found by DetectPlatform, classic AWX until then
+func (c *Client) Platform() Platform {
+	if p := c.detected.Load(); p != nil {
+		return *p
+	}
+	return defaultPlatform
+}
+
+// apiURL returns the URL of the v2 API of the detected platform
+func (c *Client) apiURL() string {
+	return c.baseURL + c.Platform().APIPath
+}
+
+// DetectPlatform reads the API root at /api/, which needs no authentication,
+// and adapts the API and token paths to the platform serving it
+func (c *Client) DetectPlatform(ctx context.Context) (Platform, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/", nil)
+	if err != nil {
+		return Platform{}, err
+	}
+	c.addHeaders(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Platform{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Platform{}, fmt.Errorf("failed to get API root: %w", newAPIError(resp))
+	}
+
+	var root struct {
+		Description    string `json:"description"`
+		CurrentVersion string `json:"current_version"`
+		// APIs lists the services behind the AAP 2.5 gateway
+		APIs map[string]string `json:"apis"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return Platform{}, fmt.Errorf("failed to decode API root: %w", err)
+	}
+
+	platform := defaultPlatform
+	switch {
+	case root.APIs["controller"] != "":
+		platform = Platform{
+			Name:      PlatformGateway,
+			APIPath:   strings.TrimSuffix(root.APIs["controller"], "/") + "/v2",
+			TokenPath: "/o/token/",
+		}
+	case root.CurrentVersion != "":
+		platform.APIPath = strings.TrimSuffix(root.CurrentVersion, "/")
+		if !strings.Contains(root.Description, "AWX") {
+			platform.Name = PlatformController
+		}
+	default:
+		return Platform{}, fmt.Errorf("unknown API root at %s/api/", c.baseURL)
+	}
+
+	c.detected.Store(&platform)
+	return platform, nil
+}
@@ -0,0 +1,135 @@
+package awx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CreateOrUpdateProject creates or updates a Git project and returns its ID.
+// credentialID 0 leaves the project without an SCM credential.
+func (c *Client) CreateOrUpdateProject(ctx context.Context, name, description string, orgID int, scmURL, scmBranch string, credentialID int) (int, error) {
+	projectID, err := c.findID(ctx, fmt.Sprintf("%s/projects/?name=%s&organization=%d", c.apiURL(), url.QueryEscape(name), orgID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"name":                 name,
+		"description":          description,
+		"organization":         orgID,
+		"scm_type":             "git",
+		"scm_url":              scmURL,
+		"scm_branch":           scmBranch,
+		"scm_update_on_launch": true,
+		"credential":           nil,
+	}
+	if credentialID > 0 {
+		payload["credential"] = credentialID
+	}
+	if projectID > 0 {
+		return c.saveObject(ctx, "PATCH", fmt.Sprintf("%s/projects/%d/", c.apiURL(), projectID), payload, "project")
+	}
+	return c.saveObject(ctx, "POST", c.apiURL()+"/projects/", payload, "project")
+}
+
+// UpdateProject starts an SCM update of a project and returns its ID
+func (c *Client) UpdateProject(ctx context.Context, projectID int) (int, error) {
+	return c.startUpdate(ctx, fmt.Sprintf("%s/projects/%d/update/", c.apiURL(), projectID), "project_update", "project update")
+}
+
+// GetProjectUpdate retrieves a project update by ID
+func (c *Client) GetProjectUpdate(ctx context.Context, updateID int) (*Job, error) {
+	return c.getUnifiedJob(ctx, fmt.Sprintf("%s/project_updates/%d/", c.apiURL(), updateID), "project update")
+}
+
+// CreateOrUpdateInventorySource creates or updates an inventory source of an
+// inventory reading sourcePath from a project, and returns its ID. The source
+// overwrites hosts and groups it no longer finds.
+func (c *Client) CreateOrUpdateInventorySource(ctx context.Context, invID int, name, description string, projectID int, sourcePath string) (int, error) {
+	sourceID, err := c.findID(ctx, fmt.Sprintf("%s/inventories/%d/inventory_sources/?name=%s", c.apiURL(), invID, url.QueryEscape(name)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inventory source: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"name":             name,
+		"description":      description,
+		"inventory":        invID,
+		"source":           "scm",
+		"source_project":   projectID,
+		"source_path":      sourcePath,
+		"overwrite":        true,
+		"update_on_launch": true,
+	}
+	if sourceID > 0 {
+		return c.saveObject(ctx, "PATCH", fmt.Sprintf("%s/inventory_sources/%d/", c.apiURL(), sourceID), payload, "inventory source")
+	}
+	return c.saveObject(ctx, "POST", c.apiURL()+"/inventory_sources/", payload, "inventory source")
+}
+
+// UpdateInventorySource starts a sync of an inventory source and returns the
+// inventory update ID
+func (c *Client) UpdateInventorySource(ctx context.Context, sourceID int) (int, error) {
+	return c.startUpdate(ctx, fmt.Sprintf("%s/inventory_sources/%d/update/", c.apiURL(), sourceID), "inventory_update", "inventory update")
+}
+
+// GetInventoryUpdate retrieves an inventory update by ID
+func (c *Client) GetInventoryUpdate(ctx context.Context, updateID int) (*Job, error) {
+	return c.getUnifiedJob(ctx, fmt.Sprintf("%s/inventory_updates/%d/", c.apiURL(), updateID), "inventory update")
+}
+
+// startUpdate POSTs to the update endpoint at urlStr and returns the ID of
+// the started update, found in field of the response
+func (c *Client) startUpdate(ctx context.Context, urlStr, field, object string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return 0, fmt.Errorf("failed to start %s: %w", object, newAPIError(resp))
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	id, _ := result[field].(float64)
+	if id == 0 {
+		id, _ = result["id"].(float64)
+	}
+	return int(id), nil
+}
+
+// getUnifiedJob retrieves the job, project update or inventory update at urlStr
+func (c *Client) getUnifiedJob(ctx context.Context, urlStr, object string) (*Job, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: %w", object, newAPIError(resp))
+	}
+
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,35 @@
+package awx
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retries of a rate limited request before the 429 is returned
+const maxRateLimitRetries = 5
+
+// maxRetryAfter caps the delay AWX or a proxy can ask for
+const maxRetryAfter = 2 * time.Minute
+
+// retryAfter returns how long to wait before retrying a 429 response. It
+// honors Retry-After in seconds or as an HTTP date and otherwise backs off
+// exponentially from one second.
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	delay := time.Second << attempt
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			delay = time.Until(at)
+		}
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
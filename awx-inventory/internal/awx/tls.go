@@ -0,0 +1,70 @@
+package awx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// TLSOptions configures how the AWX server certificate is verified and
+// which client certificate is presented
+type TLSOptions struct {
+	// CACertFile is a PEM bundle trusted in addition to the system roots
+	CACertFile string
+	// CertFile and KeyFile are a PEM client certificate and key
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool
+}
+
+// SetTLS configures TLS for AWX connections. It must be called before WrapTransport.
+func (c *Client) SetTLS(opts TLSOptions) error {
+	if opts == (TLSOptions{}) {
+		return nil
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return fmt.Errorf("both AWX client certificate and key files must be set")
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.InsecureSkipVerify {
+		log.Printf("WARN: AWX server certificate verification is disabled")
+	}
+
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read AWX CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in AWX CA bundle '%s'", opts.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load AWX client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport, ok := c.client.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("TLS must be configured before the AWX transport is wrapped")
+	}
+	transport.TLSClientConfig = config
+	return nil
+}
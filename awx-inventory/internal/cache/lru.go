@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// LRU is a size-bounded, concurrency-safe least-recently-used cache
+type LRU[K comparable, V any] struct {
+	name     string
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[K]*list.Element
+	// onEvict is called with entries evicted to make room, see OnEvict
+	onEvict func(K, V)
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewLRU creates a cache holding at most capacity entries.
+// name labels the cache metrics; capacity <= 0 means unbounded.
+func NewLRU[K comparable, V any](name string, capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		name:     name,
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.items[key]; exists {
+		c.order.MoveToFront(elem)
+		metrics.CacheHitsTotal.WithLabelValues(c.name).Inc()
+		return elem.Value.(*entry[K, V]).value, true
+	}
+
+	metrics.CacheMissesTotal.WithLabelValues(c.name).Inc()
+	var zero V
+	return zero, false
+}
+
+// OnEvict sets a function called with every entry evicted to make room. It
+// runs in Add after the cache is unlocked.
+func (c *LRU[K, V]) OnEvict(fn func(key K, value V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvict = fn
+}
+
+// Add inserts or updates key, evicting the least recently used entry if full
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+
+	if elem, exists := c.items[key]; exists {
+		elem.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+
+	var evicted *entry[K, V]
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		evicted = oldest.Value.(*entry[K, V])
+		delete(c.items, evicted.key)
+		metrics.CacheEvictionsTotal.WithLabelValues(c.name).Inc()
+	}
+
+	metrics.CacheSize.WithLabelValues(c.name).Set(float64(c.order.Len()))
+	onEvict := c.onEvict
+	c.mu.Unlock()
+
+	if evicted != nil && onEvict != nil {
+		onEvict(evicted.key, evicted.value)
+	}
+}
+
+// Remove deletes key from the cache
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.items[key]; exists {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		metrics.CacheSize.WithLabelValues(c.name).Set(float64(c.order.Len()))
+	}
+}
+
+// Len returns the number of cached entries
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Items returns a copy of all entries without affecting recency
+func (c *LRU[K, V]) Items() map[K]V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := make(map[K]V, len(c.items))
+	for key, elem := range c.items {
+		items[key] = elem.Value.(*entry[K, V]).value
+	}
+	return items
+}
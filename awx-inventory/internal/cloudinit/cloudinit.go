@@ -0,0 +1,104 @@
+package cloudinit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the subset of a #cloud-config document relevant for connecting to a VM
+type Config struct {
+	Users []User
+	// SSHAuthorizedKeys are keys of the distribution default user
+	SSHAuthorizedKeys []string
+}
+
+// User is a user created by cloud-init
+type User struct {
+	Name              string
+	SSHAuthorizedKeys []string
+}
+
+// Parse parses cloud-init user data. Data that is not a #cloud-config
+// document (scripts, MIME multipart) yields an empty config.
+func Parse(userData string) (*Config, error) {
+	if !strings.HasPrefix(strings.TrimSpace(userData), "#cloud-config") {
+		return &Config{}, nil
+	}
+
+	var doc struct {
+		Users             []interface{} `json:"users"`
+		SSHAuthorizedKeys []string      `json:"ssh_authorized_keys"`
+	}
+	if err := yaml.Unmarshal([]byte(userData), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse cloud-config: %w", err)
+	}
+
+	cfg := &Config{SSHAuthorizedKeys: doc.SSHAuthorizedKeys}
+	for _, entry := range doc.Users {
+		switch u := entry.(type) {
+		case string:
+			// "default" refers to the distribution default user
+			if u != "default" {
+				cfg.Users = append(cfg.Users, User{Name: u})
+			}
+		case map[string]interface{}:
+			user := User{}
+			user.Name, _ = u["name"].(string)
+			if keys, ok := u["ssh_authorized_keys"].([]interface{}); ok {
+				for _, k := range keys {
+					if key, ok := k.(string); ok {
+						user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, key)
+					}
+				}
+			}
+			if user.Name != "" {
+				cfg.Users = append(cfg.Users, user)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// ConnectionVars returns Ansible variables derived from the config:
+// ansible_user for the first created user, and SHA256 fingerprints of the
+// user's authorized keys as a hint for which private key to use
+func (c *Config) ConnectionVars() map[string]interface{} {
+	vars := make(map[string]interface{})
+	if len(c.Users) == 0 {
+		if fingerprints := Fingerprints(c.SSHAuthorizedKeys); len(fingerprints) > 0 {
+			vars["vm_ssh_key_fingerprints"] = fingerprints
+		}
+		return vars
+	}
+
+	user := c.Users[0]
+	vars["ansible_user"] = user.Name
+	if fingerprints := Fingerprints(user.SSHAuthorizedKeys); len(fingerprints) > 0 {
+		vars["vm_ssh_key_fingerprints"] = fingerprints
+	}
+	return vars
+}
+
+// Fingerprints returns OpenSSH-style SHA256 fingerprints of authorized keys,
+// skipping keys that cannot be parsed
+func Fingerprints(keys []string) []string {
+	var fingerprints []string
+	for _, key := range keys {
+		fields := strings.Fields(key)
+		if len(fields) < 2 {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(blob)
+		fingerprints = append(fingerprints, "SHA256:"+base64.RawStdEncoding.EncodeToString(sum[:]))
+	}
+	return fingerprints
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// errResyncUnsupported is returned when VMs do not come from Kubernetes and
+// cannot be read again
+var errResyncUnsupported = errors.New("resync requires a Kubernetes VM source")
+
+// errNotRunning is returned by Resync before the watch started
+var errNotRunning = errors.New("controller is not watching VMs yet")
+
+// VMMapping is the host and inventory a VM was synced to
+type VMMapping struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Host      string `json:"host"`
+	Inventory string `json:"inventory"`
+	// InventoryID is 0 while the inventory is not cached
+	InventoryID int `json:"inventoryID,omitempty"`
+}
+
+// CachedInventory is an entry of the inventory cache
+type CachedInventory struct {
+	Namespace string `json:"namespace"`
+	Inventory string `json:"inventory"`
+	ID        int    `json:"id"`
+}
+
+// PendingEvent is a VM event not applied yet
+type PendingEvent struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Type      watch.EventType `json:"type"`
+}
+
+// QueueState lists the events waiting for a worker and those deferred by a
+// blackout window
+type QueueState struct {
+	Pending  []PendingEvent `json:"pending"`
+	Deferred []PendingEvent `json:"deferred"`
+}
+
+// Mappings returns the VMs known to the controller with their host and
+// inventory, optionally only those of namespace. Only as many VMs as the
+// host name cache holds are known.
+func (c *Controller) Mappings(namespace string) []VMMapping {
+	inventories := c.inventoryCache.Items()
+	mappings := []VMMapping{}
+	for key, host := range c.hostNames.Items() {
+		vmNamespace, name, _ := strings.Cut(key, "/")
+		if namespace != "" && vmNamespace != namespace {
+			continue
+		}
+		mappings = append(mappings, VMMapping{
+			Namespace:   vmNamespace,
+			Name:        name,
+			Host:        host,
+			Inventory:   c.inventoryName(vmNamespace),
+			InventoryID: inventories[vmNamespace],
+		})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Namespace != mappings[j].Namespace {
+			return mappings[i].Namespace < mappings[j].Namespace
+		}
+		return mappings[i].Name < mappings[j].Name
+	})
+	return mappings
+}
+
+// CachedInventories returns the inventory cache ordered by namespace
+func (c *Controller) CachedInventories() []CachedInventory {
+	inventories := []CachedInventory{}
+	for namespace, id := range c.inventoryCache.Items() {
+		inventories = append(inventories, CachedInventory{Namespace: namespace, Inventory: c.inventoryName(namespace), ID: id})
+	}
+	sort.Slice(inventories, func(i, j int) bool { return inventories[i].Namespace < inventories[j].Namespace })
+	return inventories
+}
+
+// Queue returns the events not applied yet
+func (c *Controller) Queue() QueueState {
+	state := QueueState{Pending: []PendingEvent{}, Deferred: []PendingEvent{}}
+	if c.running() {
+		state.Pending = pendingEvents(c.queue.pending())
+	}
+	if c.blackout != nil {
+		state.Deferred = pendingEvents(c.blackout.deferred())
+	}
+	return state
+}
+
+func pendingEvents(events []vmEvent) []PendingEvent {
+	pending := make([]PendingEvent, 0, len(events))
+	for _, e := range events {
+		pending = append(pending, PendingEvent{Namespace: e.namespace, Name: e.name, Type: e.event.Type})
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Namespace != pending[j].Namespace {
+			return pending[i].Namespace < pending[j].Namespace
+		}
+		return pending[i].Name < pending[j].Name
+	})
+	return pending
+}
+
+// Resync queues the VMs of namespace, or only the VM name if it is set, as
+// ADDED events. Their hosts are written to AWX even if nothing changed. It
+// returns the number of queued VMs, and a NotFound error if name does not
+// exist.
+func (c *Controller) Resync(ctx context.Context, namespace, name string) (int, error) {
+	if len(c.vmSources) == 0 {
+		return 0, errResyncUnsupported
+	}
+	if !c.running() {
+		return 0, errNotRunning
+	}
+
+	queued := 0
+	resync := func(source kubernetes.Source, obj *unstructured.Unstructured) {
+		e, ok := newVMEvent(source, watch.Event{Type: watch.Added, Object: obj}, obj)
+		if !ok || e.namespace != namespace || (name != "" && e.name != name) {
+			return
+		}
+		if host, exists := c.hostNames.Get(e.key()); exists {
+			c.forgetHostState(e.namespace, host)
+		}
+		c.enqueue(e)
+		queued++
+	}
+
+	if name != "" {
+		var notFound error
+		for _, source := range c.vmSources {
+			obj, err := source.GetVMObject(namespace, name)
+			if apierrors.IsNotFound(err) {
+				notFound = err
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			resync(source, obj)
+			return queued, nil
+		}
+		return 0, notFound
+	}
+
+	for _, source := range c.vmSources {
+		err := source.ForEachVMObject(ctx, func(obj *unstructured.Unstructured) error {
+			resync(source, obj)
+			return nil
+		})
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// running reports whether the queue was set up and the watch started
+func (c *Controller) running() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.watching
+}
+
+// AdminHandler serves the admin API:
+//
+//	GET  /admin/mappings[?namespace=]    VMs with their host and inventory
+//	GET  /admin/inventories              the inventory cache
+//	GET  /admin/queue                    events not applied yet
+//	POST /admin/resync?namespace=[&vm=]  queue the VMs of a namespace again
+func (c *Controller) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/mappings", get(func(r *http.Request) interface{} {
+		return c.Mappings(r.URL.Query().Get("namespace"))
+	}))
+	mux.HandleFunc("/admin/inventories", get(func(r *http.Request) interface{} {
+		return c.CachedInventories()
+	}))
+	mux.HandleFunc("/admin/queue", get(func(r *http.Request) interface{} {
+		return c.Queue()
+	}))
+	mux.HandleFunc("/admin/resync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		namespace, name := r.URL.Query().Get("namespace"), r.URL.Query().Get("vm")
+		if namespace == "" {
+			writeError(w, http.StatusBadRequest, "namespace is required")
+			return
+		}
+
+		queued, err := c.Resync(r.Context(), namespace, name)
+		switch {
+		case apierrors.IsNotFound(err):
+			writeError(w, http.StatusNotFound, fmt.Sprintf("VM '%s' not found in namespace '%s'", name, namespace))
+			return
+		case errors.Is(err, errResyncUnsupported):
+			writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		case errors.Is(err, errNotRunning):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		case err != nil:
+			log.Printf("ERROR: failed to resync namespace '%s': %v", namespace, err)
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("Admin API: queued %d VMs of namespace '%s' to sync again", queued, namespace)
+		writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued})
+	})
+	return mux
+}
+
+// get serves the result of view as JSON to GET requests
+func get(view func(r *http.Request) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, view(r))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// Annotations on VirtualMachine objects that change how they are synced
+const (
+	// AnnotationIgnore set to "true" keeps the VM out of all inventories
+	AnnotationIgnore = "awx-inventory.io/ignore"
+	// AnnotationHostname overrides the AWX host name, which defaults to the
+	// configured hostname field or the VM name
+	AnnotationHostname = "awx-inventory.io/hostname"
+	// AnnotationAnsibleHost overrides ansible_host, which defaults to the VM IP address
+	AnnotationAnsibleHost = "awx-inventory.io/ansible-host"
+)
+
+// ignored reports whether the VM opted out of syncing
+func ignored(vm *kubernetes.VirtualMachine) bool {
+	return vm.Annotations[AnnotationIgnore] == "true"
+}
+
+// syncable returns the VMs that get a host, i.e. not ignored ones or ones without an address
+func syncable(vms []*kubernetes.VirtualMachine) []*kubernetes.VirtualMachine {
+	var result []*kubernetes.VirtualMachine
+	for _, vm := range vms {
+		if !ignored(vm) && ansibleHost(vm) != "" {
+			result = append(result, vm)
+		}
+	}
+	return result
+}
+
+// ansibleHost returns the address Ansible connects to
+func ansibleHost(vm *kubernetes.VirtualMachine) string {
+	if host := strings.TrimSpace(vm.Annotations[AnnotationAnsibleHost]); host != "" {
+		return host
+	}
+	return vm.IP
+}
+
+// otherAddresses returns the addresses of a VM besides ansible_host
+func otherAddresses(vm *kubernetes.VirtualMachine) []string {
+	host := ansibleHost(vm)
+	var others []string
+	for _, address := range vm.Addresses {
+		if address.IP != host {
+			others = append(others, address.IP)
+		}
+	}
+	return others
+}
+
+// annotationVars returns the host variables VM owners set with annotations
+// under the configured prefix, e.g. awx-vars.fl64.io/ansible_user=ubuntu.
+// Variables the controller sets itself can't be overridden this way, and the
+// sync status is skipped, as every sync would change it.
+func (c *Controller) annotationVars(vm *kubernetes.VirtualMachine) map[string]interface{} {
+	if c.hostVarsPrefix == "" {
+		return nil
+	}
+	vars := make(map[string]interface{})
+	for key, value := range vm.Annotations {
+		name, found := strings.CutPrefix(key, c.hostVarsPrefix)
+		if !found || name == "" || reservedHostVar(name) || key == AnnotationSyncStatus {
+			continue
+		}
+		vars[name] = value
+	}
+	return vars
+}
+
+// reservedHostVar reports whether the controller owns a host variable
+func reservedHostVar(name string) bool {
+	return name == "ansible_host" || name == "labels" || strings.HasPrefix(name, "vm_")
+}
+
+// vmNameForHost returns the VM a synced host belongs to, defaulting to the host name
+func (c *Controller) vmNameForHost(namespace, host string) string {
+	for key, synced := range c.hostNames.Items() {
+		if synced == host && strings.HasPrefix(key, namespace+"/") {
+			return strings.TrimPrefix(key, namespace+"/")
+		}
+	}
+	return host
+}
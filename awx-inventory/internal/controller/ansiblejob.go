@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/schedule"
+)
+
+// AnsibleJob phases
+const (
+	phasePending    = "Pending"
+	phaseRunning    = "Running"
+	phaseSuccessful = "Successful"
+	phaseFailed     = "Failed"
+)
+
+// runAnsibleJobs periodically reconciles AnsibleJob resources
+func (c *Controller) runAnsibleJobs(ctx context.Context) {
+	log.Printf("Starting AnsibleJob reconciliation every %v", c.ansibleJobsInterval)
+
+	ticker := time.NewTicker(c.ansibleJobsInterval)
+	defer ticker.Stop()
+
+	for {
+		jobs, err := c.k8sClient.ListAnsibleJobs()
+		if err != nil {
+			log.Printf("ERROR: failed to list AnsibleJobs: %v", err)
+		}
+
+		for _, job := range jobs {
+			if err := c.reconcileAnsibleJob(ctx, job, time.Now()); err != nil {
+				log.Printf("ERROR: failed to reconcile AnsibleJob '%s' in namespace '%s': %v", job.Name, job.Namespace, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileAnsibleJob launches or polls the AWX job for an AnsibleJob
+func (c *Controller) reconcileAnsibleJob(ctx context.Context, job *kubernetes.AnsibleJob, now time.Time) error {
+	before := job.Status
+
+	if err := c.syncAnsibleJob(ctx, job, now); err != nil {
+		job.Status.Message = err.Error()
+		if job.Status.Phase == "" {
+			job.Status.Phase = phasePending
+		}
+	}
+
+	if job.Status == before {
+		return nil
+	}
+	return c.k8sClient.UpdateAnsibleJobStatus(job)
+}
+
+// syncAnsibleJob updates job.Status in place
+func (c *Controller) syncAnsibleJob(ctx context.Context, job *kubernetes.AnsibleJob, now time.Time) error {
+	status := &job.Status
+
+	// Mirror the state of a job that is still running
+	if status.JobID != 0 && status.CompletionTime.IsZero() {
+		awxJob, err := c.awxClient.GetJob(ctx, int(status.JobID))
+		if err != nil {
+			return fmt.Errorf("failed to get AWX job %d: %w", status.JobID, err)
+		}
+
+		status.JobStatus = awxJob.Status
+		status.Message = ""
+		if !awxJob.IsFinished() {
+			status.Phase = phaseRunning
+			return nil
+		}
+
+		status.CompletionTime = awxJob.Finished
+		if status.CompletionTime.IsZero() {
+			status.CompletionTime = now
+		}
+		if awxJob.Status == "successful" {
+			status.Phase = phaseSuccessful
+		} else {
+			status.Phase = phaseFailed
+		}
+	}
+
+	launch := false
+	if job.Schedule == "" {
+		// One-shot jobs run once per spec generation
+		launch = status.ObservedGeneration != job.Generation
+		status.NextScheduleTime = time.Time{}
+	} else {
+		sched, err := schedule.Parse(job.Schedule)
+		if err != nil {
+			status.ObservedGeneration = job.Generation
+			return err
+		}
+
+		last := status.LastLaunchTime
+		if last.IsZero() || status.ObservedGeneration != job.Generation {
+			last = job.Created
+		}
+		next := sched.Next(last)
+		launch = !next.After(now)
+		status.NextScheduleTime = next
+	}
+
+	if !launch {
+		return nil
+	}
+
+	templateID, err := c.awxClient.GetJobTemplateID(ctx, job.JobTemplateName)
+	if err != nil {
+		return err
+	}
+
+	jobID, err := c.awxClient.LaunchJobTemplate(ctx, templateID, 0, job.Limit, job.ExtraVars)
+	if err != nil {
+		return err
+	}
+	log.Printf("Launched AWX job %d from template '%s' for AnsibleJob '%s' in namespace '%s'", jobID, job.JobTemplateName, job.Name, job.Namespace)
+
+	status.Phase = phaseRunning
+	status.JobID = int64(jobID)
+	status.JobStatus = "pending"
+	status.JobURL = c.awxClient.JobURL(jobID)
+	status.Message = ""
+	status.LastLaunchTime = now
+	status.CompletionTime = time.Time{}
+	status.ObservedGeneration = job.Generation
+	if job.Schedule != "" {
+		sched, _ := schedule.Parse(job.Schedule)
+		status.NextScheduleTime = sched.Next(now)
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"log"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/audit"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// auditedClient records every change the controller makes in AWX to an
+// audit log. Host and inventory variables are read before they are written,
+// so records hold the difference.
+type auditedClient struct {
+	AWXClient
+	log *audit.Log
+}
+
+func newAuditedClient(client AWXClient, log *audit.Log) *auditedClient {
+	return &auditedClient{AWXClient: client, log: log}
+}
+
+// record writes r with the outcome of the change
+func (a *auditedClient) record(r audit.Record, err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := a.log.Write(r); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
+
+// hostVariables returns the variables of host, nil if it does not exist or
+// they cannot be decoded
+func hostVariables(host *awx.Host) map[string]interface{} {
+	if host == nil {
+		return nil
+	}
+	vars, err := audit.ParseVariables(host.Variables)
+	if err != nil {
+		return nil
+	}
+	return vars
+}
+
+// hostRecord describes writing host, which was before, nil if it is new
+func hostRecord(before *awx.Host, id, invID int, name string, vars map[string]interface{}, enabled bool, description string) audit.Record {
+	r := audit.Record{Action: audit.ActionCreate, Object: "host", ID: id, Name: name, Inventory: invID}
+	fields := map[string]interface{}{}
+	if before != nil {
+		r.Action = audit.ActionUpdate
+		r.ID = before.ID
+	}
+	if before == nil || before.Enabled != enabled {
+		fields["enabled"] = enabled
+	}
+	if before == nil && description != "" || before != nil && before.Description != description {
+		fields["description"] = description
+	}
+	if len(fields) > 0 {
+		r.Fields = fields
+	}
+	r.Changes = audit.Diff(hostVariables(before), vars)
+	return r
+}
+
+func (a *auditedClient) CreateOrganization(ctx context.Context, name string) (int, error) {
+	id, err := a.AWXClient.CreateOrganization(ctx, name)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "organization", ID: id, Name: name}, err)
+	return id, err
+}
+
+func (a *auditedClient) CreateInventory(ctx context.Context, name, description string, orgID int) (int, error) {
+	id, err := a.AWXClient.CreateInventory(ctx, name, description, orgID)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "inventory", ID: id, Name: name}, err)
+	return id, err
+}
+
+func (a *auditedClient) UpdateInventory(ctx context.Context, invID int, name, description string) error {
+	err := a.AWXClient.UpdateInventory(ctx, invID, name, description)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "inventory", ID: invID, Name: name,
+		Fields: map[string]interface{}{"description": description}}, err)
+	return err
+}
+
+func (a *auditedClient) SetInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error {
+	var before map[string]interface{}
+	if current, err := a.AWXClient.GetInventoryVariables(ctx, invID); err == nil {
+		before, _ = audit.ParseVariables(current)
+	}
+	err := a.AWXClient.SetInventoryVariables(ctx, invID, vars)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "inventory", ID: invID, Changes: audit.Diff(before, vars)}, err)
+	return err
+}
+
+func (a *auditedClient) DeleteInventory(ctx context.Context, invID int) error {
+	err := a.AWXClient.DeleteInventory(ctx, invID)
+	a.record(audit.Record{Action: audit.ActionDelete, Object: "inventory", ID: invID}, err)
+	return err
+}
+
+// inventoryAction returns whether saving the inventory name creates or
+// updates it
+func (a *auditedClient) inventoryAction(ctx context.Context, name string) string {
+	if inventory, err := a.AWXClient.GetInventory(ctx, name); err == nil && inventory != nil {
+		return audit.ActionUpdate
+	}
+	return audit.ActionCreate
+}
+
+func (a *auditedClient) CreateOrUpdateSmartInventory(ctx context.Context, name, description string, orgID int, hostFilter string) (int, error) {
+	action := a.inventoryAction(ctx, name)
+	id, err := a.AWXClient.CreateOrUpdateSmartInventory(ctx, name, description, orgID, hostFilter)
+	a.record(audit.Record{Action: action, Object: "smart inventory", ID: id, Name: name,
+		Fields: map[string]interface{}{"host_filter": hostFilter}}, err)
+	return id, err
+}
+
+func (a *auditedClient) CreateOrUpdateConstructedInventory(ctx context.Context, name, description string, orgID int, sourceVars map[string]interface{}) (int, error) {
+	action := a.inventoryAction(ctx, name)
+	id, err := a.AWXClient.CreateOrUpdateConstructedInventory(ctx, name, description, orgID, sourceVars)
+	a.record(audit.Record{Action: action, Object: "constructed inventory", ID: id, Name: name,
+		Fields: map[string]interface{}{"source_vars": sourceVars}}, err)
+	return id, err
+}
+
+func (a *auditedClient) AddInputInventory(ctx context.Context, constructedID, invID int) error {
+	err := a.AWXClient.AddInputInventory(ctx, constructedID, invID)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "input inventory", ID: constructedID, Related: invID}, err)
+	return err
+}
+
+func (a *auditedClient) CreateOrUpdateHost(ctx context.Context, invID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) (int, error) {
+	before, _ := a.AWXClient.GetHost(ctx, invID, hostName)
+	id, err := a.AWXClient.CreateOrUpdateHost(ctx, invID, hostName, hostVars, enabled, description)
+	a.record(hostRecord(before, id, invID, hostName, hostVars, enabled, description), err)
+	return id, err
+}
+
+func (a *auditedClient) UpdateHost(ctx context.Context, hostID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) error {
+	before, _ := a.AWXClient.GetHostByID(ctx, hostID)
+	err := a.AWXClient.UpdateHost(ctx, hostID, hostName, hostVars, enabled, description)
+	r := hostRecord(before, hostID, 0, hostName, hostVars, enabled, description)
+	r.Action = audit.ActionUpdate
+	if before != nil {
+		r.Inventory = before.Inventory
+	}
+	a.record(r, err)
+	return err
+}
+
+func (a *auditedClient) BulkCreateHosts(ctx context.Context, invID int, hosts []awx.BulkHost, fn func([]awx.BulkHost)) error {
+	return a.AWXClient.BulkCreateHosts(ctx, invID, hosts, func(created []awx.BulkHost) {
+		for _, host := range created {
+			a.record(audit.Record{Action: audit.ActionCreate, Object: "host", Name: host.Name, Inventory: invID,
+				Changes: audit.Diff(nil, host.Variables)}, nil)
+		}
+		fn(created)
+	})
+}
+
+func (a *auditedClient) DeleteHost(ctx context.Context, invID int, hostName string) error {
+	before, _ := a.AWXClient.GetHost(ctx, invID, hostName)
+	err := a.AWXClient.DeleteHost(ctx, invID, hostName)
+	r := audit.Record{Action: audit.ActionDelete, Object: "host", Name: hostName, Inventory: invID}
+	if before != nil {
+		r.ID = before.ID
+		r.Changes = audit.Diff(hostVariables(before), nil)
+	}
+	a.record(r, err)
+	return err
+}
+
+func (a *auditedClient) DeleteHostByID(ctx context.Context, hostID int) error {
+	before, _ := a.AWXClient.GetHostByID(ctx, hostID)
+	err := a.AWXClient.DeleteHostByID(ctx, hostID)
+	r := audit.Record{Action: audit.ActionDelete, Object: "host", ID: hostID}
+	if before != nil {
+		r.Name = before.Name
+		r.Inventory = before.Inventory
+		r.Changes = audit.Diff(hostVariables(before), nil)
+	}
+	a.record(r, err)
+	return err
+}
+
+func (a *auditedClient) SetHostEnabled(ctx context.Context, hostID int, enabled bool) error {
+	err := a.AWXClient.SetHostEnabled(ctx, hostID, enabled)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "host", ID: hostID,
+		Fields: map[string]interface{}{"enabled": enabled}}, err)
+	return err
+}
+
+func (a *auditedClient) UpdateHostEnabled(ctx context.Context, invID int, hostName string, enabled bool) error {
+	err := a.AWXClient.UpdateHostEnabled(ctx, invID, hostName, enabled)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "host", Name: hostName, Inventory: invID,
+		Fields: map[string]interface{}{"enabled": enabled}}, err)
+	return err
+}
+
+// GetOrCreateGroup records a create only if the group did not exist
+func (a *auditedClient) GetOrCreateGroup(ctx context.Context, invID int, groupName, description string) (int, error) {
+	existed := false
+	if groups, err := a.AWXClient.ListGroups(ctx, invID); err == nil {
+		for _, group := range groups {
+			existed = existed || group.Name == groupName
+		}
+	}
+	id, err := a.AWXClient.GetOrCreateGroup(ctx, invID, groupName, description)
+	if !existed {
+		a.record(audit.Record{Action: audit.ActionCreate, Object: "group", ID: id, Name: groupName, Inventory: invID}, err)
+	}
+	return id, err
+}
+
+func (a *auditedClient) SetGroupVariables(ctx context.Context, groupID int, vars map[string]interface{}) error {
+	err := a.AWXClient.SetGroupVariables(ctx, groupID, vars)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "group", ID: groupID,
+		Fields: map[string]interface{}{"variables": vars}}, err)
+	return err
+}
+
+func (a *auditedClient) AddHostToGroup(ctx context.Context, groupID, hostID int) error {
+	err := a.AWXClient.AddHostToGroup(ctx, groupID, hostID)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "group host", ID: groupID, Related: hostID}, err)
+	return err
+}
+
+func (a *auditedClient) DisassociateHostFromGroup(ctx context.Context, groupID, hostID int) error {
+	err := a.AWXClient.DisassociateHostFromGroup(ctx, groupID, hostID)
+	a.record(audit.Record{Action: audit.ActionDelete, Object: "group host", ID: groupID, Related: hostID}, err)
+	return err
+}
+
+func (a *auditedClient) AddGroupToGroup(ctx context.Context, parentID, childID int) error {
+	err := a.AWXClient.AddGroupToGroup(ctx, parentID, childID)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "group child", ID: parentID, Related: childID}, err)
+	return err
+}
+
+func (a *auditedClient) DeleteGroup(ctx context.Context, groupID int) error {
+	err := a.AWXClient.DeleteGroup(ctx, groupID)
+	a.record(audit.Record{Action: audit.ActionDelete, Object: "group", ID: groupID}, err)
+	return err
+}
+
+// CreateOrUpdateMachineCredential records the user name, never the key
+func (a *auditedClient) CreateOrUpdateMachineCredential(ctx context.Context, name, description string, orgID int, username, privateKey string) (int, error) {
+	id, err := a.AWXClient.CreateOrUpdateMachineCredential(ctx, name, description, orgID, username, privateKey)
+	a.record(audit.Record{Action: audit.ActionUpdate, Object: "credential", ID: id, Name: name,
+		Fields: map[string]interface{}{"username": username}}, err)
+	return id, err
+}
+
+func (a *auditedClient) DeleteCredential(ctx context.Context, credentialID int) error {
+	err := a.AWXClient.DeleteCredential(ctx, credentialID)
+	a.record(audit.Record{Action: audit.ActionDelete, Object: "credential", ID: credentialID}, err)
+	return err
+}
+
+func (a *auditedClient) AttachJobTemplateCredential(ctx context.Context, templateID, credentialID int) error {
+	err := a.AWXClient.AttachJobTemplateCredential(ctx, templateID, credentialID)
+	a.record(audit.Record{Action: audit.ActionCreate, Object: "job template credential", ID: templateID, Related: credentialID}, err)
+	return err
+}
+
+func (a *auditedClient) LaunchJobTemplate(ctx context.Context, templateID, invID int, limit string, extraVars map[string]interface{}) (int, error) {
+	id, err := a.AWXClient.LaunchJobTemplate(ctx, templateID, invID, limit, extraVars)
+	a.record(audit.Record{Action: audit.ActionLaunch, Object: "job", ID: id, Inventory: invID, Related: templateID,
+		Fields: map[string]interface{}{"limit": limit}}, err)
+	return id, err
+}
+
+func (a *auditedClient) LaunchAdHocCommand(ctx context.Context, invID, credentialID int, limit, module, args string) (int, error) {
+	id, err := a.AWXClient.LaunchAdHocCommand(ctx, invID, credentialID, limit, module, args)
+	a.record(audit.Record{Action: audit.ActionLaunch, Object: "ad hoc command", ID: id, Inventory: invID,
+		Fields: map[string]interface{}{"limit": limit, "module": module}}, err)
+	return id, err
+}
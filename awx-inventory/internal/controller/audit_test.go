@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/audit"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx/awxfake"
+)
+
+// readOnlyMethods are the AWXClient methods that change nothing in AWX and
+// need no audit record
+var readOnlyMethods = map[string]bool{
+	"Ping":                   true,
+	"WaitForAWX":             true,
+	"CheckPermissions":       true,
+	"SupportsBulkHostCreate": true,
+	"JobURL":                 true,
+	"HostURL":                true,
+}
+
+func readOnly(method string) bool {
+	if readOnlyMethods[method] {
+		return true
+	}
+	if strings.HasPrefix(method, "GetOrCreate") {
+		return false
+	}
+	for _, prefix := range []string{"Get", "List", "ForEach"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAuditedClientWrapsMutatingMethods fails when a method that can change
+// AWX reaches the client through embedding, without an audit record
+func TestAuditedClientWrapsMutatingMethods(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "audit.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := make(map[string]bool)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			continue
+		}
+		if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok {
+			if ident, ok := star.X.(*ast.Ident); ok && ident.Name == "auditedClient" {
+				wrapped[fn.Name.Name] = true
+			}
+		}
+	}
+
+	client := reflect.TypeOf((*AWXClient)(nil)).Elem()
+	for i := 0; i < client.NumMethod(); i++ {
+		method := client.Method(i).Name
+		if !readOnly(method) && !wrapped[method] {
+			t.Errorf("auditedClient does not wrap %s, changes made with it are not audited", method)
+		}
+	}
+}
+
+func TestAuditedGetOrCreateGroup(t *testing.T) {
+	ctx := context.Background()
+	fake := awxfake.New("Default")
+	orgID, err := fake.GetOrganizationID(ctx, "Default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invID, err := fake.CreateInventory(ctx, "demo", "", orgID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	client := newAuditedClient(fake, audit.New(&out))
+	first, err := client.GetOrCreateGroup(ctx, invID, "web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.GetOrCreateGroup(ctx, invID, "web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatalf("got group %d, then %d", first, second)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d records, want 1 for the new group: %q", len(lines), out.String())
+	}
+	var record audit.Record
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Action != audit.ActionCreate || record.Object != "group" || record.ID != first || record.Name != "web" || record.Inventory != invID {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx/awxfake"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/snapshot"
+)
+
+// AWXClient is the AWX API used by the controller. It is implemented by
+// *awx.Client and by the in-memory awxfake.Client.
+type AWXClient interface {
+	// Snapshots are collected from the managed inventories
+	snapshot.Client
+
+	Ping(ctx context.Context) error
+	WaitForAWX(ctx context.Context, timeout, interval time.Duration) error
+	CheckPermissions(ctx context.Context, orgID int) (*awx.Permissions, error)
+	CreateOrganization(ctx context.Context, name string) (int, error)
+
+	GetHost(ctx context.Context, invID int, hostName string) (*awx.Host, error)
+	ListHosts(ctx context.Context, invID int) ([]awx.Host, error)
+	GetHostByID(ctx context.Context, hostID int) (*awx.Host, error)
+	UpdateHost(ctx context.Context, hostID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) error
+	DeleteHost(ctx context.Context, invID int, hostName string) error
+	DeleteHostByID(ctx context.Context, hostID int) error
+	SetHostEnabled(ctx context.Context, hostID int, enabled bool) error
+	UpdateHostEnabled(ctx context.Context, invID int, hostName string, enabled bool) error
+	SupportsBulkHostCreate(ctx context.Context) (bool, error)
+	BulkCreateHosts(ctx context.Context, invID int, hosts []awx.BulkHost, fn func([]awx.BulkHost)) error
+	ForEachInventory(ctx context.Context, orgID int, fn func(awx.Inventory) error) error
+	GetInventory(ctx context.Context, name string) (*awx.Inventory, error)
+	UpdateInventory(ctx context.Context, invID int, name, description string) error
+	CreateOrUpdateSmartInventory(ctx context.Context, name, description string, orgID int, hostFilter string) (int, error)
+	CreateOrUpdateConstructedInventory(ctx context.Context, name, description string, orgID int, sourceVars map[string]interface{}) (int, error)
+	AddInputInventory(ctx context.Context, constructedID, invID int) error
+
+	ListHostGroups(ctx context.Context, hostID int) ([]awx.Group, error)
+	DisassociateHostFromGroup(ctx context.Context, groupID, hostID int) error
+	DeleteGroup(ctx context.Context, groupID int) error
+	AddGroupToGroup(ctx context.Context, parentID, childID int) error
+	ListGroupChildren(ctx context.Context, groupID int) ([]awx.Group, error)
+	DeleteInventory(ctx context.Context, invID int) error
+
+	CreateOrUpdateMachineCredential(ctx context.Context, name, description string, orgID int, username, privateKey string) (int, error)
+	GetCredentialID(ctx context.Context, name string, orgID int) (int, error)
+	DeleteCredential(ctx context.Context, credentialID int) error
+
+	GetJobTemplateID(ctx context.Context, name string) (int, error)
+	ListJobTemplateIDs(ctx context.Context, invID int) ([]int, error)
+	AttachJobTemplateCredential(ctx context.Context, templateID, credentialID int) error
+	LaunchJobTemplate(ctx context.Context, templateID, invID int, limit string, extraVars map[string]interface{}) (int, error)
+	GetJob(ctx context.Context, jobID int) (*awx.Job, error)
+	LaunchAdHocCommand(ctx context.Context, invID, credentialID int, limit, module, args string) (int, error)
+	GetAdHocCommand(ctx context.Context, commandID int) (*awx.Job, error)
+	JobURL(jobID int) string
+	HostURL(invID, hostID int) string
+}
+
+var _ AWXClient = (*awx.Client)(nil)
+
+// newAWXClient builds the AWX client from the connection settings in cfg
+func newAWXClient(cfg Config) (*awx.Client, error) {
+	client := awx.NewClient(cfg.AWXURL, cfg.AWXToken)
+	if err := client.SetTLS(cfg.AWXTLS); err != nil {
+		return nil, err
+	}
+	client.SetHeaders(cfg.AWXHeaders)
+	client.SetRateLimit(cfg.AWXRateLimit, cfg.AWXRateBurst)
+	client.SetResponseCache(cfg.AWXResponseCache)
+
+	switch {
+	case cfg.AWXOAuthClientID != "":
+		client.SetOAuth2(cfg.AWXOAuthClientID, cfg.AWXOAuthClientSecret)
+	case cfg.AWXUsername != "":
+		client.SetBasicAuth(cfg.AWXUsername, cfg.AWXPassword)
+	case cfg.AWXTokenFile != "":
+		if err := client.SetTokenFile(cfg.AWXTokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Faults.Enabled() {
+		client.WrapTransport(cfg.Faults.Transport)
+	}
+	return client, nil
+}
+
+// shadowMemoryURL selects an in-memory fake AWX as the shadow target
+const shadowMemoryURL = "memory://"
+
+// newShadowClient builds the client of the shadow AWX. It shares the TLS,
+// header, rate limit and fault settings of the primary, and its credentials
+// unless ShadowAWXToken is set.
+func newShadowClient(cfg Config) (AWXClient, error) {
+	if cfg.ShadowAWXURL == shadowMemoryURL {
+		return awxfake.New(cfg.Organization), nil
+	}
+	cfg.AWXURL = cfg.ShadowAWXURL
+	if cfg.ShadowAWXToken != "" {
+		cfg.AWXToken = cfg.ShadowAWXToken
+		cfg.AWXOAuthClientID, cfg.AWXUsername, cfg.AWXTokenFile = "", "", ""
+	}
+	return newAWXClient(cfg)
+}
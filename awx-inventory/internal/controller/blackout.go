@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/schedule"
+)
+
+// blackoutCheckInterval is how often a closed window is detected and the queue flushed
+const blackoutCheckInterval = 30 * time.Second
+
+// blackout holds events received while a blackout window is open
+type blackout struct {
+	windows []schedule.Window
+
+	mu sync.Mutex
+	// Latest event per VM, in order of the first event received
+	events map[string]vmEvent
+	order  []string
+}
+
+func newBlackout(windows []schedule.Window) *blackout {
+	return &blackout{
+		windows: windows,
+		events:  make(map[string]vmEvent),
+	}
+}
+
+// active reports whether any blackout window is open at t
+func (b *blackout) active(t time.Time) bool {
+	for _, w := range b.windows {
+		if w.Active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// add queues an event, replacing any earlier event for the same VM
+func (b *blackout) add(e vmEvent) {
+	key := e.key()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.events[key]; !exists {
+		b.order = append(b.order, key)
+	}
+	b.events[key] = e
+	metrics.DeferredEvents.Set(float64(len(b.events)))
+}
+
+// deferred returns the queued events without removing them
+func (b *blackout) deferred() []vmEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make([]vmEvent, 0, len(b.order))
+	for _, key := range b.order {
+		events = append(events, b.events[key])
+	}
+	return events
+}
+
+// take removes and returns all queued events
+func (b *blackout) take() []vmEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make([]vmEvent, 0, len(b.order))
+	for _, key := range b.order {
+		events = append(events, b.events[key])
+	}
+	b.events = make(map[string]vmEvent)
+	b.order = nil
+	metrics.DeferredEvents.Set(0)
+	return events
+}
+
+// inBlackout reports whether mutations must be deferred right now
+func (c *Controller) inBlackout() bool {
+	return c.blackout != nil && c.blackout.active(time.Now())
+}
+
+// runBlackouts flushes the deferred events once the blackout window closes
+func (c *Controller) runBlackouts(ctx context.Context) {
+	log.Printf("Starting blackout window monitor with %d windows", len(c.blackout.windows))
+
+	ticker := time.NewTicker(blackoutCheckInterval)
+	defer ticker.Stop()
+
+	wasActive := false
+	for {
+		active := c.inBlackout()
+		if active != wasActive {
+			if active {
+				log.Printf("Blackout window opened, deferring AWX mutations")
+				metrics.BlackoutActive.Set(1)
+			} else {
+				log.Printf("Blackout window closed")
+				metrics.BlackoutActive.Set(0)
+			}
+			wasActive = active
+		}
+		if !active {
+			c.flushDeferred()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushDeferred queues the events deferred during a blackout for the workers
+func (c *Controller) flushDeferred() {
+	events := c.blackout.take()
+	if len(events) == 0 {
+		return
+	}
+
+	log.Printf("Applying %d events deferred during the blackout window", len(events))
+	for _, e := range events {
+		c.queue.add(e)
+	}
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// bulkCreateHosts creates the missing hosts of existing VMs in batches, so
+// the ADDED events of the initial list find them in place. Hosts that need no
+// groups or credentials are recorded as synced and are not written again.
+func (c *Controller) bulkCreateHosts(ctx context.Context) error {
+	supported, err := c.awxClient.SupportsBulkHostCreate(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		log.Printf("AWX has no bulk host API, hosts are created one by one")
+		return nil
+	}
+
+	var all []*kubernetes.VirtualMachine
+	err = c.forEachVM(ctx, func(vm *kubernetes.VirtualMachine) error {
+		all = append(all, vm)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	// Namespaces share an inventory in single inventory mode
+	vms := make(map[string][]*kubernetes.VirtualMachine)
+	all = syncable(all)
+	c.seedHostNames(all)
+	all = c.reachable(ctx, all)
+	for _, vm := range all {
+		if c.stopped(vm) {
+			continue
+		}
+		name := c.inventoryName(vm.Namespace)
+		vms[name] = append(vms[name], vm)
+	}
+
+	created := 0
+	for name, invVMs := range vms {
+		invID, err := c.getOrCreateInventoryForNamespace(ctx, invVMs[0].Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to get inventory '%s': %w", name, err)
+		}
+
+		existing := make(map[string]bool)
+		err = c.awxClient.ForEachHost(ctx, invID, func(h awx.Host) error {
+			existing[h.Name] = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list hosts of inventory '%s': %w", name, err)
+		}
+
+		var hosts []awx.BulkHost
+		byHost := make(map[string]*kubernetes.VirtualMachine)
+		for _, vm := range invVMs {
+			hostName := c.hostName(vm)
+			if existing[hostName] || byHost[hostName] != nil {
+				continue
+			}
+			// Left to the ADDED event, which launches the provisioning job
+			if c.provisionTemplate(vm) != "" && vm.Annotations[AnnotationProvisionJobID] == "" {
+				continue
+			}
+			byHost[hostName] = vm
+			// Bulk created hosts are new, there is nothing to merge with
+			hosts = append(hosts, awx.BulkHost{
+				Name:        hostName,
+				Description: c.hostDescription(vm),
+				Variables:   mergeVars(c.mergeStrategy, nil, c.hostVars(vm)),
+			})
+		}
+
+		added := 0
+		err = c.awxClient.BulkCreateHosts(ctx, invID, hosts, func(batch []awx.BulkHost) {
+			for _, h := range batch {
+				c.recordBulkHost(byHost[h.Name], h)
+				c.recordSynced(byHost[h.Name], invID, 0)
+			}
+			added += len(batch)
+		})
+		created += added
+		c.notifyHostsAdded(invVMs[0].Namespace, added)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Created %d hosts with the AWX bulk API", created)
+	return nil
+}
+
+// recordBulkHost records a host created in bulk as synced, unless it still
+// needs groups or a credential from its ADDED event
+func (c *Controller) recordBulkHost(vm *kubernetes.VirtualMachine, h awx.BulkHost) {
+	c.hostNames.Add(vm.Namespace+"/"+vm.Name, h.Name)
+	c.recordEvent(vm, corev1.EventTypeNormal, EventSynced, "Host '%s' created in AWX inventory '%s'", h.Name, c.inventoryName(vm.Namespace))
+	if c.expiry != nil {
+		c.expiry.seen(vm.Namespace, h.Name)
+	}
+
+	groups := c.desiredGroups(vm)
+	if len(groups) > 0 || c.sshCredentials {
+		return
+	}
+	state, err := hostStateHash(c.hostVars(vm), groups, h.Description)
+	if err != nil {
+		return
+	}
+	c.hostStates.Add(vm.Namespace+"/"+h.Name, state)
+}
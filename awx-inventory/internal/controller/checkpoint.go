@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// checkpointInterval is how often a changed checkpoint is written
+const checkpointInterval = 10 * time.Second
+
+// checkpointKey is the ConfigMap key holding the saved events
+const checkpointKey = "events.json"
+
+// maxCheckpointSize keeps the saved events below the 1 MiB limit of a ConfigMap
+const maxCheckpointSize = 900 * 1024
+
+// savedEvent is the stored form of a vmEvent
+type savedEvent struct {
+	Type watch.EventType `json:"type"`
+	// Source is the index of the Kubernetes source of the event, -1 for the
+	// default source
+	Source int                    `json:"source"`
+	Object map[string]interface{} `json:"object"`
+}
+
+// checkpoint saves the events that failed to apply, e.g. while AWX is
+// unreachable, to a ConfigMap so they are replayed after a restart. The
+// watch delivers all existing VMs again on startup, which replaces their
+// saved events, so the checkpoint matters most for VMs deleted meanwhile.
+type checkpoint struct {
+	namespace string
+	name      string
+	client    KubernetesClient
+	sources   []kubernetes.Source
+	fallback  hostSource
+
+	mu sync.Mutex
+	// Latest event per VM, in order of the first failure
+	events map[string]vmEvent
+	order  []string
+	dirty  bool
+}
+
+func newCheckpoint(client KubernetesClient, namespace, name string, sources []kubernetes.Source, fallback hostSource) *checkpoint {
+	return &checkpoint{
+		namespace: namespace,
+		name:      name,
+		client:    client,
+		sources:   sources,
+		fallback:  fallback,
+		events:    make(map[string]vmEvent),
+	}
+}
+
+// track saves a failed event, replacing the saved event of the same VM
+func (p *checkpoint) track(e vmEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.events[e.key()]; !exists {
+		p.order = append(p.order, e.key())
+	}
+	p.events[e.key()] = e
+	p.dirty = true
+}
+
+// update replaces the saved event of a VM by a newer one, so a VM deleted
+// after a failed update is not recreated on replay
+func (p *checkpoint) update(e vmEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.events[e.key()]; exists {
+		p.events[e.key()] = e
+		p.dirty = true
+	}
+}
+
+// forget drops the saved event of a VM once e was applied, unless a newer
+// event was saved meanwhile
+func (p *checkpoint) forget(e vmEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if saved, exists := p.events[e.key()]; !exists || saved.obj != e.obj {
+		return
+	}
+	delete(p.events, e.key())
+	for i, key := range p.order {
+		if key == e.key() {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+	p.dirty = true
+}
+
+// sourceIndex returns the index of source among the Kubernetes sources, -1
+// if it is not one of them
+func (p *checkpoint) sourceIndex(source hostSource) int {
+	for i, s := range p.sources {
+		// Interfaces holding non-comparable types panic when compared
+		if reflect.TypeOf(s).Comparable() && hostSource(s) == source {
+			return i
+		}
+	}
+	return -1
+}
+
+// marshal encodes the saved events in order, dropping the oldest ones if
+// they do not fit into a ConfigMap
+func (p *checkpoint) marshal() (string, error) {
+	p.mu.Lock()
+	keys := append([]string{}, p.order...)
+	saved := make([]savedEvent, 0, len(keys))
+	for _, key := range keys {
+		e := p.events[key]
+		obj := e.obj.DeepCopy()
+		obj.SetManagedFields(nil)
+		saved = append(saved, savedEvent{Type: e.event.Type, Source: p.sourceIndex(e.source), Object: obj.Object})
+	}
+	p.dirty = false
+	p.mu.Unlock()
+
+	for {
+		data, err := json.Marshal(saved)
+		if err != nil {
+			return "", err
+		}
+		if len(data) <= maxCheckpointSize || len(saved) == 0 {
+			return string(data), nil
+		}
+		log.Printf("WARN: queue checkpoint is full, not saving the event of VM '%s'", keys[0])
+		keys, saved = keys[1:], saved[1:]
+	}
+}
+
+// save writes the checkpoint if it changed since it was last written
+func (p *checkpoint) save() error {
+	p.mu.Lock()
+	dirty := p.dirty
+	p.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	data, err := p.marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode queue checkpoint: %w", err)
+	}
+	labels := map[string]string{"app.kubernetes.io/managed-by": "awx-inventory"}
+	if err := p.client.ApplyConfigMap(p.namespace, p.name, labels, map[string]string{checkpointKey: data}); err != nil {
+		p.mu.Lock()
+		p.dirty = true
+		p.mu.Unlock()
+		return fmt.Errorf("failed to write queue checkpoint: %w", err)
+	}
+	return nil
+}
+
+// load reads the events saved before the restart, in order
+func (p *checkpoint) load() ([]vmEvent, error) {
+	data, err := p.client.GetConfigMapData(p.namespace, p.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue checkpoint: %w", err)
+	}
+	if data[checkpointKey] == "" {
+		return nil, nil
+	}
+
+	var saved []savedEvent
+	if err := json.Unmarshal([]byte(data[checkpointKey]), &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode queue checkpoint: %w", err)
+	}
+	var events []vmEvent
+	for _, s := range saved {
+		var source hostSource = p.fallback
+		if s.Source >= 0 && s.Source < len(p.sources) {
+			source = p.sources[s.Source]
+		}
+		obj := &unstructured.Unstructured{Object: s.Object}
+		e, ok := newVMEvent(source, watch.Event{Type: s.Type, Object: obj}, obj)
+		if ok {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// replayCheckpoint queues the events saved before the restart. They are
+// saved again until applied.
+func (c *Controller) replayCheckpoint() {
+	events, err := c.checkpoint.load()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	log.Printf("Replaying %d events saved in ConfigMap '%s/%s' before the restart", len(events), c.checkpoint.namespace, c.checkpoint.name)
+	for _, e := range events {
+		c.checkpoint.track(e)
+		c.queue.add(e)
+	}
+}
+
+// runCheckpoint writes the checkpoint whenever it changed. It is written a
+// last time once the queue was drained on shutdown.
+func (c *Controller) runCheckpoint(ctx context.Context) {
+	log.Printf("Saving failed events to ConfigMap '%s/%s'", c.checkpoint.namespace, c.checkpoint.name)
+
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.checkpoint.save(); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+}
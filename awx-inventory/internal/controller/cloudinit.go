@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cloudinit"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// userDataTTL is how long cloud-init data read from Secrets is cached
+const userDataTTL = 5 * time.Minute
+
+// cachedUserData is cloud-init data with the time it was fetched
+type cachedUserData struct {
+	userData  string
+	fetchedAt time.Time
+}
+
+// connectionVars returns connection variables derived from the VM's cloud-init data
+func (c *Controller) connectionVars(vm *kubernetes.VirtualMachine) map[string]interface{} {
+	userData := vm.UserData
+	if userData == "" && vm.UserDataSecret != "" {
+		userData = c.userDataFromSecret(vm.Namespace, vm.UserDataSecret)
+	}
+	if userData == "" {
+		return nil
+	}
+
+	cfg, err := cloudinit.Parse(userData)
+	if err != nil {
+		log.Printf("WARN: VM '%s' in namespace '%s': %v", vm.Name, vm.Namespace, err)
+		return nil
+	}
+	return cfg.ConnectionVars()
+}
+
+// userDataFromSecret reads cloud-init data from a provisioning Secret
+func (c *Controller) userDataFromSecret(namespace, name string) string {
+	key := namespace + "/" + name
+	if cached, exists := c.userDataCache.Get(key); exists && time.Since(cached.fetchedAt) < userDataTTL {
+		return cached.userData
+	}
+	if c.k8sClient == nil {
+		return ""
+	}
+
+	data, err := c.k8sClient.GetSecretData(namespace, name)
+	if err != nil {
+		log.Printf("WARN: failed to read provisioning secret '%s' in namespace '%s': %v", name, namespace, err)
+		return ""
+	}
+
+	// Deckhouse accepts either key name for cloud-init secrets
+	var userData string
+	for k, v := range data {
+		if strings.EqualFold(k, "userdata") {
+			userData = string(v)
+			break
+		}
+	}
+
+	c.userDataCache.Add(key, cachedUserData{userData: userData, fetchedAt: time.Now()})
+	return userData
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// constructedSourceVars returns the options of the constructed inventory
+// plugin rebuilding the groups the controller maps VMs into from their host
+// variables. Zone groups need node labels and are not rebuilt.
+func (c *Controller) constructedSourceVars() map[string]interface{} {
+	settings := c.settings.Load()
+	var keyedGroups []interface{}
+	if settings.GroupByClass {
+		keyedGroups = append(keyedGroups, map[string]interface{}{"key": "vm_class", "prefix": "class"})
+	}
+	if settings.GroupByNode {
+		keyedGroups = append(keyedGroups, map[string]interface{}{"key": "vm_node", "prefix": "node"})
+	}
+	for _, key := range settings.GroupLabels {
+		keyedGroups = append(keyedGroups, map[string]interface{}{
+			"key":    fmt.Sprintf("labels[%q]", key),
+			"prefix": sanitizeGroupName(key),
+		})
+	}
+	if c.singleInventory != "" {
+		keyedGroups = append(keyedGroups, map[string]interface{}{"key": "vm_namespace", "prefix": "namespace"})
+	}
+
+	vars := map[string]interface{}{
+		"plugin": "constructed",
+		// VMs without a class, node or label are left out of those groups
+		"strict": false,
+	}
+	if len(keyedGroups) > 0 {
+		vars["keyed_groups"] = keyedGroups
+	}
+	return vars
+}
+
+// syncConstructedInventory creates the constructed inventory, or updates its
+// source variables, and adds the managed inventories to its inputs
+func (c *Controller) syncConstructedInventory(ctx context.Context) error {
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	id, err := c.awxClient.CreateOrUpdateConstructedInventory(ctx, c.constructedInventory, c.managedDescription(), orgID, c.constructedSourceVars())
+	if err != nil {
+		return fmt.Errorf("failed to sync constructed inventory '%s': %w", c.constructedInventory, err)
+	}
+	c.constructedID.Store(int64(id))
+
+	var inputs []awx.Inventory
+	err = c.awxClient.ForEachInventory(ctx, orgID, func(inv awx.Inventory) error {
+		if c.managed(inv.Description) && inv.Kind == "" {
+			inputs = append(inputs, inv)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list inventories: %w", err)
+	}
+	for _, inv := range inputs {
+		if err := c.awxClient.AddInputInventory(ctx, id, inv.ID); err != nil {
+			return fmt.Errorf("failed to add inventory '%s' to constructed inventory '%s': %w", inv.Name, c.constructedInventory, err)
+		}
+	}
+	log.Printf("Constructed inventory '%s' (ID %d) has %d input inventories", c.constructedInventory, id, len(inputs))
+	return nil
+}
+
+// addConstructedInput adds a new inventory to the inputs of the constructed
+// inventory, if there is one
+func (c *Controller) addConstructedInput(ctx context.Context, invID int, inventoryName string) {
+	id := int(c.constructedID.Load())
+	if id == 0 {
+		return
+	}
+	if err := c.awxClient.AddInputInventory(ctx, id, invID); err != nil {
+		log.Printf("WARN: failed to add inventory '%s' to constructed inventory '%s': %v", inventoryName, c.constructedInventory, err)
+		return
+	}
+	log.Printf("Added inventory '%s' to constructed inventory '%s'", inventoryName, c.constructedInventory)
+}
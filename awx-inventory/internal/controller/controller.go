@@ -2,195 +2,1204 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/fl64/ansible-demo/awx-inventory/internal/audit"
 	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cache"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/faults"
 	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/notify"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/schedule"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/snapshot"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/workers"
 )
 
+// VMSource delivers VirtualMachine watch events to the controller
+type VMSource interface {
+	WatchVMs(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error) error
+}
+
+// Backend receives host changes in addition to (or instead of) AWX.
+// Backends that also implement Run(context.Context) are started with the controller.
+type Backend interface {
+	UpsertHost(namespace, hostName string, hostVars map[string]interface{}) error
+	RemoveHost(namespace, hostName string) error
+}
+
 // Controller manages the inventory updater
 type Controller struct {
-	awxClient    *awx.Client
-	k8sClient    *kubernetes.Client
+	awxClient    AWXClient
+	k8sClient    KubernetesClient
+	source       VMSource
+	vmSources    []kubernetes.Source
 	organization string
 	prefix       string
+	nameTemplate *template.Template
+	clusterName  string
+	// Inventory all VMs are synced into, one per namespace if empty
+	singleInventory string
+	// Create the organization during Initialize if it does not exist
+	createOrganization bool
+	// Secret holding the AWX token, watched for rotation if set. token is
+	// the current one and only used by the watch.
+	tokenSecret    string
+	tokenSecretKey string
+	tokenNamespace string
+	token          string
+	// Annotation prefix of host variables set by VM owners, disabled if empty
+	hostVarsPrefix string
+	// Host variables rendered per VM, by variable name
+	hostVarsTemplates map[string]*template.Template
+	// Selects and redacts host variables, nil to push all of them
+	varFilter *varFilter
+	// How host variables are merged with those in AWX, see MergeReplace
+	mergeStrategy string
+	// Connection variables of Windows VMs, disabled if empty
+	winRM map[string]interface{}
+	// Checks new hosts accept connections before adding them, nil if disabled
+	readiness *readinessProbe
+	// Phases of synced VMs, all if empty
+	syncPhases []string
+	// Disable hosts of VMs outside syncPhases instead of removing them
+	disableStopped bool
+	// Interval of pruning empty groups and inventories, 0 if disabled
+	pruneInterval time.Duration
+	// What happens to the inventory of a deleted namespace
+	namespacePolicy string
+	// Annotate VMs with their AWX host ID and address hosts by it
+	annotateHostID bool
+	// Cache of AWX host IDs by namespace/host name
+	hostIDs *cache.LRU[string, int]
+	// Keep VMs with FinalizerCleanup until their host is removed
+	finalizer bool
+	// Records events on VMs, nil if disabled or until Run starts
+	events   bool
+	recorder record.EventRecorder
+	// Annotate VMs with their SyncStatus
+	statusAnnotation bool
+	// Job template launched for new hosts, and the launched job by VM UID:
+	// 0 until the launch succeeded, noProvisioning if the host existed
+	provisionJobTemplate string
+	provisioning         *cache.LRU[string, int]
+	// Job template run before the host of a deleted VM is removed, and the
+	// launched job by VM UID while it runs
+	deprovisionJobTemplate string
+	deprovisionTimeout     time.Duration
+	deprovisioning         *cache.LRU[string, int]
+	// Relaunches of failed jobs, the backoff doubles with each attempt
+	jobRetries      int
+	jobRetryBackoff time.Duration
+	jobTracker      jobTracker
+	// Ping new hosts with an ad hoc command, using pingCredential unless
+	// the VM has a synced SSH credential
+	pingHosts      bool
+	pingCredential string
+	// Host name template, the hostname field or VM name if nil
+	hostnameTemplate *template.Template
+	// Host names asked for by VMs, to resolve collisions
+	hostClaims *hostNameClaims
+	// Watched namespaces, empty for all namespaces
+	namespaces []string
+	// Remove hosts of deleted VMs during Initialize
+	startupGC bool
+	// Create hosts of existing VMs with the bulk API during Initialize
+	startupBulkCreate bool
 	// Cache of inventory IDs by namespace
-	inventoryCache map[string]int
+	inventoryCache *cache.LRU[string, int]
+	// Host names VMs were last synced under, by namespace/name
+	hostNames *cache.LRU[string, string]
+	// Hash of the last state synced to AWX, by namespace/host name
+	hostStates *cache.LRU[string, [sha256.Size]byte]
+	// AnsibleJob reconciliation settings
+	ansibleJobs         bool
+	ansibleJobsInterval time.Duration
+	// Periodic snapshot settings, disabled if snapshotStore is nil
+	snapshotStore    *snapshot.Store
+	snapshotInterval time.Duration
+	// Optional second AWX receiving the same writes, nil if disabled
+	shadow *shadow
+	// awxEnabled is false when only other backends are used
+	awxEnabled bool
+	// How Initialize waits for AWX
+	awxWaitTimeout  time.Duration
+	awxWaitInterval time.Duration
+	skipAWXWait     bool
+	permissionCheck bool
+	// Additional backends, e.g. local ansible-runner or Rundeck
+	backends []Backend
+	// Settings that can be reloaded, see Reload
+	settings atomic.Pointer[Settings]
+	// previousSettings are the settings before the last reload
+	previousSettings atomic.Pointer[Settings]
+	nodeTopologies   *cache.LRU[string, cachedTopology]
+	// Derive connection variables from cloud-init data
+	cloudInitVars bool
+	userDataCache *cache.LRU[string, cachedUserData]
+	// Sync SSH keys from provisioning Secrets into AWX credentials
+	sshCredentials  bool
+	credentialCache *cache.LRU[string, syncedCredential]
+	// Sync Secrets labeled LabelCredential into AWX credentials, attaching
+	// them to the job templates of the namespace's inventory
+	credentialSecrets   bool
+	credentialTemplates bool
+	// Sync InventoryVarsConfigMap of each namespace into its inventory
+	inventoryVarsEnabled bool
+	inventoryVars        inventoryVars
+	// Variables of groups by name, overridden by GroupVarsConfigMap, and
+	// the hash of the variables last set by inventory ID and group name
+	groupVarsBase       map[string]map[string]interface{}
+	groupVarsConfigMaps bool
+	groupVars           groupVars
+	appliedGroupVars    *cache.LRU[string, [sha256.Size]byte]
+	// Child group patterns by parent group, and the IDs of the groups
+	// already linked to their parents
+	groupParents map[string][]string
+	linkedGroups *cache.LRU[string, bool]
+	// Smart inventories of the hosts of VMs matching label selectors
+	smartInventories []smartInventory
+	// Name and ID of the constructed inventory over all managed
+	// inventories, the ID set once it was synced
+	constructedInventory string
+	constructedID        atomic.Int64
+	// Stale host TTL policy, nil if disabled
+	expiry *hostExpiry
+	// Windows during which events are queued, nil if none are configured
+	blackout *blackout
+	// ConfigMap publishing the namespace to inventory mapping, disabled if empty
+	inventoryMap          string
+	inventoryMapNamespace string
+	inventoryMapInterval  time.Duration
+	// Failed events saved across restarts, nil if disabled
+	checkpoint *checkpoint
+	// Pending VM events, the number of workers applying them and the window
+	// coalescing MODIFIED events
+	queue          *eventQueue
+	workerCount    int
+	coalesceWindow time.Duration
+	// How long pending events are applied after the watch stopped
+	shutdownTimeout time.Duration
+	// Webhook notifications, nil if disabled, and the failed syncs of a VM
+	// in a row notified about
+	notifier         *notify.Notifier
+	failureThreshold int
+	failures         *failureStreaks
+	// Instrumentation of event processing workers
+	workers                *workers.Pool
+	goroutineLeakThreshold int
+	// Protects status fields read by the status API
+	mu          sync.RWMutex
+	lastEventAt time.Time
+	lastError   string
+	// Probe state: whether Initialize finished, the VM watch runs and the
+	// last AWX ping
+	initialized bool
+	watching    bool
+	lastPingAt  time.Time
+	lastPingErr error
+}
+
+// Config holds the controller configuration
+type Config struct {
+	AWXURL   string
+	AWXToken string
+	// AWXTokenFile is read instead of AWXToken and reread when it changes
+	AWXTokenFile string
+	// AWXTokenSecret names a Secret in AWXTokenNamespace whose
+	// AWXTokenSecretKey is used instead of AWXToken. The Secret is watched,
+	// so a rotated token is used right away.
+	AWXTokenSecret    string
+	AWXTokenSecretKey string
+	AWXTokenNamespace string
+	// AWXUsername and AWXPassword authenticate with basic auth instead of a token
+	AWXUsername string
+	AWXPassword string
+	// AWXOAuthClientID and AWXOAuthClientSecret request tokens for an AWX
+	// OAuth2 application instead of using a static token
+	AWXOAuthClientID     string
+	AWXOAuthClientSecret string
+	// AWXTLS configures a custom CA, client certificate or disabled verification
+	AWXTLS awx.TLSOptions
+	// AWXHeaders are added to every AWX request, e.g. for an authenticating proxy
+	AWXHeaders http.Header
+	// AWXRateLimit caps AWX requests per second, 0 means unlimited
+	AWXRateLimit float64
+	AWXRateBurst int
+	// AWXWaitTimeout is how long Initialize waits for AWX, 5 minutes if 0,
+	// checking every AWXWaitInterval, 5 seconds if 0
+	AWXWaitTimeout  time.Duration
+	AWXWaitInterval time.Duration
+	// SkipAWXWait checks AWX once, failing Initialize if it is not available
+	SkipAWXWait bool
+	// PermissionCheck fails Initialize if the AWX user cannot create
+	// inventories or change the managed ones
+	PermissionCheck bool
+	// AWXResponseCache bounds the organization, inventory and group
+	// responses revalidated with ETag and Last-Modified, 0 disables caching
+	AWXResponseCache int
+	InventoryPrefix  string
+	Organization     string
+	// CreateOrganization creates a missing organization, which needs an admin token
+	CreateOrganization bool
+	// InventoryNameTemplate names inventories, "<prefix> <namespace>" if nil
+	InventoryNameTemplate *template.Template
+	// SingleInventory syncs all VMs into the inventory of this name instead
+	// of one inventory per namespace, with the namespace as a group
+	SingleInventory string
+	// ClusterName is available to the name templates as .ClusterName
+	ClusterName string
+	// HostnameTemplate names hosts, the hostname field or VM name if nil
+	HostnameTemplate *template.Template
+	// HostVarsPrefix copies annotations with this prefix into host
+	// variables, named after the rest of the key
+	HostVarsPrefix string
+	// HostVarsTemplates set host variables to templates rendered with the
+	// data of HostnameTemplate, by variable name
+	HostVarsTemplates map[string]*template.Template
+	// HostVarsInclude and HostVarsExclude list glob patterns of host variables
+	// to push to AWX, or to leave out. Nested variables are named like "labels.app".
+	HostVarsInclude []string
+	HostVarsExclude []string
+	// HostVarsRedact lists glob patterns of variable keys whose values are redacted
+	HostVarsRedact []string
+	// MergeStrategy merges host variables with those in AWX, MergeReplace if empty
+	MergeStrategy string
+	// WinRMVars are set on VMs detected to run Windows, e.g. ansible_connection=winrm
+	WinRMVars map[string]interface{}
+	// ReadinessPort, if set, delays adding hosts until ansible_host accepts
+	// TCP connections on it, or on ansible_port if the host sets one. Each
+	// check tries ReadinessRetries times with ReadinessTimeout.
+	ReadinessPort    int
+	ReadinessTimeout time.Duration
+	ReadinessRetries int
+	// SyncPhases limits synced VMs to these phases, e.g. Running; all if empty
+	SyncPhases []string
+	// DisableStopped disables the hosts of VMs outside SyncPhases or without
+	// an IP address in AWX instead of removing them
+	DisableStopped bool
+	// PruneInterval is how often empty managed groups and the inventories of
+	// deleted namespaces are removed, 0 to disable pruning
+	PruneInterval time.Duration
+	// NamespacePolicy is NamespaceOrphan, NamespaceDelete or NamespaceRename,
+	// applied to the inventory of a deleted namespace
+	NamespacePolicy string
+	// AnnotateHostID records the AWX host ID on VMs as AnnotationHostID, so
+	// hosts are updated and deleted by ID instead of looked up by name
+	AnnotateHostID bool
+	// Finalizer adds FinalizerCleanup to synced VMs, so they are only deleted
+	// once their host was removed from AWX
+	Finalizer bool
+	// Events records sync outcomes as Kubernetes Events on the VMs
+	Events bool
+	// StatusAnnotation records the last sync of VMs as AnnotationSyncStatus
+	StatusAnnotation bool
+	// ProvisionJobTemplate is launched, limited to the host, once a VM's
+	// host was created. AnnotationProvisionJob can override it per VM.
+	ProvisionJobTemplate string
+	// DeprovisionJobTemplate is launched, limited to the host, when a VM is
+	// deleted. The host is removed once the job finished or after
+	// DeprovisionTimeout. AnnotationDeprovisionJob can override it per VM.
+	DeprovisionJobTemplate string
+	DeprovisionTimeout     time.Duration
+	// JobRetries relaunches failed provisioning and deprovisioning jobs up
+	// to this many times, waiting JobRetryBackoff, doubled each attempt
+	JobRetries      int
+	JobRetryBackoff time.Duration
+	// PingHosts runs the ping module against new hosts and records the
+	// result as AnnotationPingStatus and the vm_reachable host variable.
+	// PingCredential names the Machine credential, VMs with a credential
+	// synced by SSHCredentials use theirs.
+	PingHosts      bool
+	PingCredential string
+	// Namespaces limits the watched namespaces, all if empty. Each namespace
+	// is watched separately, so no cluster-wide access is needed.
+	Namespaces []string
+	// VMLabelSelector limits synced VMs to those matching this label selector
+	VMLabelSelector string
+	// VMResources are the watched resources, DefaultVMResource if empty.
+	// Each one is watched concurrently by its own source.
+	VMResources []kubernetes.VMResource
+	// AnsibleJobs enables reconciliation of AnsibleJob resources
+	AnsibleJobs         bool
+	AnsibleJobsInterval time.Duration
+	// SnapshotStore enables periodic inventory snapshots when set
+	SnapshotStore    *snapshot.Store
+	SnapshotInterval time.Duration
+	// ShadowAWXURL enables dual writes to a second AWX instance when set,
+	// or to an in-memory fake with "memory://". The shadow uses the
+	// connection settings of the primary and ShadowAWXToken if set.
+	ShadowAWXURL   string
+	ShadowAWXToken string
+	// Faults configures fault injection for resilience testing
+	Faults faults.Config
+	// NoKubernetes skips creating the Kubernetes client, so events can only
+	// come from Source or be fed through HandleEvent
+	NoKubernetes bool
+	// Kubernetes overrides the in-cluster Kubernetes client, e.g. with one
+	// built on a fake dynamic client
+	Kubernetes KubernetesClient
+	// Sources override the sources built from VMResources, defaulting to
+	// Kubernetes if it is set
+	Sources []kubernetes.Source
+	// Source overrides the VirtualMachine watch, e.g. with synthetic VMs
+	Source VMSource
+	// CacheSize bounds each internal lookup cache, 0 means unbounded
+	CacheSize int
+	// GoroutineLeakThreshold is the goroutine growth over the startup
+	// baseline that is reported as a suspected leak, 0 disables the check
+	GoroutineLeakThreshold int
+	// DisableAWX skips all AWX calls, for use with other backends only
+	DisableAWX bool
+	// Backends receive host changes alongside AWX
+	Backends []Backend
+	// GroupByClass adds hosts to a class_<name> group per VirtualMachineClass
+	GroupByClass bool
+	// GroupByNode adds hosts to a node_<name> group for the node they run on
+	GroupByNode bool
+	// GroupByZone adds hosts to zone_<zone> and region_<region> groups
+	// from the topology labels of their node
+	GroupByZone bool
+	// GroupLabels adds hosts to a <label>_<value> group for each of these label keys
+	GroupLabels []string
+	// CloudInitVars publishes ansible_user and SSH key fingerprints parsed
+	// from the VM's cloud-init provisioning data
+	CloudInitVars bool
+	// SSHCredentials creates AWX Machine credentials from provisioning
+	// Secrets that contain an ssh-privatekey
+	SSHCredentials bool
+	// CredentialSecrets creates AWX Machine credentials from Secrets labeled
+	// LabelCredential=ssh in the watched namespaces and deletes them with
+	// the Secret. CredentialTemplates attaches them to the job templates
+	// using the namespace's inventory.
+	CredentialSecrets   bool
+	CredentialTemplates bool
+	// InventoryVars replaces the variables of each namespace's inventory
+	// with the data of its InventoryVarsConfigMap, values parsed as YAML
+	InventoryVars bool
+	// GroupVars sets the variables of groups by name in every inventory.
+	// GroupVarsConfigMaps lets the GroupVarsConfigMap of a namespace
+	// override them for its inventory.
+	GroupVars           map[string]map[string]interface{}
+	GroupVarsConfigMaps bool
+	// GroupParents maps parent groups to path.Match patterns of groups
+	// made their children, e.g. "apps" to "app_*". Missing parents are
+	// created, and parents can have parents of their own.
+	GroupParents map[string][]string
+	// SmartInventories creates a smart inventory by name with the hosts of
+	// VMs matching each label selector, across all managed inventories
+	SmartInventories map[string]string
+	// ConstructedInventory names a constructed inventory, needing AWX 22 or
+	// AAP 2.4, whose inputs are all managed inventories and whose groups
+	// are rebuilt with the group settings, empty to disable it
+	ConstructedInventory string
+	// HostTTL disables hosts whose VM has not been seen for this long and
+	// removes them after twice as long, 0 disables expiry
+	HostTTL time.Duration
+	// BlackoutWindows defer all host changes while any window is open
+	BlackoutWindows []schedule.Window
+	// InventoryMapConfigMap publishes the namespace to inventory mapping
+	// to this ConfigMap in InventoryMapNamespace when set
+	InventoryMapConfigMap string
+	InventoryMapNamespace string
+	InventoryMapInterval  time.Duration
+	// CheckpointConfigMap saves events that failed to apply to this
+	// ConfigMap in CheckpointNamespace, to replay them after a restart
+	CheckpointConfigMap string
+	CheckpointNamespace string
+	// Workers is the number of namespaces whose VM events are applied in parallel
+	Workers int
+	// CoalesceWindow delays MODIFIED events of a VM synced less than this
+	// ago until it passed, keeping only the latest. 0 applies them right away.
+	CoalesceWindow time.Duration
+	// ShutdownTimeout is how long the queued events are still applied once
+	// the context is cancelled, before the remaining syncs are aborted
+	ShutdownTimeout time.Duration
+	// StartupGC deletes hosts whose VM no longer exists during Initialize
+	StartupGC bool
+	// StartupBulkCreate creates the hosts of existing VMs in batches during
+	// Initialize if AWX supports the bulk API
+	StartupBulkCreate bool
+	// AWXClient replaces the client built from the AWX settings, e.g. with
+	// an in-memory awxfake.Client
+	AWXClient AWXClient
+	// AuditLog records every change made in AWX when set
+	AuditLog *audit.Log
+	// Notifier is told about added and removed hosts, created inventories
+	// and VMs whose sync failed NotifyFailureThreshold times in a row
+	Notifier               *notify.Notifier
+	NotifyFailureThreshold int
 }
 
 // New creates a new controller
-func New(awxURL, awxToken, prefix, organization, namespace string) (*Controller, error) {
-	awxClient := awx.NewClient(awxURL, awxToken)
+func New(cfg Config) (*Controller, error) {
+	awxClient := cfg.AWXClient
+	if awxClient == nil {
+		client, err := newAWXClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		awxClient = client
+	}
+	if cfg.AuditLog != nil {
+		awxClient = newAuditedClient(awxClient, cfg.AuditLog)
+	}
+
+	if len(cfg.VMResources) == 0 {
+		cfg.VMResources = []kubernetes.VMResource{kubernetes.DefaultVMResource}
+	}
+
+	k8sClient := cfg.Kubernetes
+	vmSources := cfg.Sources
+	if k8sClient == nil && !cfg.NoKubernetes {
+		client, err := kubernetes.NewClient(cfg.Namespaces...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		if cfg.Faults.Enabled() {
+			client.SetFaults(cfg.Faults)
+		}
+		client.SetVMResource(cfg.VMResources[0])
+		k8sClient = client
+		if len(vmSources) == 0 {
+			vmSources = append(vmSources, client)
+			for _, resource := range cfg.VMResources[1:] {
+				vmSources = append(vmSources, client.ForResource(resource))
+			}
+		}
+	}
+	if len(vmSources) == 0 && k8sClient != nil {
+		vmSources = append(vmSources, k8sClient)
+	}
+	for _, vmSource := range vmSources {
+		vmSource.SetLabelSelector(cfg.VMLabelSelector)
+	}
 
-	k8sClient, err := kubernetes.NewClient(namespace)
+	if cfg.AnsibleJobsInterval <= 0 {
+		cfg.AnsibleJobsInterval = 15 * time.Second
+	}
+	if cfg.SnapshotInterval <= 0 {
+		cfg.SnapshotInterval = time.Hour
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.InventoryMapInterval <= 0 {
+		cfg.InventoryMapInterval = time.Minute
+	}
+	if cfg.NotifyFailureThreshold <= 0 {
+		cfg.NotifyFailureThreshold = 3
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.AWXWaitTimeout <= 0 {
+		cfg.AWXWaitTimeout = 5 * time.Minute
+	}
+	if cfg.AWXWaitInterval <= 0 {
+		cfg.AWXWaitInterval = 5 * time.Second
+	}
+	if cfg.DeprovisionTimeout <= 0 {
+		cfg.DeprovisionTimeout = 10 * time.Minute
+	}
+	if cfg.JobRetryBackoff <= 0 {
+		cfg.JobRetryBackoff = time.Minute
+	}
+
+	var shadowTarget *shadow
+	if cfg.ShadowAWXURL != "" {
+		shadowClient, err := newShadowClient(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create shadow AWX client: %w", err)
+		}
+		shadowTarget = newShadow(shadowClient, cfg.Organization, cfg.CacheSize)
+	}
+
+	var blackoutQueue *blackout
+	if len(cfg.BlackoutWindows) > 0 {
+		blackoutQueue = newBlackout(cfg.BlackoutWindows)
+	}
+
+	smartInventories, err := newSmartInventories(cfg.SmartInventories)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		return nil, err
 	}
 
-	return &Controller{
-		awxClient:      awxClient,
-		k8sClient:      k8sClient,
-		organization:   organization,
-		prefix:         prefix,
-		inventoryCache: make(map[string]int),
-	}, nil
-}
+	var expiry *hostExpiry
+	if cfg.HostTTL > 0 {
+		expiry = newHostExpiry(cfg.HostTTL)
+	}
 
-// Initialize initializes the controller
-func (c *Controller) Initialize() error {
-	// Wait for AWX
-	timeout := 300 * time.Second
-	interval := 5 * time.Second
-	if timeoutStr := os.Getenv("AWX_WAIT_TIMEOUT"); timeoutStr != "" {
-		if d, err := time.ParseDuration(timeoutStr + "s"); err == nil {
-			timeout = d
+	c := &Controller{
+		awxClient:              awxClient,
+		k8sClient:              k8sClient,
+		source:                 cfg.Source,
+		vmSources:              vmSources,
+		organization:           cfg.Organization,
+		createOrganization:     cfg.CreateOrganization,
+		tokenSecret:            cfg.AWXTokenSecret,
+		tokenSecretKey:         cfg.AWXTokenSecretKey,
+		tokenNamespace:         cfg.AWXTokenNamespace,
+		hostVarsPrefix:         cfg.HostVarsPrefix,
+		hostVarsTemplates:      cfg.HostVarsTemplates,
+		varFilter:              newVarFilter(cfg.HostVarsInclude, cfg.HostVarsExclude, cfg.HostVarsRedact),
+		mergeStrategy:          cfg.MergeStrategy,
+		winRM:                  cfg.WinRMVars,
+		readiness:              newReadinessProbe(cfg.ReadinessPort, cfg.ReadinessTimeout, cfg.ReadinessRetries),
+		syncPhases:             cfg.SyncPhases,
+		disableStopped:         cfg.DisableStopped,
+		pruneInterval:          cfg.PruneInterval,
+		namespacePolicy:        cfg.NamespacePolicy,
+		annotateHostID:         cfg.AnnotateHostID,
+		hostIDs:                cache.NewLRU[string, int]("host_id", cfg.CacheSize),
+		finalizer:              cfg.Finalizer,
+		events:                 cfg.Events,
+		statusAnnotation:       cfg.StatusAnnotation,
+		provisionJobTemplate:   cfg.ProvisionJobTemplate,
+		provisioning:           cache.NewLRU[string, int]("provisioning", cfg.CacheSize),
+		deprovisionJobTemplate: cfg.DeprovisionJobTemplate,
+		deprovisionTimeout:     cfg.DeprovisionTimeout,
+		deprovisioning:         cache.NewLRU[string, int]("deprovisioning", cfg.CacheSize),
+		jobRetries:             cfg.JobRetries,
+		jobRetryBackoff:        cfg.JobRetryBackoff,
+		jobTracker:             jobTracker{jobs: make(map[string]*trackedJob)},
+		pingHosts:              cfg.PingHosts,
+		pingCredential:         cfg.PingCredential,
+		prefix:                 cfg.InventoryPrefix,
+		nameTemplate:           cfg.InventoryNameTemplate,
+		clusterName:            cfg.ClusterName,
+		singleInventory:        cfg.SingleInventory,
+		hostnameTemplate:       cfg.HostnameTemplate,
+		hostClaims:             newHostNameClaims(cfg.CacheSize),
+		namespaces:             cfg.Namespaces,
+		startupGC:              cfg.StartupGC,
+		startupBulkCreate:      cfg.StartupBulkCreate,
+		inventoryCache:         cache.NewLRU[string, int]("inventory", cfg.CacheSize),
+		hostNames:              cache.NewLRU[string, string]("host_name", cfg.CacheSize),
+		hostStates:             cache.NewLRU[string, [sha256.Size]byte]("host_state", cfg.CacheSize),
+		ansibleJobs:            cfg.AnsibleJobs,
+		ansibleJobsInterval:    cfg.AnsibleJobsInterval,
+		snapshotStore:          cfg.SnapshotStore,
+		snapshotInterval:       cfg.SnapshotInterval,
+		shadow:                 shadowTarget,
+		workers:                workers.NewPool("events"),
+		workerCount:            cfg.Workers,
+		coalesceWindow:         cfg.CoalesceWindow,
+		shutdownTimeout:        cfg.ShutdownTimeout,
+		notifier:               cfg.Notifier,
+		failureThreshold:       cfg.NotifyFailureThreshold,
+		failures:               newFailureStreaks(),
+		goroutineLeakThreshold: cfg.GoroutineLeakThreshold,
+		awxEnabled:             !cfg.DisableAWX,
+		awxWaitTimeout:         cfg.AWXWaitTimeout,
+		awxWaitInterval:        cfg.AWXWaitInterval,
+		skipAWXWait:            cfg.SkipAWXWait,
+		permissionCheck:        cfg.PermissionCheck,
+		backends:               cfg.Backends,
+		nodeTopologies:         cache.NewLRU[string, cachedTopology]("node_topology", cfg.CacheSize),
+		cloudInitVars:          cfg.CloudInitVars,
+		userDataCache:          cache.NewLRU[string, cachedUserData]("user_data", cfg.CacheSize),
+		sshCredentials:         cfg.SSHCredentials,
+		credentialCache:        cache.NewLRU[string, syncedCredential]("credential", cfg.CacheSize),
+		credentialSecrets:      cfg.CredentialSecrets,
+		credentialTemplates:    cfg.CredentialTemplates,
+		inventoryVarsEnabled:   cfg.InventoryVars,
+		inventoryVars:          inventoryVars{byNamespace: make(map[string]map[string]interface{})},
+		groupVarsBase:          cfg.GroupVars,
+		groupVarsConfigMaps:    cfg.GroupVarsConfigMaps,
+		groupVars:              groupVars{byNamespace: make(map[string]map[string]map[string]interface{})},
+		appliedGroupVars:       cache.NewLRU[string, [sha256.Size]byte]("group_vars", cfg.CacheSize),
+		groupParents:           cfg.GroupParents,
+		linkedGroups:           cache.NewLRU[string, bool]("group_parents", cfg.CacheSize),
+		smartInventories:       smartInventories,
+		constructedInventory:   cfg.ConstructedInventory,
+		expiry:                 expiry,
+		blackout:               blackoutQueue,
+		inventoryMap:           cfg.InventoryMapConfigMap,
+		inventoryMapNamespace:  cfg.InventoryMapNamespace,
+		inventoryMapInterval:   cfg.InventoryMapInterval,
+	}
+	c.settings.Store(&Settings{
+		VMLabelSelector: cfg.VMLabelSelector,
+		GroupByClass:    cfg.GroupByClass,
+		GroupByNode:     cfg.GroupByNode,
+		GroupByZone:     cfg.GroupByZone,
+		GroupLabels:     cfg.GroupLabels,
+	})
+	if c.tokenSecret != "" && c.awxEnabled {
+		if err := c.loadTokenSecret(); err != nil {
+			return nil, err
 		}
 	}
-	if intervalStr := os.Getenv("AWX_WAIT_INTERVAL"); intervalStr != "" {
-		if d, err := time.ParseDuration(intervalStr + "s"); err == nil {
-			interval = d
+	if cfg.CheckpointConfigMap != "" {
+		if k8sClient == nil {
+			log.Printf("WARN: the queue checkpoint requires a Kubernetes client, skipping")
+		} else {
+			c.checkpoint = newCheckpoint(k8sClient, cfg.CheckpointNamespace, cfg.CheckpointConfigMap, vmSources, c.defaultSource())
 		}
 	}
+	return c, nil
+}
 
-	log.Printf("Waiting for AWX availability...")
-	if err := c.awxClient.WaitForAWX(timeout, interval); err != nil {
+// Initialize initializes the controller
+func (c *Controller) Initialize(ctx context.Context) error {
+	if !c.awxEnabled {
+		c.recordSuccess("")
+		c.recordInitialized()
+		log.Printf("Controller initialized without AWX, using %d other backends only", len(c.backends))
+		return nil
+	}
+
+	timeout := c.awxWaitTimeout
+	if c.skipAWXWait {
+		timeout = 0
+		log.Printf("Checking AWX availability...")
+	} else {
+		log.Printf("Waiting up to %v for AWX availability...", timeout)
+	}
+	if err := c.awxClient.WaitForAWX(ctx, timeout, c.awxWaitInterval); err != nil {
 		return fmt.Errorf("failed to wait for AWX: %w", err)
 	}
 	log.Printf("AWX is available")
+	c.recordPing(nil)
 
 	// Verify organization exists
-	_, err := c.awxClient.GetOrganizationID(c.organization)
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if errors.Is(err, awx.ErrOrganizationNotFound) && c.createOrganization {
+		log.Printf("Creating organization '%s'...", c.organization)
+		orgID, err = c.awxClient.CreateOrganization(ctx, c.organization)
+		if err == nil {
+			log.Printf("Organization '%s' created with ID: %d", c.organization, orgID)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get organization ID: %w", err)
 	}
+	if c.permissionCheck {
+		if err := c.checkPermissions(ctx, orgID); err != nil {
+			return err
+		}
+	}
 
+	if c.startupGC && len(c.vmSources) > 0 {
+		if err := c.collectGarbage(ctx); err != nil {
+			log.Printf("ERROR: failed to remove stale hosts: %v", err)
+		}
+	}
+	if len(c.smartInventories) > 0 {
+		if err := c.syncSmartInventories(ctx); err != nil {
+			log.Printf("ERROR: failed to sync smart inventories: %v", err)
+		}
+	}
+	if c.constructedInventory != "" {
+		if err := c.syncConstructedInventory(ctx); err != nil {
+			log.Printf("ERROR: failed to sync constructed inventory: %v", err)
+		}
+	}
+	if c.startupBulkCreate && len(c.vmSources) > 0 {
+		if err := c.bulkCreateHosts(ctx); err != nil {
+			log.Printf("ERROR: failed to bulk create hosts, falling back to creating them one by one: %v", err)
+		}
+	}
+
+	c.recordSuccess("")
+	c.recordInitialized()
 	log.Printf("Controller initialized. Inventories will be created per namespace as needed.")
 	return nil
 }
 
 // getOrCreateInventoryForNamespace gets or creates inventory for a namespace
-func (c *Controller) getOrCreateInventoryForNamespace(namespace string) (int, error) {
+func (c *Controller) getOrCreateInventoryForNamespace(ctx context.Context, namespace string) (int, error) {
 	// Check cache first
-	if invID, exists := c.inventoryCache[namespace]; exists {
+	invID, exists := c.inventoryCache.Get(namespace)
+	if exists {
 		return invID, nil
 	}
 
-	// Build inventory name: prefix + namespace (or just namespace if prefix is empty)
-	var inventoryName string
-	if c.prefix != "" {
-		inventoryName = fmt.Sprintf("%s %s", c.prefix, namespace)
-	} else {
-		inventoryName = namespace
-	}
+	inventoryName := c.inventoryName(namespace)
 
 	// Get organization ID
-	orgID, err := c.awxClient.GetOrganizationID(c.organization)
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get organization ID: %w", err)
 	}
 
 	// Get or create inventory
-	invID, err := c.awxClient.GetInventoryID(inventoryName)
+	invID, err = c.awxClient.GetInventoryID(ctx, inventoryName)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get inventory ID: %w", err)
 	}
 
 	if invID == 0 {
 		log.Printf("Creating inventory '%s' for namespace '%s'...", inventoryName, namespace)
-		invID, err = c.awxClient.CreateInventory(inventoryName, orgID)
+		invID, err = c.awxClient.CreateInventory(ctx, inventoryName, c.inventoryDescription(namespace), orgID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to create inventory: %w", err)
 		}
 		log.Printf("Inventory '%s' created with ID: %d", inventoryName, invID)
+		c.notifyInventoryCreated(namespace, inventoryName)
+		if err := c.applyInventoryVars(ctx, namespace, invID); err != nil {
+			log.Printf("WARN: %v", err)
+		}
+		c.addConstructedInput(ctx, invID, inventoryName)
 	} else {
 		log.Printf("Inventory '%s' already exists with ID: %d", inventoryName, invID)
 	}
 
 	// Cache the inventory ID
-	c.inventoryCache[namespace] = invID
+	c.inventoryCache.Add(namespace, invID)
+	metrics.Inventories.Set(float64(c.inventoryCache.Len()))
 	return invID, nil
 }
 
-// handleVMAdded handles ADDED or MODIFIED events
-func (c *Controller) handleVMAdded(vm *kubernetes.VirtualMachine) error {
-	// Get or create inventory for this namespace
-	invID, err := c.getOrCreateInventoryForNamespace(vm.Namespace)
+// lookupInventoryForNamespace returns the inventory ID of a namespace, or 0 if it has none
+func (c *Controller) lookupInventoryForNamespace(ctx context.Context, namespace string) (int, error) {
+	if invID, exists := c.inventoryCache.Get(namespace); exists {
+		return invID, nil
+	}
+
+	invID, err := c.awxClient.GetInventoryID(ctx, c.inventoryName(namespace))
 	if err != nil {
-		return fmt.Errorf("failed to get inventory for namespace '%s': %w", vm.Namespace, err)
+		return 0, fmt.Errorf("failed to get inventory ID: %w", err)
+	}
+	if invID > 0 {
+		c.inventoryCache.Add(namespace, invID)
+		metrics.Inventories.Set(float64(c.inventoryCache.Len()))
 	}
+	return invID, nil
+}
+
+// inventoryNameData is passed to the inventory name template
+type inventoryNameData struct {
+	Namespace   string
+	ClusterName string
+	Prefix      string
+}
 
-	hostName := vm.Name
+// inventoryName builds inventory name from the name template, or prefix +
+// namespace (or just namespace if prefix is empty) without one. In single
+// inventory mode every namespace maps to the same inventory.
+func (c *Controller) inventoryName(namespace string) string {
+	if c.singleInventory != "" {
+		return c.singleInventory
+	}
+	if c.nameTemplate != nil {
+		var name strings.Builder
+		err := c.nameTemplate.Execute(&name, inventoryNameData{
+			Namespace:   namespace,
+			ClusterName: c.clusterName,
+			Prefix:      c.prefix,
+		})
+		if result := strings.TrimSpace(name.String()); err == nil && result != "" {
+			return result
+		}
+		log.Printf("WARN: inventory name template failed for namespace '%s', using the namespace: %v", namespace, err)
+		return namespace
+	}
+	if c.prefix != "" {
+		return fmt.Sprintf("%s %s", c.prefix, namespace)
+	}
+	return namespace
+}
 
+// hostVars returns the variables of the host of a VM
+func (c *Controller) hostVars(vm *kubernetes.VirtualMachine) map[string]interface{} {
 	hostVars := map[string]interface{}{
 		"vm_name":      vm.Name,
 		"vm_namespace": vm.Namespace,
 		"labels":       vm.Labels,
-		"ansible_host": vm.IP,
+		"ansible_host": ansibleHost(vm),
+	}
+	if vm.ClassName != "" {
+		hostVars["vm_class"] = vm.ClassName
+	}
+	if vm.NodeName != "" {
+		hostVars["vm_node"] = vm.NodeName
+	}
+	if others := otherAddresses(vm); len(others) > 0 {
+		hostVars["vm_addresses"] = others
+	}
+	if vm.CPUCores > 0 {
+		hostVars["vm_cpu"] = vm.CPUCores
+	}
+	if vm.Memory != "" {
+		hostVars["vm_memory"] = vm.Memory
+	}
+	if osVars := guestOSVars(vm.OS); len(osVars) > 0 {
+		hostVars["vm_os"] = osVars
+	}
+	if vm.AgentReady != nil {
+		hostVars["vm_agent_ready"] = *vm.AgentReady
+	}
+	if status := vm.Annotations[AnnotationPingStatus]; status != "" {
+		hostVars["vm_reachable"] = status == jobStatusSuccessful
+	}
+	for k, v := range vm.Vars {
+		hostVars[k] = v
+	}
+	for k, v := range c.templateVars(vm) {
+		hostVars[k] = v
+	}
+	if c.cloudInitVars {
+		for k, v := range c.connectionVars(vm) {
+			hostVars[k] = v
+		}
+	}
+	for k, v := range c.winRMVars(vm) {
+		hostVars[k] = v
+	}
+	for k, v := range c.annotationVars(vm) {
+		hostVars[k] = v
+	}
+	return c.varFilter.apply(hostVars)
+}
+
+// guestOSVars returns the non-empty fields of the guest OS as host variables
+func guestOSVars(info kubernetes.GuestOS) map[string]interface{} {
+	osVars := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"id":          info.ID,
+		"name":        info.Name,
+		"pretty_name": info.PrettyName,
+		"version":     info.Version,
+		"kernel":      info.KernelRelease,
+	} {
+		if value != "" {
+			osVars[key] = value
+		}
+	}
+	return osVars
+}
+
+// handleVMAdded handles ADDED or MODIFIED events
+func (c *Controller) handleVMAdded(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	hostName := c.claimHostName(vm)
+
+	// The host name changed, drop the host synced under the old name unless
+	// another VM took it over in a collision
+	vmKey := vm.Namespace + "/" + vm.Name
+	if previous, exists := c.hostNames.Get(vmKey); exists && previous != hostName {
+		log.Printf("Host name of VM '%s' in namespace '%s' changed from '%s' to '%s'", vm.Name, vm.Namespace, previous, hostName)
+		if !c.hostClaims.heldByOther(c.inventoryName(vm.Namespace), previous, vmKey) {
+			if err := c.handleVMDeleted(ctx, vm.Namespace, previous); err != nil {
+				return fmt.Errorf("failed to remove host '%s': %w", previous, err)
+			}
+		}
+		c.hostNames.Remove(vmKey)
+	}
+
+	hostVars := c.hostVars(vm)
+	if _, known := c.hostNames.Get(vmKey); !known {
+		if err := c.readiness.check(ctx, hostVars); err != nil {
+			return err
+		}
+	}
+	for _, backend := range c.backends {
+		if err := backend.UpsertHost(vm.Namespace, hostName, hostVars); err != nil {
+			return fmt.Errorf("failed to update host in %T backend: %w", backend, err)
+		}
+	}
+	c.hostNames.Add(vmKey, hostName)
+	if !c.awxEnabled {
+		return nil
+	}
+
+	// Get or create inventory for this namespace
+	invID, err := c.getOrCreateInventoryForNamespace(ctx, vm.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory for namespace '%s': %w", vm.Namespace, err)
+	}
+
+	// Status churn produces MODIFIED events that change nothing in AWX
+	groups := c.desiredGroups(vm)
+	stateKey := vm.Namespace + "/" + hostName
+	description := c.hostDescription(vm)
+	state, err := hostStateHash(hostVars, groups, description)
+	if err != nil {
+		return err
+	}
+	if synced, exists := c.hostStates.Get(stateKey); exists && synced == state {
+		metrics.SyncSkippedTotal.Inc()
+		if err := c.markHostSeen(ctx, invID, vm.Namespace, hostName); err != nil {
+			return fmt.Errorf("failed to re-enable host: %w", err)
+		}
+		// Secrets change independently of the VM, syncCredential caches its own state
+		if c.sshCredentials {
+			return c.syncCredential(ctx, vm)
+		}
+		return nil
+	}
+
+	if err := c.checkProvisioning(ctx, invID, vm, hostName); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	awxVars, err := c.mergeHostVars(ctx, invID, hostName, hostVars)
+
+	// The shadow gets the merged variables, so merge strategies produce the
+	// same host in both
+	var shadowResult chan error
+	if c.shadow != nil && err == nil {
+		shadowResult = c.shadow.upsertHost(ctx, c.inventoryName(vm.Namespace), hostName, awxVars, description)
+	}
+
+	var hostID int
+	if err == nil {
+		hostID, err = c.knownHostID(ctx, invID, vm, hostName)
+	}
+	if err == nil && hostID != 0 {
+		err = c.awxClient.UpdateHost(ctx, hostID, hostName, awxVars, true, description)
+		if awx.IsNotFound(err) {
+			// Deleted in AWX, create it again
+			c.hostIDs.Remove(stateKey)
+			hostID, err = 0, nil
+		}
+	}
+	if err == nil && hostID == 0 {
+		existed := c.hostExists(ctx, invID, hostName)
+		hostID, err = c.awxClient.CreateOrUpdateHost(ctx, invID, hostName, awxVars, true, description)
+		if err == nil && !existed {
+			c.notifyHostAdded(vm.Namespace, vm.Name, hostName)
+		}
 	}
+	metrics.SyncDuration.Observe(time.Since(start).Seconds())
 
-	return c.awxClient.CreateOrUpdateHost(invID, hostName, hostVars)
+	if shadowResult != nil {
+		c.shadow.compareHost(ctx, c.awxClient, invID, c.inventoryName(vm.Namespace), hostName, err, <-shadowResult)
+	}
+	if awx.IsNotFound(err) {
+		// The inventory was deleted in AWX, look it up again on retry
+		c.inventoryCache.Remove(vm.Namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.recordHostID(vm, hostName, hostID)
+
+	if err := c.markHostSeen(ctx, invID, vm.Namespace, hostName); err != nil {
+		return fmt.Errorf("failed to re-enable host: %w", err)
+	}
+
+	if c.sshCredentials {
+		if err := c.syncCredential(ctx, vm); err != nil {
+			return err
+		}
+	}
+
+	if err := c.syncGroups(ctx, invID, hostID, vm, hostName, groups); err != nil {
+		return err
+	}
+	if err := c.ping(ctx, invID, vm, hostName); err != nil {
+		return err
+	}
+	if err := c.provision(ctx, invID, vm, hostName); err != nil {
+		return err
+	}
+	c.hostStates.Add(stateKey, state)
+	c.recordEvent(vm, corev1.EventTypeNormal, EventSynced, "Host '%s' synced to AWX inventory '%s'", hostName, c.inventoryName(vm.Namespace))
+	c.recordSynced(vm, invID, hostID)
+	return nil
 }
 
-// handleVMDeleted handles DELETED events
-func (c *Controller) handleVMDeleted(namespace, name string) error {
-	// Get inventory for this namespace
-	invID, err := c.getOrCreateInventoryForNamespace(namespace)
+// handleVMRemoved removes the host of a deleted or ignored VM
+func (c *Controller) handleVMRemoved(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	vmKey := vm.Namespace + "/" + vm.Name
+	name, exists := c.hostNames.Get(vmKey)
+	if !exists {
+		name = c.hostName(vm)
+	}
+
+	c.seedHostID(vm, name)
+	c.untrackJobs(vm)
+	if vm.Deleting {
+		running, err := c.deprovision(ctx, vm, name)
+		if err != nil || running {
+			return err
+		}
+	}
+	if err := c.handleVMDeleted(ctx, vm.Namespace, name); err != nil {
+		return err
+	}
+	c.hostNames.Remove(vmKey)
+	c.releaseHostName(vm.Namespace, vm.Name)
+	return nil
+}
+
+// handleVMDeleted removes a host from the backends and AWX
+func (c *Controller) handleVMDeleted(ctx context.Context, namespace, hostName string) error {
+	for _, backend := range c.backends {
+		if err := backend.RemoveHost(namespace, hostName); err != nil {
+			return fmt.Errorf("failed to remove host from %T backend: %w", backend, err)
+		}
+	}
+	if !c.awxEnabled {
+		return nil
+	}
+
+	// Get inventory for this namespace, there is nothing to delete without one
+	invID, err := c.lookupInventoryForNamespace(ctx, namespace)
 	if err != nil {
 		return fmt.Errorf("failed to get inventory for namespace '%s': %w", namespace, err)
 	}
+	if invID == 0 {
+		return nil
+	}
 
-	hostName := name
-	return c.awxClient.DeleteHost(invID, hostName)
+	var shadowResult chan error
+	if c.shadow != nil {
+		shadowResult = c.shadow.deleteHost(ctx, c.inventoryName(namespace), hostName)
+	}
+
+	c.forgetHostState(namespace, hostName)
+	err = c.deleteManagedHost(ctx, invID, namespace, hostName)
+	if err == nil && c.expiry != nil {
+		c.expiry.forget(namespace, hostName)
+	}
+
+	if shadowResult != nil {
+		c.shadow.compareHost(ctx, c.awxClient, invID, c.inventoryName(namespace), hostName, err, <-shadowResult)
+	}
+	return err
 }
 
-// handleWatchEvent handles a watch event
-func (c *Controller) handleWatchEvent(event watch.Event, obj *unstructured.Unstructured) error {
-	namespace, found, _ := unstructured.NestedString(obj.Object, "metadata", "namespace")
-	if !found {
+// HandleEvent applies a single VirtualMachine event synchronously, bypassing the queue
+func (c *Controller) HandleEvent(ctx context.Context, event watch.Event, obj *unstructured.Unstructured) error {
+	e, ok := newVMEvent(c.defaultSource(), event, obj)
+	if !ok {
 		return nil
 	}
 
-	name, found, _ := unstructured.NestedString(obj.Object, "metadata", "name")
-	if !found {
+	metrics.EventsTotal.WithLabelValues(string(event.Type)).Inc()
+	return c.syncEvent(ctx, c.workers.Worker(0), e)
+}
+
+// enqueueEvent queues a watch event of source for the workers, or defers it during a blackout
+func (c *Controller) enqueueEvent(source hostSource, event watch.Event, obj *unstructured.Unstructured) error {
+	e, ok := newVMEvent(source, event, obj)
+	if !ok {
 		return nil
 	}
 
+	metrics.EventsTotal.WithLabelValues(string(event.Type)).Inc()
+	c.enqueue(e)
+	return nil
+}
+
+// enqueue queues e for the workers, or defers it during a blackout
+func (c *Controller) enqueue(e vmEvent) {
+	if c.inBlackout() {
+		c.blackout.add(e)
+		return
+	}
+	c.queue.add(e)
+}
+
+// syncEvent applies a single event and records its result
+func (c *Controller) syncEvent(ctx context.Context, worker *workers.Worker, e vmEvent) error {
+	worker.Begin(e.key())
+	err := c.applyEvent(ctx, e)
+	worker.End()
+	c.recordResult(err)
+	c.notifySyncResult(ctx, e, err)
+	if err != nil {
+		metrics.SyncErrorsTotal.Inc()
+	} else {
+		c.recordSuccess(e.namespace)
+	}
+	return err
+}
+
+// processWatchEvent dispatches a watch event to the matching handler
+func (c *Controller) processWatchEvent(ctx context.Context, source hostSource, event watch.Event, obj *unstructured.Unstructured, namespace, name string) error {
 	switch event.Type {
 	case watch.Added:
 		// Log ADDED events (new VMs)
 		log.Printf("Event: ADDED for VM '%s' in namespace '%s'", name, namespace)
-		vm := kubernetes.UnstructuredToVM(obj)
+		vm := source.ToHost(obj)
+
+		// Deleted while the controller was down, our finalizer kept it
+		if vm.Deleting && hasFinalizer(vm) {
+			return c.releaseVM(ctx, vm)
+		}
+
+		if ignored(vm) {
+			log.Printf("VM '%s' in namespace '%s' has %s, skipping", name, namespace, AnnotationIgnore)
+			return c.releaseVM(ctx, vm)
+		}
+
+		if c.stopped(vm) {
+			return c.handleVMStopped(ctx, vm)
+		}
 
-		if vm.IP == "" {
+		if ansibleHost(vm) == "" {
 			log.Printf("WARN: VM '%s' in namespace '%s' has no IP address, skipping", name, namespace)
+			if c.disableStopped {
+				return c.disableHost(ctx, vm)
+			}
 			return nil
 		}
 
-		return c.handleVMAdded(vm)
+		return c.syncVM(ctx, vm)
 
 	case watch.Modified:
 		// Only process MODIFIED if VM has IP (avoid spam for VMs without IP)
-		vm := kubernetes.UnstructuredToVM(obj)
+		vm := source.ToHost(obj)
+
+		// Deletion was requested, our finalizer keeps the VM until its host is gone
+		if vm.Deleting && hasFinalizer(vm) {
+			return c.releaseVM(ctx, vm)
+		}
+
+		// The annotation may have been added after the VM was synced. Once
+		// released, status updates of the ignored VM need no AWX lookup.
+		if ignored(vm) {
+			if _, synced := c.hostNames.Get(namespace + "/" + name); synced || hasFinalizer(vm) {
+				return c.releaseVM(ctx, vm)
+			}
+			return nil
+		}
+
+		// The VM was stopped, or is not running yet
+		if c.stopped(vm) {
+			return c.handleVMStopped(ctx, vm)
+		}
 
-		if vm.IP == "" {
+		if ansibleHost(vm) == "" {
 			// Silently skip VMs without IP to reduce log spam
+			if c.disableStopped {
+				return c.disableHost(ctx, vm)
+			}
 			return nil
 		}
 
 		// Only log if we're actually processing it
-		log.Printf("Event: MODIFIED for VM '%s' in namespace '%s' (IP: %s)", name, namespace, vm.IP)
-		return c.handleVMAdded(vm)
+		log.Printf("Event: MODIFIED for VM '%s' in namespace '%s' (IP: %s)", name, namespace, ansibleHost(vm))
+		return c.syncVM(ctx, vm)
 
 	case watch.Deleted:
-		return c.handleVMDeleted(namespace, name)
+		vm := source.ToHost(obj)
+		// Without finalizers the VM is gone without a deletion timestamp
+		vm.Deleting = true
+		return c.handleVMRemoved(ctx, vm)
 
 	default:
 		log.Printf("WARN: Unknown event type: %s", event.Type)
@@ -200,15 +1209,103 @@ func (c *Controller) handleWatchEvent(event watch.Event, obj *unstructured.Unstr
 
 // Run starts the controller
 func (c *Controller) Run(ctx context.Context) error {
-	if err := c.Initialize(); err != nil {
+	if c.source == nil && len(c.vmSources) == 0 {
+		return fmt.Errorf("controller was created without a VM source")
+	}
+
+	if c.events && c.k8sClient != nil {
+		recorder, stop := c.k8sClient.NewEventRecorder("awx-inventory")
+		defer stop()
+		c.recorder = recorder
+	}
+
+	if err := c.Initialize(ctx); err != nil {
 		return err
 	}
 
+	c.queue = newEventQueue(c.workerCount, c.coalesceWindow)
+	defer c.queue.shutDown()
+	if c.checkpoint != nil {
+		c.queue.checkpoint = c.checkpoint
+		c.replayCheckpoint()
+		go c.runCheckpoint(ctx)
+	}
+
+	if c.ansibleJobs {
+		if c.k8sClient != nil {
+			go c.runAnsibleJobs(ctx)
+		} else {
+			log.Printf("WARN: AnsibleJob reconciliation requires a Kubernetes client, skipping")
+		}
+	}
+	if c.tokenSecret != "" && c.awxEnabled {
+		go c.runTokenWatch(ctx)
+	}
+	if c.snapshotStore != nil {
+		go c.runSnapshots(ctx)
+	}
+	if c.expiry != nil && c.awxEnabled {
+		go c.runHostExpiry(ctx)
+	}
+	if c.pruneInterval > 0 && c.awxEnabled {
+		go c.runPrune(ctx)
+	}
+	if c.namespacePolicy != "" && c.k8sClient != nil && c.awxEnabled {
+		go c.runNamespaceWatch(ctx)
+	}
+	if c.credentialSecrets && c.k8sClient != nil && c.awxEnabled {
+		go c.runCredentialSecretWatch(ctx)
+	}
+	if c.inventoryVarsEnabled && c.k8sClient != nil && c.awxEnabled {
+		if c.singleInventory == "" {
+			go c.runInventoryVarsWatch(ctx)
+		} else {
+			log.Printf("WARN: inventory variables from ConfigMaps are not supported with a single inventory, skipping")
+		}
+	}
+	if c.groupVarsConfigMaps && c.k8sClient != nil && c.awxEnabled {
+		if c.singleInventory == "" {
+			go c.runGroupVarsWatch(ctx)
+		} else {
+			log.Printf("WARN: group variables from ConfigMaps are not supported with a single inventory, skipping")
+		}
+	}
+	if c.blackout != nil {
+		go c.runBlackouts(ctx)
+	}
+	if c.inventoryMap != "" && c.awxEnabled {
+		if c.k8sClient != nil {
+			go c.runInventoryMap(ctx)
+		} else {
+			log.Printf("WARN: publishing the inventory mapping requires a Kubernetes client, skipping")
+		}
+	}
+	for _, backend := range c.backends {
+		if runnable, ok := backend.(interface{ Run(context.Context) }); ok {
+			go runnable.Run(ctx)
+		}
+	}
+	if c.goroutineLeakThreshold > 0 {
+		go workers.WatchGoroutines(ctx, time.Minute, c.goroutineLeakThreshold)
+	}
+
 	log.Printf("Starting VirtualMachine resources watch...")
 	log.Printf("Note: Watch will process all existing VMs as ADDED events on startup")
 	log.Printf("Inventories will be created per namespace as needed")
 
-	return c.k8sClient.WatchVMs(ctx, c.handleWatchEvent)
+	cancelWorkers, running := c.startWorkers(ctx)
+	if c.awxEnabled {
+		go c.runAWXPing(ctx)
+		go c.runJobTracking(ctx)
+	}
+
+	c.mu.Lock()
+	c.watching = true
+	c.mu.Unlock()
+
+	err := c.watch(ctx)
+	c.drain(cancelWorkers, running)
+	return err
 }
 
 // Start starts the controller with signal handling
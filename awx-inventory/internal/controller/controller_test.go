@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx/awxfake"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestController returns an initialized controller on an in-memory AWX
+// with the organization Default. Events are fed through HandleEvent.
+func newTestController(t *testing.T, cfg Config) (*Controller, *awxfake.Client) {
+	t.Helper()
+	fake := awxfake.New("Default")
+	cfg.AWXClient = fake
+	cfg.NoKubernetes = true
+	cfg.Organization = "Default"
+	cfg.SkipAWXWait = true
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c, fake
+}
+
+// testVM returns a Deckhouse VirtualMachine object
+func testVM(namespace, name, ip string, labels map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name, "namespace": namespace}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	obj := map[string]interface{}{
+		"apiVersion": "virtualization.deckhouse.io/v1alpha2",
+		"kind":       "VirtualMachine",
+		"metadata":   metadata,
+	}
+	if ip != "" {
+		obj["status"] = map[string]interface{}{"ipAddress": ip}
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func handle(t *testing.T, c *Controller, eventType watch.EventType, obj *unstructured.Unstructured) {
+	t.Helper()
+	if err := c.HandleEvent(context.Background(), watch.Event{Type: eventType, Object: obj}, obj); err != nil {
+		t.Fatalf("%s event of VM '%s': %v", eventType, obj.GetName(), err)
+	}
+}
+
+func TestHandleEventAddsHost(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", nil))
+
+	if hosts := fake.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-1"}) {
+		t.Fatalf("hosts of inventory 'demo': got %v, want [vm-1]", hosts)
+	}
+	vars := fake.HostVars("demo", "vm-1")
+	if vars["ansible_host"] != "10.0.0.1" || vars["vm_name"] != "vm-1" || vars["vm_namespace"] != "demo" {
+		t.Errorf("unexpected host variables %v", vars)
+	}
+}
+
+func TestHandleEventCreatesInventoryPerNamespace(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("team-a", "vm-1", "10.0.0.1", nil))
+	handle(t, c, watch.Added, testVM("team-a", "vm-2", "10.0.0.2", nil))
+	handle(t, c, watch.Added, testVM("team-b", "vm-1", "10.0.1.1", nil))
+
+	if n := fake.Calls("CreateInventory"); n != 2 {
+		t.Errorf("created %d inventories, want one per namespace", n)
+	}
+	for inventory, want := range map[string][]string{"team-a": {"vm-1", "vm-2"}, "team-b": {"vm-1"}} {
+		if hosts := fake.HostNames(inventory); !reflect.DeepEqual(hosts, want) {
+			t.Errorf("hosts of inventory '%s': got %v, want %v", inventory, hosts, want)
+		}
+	}
+}
+
+func TestHandleEventUpdatesHost(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", nil))
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.2", nil))
+
+	if hosts := fake.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-1"}) {
+		t.Fatalf("hosts of inventory 'demo': got %v, want [vm-1]", hosts)
+	}
+	if ip := fake.HostVars("demo", "vm-1")["ansible_host"]; ip != "10.0.0.2" {
+		t.Errorf("ansible_host: got %v, want 10.0.0.2", ip)
+	}
+}
+
+func TestHandleEventSkipsUnchangedHost(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", nil))
+	writes := fake.Calls("CreateOrUpdateHost") + fake.Calls("UpdateHost")
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.1", nil))
+
+	if n := fake.Calls("CreateOrUpdateHost") + fake.Calls("UpdateHost"); n != writes {
+		t.Errorf("unchanged VM was written %d more times", n-writes)
+	}
+}
+
+func TestHandleEventDeletesHost(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", nil))
+	handle(t, c, watch.Added, testVM("demo", "vm-2", "10.0.0.2", nil))
+	handle(t, c, watch.Deleted, testVM("demo", "vm-1", "10.0.0.1", nil))
+
+	if hosts := fake.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-2"}) {
+		t.Errorf("hosts of inventory 'demo': got %v, want [vm-2]", hosts)
+	}
+}
+
+func TestHandleEventSkipsVMWithoutIP(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "", nil))
+
+	if hosts := fake.HostNames("demo"); len(hosts) != 0 {
+		t.Errorf("got hosts %v for a VM without IP", hosts)
+	}
+}
+
+func TestHandleEventSyncsGroups(t *testing.T) {
+	c, fake := newTestController(t, Config{GroupLabels: []string{"app"}})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "web"}))
+	if groups := fake.HostGroups("demo", "vm-1"); !reflect.DeepEqual(groups, []string{"app_web"}) {
+		t.Fatalf("groups of host 'vm-1': got %v, want [app_web]", groups)
+	}
+
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "db"}))
+	if groups := fake.HostGroups("demo", "vm-1"); !reflect.DeepEqual(groups, []string{"app_db"}) {
+		t.Errorf("groups of host 'vm-1' after the label changed: got %v, want [app_db]", groups)
+	}
+}
+
+func TestHandleEventSkipsObjectWithoutMetadata(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":   "VirtualMachine",
+		"status": map[string]interface{}{"ipAddress": "10.0.0.1"},
+	}}
+
+	handle(t, c, watch.Added, obj)
+
+	if n := fake.Calls("CreateInventory") + fake.Calls("CreateOrUpdateHost"); n != 0 {
+		t.Errorf("made %d AWX calls for an object without metadata", n)
+	}
+}
+
+func TestHandleEventOnKubernetes(t *testing.T) {
+	vm1 := testVM("demo", "vm-1", "10.0.0.1", nil)
+	vm2 := testVM("demo", "vm-2", "10.0.0.2", nil)
+	dyn := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		kubernetes.DefaultVMResource.GVR: "VirtualMachineList",
+	}, vm1, vm2)
+	c, fake := newTestController(t, Config{Kubernetes: kubernetes.NewClientForDynamic(dyn)})
+
+	handle(t, c, watch.Added, vm1)
+	handle(t, c, watch.Added, vm2)
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.3", nil))
+	handle(t, c, watch.Deleted, vm2)
+
+	if hosts := fake.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-1"}) {
+		t.Fatalf("hosts of inventory 'demo': got %v, want [vm-1]", hosts)
+	}
+	if ip := fake.HostVars("demo", "vm-1")["ansible_host"]; ip != "10.0.0.3" {
+		t.Errorf("ansible_host: got %v, want 10.0.0.3", ip)
+	}
+}
+
+func TestHandleEventSyncsGroupsWithoutHostLookup(t *testing.T) {
+	c, fake := newTestController(t, Config{GroupLabels: []string{"app"}})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "web"}))
+	lookups := fake.Calls("GetHostID")
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "db"}))
+
+	if n := fake.Calls("GetHostID") - lookups; n != 0 {
+		t.Errorf("looked up the host ID %d times to sync its groups, want 0", n)
+	}
+}
+
+func TestReloadRemovesHostFromDroppedGroups(t *testing.T) {
+	c, fake := newTestController(t, Config{GroupLabels: []string{"app"}})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "web"}))
+	c.Reload(Settings{})
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "web"}))
+
+	if groups := fake.HostGroups("demo", "vm-1"); len(groups) != 0 {
+		t.Errorf("groups of host 'vm-1' after GROUP_LABELS was cleared: got %v, want none", groups)
+	}
+}
+
+func TestHandleEventKeepsGroupsOfOtherLabelKeys(t *testing.T) {
+	c, fake := newTestController(t, Config{GroupLabels: []string{"app"}})
+	ctx := context.Background()
+	labels := map[string]interface{}{"app": "web", "app_tier": "prod"}
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", labels))
+	invID, err := c.getOrCreateInventoryForNamespace(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostID, err := fake.GetHostID(ctx, invID, "vm-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID, err := fake.GetOrCreateGroup(ctx, invID, "app_tier_prod", c.managedDescription())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.AddHostToGroup(ctx, groupID, hostID); err != nil {
+		t.Fatal(err)
+	}
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.2", labels))
+
+	if groups := fake.HostGroups("demo", "vm-1"); !reflect.DeepEqual(groups, []string{"app_tier_prod", "app_web"}) {
+		t.Errorf("groups of host 'vm-1': got %v, want [app_tier_prod app_web]", groups)
+	}
+}
+
+func TestHandleEventReleasesIgnoredVMOnce(t *testing.T) {
+	c, fake := newTestController(t, Config{})
+	ignoredVM := testVM("demo", "vm-1", "10.0.0.1", nil)
+	ignoredVM.SetAnnotations(map[string]string{AnnotationIgnore: "true"})
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", nil))
+	handle(t, c, watch.Modified, ignoredVM)
+	if hosts := fake.HostNames("demo"); len(hosts) != 0 {
+		t.Fatalf("got hosts %v after the VM was ignored", hosts)
+	}
+
+	lookups := fake.Calls("GetHostID") + fake.Calls("GetHost") + fake.Calls("DeleteHost")
+	handle(t, c, watch.Modified, ignoredVM)
+	if n := fake.Calls("GetHostID") + fake.Calls("GetHost") + fake.Calls("DeleteHost") - lookups; n != 0 {
+		t.Errorf("made %d host calls for a status update of a released VM, want 0", n)
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cloudinit"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// Keys looked up in provisioning Secrets, matching the kubernetes.io/ssh-auth convention
+const (
+	secretKeyPrivateKey = "ssh-privatekey"
+	secretKeyUsername   = "username"
+)
+
+// credentialTTL is how long a synced credential is trusted before the Secret is re-read
+const credentialTTL = 5 * time.Minute
+
+// syncedCredential records the last credential pushed for a Secret
+type syncedCredential struct {
+	hash     [sha256.Size]byte
+	syncedAt time.Time
+}
+
+// credentialName is the documented naming convention: "<inventory name> ssh <secret name>"
+func (c *Controller) credentialName(namespace, secretName string) string {
+	return fmt.Sprintf("%s ssh %s", c.inventoryName(namespace), secretName)
+}
+
+// syncCredential creates or updates an AWX Machine credential from the VM's
+// provisioning Secret if it contains an SSH private key
+func (c *Controller) syncCredential(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	if vm.UserDataSecret == "" || c.k8sClient == nil {
+		return nil
+	}
+
+	key := vm.Namespace + "/" + vm.UserDataSecret
+	if synced, exists := c.credentialCache.Get(key); exists && time.Since(synced.syncedAt) < credentialTTL {
+		return nil
+	}
+
+	data, err := c.k8sClient.GetSecretData(vm.Namespace, vm.UserDataSecret)
+	if err != nil {
+		return fmt.Errorf("failed to read provisioning secret: %w", err)
+	}
+
+	privateKey := string(data[secretKeyPrivateKey])
+	if privateKey == "" {
+		c.credentialCache.Add(key, syncedCredential{syncedAt: time.Now()})
+		return nil
+	}
+
+	// Prefer an explicit username, fall back to the cloud-init user
+	username := string(data[secretKeyUsername])
+	if username == "" {
+		for k, v := range data {
+			if k != secretKeyPrivateKey {
+				if cfg, err := cloudinit.Parse(string(v)); err == nil && len(cfg.Users) > 0 {
+					username = cfg.Users[0].Name
+					break
+				}
+			}
+		}
+	}
+
+	hash := sha256.Sum256([]byte(username + "\n" + privateKey))
+	if synced, exists := c.credentialCache.Get(key); exists && synced.hash == hash {
+		c.credentialCache.Add(key, syncedCredential{hash: hash, syncedAt: time.Now()})
+		return nil
+	}
+
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	name := c.credentialName(vm.Namespace, vm.UserDataSecret)
+	description := fmt.Sprintf("managed-by=awx-inventory inventory=%s secret=%s/%s", c.inventoryName(vm.Namespace), vm.Namespace, vm.UserDataSecret)
+	credID, err := c.awxClient.CreateOrUpdateMachineCredential(ctx, name, description, orgID, username, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sync credential '%s': %w", name, err)
+	}
+
+	log.Printf("Synced machine credential '%s' (ID: %d) from secret '%s' in namespace '%s'", name, credID, vm.UserDataSecret, vm.Namespace)
+	c.credentialCache.Add(key, syncedCredential{hash: hash, syncedAt: time.Now()})
+	return nil
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// LabelCredential marks Secrets synced into AWX Machine credentials, the
+// value "ssh" is the only supported credential kind
+const LabelCredential = "awx-inventory.io/credential"
+
+// credentialSecretSelector selects the Secrets synced by CredentialSecrets
+const credentialSecretSelector = LabelCredential + "=ssh"
+
+// runCredentialSecretWatch syncs labeled Secrets into Machine credentials
+// until ctx is done
+func (c *Controller) runCredentialSecretWatch(ctx context.Context) {
+	log.Printf("Watching Secrets labeled %s for Machine credentials", credentialSecretSelector)
+
+	err := c.k8sClient.WatchSecrets(ctx, credentialSecretSelector, func(namespace, name string, data map[string][]byte) {
+		var err error
+		if data == nil {
+			err = c.deleteSecretCredential(ctx, namespace, name)
+		} else {
+			err = c.syncSecretCredential(ctx, namespace, name, data)
+		}
+		if err != nil {
+			log.Printf("ERROR: failed to sync credential of secret '%s' in namespace '%s': %v", name, namespace, err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("WARN: stopped watching credential Secrets: %v", err)
+	}
+}
+
+// syncSecretCredential creates or updates the Machine credential of a
+// labeled Secret, named like those of SSHCredentials, and attaches it to
+// the job templates of the namespace's inventory if enabled
+func (c *Controller) syncSecretCredential(ctx context.Context, namespace, name string, data map[string][]byte) error {
+	privateKey := string(data[secretKeyPrivateKey])
+	if privateKey == "" {
+		log.Printf("WARN: secret '%s' in namespace '%s' has no '%s' key, skipping", name, namespace, secretKeyPrivateKey)
+		return nil
+	}
+
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	credName := c.credentialName(namespace, name)
+	description := fmt.Sprintf("managed-by=awx-inventory inventory=%s secret=%s/%s", c.inventoryName(namespace), namespace, name)
+	credID, err := c.awxClient.CreateOrUpdateMachineCredential(ctx, credName, description, orgID, string(data[secretKeyUsername]), privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sync credential '%s': %w", credName, err)
+	}
+	log.Printf("Synced machine credential '%s' (ID: %d) from secret '%s' in namespace '%s'", credName, credID, name, namespace)
+
+	if !c.credentialTemplates {
+		return nil
+	}
+	invID, err := c.lookupInventoryForNamespace(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory for namespace '%s': %w", namespace, err)
+	}
+	if invID == 0 {
+		return nil
+	}
+	templateIDs, err := c.awxClient.ListJobTemplateIDs(ctx, invID)
+	if err != nil {
+		return err
+	}
+	for _, templateID := range templateIDs {
+		// A template with another Machine credential keeps it
+		if err := c.awxClient.AttachJobTemplateCredential(ctx, templateID, credID); err != nil {
+			log.Printf("WARN: failed to attach credential '%s' to job template %d: %v", credName, templateID, err)
+		}
+	}
+	return nil
+}
+
+// deleteSecretCredential deletes the Machine credential of a Secret that was
+// deleted or lost LabelCredential
+func (c *Controller) deleteSecretCredential(ctx context.Context, namespace, name string) error {
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	credName := c.credentialName(namespace, name)
+	credID, err := c.awxClient.GetCredentialID(ctx, credName, orgID)
+	if err != nil {
+		return err
+	}
+	if credID == 0 {
+		return nil
+	}
+	if err := c.awxClient.DeleteCredential(ctx, credID); err != nil {
+		return fmt.Errorf("failed to delete credential '%s': %w", credName, err)
+	}
+	log.Printf("Deleted machine credential '%s', secret '%s' in namespace '%s' is gone", credName, name, namespace)
+	return nil
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx/awxtest"
+)
+
+// TestEndToEnd syncs VMs through the real AWX client into a fake AWX API
+func TestEndToEnd(t *testing.T) {
+	srv := awxtest.NewServer("Default")
+	defer srv.Close()
+
+	c, err := New(Config{
+		AWXURL:       srv.URL,
+		AWXToken:     awxtest.Token,
+		Organization: "Default",
+		SkipAWXWait:  true,
+		NoKubernetes: true,
+		GroupLabels:  []string{"app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	handle(t, c, watch.Added, testVM("demo", "vm-1", "10.0.0.1", map[string]interface{}{"app": "web"}))
+	handle(t, c, watch.Added, testVM("demo", "vm-2", "10.0.0.2", map[string]interface{}{"app": "web"}))
+	if hosts := srv.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-1", "vm-2"}) {
+		t.Fatalf("hosts of inventory 'demo': got %v, want [vm-1 vm-2]", hosts)
+	}
+	if groups := srv.HostGroups("demo", "vm-1"); !reflect.DeepEqual(groups, []string{"app_web"}) {
+		t.Errorf("groups of host 'vm-1': got %v, want [app_web]", groups)
+	}
+
+	handle(t, c, watch.Modified, testVM("demo", "vm-1", "10.0.0.3", map[string]interface{}{"app": "db"}))
+	if groups := srv.HostGroups("demo", "vm-1"); !reflect.DeepEqual(groups, []string{"app_db"}) {
+		t.Errorf("groups of host 'vm-1' after the label changed: got %v, want [app_db]", groups)
+	}
+
+	handle(t, c, watch.Deleted, testVM("demo", "vm-2", "10.0.0.2", nil))
+	if hosts := srv.HostNames("demo"); !reflect.DeepEqual(hosts, []string{"vm-1"}) {
+		t.Errorf("hosts of inventory 'demo' after deleting vm-2: got %v, want [vm-1]", hosts)
+	}
+}
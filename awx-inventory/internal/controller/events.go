@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// Reasons of the events recorded on VMs
+const (
+	EventSynced     = "SyncedToAWX"
+	EventSyncFailed = "AWXSyncFailed"
+
+	EventProvisionSucceeded   = "ProvisionJobSucceeded"
+	EventProvisionFailed      = "ProvisionJobFailed"
+	EventDeprovisionSucceeded = "DeprovisionJobSucceeded"
+	EventDeprovisionFailed    = "DeprovisionJobFailed"
+	EventPingFailed           = "HostPingFailed"
+)
+
+// syncVM syncs the host of a VM and its finalizer, recording a failure on
+// the VM
+func (c *Controller) syncVM(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	if err := c.handleVMAdded(ctx, vm); err != nil {
+		c.recordEvent(vm, corev1.EventTypeWarning, EventSyncFailed, "Failed to sync host to AWX: %v", err)
+		c.recordSyncFailed(vm, err)
+		return err
+	}
+	return c.syncFinalizer(vm)
+}
+
+// recordEvent records an event on the object of a VM if events are enabled
+func (c *Controller) recordEvent(vm *kubernetes.VirtualMachine, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.recorder == nil || vm.Object.Name == "" {
+		return
+	}
+	c.recorder.Eventf(&vm.Object, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// hostExpiry tracks when managed hosts were last backed by a VM
+type hostExpiry struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	// Hosts disabled by the sweep, re-enabled when their VM shows up again
+	disabled map[string]bool
+}
+
+func newHostExpiry(ttl time.Duration) *hostExpiry {
+	return &hostExpiry{
+		ttl:      ttl,
+		lastSeen: make(map[string]time.Time),
+		disabled: make(map[string]bool),
+	}
+}
+
+// seen records that the host is backed by a VM and reports whether it had been disabled
+func (e *hostExpiry) seen(namespace, hostName string) (wasDisabled bool) {
+	key := namespace + "/" + hostName
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastSeen[key] = time.Now()
+	wasDisabled = e.disabled[key]
+	delete(e.disabled, key)
+	return wasDisabled
+}
+
+// forget drops a host whose VM was deleted
+func (e *hostExpiry) forget(namespace, hostName string) {
+	key := namespace + "/" + hostName
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.lastSeen, key)
+	delete(e.disabled, key)
+}
+
+// age returns how long the host has not been seen. Hosts unknown to this
+// process start their clock now, so a restart gives every host a full TTL.
+func (e *hostExpiry) age(namespace, hostName string, now time.Time) time.Duration {
+	key := namespace + "/" + hostName
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	last, exists := e.lastSeen[key]
+	if !exists {
+		e.lastSeen[key] = now
+		return 0
+	}
+	return now.Sub(last)
+}
+
+func (e *hostExpiry) markDisabled(namespace, hostName string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.disabled[namespace+"/"+hostName] = true
+}
+
+// markHostSeen refreshes the TTL of a host and re-enables it if the sweep disabled it
+func (c *Controller) markHostSeen(ctx context.Context, invID int, namespace, hostName string) error {
+	if c.expiry == nil || !c.expiry.seen(namespace, hostName) {
+		return nil
+	}
+
+	hostID, err := c.awxClient.GetHostID(ctx, invID, hostName)
+	if err != nil || hostID == 0 {
+		return err
+	}
+	if err := c.awxClient.SetHostEnabled(ctx, hostID, true); err != nil {
+		return err
+	}
+	log.Printf("Re-enabled host '%s' in namespace '%s', its VM is back", hostName, namespace)
+	return nil
+}
+
+// runHostExpiry periodically disables hosts that have not been seen for the TTL
+// and removes them once they stay unseen for twice the TTL
+func (c *Controller) runHostExpiry(ctx context.Context) {
+	interval := c.expiry.ttl / 4
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	log.Printf("Starting stale host expiry with TTL %v, checking every %v", c.expiry.ttl, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.inBlackout() {
+			continue
+		}
+
+		for namespace, invID := range c.inventoryCache.Items() {
+			if err := c.expireHosts(ctx, namespace, invID); err != nil {
+				log.Printf("ERROR: failed to expire stale hosts in namespace '%s': %v", namespace, err)
+			}
+		}
+	}
+}
+
+// expireHosts applies the TTL policy to a single inventory
+func (c *Controller) expireHosts(ctx context.Context, namespace string, invID int) error {
+	now := time.Now()
+	var stale []awx.Host
+
+	err := c.awxClient.ForEachHost(ctx, invID, func(h awx.Host) error {
+		if c.expiry.age(namespace, h.Name, now) > c.expiry.ttl && c.managed(h.Description) {
+			stale = append(stale, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, h := range stale {
+		// Idle VMs produce no events, so confirm with the API before expiring
+		if len(c.vmSources) > 0 {
+			vm, err := c.getVM(namespace, c.vmNameForHost(namespace, h.Name))
+			if err == nil && !c.available(vm) && c.disableStopped {
+				// Unavailable VMs keep their disabled host
+				c.expiry.seen(namespace, h.Name)
+				continue
+			}
+			if err == nil {
+				if err := c.markHostSeen(ctx, invID, namespace, h.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+
+		if c.expiry.age(namespace, h.Name, now) > 2*c.expiry.ttl {
+			log.Printf("Removing host '%s' in namespace '%s', unseen for more than %v", h.Name, namespace, 2*c.expiry.ttl)
+			if err := c.awxClient.DeleteHost(ctx, invID, h.Name); err != nil {
+				return err
+			}
+			c.notifyHostRemoved(namespace, c.inventoryName(namespace), h.Name, fmt.Sprintf("unseen for more than %v", 2*c.expiry.ttl))
+			c.expiry.forget(namespace, h.Name)
+			c.forgetHostState(namespace, h.Name)
+			metrics.HostsExpiredTotal.WithLabelValues("removed").Inc()
+			continue
+		}
+
+		if !h.Enabled {
+			continue
+		}
+		log.Printf("Disabling host '%s' in namespace '%s', unseen for more than %v", h.Name, namespace, c.expiry.ttl)
+		if err := c.awxClient.SetHostEnabled(ctx, h.ID, false); err != nil {
+			return err
+		}
+		c.expiry.markDisabled(namespace, h.Name)
+		metrics.HostsExpiredTotal.WithLabelValues("disabled").Inc()
+	}
+
+	return nil
+}
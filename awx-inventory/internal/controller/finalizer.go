@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// FinalizerCleanup keeps a VM until the controller removed its host
+const FinalizerCleanup = "awx-inventory.io/cleanup"
+
+// hasFinalizer reports whether a VM carries FinalizerCleanup
+func hasFinalizer(vm *kubernetes.VirtualMachine) bool {
+	return slices.Contains(vm.Finalizers, FinalizerCleanup)
+}
+
+// syncFinalizer adds FinalizerCleanup to a synced VM, or removes it if
+// finalizers were turned off
+func (c *Controller) syncFinalizer(vm *kubernetes.VirtualMachine) error {
+	if c.finalizer == hasFinalizer(vm) {
+		return nil
+	}
+	err := c.patchVM(func(patcher vmPatcher) error {
+		if c.finalizer {
+			return patcher.AddVMFinalizer(vm, FinalizerCleanup)
+		}
+		return patcher.RemoveVMFinalizer(vm, FinalizerCleanup)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update finalizers of VM '%s': %w", vm.Name, err)
+	}
+	return nil
+}
+
+// releaseVM removes the host of a VM that is being deleted or opted out, then
+// lets Kubernetes delete the VM. On failure the finalizer stays and the event
+// is retried.
+func (c *Controller) releaseVM(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	if err := c.handleVMRemoved(ctx, vm); err != nil {
+		return err
+	}
+	// Kept until its deprovisioning job finished
+	if !hasFinalizer(vm) || c.tracked(jobKindDeprovision, vm) {
+		return nil
+	}
+	err := c.patchVM(func(patcher vmPatcher) error {
+		return patcher.RemoveVMFinalizer(vm, FinalizerCleanup)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove finalizer of VM '%s': %w", vm.Name, err)
+	}
+	if vm.Deleting {
+		log.Printf("Removed host of VM '%s' in namespace '%s', releasing it for deletion", vm.Name, vm.Namespace)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// collectGarbage deletes hosts of managed inventories whose VM no longer exists,
+// e.g. because it was deleted while the controller was down
+func (c *Controller) collectGarbage(ctx context.Context) error {
+	var vms []*kubernetes.VirtualMachine
+	err := c.forEachVM(ctx, func(vm *kubernetes.VirtualMachine) error {
+		vms = append(vms, vm)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	existing := make(map[string]map[string]bool)
+	c.seedHostNames(syncable(vms))
+	for _, vm := range vms {
+		if existing[vm.Namespace] == nil {
+			existing[vm.Namespace] = make(map[string]bool)
+		}
+		existing[vm.Namespace][c.hostName(vm)] = true
+	}
+
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	var inventories []awx.Inventory
+	err = c.awxClient.ForEachInventory(ctx, orgID, func(inv awx.Inventory) error {
+		inventories = append(inventories, inv)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list inventories: %w", err)
+	}
+
+	removed := 0
+	for _, inv := range inventories {
+		// The hosts of smart and constructed inventories belong to other inventories
+		if inv.Kind != "" {
+			continue
+		}
+		namespaces, hosts, managed := c.managedInventory(inv.Name, existing)
+		if !managed {
+			continue
+		}
+		for _, namespace := range namespaces {
+			c.inventoryCache.Add(namespace, inv.ID)
+		}
+
+		var stale []string
+		err := c.awxClient.ForEachHost(ctx, inv.ID, func(h awx.Host) error {
+			// Hosts added by hand or by another cluster are left alone
+			if !hosts[h.Name] && c.managed(h.Description) {
+				stale = append(stale, h.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list hosts of inventory '%s': %w", inv.Name, err)
+		}
+
+		for _, hostName := range stale {
+			log.Printf("Removing host '%s' from inventory '%s', its VM no longer exists", hostName, inv.Name)
+			if err := c.awxClient.DeleteHost(ctx, inv.ID, hostName); err != nil {
+				return fmt.Errorf("failed to delete host '%s': %w", hostName, err)
+			}
+			c.notifyHostRemoved("", inv.Name, hostName, "its VM no longer exists")
+			for _, namespace := range namespaces {
+				c.forgetHostState(namespace, hostName)
+			}
+			removed++
+		}
+	}
+
+	log.Printf("Startup garbage collection removed %d stale hosts", removed)
+	return nil
+}
+
+// managedInventory returns the namespaces synced into an inventory and the
+// host names of their VMs, or false if the controller does not manage it
+func (c *Controller) managedInventory(inventoryName string, existing map[string]map[string]bool) ([]string, map[string]bool, bool) {
+	if c.singleInventory == "" {
+		namespace, managed := c.managedNamespace(inventoryName, existing)
+		return []string{namespace}, existing[namespace], managed
+	}
+
+	// All namespaces share the single inventory
+	if inventoryName != c.singleInventory {
+		return nil, nil, false
+	}
+	var namespaces []string
+	hosts := make(map[string]bool)
+	for namespace, nsHosts := range existing {
+		namespaces = append(namespaces, namespace)
+		for host := range nsHosts {
+			hosts[host] = true
+		}
+	}
+	return namespaces, hosts, true
+}
+
+// managedNamespace returns the namespace an inventory belongs to. Without an
+// inventory prefix any inventory could be named after a namespace, so only
+// inventories of namespaces that still have VMs are considered managed.
+// A name template can't be reversed, so the same applies with one, matched
+// against the watched namespaces as well.
+func (c *Controller) managedNamespace(inventoryName string, existing map[string]map[string]bool) (string, bool) {
+	if c.nameTemplate != nil {
+		for namespace := range existing {
+			if c.inventoryName(namespace) == inventoryName {
+				return namespace, true
+			}
+		}
+		for _, namespace := range c.namespaces {
+			if c.inventoryName(namespace) == inventoryName {
+				return namespace, true
+			}
+		}
+		return "", false
+	}
+
+	namespace := inventoryName
+	if c.prefix != "" {
+		var found bool
+		namespace, found = strings.CutPrefix(inventoryName, c.prefix+" ")
+		if !found || namespace == "" {
+			return "", false
+		}
+	} else if existing[namespace] == nil {
+		return "", false
+	}
+
+	// Sources like nodes sync into a namespace of their own
+	if len(c.namespaces) > 0 && !slices.Contains(c.namespaces, namespace) && existing[namespace] == nil {
+		return "", false
+	}
+	return namespace, true
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// groupParentsOf returns the sorted parent groups whose patterns match a group
+func (c *Controller) groupParentsOf(group string) []string {
+	var parents []string
+	for parent, patterns := range c.groupParents {
+		if parent == group {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, group); matched {
+				parents = append(parents, parent)
+				break
+			}
+		}
+	}
+	sort.Strings(parents)
+	return parents
+}
+
+// syncGroupParents makes a group a child of the parents matching it,
+// creating missing parents and linking them to their own parents in turn
+func (c *Controller) syncGroupParents(ctx context.Context, invID int, group string, groupID int) error {
+	return c.linkGroupParents(ctx, invID, group, groupID, map[string]bool{group: true})
+}
+
+// linkGroupParents links a group to its parents, seen stops cycles in the
+// configured hierarchy
+func (c *Controller) linkGroupParents(ctx context.Context, invID int, group string, groupID int, seen map[string]bool) error {
+	key := strconv.Itoa(groupID)
+	if _, linked := c.linkedGroups.Get(key); linked {
+		return nil
+	}
+
+	for _, parent := range c.groupParentsOf(group) {
+		if seen[parent] {
+			log.Printf("WARN: group parents form a cycle, not adding group '%s' to its descendant '%s'", group, parent)
+			continue
+		}
+		parentID, err := c.awxClient.GetOrCreateGroup(ctx, invID, parent, c.managedDescription())
+		if err != nil {
+			return fmt.Errorf("failed to get group '%s': %w", parent, err)
+		}
+		if err := c.awxClient.AddGroupToGroup(ctx, parentID, groupID); err != nil {
+			return fmt.Errorf("failed to add group '%s' to group '%s': %w", group, parent, err)
+		}
+		log.Printf("Added group '%s' to group '%s'", group, parent)
+		seen[parent] = true
+		err = c.linkGroupParents(ctx, invID, parent, parentID, seen)
+		delete(seen, parent)
+		if err != nil {
+			return err
+		}
+	}
+	c.linkedGroups.Add(key, true)
+	return nil
+}
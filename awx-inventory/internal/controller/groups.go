@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// managedGroups are the groups whose membership the controller owns. Hosts
+// are removed from such groups once they no longer match, e.g. after a
+// migration, a class change or a label change.
+type managedGroups struct {
+	prefixes []string
+	// labelKeys are the GroupLabels keys, whose groups are <key>_<value>
+	labelKeys []string
+}
+
+// managedGroups returns the managed groups of the current settings and of the
+// settings before the last reload, so the relist after a reload removes hosts
+// from groups the new settings dropped
+func (c *Controller) managedGroups() managedGroups {
+	var managed managedGroups
+	for _, settings := range []*Settings{c.settings.Load(), c.previousSettings.Load()} {
+		if settings == nil {
+			continue
+		}
+		if settings.GroupByClass {
+			managed.prefixes = append(managed.prefixes, "class_")
+		}
+		if settings.GroupByNode {
+			managed.prefixes = append(managed.prefixes, "node_")
+		}
+		if settings.GroupByZone {
+			managed.prefixes = append(managed.prefixes, "zone_", "region_")
+		}
+		for _, key := range settings.GroupLabels {
+			if !slices.Contains(managed.labelKeys, key) {
+				managed.labelKeys = append(managed.labelKeys, key)
+			}
+		}
+	}
+	for _, source := range c.vmSources {
+		managed.prefixes = append(managed.prefixes, source.GroupPrefixes()...)
+	}
+	if c.singleInventory != "" {
+		managed.prefixes = append(managed.prefixes, "namespace_")
+	}
+	if len(c.smartInventories) > 0 {
+		managed.prefixes = append(managed.prefixes, smartGroupPrefix)
+	}
+	return managed
+}
+
+// empty reports whether no group is managed
+func (m managedGroups) empty() bool {
+	return len(m.prefixes) == 0 && len(m.labelKeys) == 0
+}
+
+// contains reports whether group is managed. A label group belongs to the
+// longest key it is named after, among the managed keys and the VM's own
+// label keys, so with the key app the group app_tier_web of a VM labeled
+// app_tier is not managed.
+func (m managedGroups) contains(group string, labels map[string]string) bool {
+	if hasAnyPrefix(group, m.prefixes) {
+		return true
+	}
+	owner, managed := "", false
+	match := func(key string, isManaged bool) {
+		prefix := groupName(key, "")
+		if len(group) > len(prefix) && strings.HasPrefix(group, prefix) && len(prefix) > len(owner) {
+			owner, managed = prefix, isManaged
+		}
+	}
+	for _, key := range m.labelKeys {
+		match(key, true)
+	}
+	for key := range labels {
+		if !slices.Contains(m.labelKeys, key) {
+			match(key, false)
+		}
+	}
+	return managed
+}
+
+// nodeTopologyTTL is how long node topology labels are cached
+const nodeTopologyTTL = 10 * time.Minute
+
+// cachedTopology is a node topology with the time it was fetched
+type cachedTopology struct {
+	topology  kubernetes.NodeTopology
+	fetchedAt time.Time
+}
+
+// desiredGroups returns the AWX groups a VM should be a member of
+func (c *Controller) desiredGroups(vm *kubernetes.VirtualMachine) []string {
+	settings := c.settings.Load()
+	var groups []string
+	if settings.GroupByClass && vm.ClassName != "" {
+		groups = append(groups, groupName("class", vm.ClassName))
+	}
+	if settings.GroupByNode && vm.NodeName != "" {
+		groups = append(groups, groupName("node", vm.NodeName))
+	}
+	for _, key := range settings.GroupLabels {
+		if value := vm.Labels[key]; value != "" {
+			groups = append(groups, groupName(key, value))
+		}
+	}
+	for _, group := range vm.Groups {
+		groups = append(groups, sanitizeGroupName(group))
+	}
+	if settings.GroupByZone && vm.NodeName != "" {
+		if topology := c.nodeTopology(vm.NodeName); topology != nil {
+			if topology.Zone != "" {
+				groups = append(groups, groupName("zone", topology.Zone))
+			}
+			if topology.Region != "" {
+				groups = append(groups, groupName("region", topology.Region))
+			}
+		}
+	}
+	if c.singleInventory != "" {
+		groups = append(groups, groupName("namespace", vm.Namespace))
+	}
+	groups = append(groups, c.smartGroups(vm)...)
+	return groups
+}
+
+// nodeTopology returns the cached topology of a node, nil if unknown
+func (c *Controller) nodeTopology(nodeName string) *kubernetes.NodeTopology {
+	if cached, exists := c.nodeTopologies.Get(nodeName); exists && time.Since(cached.fetchedAt) < nodeTopologyTTL {
+		return &cached.topology
+	}
+	if c.k8sClient == nil {
+		return nil
+	}
+
+	topology, err := c.k8sClient.GetNodeTopology(nodeName)
+	if err != nil {
+		log.Printf("WARN: failed to get topology of node '%s': %v", nodeName, err)
+		return nil
+	}
+
+	c.nodeTopologies.Add(nodeName, cachedTopology{topology: *topology, fetchedAt: time.Now()})
+	return topology
+}
+
+// syncGroups diffs the host's current group memberships against the desired
+// groups: missing groups are created and joined, and managed groups the host
+// no longer matches are left. The variables and parents of the desired
+// groups are synced.
+func (c *Controller) syncGroups(ctx context.Context, invID, hostID int, vm *kubernetes.VirtualMachine, hostName string, groups []string) error {
+	managed := c.managedGroups()
+	if len(groups) == 0 && managed.empty() {
+		return nil
+	}
+
+	current, err := c.awxClient.ListHostGroups(ctx, hostID)
+	if err != nil {
+		return fmt.Errorf("failed to list groups of host: %w", err)
+	}
+
+	member := make(map[string]int, len(current))
+	for _, group := range current {
+		member[group.Name] = group.ID
+	}
+	desired := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		desired[group] = true
+	}
+
+	for _, group := range groups {
+		if groupID, exists := member[group]; exists {
+			if err := c.syncGroupVars(ctx, invID, vm.Namespace, group, groupID); err != nil {
+				return err
+			}
+			if err := c.syncGroupParents(ctx, invID, group, groupID); err != nil {
+				return err
+			}
+			continue
+		}
+		groupID, err := c.awxClient.GetOrCreateGroup(ctx, invID, group, c.managedDescription())
+		if err != nil {
+			return fmt.Errorf("failed to get group '%s': %w", group, err)
+		}
+		if err := c.syncGroupVars(ctx, invID, vm.Namespace, group, groupID); err != nil {
+			return err
+		}
+		if err := c.syncGroupParents(ctx, invID, group, groupID); err != nil {
+			return err
+		}
+		if err := c.awxClient.AddHostToGroup(ctx, groupID, hostID); err != nil {
+			return fmt.Errorf("failed to add host to group '%s': %w", group, err)
+		}
+		log.Printf("Added host '%s' to group '%s'", hostName, group)
+	}
+
+	for _, group := range current {
+		// Groups created by hand are never pruned, even with a managed prefix
+		if desired[group.Name] || !managed.contains(group.Name, vm.Labels) || !c.managed(group.Description) {
+			continue
+		}
+		if err := c.awxClient.DisassociateHostFromGroup(ctx, group.ID, hostID); err != nil {
+			return fmt.Errorf("failed to remove host from group '%s': %w", group.Name, err)
+		}
+		log.Printf("Removed host '%s' from group '%s'", hostName, group.Name)
+	}
+
+	return nil
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupName builds an Ansible-compatible group name such as "class_highcpu"
+func groupName(prefix, value string) string {
+	return sanitizeGroupName(prefix + "_" + value)
+}
+
+// sanitizeGroupName replaces characters that are not valid in Ansible group names
+func sanitizeGroupName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// GroupVarsConfigMap is the ConfigMap in a namespace mapping group names to
+// the variables of the groups in the namespace's inventory
+const GroupVarsConfigMap = "awx-inventory-group-vars"
+
+// groupVars holds the variables of groups read from GroupVarsConfigMap by
+// namespace
+type groupVars struct {
+	mu          sync.Mutex
+	byNamespace map[string]map[string]map[string]interface{}
+}
+
+// desiredGroupVars returns the variables of a group in the inventory of a
+// namespace: GroupVars overridden by those of its ConfigMap, nil if none
+func (c *Controller) desiredGroupVars(namespace, group string) map[string]interface{} {
+	c.groupVars.mu.Lock()
+	override := c.groupVars.byNamespace[namespace][group]
+	c.groupVars.mu.Unlock()
+
+	base := c.groupVarsBase[group]
+	if override == nil {
+		return base
+	}
+	vars := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		vars[k] = v
+	}
+	for k, v := range override {
+		vars[k] = v
+	}
+	return vars
+}
+
+// syncGroupVars sets the variables of a group unless they were already set
+// to the same values. A group whose variables were removed from the
+// configuration gets empty variables.
+func (c *Controller) syncGroupVars(ctx context.Context, invID int, namespace, group string, groupID int) error {
+	vars := c.desiredGroupVars(namespace, group)
+	key := fmt.Sprintf("%d/%s", invID, group)
+	applied, known := c.appliedGroupVars.Get(key)
+	if vars == nil && !known {
+		return nil
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+	if known && applied == hash {
+		return nil
+	}
+
+	if err := c.awxClient.SetGroupVariables(ctx, groupID, vars); err != nil {
+		return fmt.Errorf("failed to set variables of group '%s': %w", group, err)
+	}
+	log.Printf("Set %d variables of group '%s' in inventory '%s'", len(vars), group, c.inventoryName(namespace))
+	c.appliedGroupVars.Add(key, hash)
+	return nil
+}
+
+// runGroupVarsWatch syncs GroupVarsConfigMap of each watched namespace into
+// the groups of its inventory until ctx is done
+func (c *Controller) runGroupVarsWatch(ctx context.Context) {
+	log.Printf("Watching ConfigMaps '%s' for group variables", GroupVarsConfigMap)
+
+	err := c.k8sClient.WatchConfigMaps(ctx, GroupVarsConfigMap, func(namespace string, data map[string]string) {
+		if err := c.handleGroupVars(ctx, namespace, data); err != nil {
+			log.Printf("ERROR: failed to sync group variables of the inventory of namespace '%s': %v", namespace, err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("WARN: stopped watching group variable ConfigMaps: %v", err)
+	}
+}
+
+// handleGroupVars stores the group variables of a namespace's ConfigMap,
+// nil once it was deleted, and applies them to the existing groups of its
+// inventory. Groups created later get them when hosts join.
+func (c *Controller) handleGroupVars(ctx context.Context, namespace string, data map[string]string) error {
+	byGroup := make(map[string]map[string]interface{}, len(data))
+	for group, value := range data {
+		var vars map[string]interface{}
+		if err := yaml.Unmarshal([]byte(value), &vars); err != nil {
+			log.Printf("WARN: variables of group '%s' in ConfigMap '%s' of namespace '%s' are not a YAML map, skipping: %v", group, GroupVarsConfigMap, namespace, err)
+			continue
+		}
+		if vars == nil {
+			vars = map[string]interface{}{}
+		}
+		byGroup[group] = vars
+	}
+
+	c.groupVars.mu.Lock()
+	if data == nil {
+		delete(c.groupVars.byNamespace, namespace)
+	} else {
+		c.groupVars.byNamespace[namespace] = byGroup
+	}
+	c.groupVars.mu.Unlock()
+
+	invID, err := c.lookupInventoryForNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if invID == 0 {
+		return nil
+	}
+	groups, err := c.awxClient.ListGroups(ctx, invID)
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	var firstErr error
+	for _, group := range groups {
+		if err := c.syncGroupVars(ctx, invID, namespace, group.Name, group.ID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
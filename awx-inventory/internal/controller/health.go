@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// awxPingInterval is how often AWX reachability is checked for readiness
+	awxPingInterval = 30 * time.Second
+	// stuckWorkerTimeout is how long a single event may take before the
+	// controller is reported as not alive
+	stuckWorkerTimeout = 5 * time.Minute
+)
+
+// runAWXPing periodically records whether AWX is reachable
+func (c *Controller) runAWXPing(ctx context.Context) {
+	ticker := time.NewTicker(awxPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := c.awxClient.Ping(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("WARN: AWX ping failed: %v", err)
+		}
+		c.recordPing(err)
+	}
+}
+
+// recordPing stores the result of an AWX reachability check
+func (c *Controller) recordPing(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastPingAt = time.Now()
+	c.lastPingErr = err
+}
+
+// recordInitialized marks the end of Initialize for the startup probe
+func (c *Controller) recordInitialized() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.initialized = true
+}
+
+// notStarted returns the reasons the controller has not finished starting
+// up, which takes as long as waiting for AWX
+func (c *Controller) notStarted() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.initialized {
+		return []string{"waiting for AWX"}
+	}
+	return nil
+}
+
+// notReady returns the reasons the controller cannot serve traffic yet, if any
+func (c *Controller) notReady() []string {
+	var reasons []string
+
+	c.mu.RLock()
+	watching := c.watching
+	lastPingAt, lastPingErr := c.lastPingAt, c.lastPingErr
+	c.mu.RUnlock()
+
+	if !watching {
+		reasons = append(reasons, "VM watch not started")
+	} else if !c.sourcesSynced() {
+		reasons = append(reasons, "VM watch not synced")
+	}
+
+	if c.awxEnabled {
+		switch {
+		case lastPingAt.IsZero():
+			reasons = append(reasons, "AWX not checked yet")
+		case lastPingErr != nil:
+			reasons = append(reasons, fmt.Sprintf("AWX unreachable: %v", lastPingErr))
+		case time.Since(lastPingAt) > 3*awxPingInterval:
+			reasons = append(reasons, fmt.Sprintf("AWX last checked %v ago", time.Since(lastPingAt).Round(time.Second)))
+		}
+	}
+
+	return reasons
+}
+
+// notAlive returns the reasons the controller is considered stuck, if any
+func (c *Controller) notAlive() []string {
+	var reasons []string
+	for _, w := range c.workers.Stats() {
+		if w.BusySince != nil && time.Since(*w.BusySince) > stuckWorkerTimeout {
+			reasons = append(reasons, fmt.Sprintf("worker %s stuck on '%s' since %s", w.ID, w.CurrentKey, w.BusySince.Format(time.RFC3339)))
+		}
+	}
+	return reasons
+}
+
+// HealthHandler serves the liveness probe
+func (c *Controller) HealthHandler() http.Handler {
+	return probeHandler(c.notAlive)
+}
+
+// StartupHandler serves the startup probe
+func (c *Controller) StartupHandler() http.Handler {
+	return probeHandler(c.notStarted)
+}
+
+// ReadyHandler serves the readiness probe
+func (c *Controller) ReadyHandler() http.Handler {
+	return probeHandler(c.notReady)
+}
+
+// probeHandler responds 200 "ok", or 503 listing the reasons check returns
+func probeHandler(check func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reasons := check(); len(reasons) > 0 {
+			http.Error(w, strings.Join(reasons, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
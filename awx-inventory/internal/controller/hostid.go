@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// AnnotationHostID is set by the controller to the ID of the AWX host of a VM
+const AnnotationHostID = "awx-inventory.io/host-id"
+
+// knownHostID returns the AWX host ID of a VM from the cache or its
+// annotation, 0 if unknown. Annotated IDs are checked once, since cloned VMs
+// copy the annotation of the original.
+func (c *Controller) knownHostID(ctx context.Context, invID int, vm *kubernetes.VirtualMachine, hostName string) (int, error) {
+	if !c.annotateHostID {
+		return 0, nil
+	}
+	key := vm.Namespace + "/" + hostName
+	if hostID, exists := c.hostIDs.Get(key); exists {
+		return hostID, nil
+	}
+
+	hostID, err := strconv.Atoi(vm.Annotations[AnnotationHostID])
+	if err != nil || hostID <= 0 {
+		return 0, nil
+	}
+	host, err := c.awxClient.GetHostByID(ctx, hostID)
+	if err != nil || host == nil {
+		return 0, err
+	}
+	if host.Inventory != invID || host.Name != hostName || !c.managed(host.Description) {
+		return 0, nil
+	}
+	if uid := descriptionField(host.Description, "uid"); vm.UID != "" && uid != vm.UID {
+		return 0, nil
+	}
+	c.hostIDs.Add(key, hostID)
+	return hostID, nil
+}
+
+// recordHostID caches the host ID of a VM and annotates the VM with it
+func (c *Controller) recordHostID(vm *kubernetes.VirtualMachine, hostName string, hostID int) {
+	if !c.annotateHostID || hostID == 0 {
+		return
+	}
+	c.hostIDs.Add(vm.Namespace+"/"+hostName, hostID)
+
+	value := strconv.Itoa(hostID)
+	if vm.Annotations[AnnotationHostID] == value {
+		return
+	}
+	err := c.patchVM(func(patcher vmPatcher) error {
+		return patcher.AnnotateVM(vm.Namespace, vm.Name, map[string]string{AnnotationHostID: value})
+	})
+	if err != nil {
+		log.Printf("WARN: failed to annotate VM '%s' in namespace '%s' with host ID %d: %v", vm.Name, vm.Namespace, hostID, err)
+	}
+}
+
+// seedHostID caches the annotated host ID of a removed VM, so its host is
+// deleted by ID
+func (c *Controller) seedHostID(vm *kubernetes.VirtualMachine, hostName string) {
+	hostID, err := strconv.Atoi(vm.Annotations[AnnotationHostID])
+	if !c.annotateHostID || err != nil || hostID <= 0 {
+		return
+	}
+	key := vm.Namespace + "/" + hostName
+	if _, exists := c.hostIDs.Get(key); !exists {
+		c.hostIDs.Add(key, hostID)
+	}
+}
+
+// lookupHost gets a host by its cached ID, falling back to its name if the
+// ID is unknown or belongs to another host
+func (c *Controller) lookupHost(ctx context.Context, invID int, namespace, hostName string) (*awx.Host, error) {
+	if hostID, exists := c.hostIDs.Get(namespace + "/" + hostName); exists {
+		host, err := c.awxClient.GetHostByID(ctx, hostID)
+		if err != nil {
+			return nil, err
+		}
+		if host != nil && host.Inventory == invID && host.Name == hostName {
+			return host, nil
+		}
+		c.hostIDs.Remove(namespace + "/" + hostName)
+	}
+	return c.awxClient.GetHost(ctx, invID, hostName)
+}
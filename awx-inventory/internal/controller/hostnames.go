@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cache"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// hostNameData is passed to the host name and host variable templates
+type hostNameData struct {
+	Name        string
+	Namespace   string
+	Hostname    string
+	ClusterName string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// baseHostName returns the host name a VM asks for, before collisions with
+// other VMs are resolved: the hostname annotation, the host name template,
+// the configured hostname field or the VM name
+func (c *Controller) baseHostName(vm *kubernetes.VirtualMachine) string {
+	if name := strings.TrimSpace(vm.Annotations[AnnotationHostname]); name != "" {
+		return name
+	}
+	if c.hostnameTemplate != nil {
+		var name strings.Builder
+		err := c.hostnameTemplate.Execute(&name, c.hostNameData(vm))
+		if result := strings.TrimSpace(name.String()); err == nil && result != "" {
+			return result
+		}
+		log.Printf("WARN: host name template failed for VM '%s' in namespace '%s', using the default name: %v", vm.Name, vm.Namespace, err)
+	}
+	if vm.Hostname != "" {
+		return vm.Hostname
+	}
+	return vm.Name
+}
+
+// hostNameData returns the template data of a VM
+func (c *Controller) hostNameData(vm *kubernetes.VirtualMachine) hostNameData {
+	return hostNameData{
+		Name:        vm.Name,
+		Namespace:   vm.Namespace,
+		Hostname:    vm.Hostname,
+		ClusterName: c.clusterName,
+		Labels:      vm.Labels,
+		Annotations: vm.Annotations,
+	}
+}
+
+// templateVars renders the host variable templates for a VM, leaving out
+// those that fail
+func (c *Controller) templateVars(vm *kubernetes.VirtualMachine) map[string]interface{} {
+	if len(c.hostVarsTemplates) == 0 {
+		return nil
+	}
+	data := c.hostNameData(vm)
+	vars := make(map[string]interface{}, len(c.hostVarsTemplates))
+	for name, tmpl := range c.hostVarsTemplates {
+		var value strings.Builder
+		if err := tmpl.Execute(&value, data); err != nil {
+			log.Printf("WARN: template of host variable '%s' failed for VM '%s' in namespace '%s': %v", name, vm.Name, vm.Namespace, err)
+			continue
+		}
+		vars[name] = value.String()
+	}
+	return vars
+}
+
+// hostName returns the AWX host name of a VM
+func (c *Controller) hostName(vm *kubernetes.VirtualMachine) string {
+	return c.hostClaims.name(c.inventoryName(vm.Namespace), c.baseHostName(vm), vm.Namespace+"/"+vm.Name)
+}
+
+// claimHostName records the host name a VM asks for and returns its AWX host
+// name. VMs whose host name changed because of the claim are queued again,
+// so their own worker renames their hosts.
+func (c *Controller) claimHostName(vm *kubernetes.VirtualMachine) string {
+	affected := c.hostClaims.claim(c.inventoryName(vm.Namespace), c.baseHostName(vm), vm)
+	c.resyncHostNames(affected)
+	return c.hostName(vm)
+}
+
+// releaseHostName drops the claim of a removed VM, queueing the VM that takes
+// over its host name
+func (c *Controller) releaseHostName(namespace, name string) {
+	c.resyncHostNames(c.hostClaims.release(namespace + "/" + name))
+}
+
+// seedHostNames claims the host names of existing VMs before anything is
+// synced, so hosts get their final names right away
+func (c *Controller) seedHostNames(vms []*kubernetes.VirtualMachine) {
+	for _, vm := range vms {
+		c.hostClaims.claim(c.inventoryName(vm.Namespace), c.baseHostName(vm), vm)
+	}
+}
+
+// resyncHostNames queues the VMs whose host name changed. They are read from
+// their source again rather than synced from the claim, which may be stale,
+// and are applied by the worker of their namespace like any other event.
+func (c *Controller) resyncHostNames(vms []*kubernetes.VirtualMachine) {
+	for _, vm := range vms {
+		log.Printf("Host name of VM '%s' in namespace '%s' changed by a host name collision, syncing it again", vm.Name, vm.Namespace)
+		if err := c.requeueVM(vm.Namespace, vm.Name); err != nil {
+			log.Printf("WARN: failed to queue VM '%s' in namespace '%s', its host is renamed with its next event: %v", vm.Name, vm.Namespace, err)
+		}
+	}
+}
+
+// requeueVM reads a VM from the Kubernetes sources again and queues it as an
+// ADDED event. VMs that no longer exist are skipped, their DELETED event
+// releases the claim.
+func (c *Controller) requeueVM(namespace, name string) error {
+	if len(c.vmSources) == 0 {
+		return errResyncUnsupported
+	}
+	if !c.running() {
+		return errNotRunning
+	}
+	for _, source := range c.vmSources {
+		obj, err := source.GetVMObject(namespace, name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if e, ok := newVMEvent(source, watch.Event{Type: watch.Added, Object: obj}, obj); ok {
+			c.enqueue(e)
+		}
+		return nil
+	}
+	return nil
+}
+
+// hostNameClaims resolves host name collisions within an inventory. Of the
+// VMs asking for the same host name, the one with the lowest namespace/name
+// keeps it and the others get a suffix derived from their namespace/name,
+// so the result does not depend on the order VMs are seen in.
+type hostNameClaims struct {
+	mu sync.Mutex
+	// VMs asking for each inventory/host name, by namespace/name
+	claims map[string]map[string]*kubernetes.VirtualMachine
+	// Claimed inventory/host name by namespace/name. Claims of VMs not seen
+	// for long, e.g. whose DELETED event was lost, are evicted like released.
+	byVM *cache.LRU[string, string]
+	// VMs that took over host names of evicted claims, collected by claim
+	evicted []*kubernetes.VirtualMachine
+}
+
+func newHostNameClaims(size int) *hostNameClaims {
+	h := &hostNameClaims{
+		claims: make(map[string]map[string]*kubernetes.VirtualMachine),
+		byVM:   cache.NewLRU[string, string]("host_name_claim", size),
+	}
+	// Only claim adds to byVM, with mu held
+	h.byVM.OnEvict(func(key, claimKey string) {
+		h.evicted = append(h.evicted, h.dropLocked(key, claimKey)...)
+	})
+	return h
+}
+
+// heldByOther reports whether a VM other than the one with key asks for
+// hostName and keeps it
+func (h *hostNameClaims) heldByOther(inventory, hostName, key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	owner := lowestKey(h.claims[inventory+"/"+hostName])
+	return owner != "" && owner != key
+}
+
+// name returns the host name of the VM with key asking for base
+func (h *hostNameClaims) name(inventory, base, key string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	owner := key
+	for claimant := range h.claims[inventory+"/"+base] {
+		owner = min(owner, claimant)
+	}
+	if owner == key {
+		return base
+	}
+	return collisionName(base, key)
+}
+
+// claim records that vm asks for base and returns the other VMs whose host
+// name changed because of it
+func (h *hostNameClaims) claim(inventory, base string, vm *kubernetes.VirtualMachine) []*kubernetes.VirtualMachine {
+	key := vm.Namespace + "/" + vm.Name
+	claimKey := inventory + "/" + base
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var affected []*kubernetes.VirtualMachine
+	if previous, exists := h.byVM.Get(key); exists && previous != claimKey {
+		affected = h.releaseLocked(key)
+	}
+	h.byVM.Add(key, claimKey)
+	affected = append(affected, h.evicted...)
+	h.evicted = nil
+
+	claimants := h.claims[claimKey]
+	if claimants == nil {
+		claimants = make(map[string]*kubernetes.VirtualMachine)
+		h.claims[claimKey] = claimants
+	}
+	_, claimed := claimants[key]
+	owner := lowestKey(claimants)
+	claimants[key] = vm
+
+	if !claimed && owner != "" && key < owner {
+		log.Printf("WARN: VM '%s' in namespace '%s' asks for host name '%s' of VM '%s', which is renamed", vm.Name, vm.Namespace, base, owner)
+		affected = append(affected, claimants[owner])
+	} else if !claimed && owner != "" {
+		log.Printf("WARN: host name '%s' is taken by VM '%s', VM '%s' in namespace '%s' is synced as '%s'", base, owner, vm.Name, vm.Namespace, collisionName(base, key))
+	}
+	return affected
+}
+
+// release drops the claim of the VM with key and returns the VM that takes
+// over its host name, if any
+func (h *hostNameClaims) release(key string) []*kubernetes.VirtualMachine {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.releaseLocked(key)
+}
+
+func (h *hostNameClaims) releaseLocked(key string) []*kubernetes.VirtualMachine {
+	claimKey, exists := h.byVM.Get(key)
+	if !exists {
+		return nil
+	}
+	h.byVM.Remove(key)
+	return h.dropLocked(key, claimKey)
+}
+
+// dropLocked removes the VM with key from the claimants of claimKey and
+// returns the VM that takes over the host name, if any
+func (h *hostNameClaims) dropLocked(key, claimKey string) []*kubernetes.VirtualMachine {
+	claimants := h.claims[claimKey]
+	owner := lowestKey(claimants)
+	delete(claimants, key)
+	if len(claimants) == 0 {
+		delete(h.claims, claimKey)
+		return nil
+	}
+	if owner != key {
+		return nil
+	}
+	return []*kubernetes.VirtualMachine{claimants[lowestKey(claimants)]}
+}
+
+// lowestKey returns the lowest key of claimants, empty if there are none
+func lowestKey(claimants map[string]*kubernetes.VirtualMachine) string {
+	keys := make([]string, 0, len(claimants))
+	for key := range claimants {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return slices.Min(keys)
+}
+
+// collisionName returns the host name of a VM that lost base to another VM
+func collisionName(base, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return base + "-" + hex.EncodeToString(sum[:4])
+}
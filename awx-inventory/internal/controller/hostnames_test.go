@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+func TestHostNameClaimsCollision(t *testing.T) {
+	claims := newHostNameClaims(0)
+	a := &kubernetes.VirtualMachine{Namespace: "a", Name: "web"}
+	b := &kubernetes.VirtualMachine{Namespace: "b", Name: "web"}
+
+	claims.claim("inv", "web", b)
+	if affected := claims.claim("inv", "web", a); len(affected) != 1 || affected[0] != b {
+		t.Fatalf("claim of a/web affected %v, want b/web", affected)
+	}
+	if name := claims.name("inv", "web", "a/web"); name != "web" {
+		t.Errorf("a/web: got %s, want web", name)
+	}
+	if name := claims.name("inv", "web", "b/web"); name != collisionName("web", "b/web") {
+		t.Errorf("b/web: got %s, want the collision name", name)
+	}
+
+	if affected := claims.release("a/web"); len(affected) != 1 || affected[0] != b {
+		t.Fatalf("release of a/web affected %v, want b/web", affected)
+	}
+	if name := claims.name("inv", "web", "b/web"); name != "web" {
+		t.Errorf("b/web after a/web was released: got %s, want web", name)
+	}
+}
+
+func TestHostNameClaimsEviction(t *testing.T) {
+	claims := newHostNameClaims(2)
+	a := &kubernetes.VirtualMachine{Namespace: "a", Name: "web"}
+	b := &kubernetes.VirtualMachine{Namespace: "b", Name: "web"}
+
+	claims.claim("inv", "web", a)
+	claims.claim("inv", "web", b)
+	// a/web is seen least recently and evicted like released
+	affected := claims.claim("inv", "db", &kubernetes.VirtualMachine{Namespace: "c", Name: "db"})
+	if len(affected) != 1 || affected[0] != b {
+		t.Fatalf("eviction of a/web affected %v, want b/web", affected)
+	}
+	if name := claims.name("inv", "web", "b/web"); name != "web" {
+		t.Errorf("b/web after a/web was evicted: got %s, want web", name)
+	}
+
+	for i := 0; i < 100; i++ {
+		claims.claim("inv", fmt.Sprintf("vm-%d", i), &kubernetes.VirtualMachine{Namespace: "churn", Name: fmt.Sprintf("vm-%d", i)})
+	}
+	if n := len(claims.claims); n > 2 {
+		t.Errorf("holding %d claimed host names, want at most 2", n)
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// InventoryVarsConfigMap is the ConfigMap in a namespace whose data becomes
+// the variables of the namespace's inventory
+const InventoryVarsConfigMap = "awx-inventory-vars"
+
+// inventoryVars holds the variables read from InventoryVarsConfigMap by
+// namespace, so inventories created later get them
+type inventoryVars struct {
+	mu          sync.Mutex
+	byNamespace map[string]map[string]interface{}
+}
+
+// parseVars decodes each value of a ConfigMap as YAML, keeping values that
+// are not valid YAML as strings
+func parseVars(data map[string]string) map[string]interface{} {
+	vars := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		var decoded interface{}
+		if err := yaml.Unmarshal([]byte(value), &decoded); err != nil {
+			decoded = value
+		}
+		vars[key] = decoded
+	}
+	return vars
+}
+
+// runInventoryVarsWatch syncs InventoryVarsConfigMap of each watched
+// namespace into its inventory until ctx is done
+func (c *Controller) runInventoryVarsWatch(ctx context.Context) {
+	log.Printf("Watching ConfigMaps '%s' for inventory variables", InventoryVarsConfigMap)
+
+	err := c.k8sClient.WatchConfigMaps(ctx, InventoryVarsConfigMap, func(namespace string, data map[string]string) {
+		if err := c.handleInventoryVars(ctx, namespace, data); err != nil {
+			log.Printf("ERROR: failed to sync variables of the inventory of namespace '%s': %v", namespace, err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("WARN: stopped watching inventory variable ConfigMaps: %v", err)
+	}
+}
+
+// handleInventoryVars replaces the variables of a namespace's inventory with
+// the data of its ConfigMap, clearing them once the ConfigMap was deleted.
+// A namespace without inventory gets the variables once it is created.
+func (c *Controller) handleInventoryVars(ctx context.Context, namespace string, data map[string]string) error {
+	vars := parseVars(data)
+
+	c.inventoryVars.mu.Lock()
+	_, known := c.inventoryVars.byNamespace[namespace]
+	if data == nil {
+		delete(c.inventoryVars.byNamespace, namespace)
+	} else {
+		c.inventoryVars.byNamespace[namespace] = vars
+	}
+	c.inventoryVars.mu.Unlock()
+
+	// Variables set by hand are only cleared if the ConfigMap set them
+	if data == nil && !known {
+		return nil
+	}
+
+	invID, err := c.lookupInventoryForNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if invID == 0 {
+		return nil
+	}
+	return c.setInventoryVars(ctx, namespace, invID, vars)
+}
+
+// applyInventoryVars sets the variables of a newly created inventory, if
+// its namespace has InventoryVarsConfigMap
+func (c *Controller) applyInventoryVars(ctx context.Context, namespace string, invID int) error {
+	c.inventoryVars.mu.Lock()
+	vars, exists := c.inventoryVars.byNamespace[namespace]
+	c.inventoryVars.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return c.setInventoryVars(ctx, namespace, invID, vars)
+}
+
+// setInventoryVars writes the variables of the inventory of a namespace
+func (c *Controller) setInventoryVars(ctx context.Context, namespace string, invID int, vars map[string]interface{}) error {
+	if err := c.awxClient.SetInventoryVariables(ctx, invID, vars); err != nil {
+		return fmt.Errorf("failed to set inventory variables: %w", err)
+	}
+	log.Printf("Set %d variables of inventory '%s' from ConfigMap '%s' in namespace '%s'", len(vars), c.inventoryName(namespace), InventoryVarsConfigMap, namespace)
+	return nil
+}
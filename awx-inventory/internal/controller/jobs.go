@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// jobPollInterval is how often launched jobs are checked
+const jobPollInterval = 5 * time.Second
+
+// Job kinds, the kind label of the job metrics
+const (
+	jobKindProvision   = "provision"
+	jobKindDeprovision = "deprovision"
+	jobKindPing        = "ping"
+)
+
+// Job statuses the controller acts on
+const (
+	jobStatusRunning    = "running"
+	jobStatusSuccessful = "successful"
+)
+
+// trackedJob is a provisioning or deprovisioning job or ping polled until
+// it finished
+type trackedJob struct {
+	kind     string
+	vm       *kubernetes.VirtualMachine
+	template string
+	invID    int
+	hostName string
+	jobID    int
+	// attempt counts the launches so far
+	attempt int
+	// retryAt is when the failed job is relaunched, zero while it runs
+	retryAt time.Time
+	// deadline is when a deprovisioning job is given up on
+	deadline time.Time
+}
+
+// jobTracker holds the tracked jobs by trackKey
+type jobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*trackedJob
+}
+
+// trackKey identifies the job of a kind of a VM
+func trackKey(kind string, vm *kubernetes.VirtualMachine) string {
+	return kind + "/" + provisionKey(vm)
+}
+
+// trackJob starts polling a launched job
+func (c *Controller) trackJob(job *trackedJob) {
+	c.jobTracker.mu.Lock()
+	defer c.jobTracker.mu.Unlock()
+	c.jobTracker.jobs[trackKey(job.kind, job.vm)] = job
+}
+
+// tracked reports whether a job of a kind of a VM is polled
+func (c *Controller) tracked(kind string, vm *kubernetes.VirtualMachine) bool {
+	c.jobTracker.mu.Lock()
+	defer c.jobTracker.mu.Unlock()
+	_, exists := c.jobTracker.jobs[trackKey(kind, vm)]
+	return exists
+}
+
+// untrackJobs stops polling the jobs of a VM, e.g. once it was deleted
+func (c *Controller) untrackJobs(vm *kubernetes.VirtualMachine) {
+	c.jobTracker.mu.Lock()
+	defer c.jobTracker.mu.Unlock()
+	delete(c.jobTracker.jobs, trackKey(jobKindProvision, vm))
+	delete(c.jobTracker.jobs, trackKey(jobKindPing, vm))
+}
+
+// removeTrackedJob stops polling a job unless it was replaced
+func (c *Controller) removeTrackedJob(key string, job *trackedJob) {
+	c.jobTracker.mu.Lock()
+	defer c.jobTracker.mu.Unlock()
+	if c.jobTracker.jobs[key] == job {
+		delete(c.jobTracker.jobs, key)
+	}
+}
+
+// trackedJobs returns the tracked jobs by key
+func (c *Controller) trackedJobs() map[string]*trackedJob {
+	c.jobTracker.mu.Lock()
+	defer c.jobTracker.mu.Unlock()
+
+	jobs := make(map[string]*trackedJob, len(c.jobTracker.jobs))
+	for key, job := range c.jobTracker.jobs {
+		jobs[key] = job
+	}
+	return jobs
+}
+
+// resumeJobTracking tracks a provisioning job that was still running when
+// the controller restarted. Jobs launched since are known to provisioning,
+// so a VM with a stale annotation is not tracked again.
+func (c *Controller) resumeJobTracking(vm *kubernetes.VirtualMachine, invID int, hostName string) {
+	if vm.Annotations[AnnotationProvisionJobStatus] != jobStatusRunning {
+		return
+	}
+	jobID, err := strconv.Atoi(vm.Annotations[AnnotationProvisionJobID])
+	if err != nil {
+		return
+	}
+
+	key := provisionKey(vm)
+	if _, known := c.provisioning.Get(key); known {
+		return
+	}
+	c.provisioning.Add(key, jobID)
+	c.trackJob(&trackedJob{
+		kind:     jobKindProvision,
+		vm:       vm,
+		template: c.provisionTemplate(vm),
+		invID:    invID,
+		hostName: hostName,
+		jobID:    jobID,
+		attempt:  1,
+	})
+}
+
+// runJobTracking polls the tracked jobs until ctx is done
+func (c *Controller) runJobTracking(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for key, job := range c.trackedJobs() {
+			c.pollJob(ctx, key, job)
+		}
+	}
+}
+
+// pollJob records the outcome of a finished provisioning job, relaunching
+// a failed one after a backoff up to jobRetries times
+func (c *Controller) pollJob(ctx context.Context, key string, job *trackedJob) {
+	switch job.kind {
+	case jobKindPing:
+		c.pollPing(ctx, key, job)
+		return
+	case jobKindDeprovision:
+		c.pollDeprovision(ctx, key, job)
+		return
+	}
+	if !job.retryAt.IsZero() {
+		if time.Now().Before(job.retryAt) {
+			return
+		}
+		c.relaunchJob(ctx, job)
+		return
+	}
+
+	awxJob, err := c.awxClient.GetJob(ctx, job.jobID)
+	if err != nil {
+		log.Printf("WARN: failed to get provisioning job %d of host '%s': %v", job.jobID, job.hostName, err)
+		return
+	}
+	if !awxJob.IsFinished() {
+		return
+	}
+	metrics.JobsTotal.WithLabelValues(jobKindProvision, awxJob.Status).Inc()
+
+	if awxJob.Status == jobStatusSuccessful {
+		log.Printf("Provisioning job %d of host '%s' succeeded", job.jobID, job.hostName)
+		c.recordEvent(job.vm, corev1.EventTypeNormal, EventProvisionSucceeded, "Provisioning job %d succeeded", job.jobID)
+		c.finishJob(key, job, awxJob.Status)
+		return
+	}
+	if job.attempt > c.jobRetries || job.template == "" {
+		log.Printf("WARN: provisioning job %d of host '%s' finished with status '%s'", job.jobID, job.hostName, awxJob.Status)
+		c.recordEvent(job.vm, corev1.EventTypeWarning, EventProvisionFailed, "Provisioning job %d finished with status '%s'", job.jobID, awxJob.Status)
+		c.finishJob(key, job, awxJob.Status)
+		return
+	}
+
+	backoff := c.jobBackoff(job.attempt)
+	log.Printf("WARN: provisioning job %d of host '%s' finished with status '%s', retrying in %v", job.jobID, job.hostName, awxJob.Status, backoff)
+	c.recordEvent(job.vm, corev1.EventTypeWarning, EventProvisionFailed, "Provisioning job %d finished with status '%s', retrying in %v", job.jobID, awxJob.Status, backoff)
+	c.jobTracker.mu.Lock()
+	job.retryAt = time.Now().Add(backoff)
+	c.jobTracker.mu.Unlock()
+}
+
+// relaunchJob launches a failed provisioning or deprovisioning job again, a
+// failed launch is retried on the next poll
+func (c *Controller) relaunchJob(ctx context.Context, job *trackedJob) {
+	kind := "provisioning"
+	if job.kind == jobKindDeprovision {
+		kind = "deprovisioning"
+	}
+	jobID, err := c.launchJob(ctx, job.template, job.invID, job.vm, job.hostName)
+	if err != nil {
+		log.Printf("WARN: failed to relaunch %s job template '%s' for host '%s': %v", kind, job.template, job.hostName, err)
+		return
+	}
+	log.Printf("Relaunched %s job %d from template '%s' for host '%s'", kind, jobID, job.template, job.hostName)
+	metrics.JobRetriesTotal.WithLabelValues(job.kind).Inc()
+
+	c.jobTracker.mu.Lock()
+	job.jobID = jobID
+	job.attempt++
+	job.retryAt = time.Time{}
+	c.jobTracker.mu.Unlock()
+	if job.kind == jobKindDeprovision {
+		c.deprovisioning.Add(provisionKey(job.vm), jobID)
+		return
+	}
+	c.provisioning.Add(provisionKey(job.vm), jobID)
+	c.annotateProvisionJob(job.vm, jobID, jobStatusRunning)
+}
+
+// finishJob stops tracking a provisioning job and records its final status
+func (c *Controller) finishJob(key string, job *trackedJob, status string) {
+	c.removeTrackedJob(key, job)
+	c.annotateProvisionJob(job.vm, job.jobID, status)
+}
+
+// launchJob launches a job template against the host of a VM
+func (c *Controller) launchJob(ctx context.Context, template string, invID int, vm *kubernetes.VirtualMachine, hostName string) (int, error) {
+	templateID, err := c.awxClient.GetJobTemplateID(ctx, template)
+	if err != nil {
+		return 0, err
+	}
+	return c.awxClient.LaunchJobTemplate(ctx, templateID, invID, hostName, map[string]interface{}{
+		"vm_name":      vm.Name,
+		"vm_namespace": vm.Namespace,
+	})
+}
+
+// jobBackoff returns the delay before relaunching a job that failed attempt
+// times, doubling from jobRetryBackoff
+func (c *Controller) jobBackoff(attempt int) time.Duration {
+	return c.jobRetryBackoff << (attempt - 1)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/record"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// KubernetesClient is the Kubernetes API used by the controller. It is
+// implemented by *kubernetes.Client, which can be built on a fake dynamic
+// client with kubernetes.NewClientForDynamic.
+type KubernetesClient interface {
+	kubernetes.Source
+
+	GetNodeTopology(name string) (*kubernetes.NodeTopology, error)
+	GetSecretData(namespace, name string) (map[string][]byte, error)
+	WatchSecret(ctx context.Context, namespace, name string, handler func(data map[string][]byte)) error
+	WatchSecrets(ctx context.Context, labelSelector string, handler func(namespace, name string, data map[string][]byte)) error
+	GetConfigMapData(namespace, name string) (map[string]string, error)
+	ApplyConfigMap(namespace, name string, labels, data map[string]string) error
+	WatchConfigMaps(ctx context.Context, name string, handler func(namespace string, data map[string]string)) error
+	NamespaceExists(name string) (bool, error)
+	WatchNamespaceDeletions(ctx context.Context, handler func(name string)) error
+	NewEventRecorder(component string) (record.EventRecorder, func())
+
+	ListAnsibleJobs() ([]*kubernetes.AnsibleJob, error)
+	UpdateAnsibleJobStatus(job *kubernetes.AnsibleJob) error
+}
+
+var _ KubernetesClient = (*kubernetes.Client)(nil)
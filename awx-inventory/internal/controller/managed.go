@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// managedByMarker starts the description of every inventory, group and host
+// the controller creates
+const managedByMarker = "managed-by=awx-inventory"
+
+// managedDescription marks inventories and groups created by the controller
+func (c *Controller) managedDescription() string {
+	if c.clusterName == "" {
+		return managedByMarker
+	}
+	return managedByMarker + " cluster=" + c.clusterName
+}
+
+// inventoryDescription marks an inventory and, unless all namespaces share
+// it, names its namespace so it can be pruned once the namespace is gone
+func (c *Controller) inventoryDescription(namespace string) string {
+	if c.singleInventory != "" {
+		return c.managedDescription()
+	}
+	return c.managedDescription() + " ns=" + namespace
+}
+
+// hostDescription links a host back to its Kubernetes object, e.g.
+// "managed-by=awx-inventory cluster=prod ns=team-a kind=VirtualMachine uid=..."
+func (c *Controller) hostDescription(vm *kubernetes.VirtualMachine) string {
+	fields := []string{c.managedDescription(), "ns=" + vm.Namespace}
+	if vm.Kind != "" {
+		fields = append(fields, "kind="+vm.Kind)
+	}
+	if vm.UID != "" {
+		fields = append(fields, "uid="+vm.UID)
+	}
+	return strings.Join(fields, " ")
+}
+
+// managed reports whether an AWX object description carries the marker of
+// this controller and, if it names a cluster, that it is ours. Only managed
+// objects are ever deleted or pruned.
+func (c *Controller) managed(description string) bool {
+	if !slices.Contains(strings.Fields(description), managedByMarker) {
+		return false
+	}
+	cluster := descriptionField(description, "cluster")
+	return cluster == "" || cluster == c.clusterName
+}
+
+// descriptionField returns the value of a key=value field of a description
+func descriptionField(description, key string) string {
+	for _, field := range strings.Fields(description) {
+		if value, found := strings.CutPrefix(field, key+"="); found {
+			return value
+		}
+	}
+	return ""
+}
+
+// deleteManagedHost deletes a host unless it lacks the managed marker
+func (c *Controller) deleteManagedHost(ctx context.Context, invID int, namespace, hostName string) error {
+	host, err := c.lookupHost(ctx, invID, namespace, hostName)
+	if err != nil || host == nil {
+		return err
+	}
+	if !c.managed(host.Description) {
+		log.Printf("WARN: not deleting host '%s', it was not created by awx-inventory", hostName)
+		return nil
+	}
+	c.hostIDs.Remove(namespace + "/" + hostName)
+	if err := c.awxClient.DeleteHostByID(ctx, host.ID); err != nil {
+		return err
+	}
+	c.notifyHostRemoved(namespace, c.inventoryName(namespace), hostName, "")
+	return nil
+}
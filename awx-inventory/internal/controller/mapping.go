@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// InventoryMapping describes the AWX inventory of a namespace as published in the ConfigMap
+type InventoryMapping struct {
+	Inventory string `json:"inventory"`
+	ID        int    `json:"id"`
+	Hosts     int    `json:"hosts"`
+}
+
+// runInventoryMap periodically publishes the namespace to inventory mapping
+func (c *Controller) runInventoryMap(ctx context.Context) {
+	log.Printf("Publishing inventory mapping to ConfigMap '%s/%s' every %v", c.inventoryMapNamespace, c.inventoryMap, c.inventoryMapInterval)
+
+	ticker := time.NewTicker(c.inventoryMapInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.publishInventoryMap(ctx); err != nil {
+			log.Printf("ERROR: failed to publish inventory mapping: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishInventoryMap writes one key per namespace holding its InventoryMapping as JSON
+func (c *Controller) publishInventoryMap(ctx context.Context) error {
+	data := make(map[string]string)
+	for namespace, invID := range c.inventoryCache.Items() {
+		mapping := InventoryMapping{
+			Inventory: c.inventoryName(namespace),
+			ID:        invID,
+		}
+
+		hosts, err := c.awxClient.ListHosts(ctx, invID)
+		if err != nil {
+			return fmt.Errorf("failed to count hosts of inventory '%s': %w", mapping.Inventory, err)
+		}
+		mapping.Hosts = len(hosts)
+
+		value, err := json.Marshal(mapping)
+		if err != nil {
+			return err
+		}
+		data[namespace] = string(value)
+	}
+
+	labels := map[string]string{"app.kubernetes.io/managed-by": "awx-inventory"}
+	return c.k8sClient.ApplyConfigMap(c.inventoryMapNamespace, c.inventoryMap, labels, data)
+}
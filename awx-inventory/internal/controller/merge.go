@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Strategies for merging host variables with those already in AWX
+const (
+	// MergeReplace overwrites the variables in AWX, the default
+	MergeReplace = "replace"
+	// MergeShallow keeps variables in AWX the controller does not set
+	MergeShallow = "shallow-merge"
+	// MergeDeep is MergeShallow applied recursively to nested variables
+	MergeDeep = "deep-merge"
+	// MergeManagedKeys is MergeShallow that also removes variables the
+	// controller set before but no longer sets
+	MergeManagedKeys = "managed-keys-only"
+)
+
+// managedKeysVar lists the host variables set by the controller in
+// managed-keys-only mode
+const managedKeysVar = "awx_inventory_managed_keys"
+
+// mergeHostVars merges hostVars with the variables of the host in AWX
+// according to the merge strategy
+func (c *Controller) mergeHostVars(ctx context.Context, invID int, hostName string, hostVars map[string]interface{}) (map[string]interface{}, error) {
+	if c.mergeStrategy == "" || c.mergeStrategy == MergeReplace {
+		return hostVars, nil
+	}
+
+	host, err := c.awxClient.GetHost(ctx, invID, hostName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host '%s': %w", hostName, err)
+	}
+
+	// AWX stores variables as YAML or JSON
+	var existing map[string]interface{}
+	if host != nil && strings.TrimSpace(host.Variables) != "" {
+		if err := yaml.Unmarshal([]byte(host.Variables), &existing); err != nil {
+			log.Printf("WARN: variables of host '%s' are neither YAML nor JSON, replacing them: %v", hostName, err)
+			existing = nil
+		}
+	}
+	return mergeVars(c.mergeStrategy, existing, hostVars), nil
+}
+
+// mergeVars returns existing updated with hostVars
+func mergeVars(strategy string, existing, hostVars map[string]interface{}) map[string]interface{} {
+	if strategy == "" || strategy == MergeReplace {
+		return hostVars
+	}
+
+	merged := make(map[string]interface{}, len(existing)+len(hostVars))
+	for k, v := range existing {
+		merged[k] = v
+	}
+
+	switch strategy {
+	case MergeDeep:
+		return deepMerge(merged, hostVars)
+	case MergeManagedKeys:
+		if previous, ok := existing[managedKeysVar].([]interface{}); ok {
+			for _, key := range previous {
+				if name, ok := key.(string); ok {
+					delete(merged, name)
+				}
+			}
+		}
+		keys := make([]string, 0, len(hostVars))
+		for k := range hostVars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		merged[managedKeysVar] = keys
+	}
+
+	for k, v := range hostVars {
+		merged[k] = v
+	}
+	return merged
+}
+
+// deepMerge sets the values of src in dst, merging nested maps
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		srcMap, srcIsMap := asMap(v)
+		dstMap, dstIsMap := asMap(dst[k])
+		if srcIsMap && dstIsMap {
+			merged := make(map[string]interface{}, len(dstMap))
+			for key, value := range dstMap {
+				merged[key] = value
+			}
+			dst[k] = deepMerge(merged, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// asMap converts nested variables like labels to a generic map
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, true
+	case map[string]string:
+		result := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			result[k] = v
+		}
+		return result, true
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"log"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// Policies for the inventory of a deleted namespace
+const (
+	// NamespaceOrphan leaves the inventory in AWX untouched
+	NamespaceOrphan = "orphan"
+	// NamespaceDelete deletes the inventory with its hosts and groups
+	NamespaceDelete = "delete"
+	// NamespaceRename keeps the inventory under the name "<name>-deleted"
+	NamespaceRename = "rename"
+)
+
+// deletedSuffix is appended to inventories renamed by NamespaceRename
+const deletedSuffix = "-deleted"
+
+// runNamespaceWatch applies the namespace deletion policy to deleted namespaces
+func (c *Controller) runNamespaceWatch(ctx context.Context) {
+	log.Printf("Watching namespace deletions with policy '%s'", c.namespacePolicy)
+
+	err := c.k8sClient.WatchNamespaceDeletions(ctx, func(namespace string) {
+		if err := c.handleNamespaceDeleted(ctx, namespace); err != nil {
+			log.Printf("ERROR: failed to handle deletion of namespace '%s': %v", namespace, err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("WARN: stopped watching namespace deletions: %v", err)
+	}
+}
+
+// handleNamespaceDeleted forgets the inventory of a deleted namespace and
+// deletes, orphans or renames it in AWX
+func (c *Controller) handleNamespaceDeleted(ctx context.Context, namespace string) error {
+	defer func() {
+		c.inventoryCache.Remove(namespace)
+		metrics.Inventories.Set(float64(c.inventoryCache.Len()))
+	}()
+
+	// Other namespaces still use the shared inventory
+	if c.singleInventory != "" || c.namespacePolicy == NamespaceOrphan {
+		log.Printf("Namespace '%s' was deleted, leaving its inventory in AWX", namespace)
+		return nil
+	}
+
+	inv, err := c.awxClient.GetInventory(ctx, c.inventoryName(namespace))
+	if err != nil || inv == nil {
+		return err
+	}
+	if !c.managed(inv.Description) {
+		log.Printf("WARN: not touching inventory '%s' of deleted namespace '%s', it was not created by awx-inventory", inv.Name, namespace)
+		return nil
+	}
+
+	if c.namespacePolicy == NamespaceDelete {
+		_, err := c.pruneInventory(ctx, *inv, namespace)
+		return err
+	}
+
+	// Without the ns field pruning leaves the renamed inventory alone
+	name := inv.Name + deletedSuffix
+	log.Printf("Namespace '%s' was deleted, renaming inventory '%s' to '%s'", namespace, inv.Name, name)
+	return c.awxClient.UpdateInventory(ctx, inv.ID, name, c.managedDescription())
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/notify"
+)
+
+// failureStreaks counts the syncs of each VM that failed in a row
+type failureStreaks struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newFailureStreaks() *failureStreaks {
+	return &failureStreaks{counts: make(map[string]int)}
+}
+
+// fail counts a failed sync of key and returns the length of the streak
+func (f *failureStreaks) fail(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[key]++
+	return f.counts[key]
+}
+
+// succeed ends the streak of key and returns its length
+func (f *failureStreaks) succeed(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failures := f.counts[key]
+	delete(f.counts, key)
+	return failures
+}
+
+// notifySyncResult sends SyncFailing once the syncs of a VM failed
+// failureThreshold times in a row, and SyncRecovered when it syncs again
+func (c *Controller) notifySyncResult(ctx context.Context, e vmEvent, err error) {
+	if c.notifier == nil || ctx.Err() != nil {
+		return
+	}
+	event := notify.Event{Namespace: e.namespace, VM: e.name}
+
+	if err != nil {
+		failures := c.failures.fail(e.key())
+		if failures != c.failureThreshold {
+			return
+		}
+		event.Event = notify.SyncFailing
+		event.Failures = failures
+		event.Error = err.Error()
+		event.Message = fmt.Sprintf("Syncing VM '%s' to AWX failed %d times in a row: %v", e.key(), failures, err)
+		c.notifier.Notify(event)
+		return
+	}
+
+	failures := c.failures.succeed(e.key())
+	if failures < c.failureThreshold || e.event.Type == watch.Deleted {
+		return
+	}
+	event.Event = notify.SyncRecovered
+	event.Failures = failures
+	event.Message = fmt.Sprintf("Syncing VM '%s' to AWX works again after %d failures", e.key(), failures)
+	c.notifier.Notify(event)
+}
+
+// hostExists reports whether AWX has the host before it is created, so
+// HostAdded is only sent for new hosts. It is only looked up if HostAdded is
+// sent, and errors count as existing.
+func (c *Controller) hostExists(ctx context.Context, invID int, hostName string) bool {
+	if !c.notifier.Enabled(notify.HostAdded) {
+		return true
+	}
+	hostID, err := c.awxClient.GetHostID(ctx, invID, hostName)
+	return err != nil || hostID != 0
+}
+
+func (c *Controller) notifyHostAdded(namespace, vmName, hostName string) {
+	c.notifier.Notify(notify.Event{
+		Event:     notify.HostAdded,
+		Namespace: namespace,
+		VM:        vmName,
+		Host:      hostName,
+		Inventory: c.inventoryName(namespace),
+		Message:   fmt.Sprintf("Host '%s' of VM '%s/%s' added to AWX inventory '%s'", hostName, namespace, vmName, c.inventoryName(namespace)),
+	})
+}
+
+// notifyHostsAdded sends one HostAdded event for hosts created in bulk
+func (c *Controller) notifyHostsAdded(namespace string, hosts int) {
+	if hosts == 0 {
+		return
+	}
+	c.notifier.Notify(notify.Event{
+		Event:     notify.HostAdded,
+		Namespace: namespace,
+		Inventory: c.inventoryName(namespace),
+		Hosts:     hosts,
+		Message:   fmt.Sprintf("%d hosts added to AWX inventory '%s'", hosts, c.inventoryName(namespace)),
+	})
+}
+
+// notifyHostRemoved sends HostRemoved, reason saying why if not empty
+func (c *Controller) notifyHostRemoved(namespace, inventory, hostName, reason string) {
+	message := fmt.Sprintf("Host '%s' removed from AWX inventory '%s'", hostName, inventory)
+	if reason != "" {
+		message += ", " + reason
+	}
+	c.notifier.Notify(notify.Event{
+		Event:     notify.HostRemoved,
+		Namespace: namespace,
+		Host:      hostName,
+		Inventory: inventory,
+		Message:   message,
+	})
+}
+
+func (c *Controller) notifyInventoryCreated(namespace, inventory string) {
+	c.notifier.Notify(notify.Event{
+		Event:     notify.InventoryCreated,
+		Namespace: namespace,
+		Inventory: inventory,
+		Message:   fmt.Sprintf("AWX inventory '%s' created for namespace '%s'", inventory, namespace),
+	})
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// checkPermissions fails if the AWX user cannot create the inventories the
+// controller needs or change the hosts of the managed ones, instead of
+// failing on the first VM event
+func (c *Controller) checkPermissions(ctx context.Context, orgID int) error {
+	perms, err := c.awxClient.CheckPermissions(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to check AWX permissions: %w", err)
+	}
+	if perms.Superuser {
+		log.Printf("AWX user '%s' is a system administrator", perms.Username)
+		return nil
+	}
+
+	var problems []string
+	singleExists := false
+	for _, inv := range perms.Inventories {
+		if inv.Kind != "" {
+			continue
+		}
+		if c.singleInventory != "" && inv.Name == c.singleInventory {
+			singleExists = true
+		} else if c.singleInventory != "" || !c.managed(inv.Description) {
+			continue
+		}
+		if !inv.Edit {
+			problems = append(problems, fmt.Sprintf("cannot change the hosts of inventory '%s', grant it the Admin role of the inventory", inv.Name))
+		}
+	}
+	if !perms.CanCreateInventories && !singleExists {
+		problems = append(problems, fmt.Sprintf("cannot create inventories, grant it the Inventory Admin role of organization '%s'", c.organization))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: AWX user '%s' %s", awx.ErrForbidden, perms.Username, strings.Join(problems, "; "))
+	}
+	log.Printf("AWX user '%s' can manage the inventories of organization '%s'", perms.Username, c.organization)
+	return nil
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// AnnotationPingStatus is set by the controller to the final status of the
+// ad hoc ping run against the new host of a VM, e.g. "successful"
+const AnnotationPingStatus = "awx-inventory.io/ping-status"
+
+// needsPing reports whether the host of a VM is to be pinged once created
+func (c *Controller) needsPing(vm *kubernetes.VirtualMachine) bool {
+	return c.pingHosts && vm.Annotations[AnnotationPingStatus] == ""
+}
+
+// pingCredentialName returns the Machine credential to ping the host of a VM with
+func (c *Controller) pingCredentialName(vm *kubernetes.VirtualMachine) string {
+	if c.sshCredentials && vm.UserDataSecret != "" {
+		return c.credentialName(vm.Namespace, vm.UserDataSecret)
+	}
+	return c.pingCredential
+}
+
+// ping runs the ping module against the host of a VM marked new by
+// checkProvisioning. The command is polled with the provisioning jobs.
+func (c *Controller) ping(ctx context.Context, invID int, vm *kubernetes.VirtualMachine, hostName string) error {
+	if !c.needsPing(vm) || c.tracked(jobKindPing, vm) {
+		return nil
+	}
+	if state, pending := c.provisioning.Get(provisionKey(vm)); !pending || state == noProvisioning {
+		return nil
+	}
+
+	credentialName := c.pingCredentialName(vm)
+	if credentialName == "" {
+		log.Printf("WARN: no credential to ping host '%s' with, set PING_CREDENTIAL", hostName)
+		return nil
+	}
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+	credentialID, err := c.awxClient.GetCredentialID(ctx, credentialName, orgID)
+	if err != nil {
+		return err
+	}
+	if credentialID == 0 {
+		return fmt.Errorf("credential '%s' to ping host '%s' not found", credentialName, hostName)
+	}
+
+	commandID, err := c.awxClient.LaunchAdHocCommand(ctx, invID, credentialID, hostName, "ping", "")
+	if err != nil {
+		return fmt.Errorf("failed to ping host '%s': %w", hostName, err)
+	}
+	log.Printf("Launched ad hoc ping %d for host '%s'", commandID, hostName)
+
+	c.trackJob(&trackedJob{
+		kind:     jobKindPing,
+		vm:       vm,
+		invID:    invID,
+		hostName: hostName,
+		jobID:    commandID,
+		attempt:  1,
+	})
+	return nil
+}
+
+// pollPing records the outcome of a finished ping. Annotating the VM syncs
+// its host again with vm_reachable.
+func (c *Controller) pollPing(ctx context.Context, key string, job *trackedJob) {
+	command, err := c.awxClient.GetAdHocCommand(ctx, job.jobID)
+	if err != nil {
+		log.Printf("WARN: failed to get ad hoc ping %d of host '%s': %v", job.jobID, job.hostName, err)
+		return
+	}
+	if !command.IsFinished() {
+		return
+	}
+	metrics.HostPingsTotal.WithLabelValues(command.Status).Inc()
+	c.removeTrackedJob(key, job)
+
+	if command.Status == jobStatusSuccessful {
+		log.Printf("Host '%s' answered ad hoc ping %d", job.hostName, job.jobID)
+	} else {
+		log.Printf("WARN: ad hoc ping %d of host '%s' finished with status '%s'", job.jobID, job.hostName, command.Status)
+		c.recordEvent(job.vm, corev1.EventTypeWarning, EventPingFailed, "Ad hoc ping %d of host '%s' finished with status '%s'", job.jobID, job.hostName, command.Status)
+	}
+
+	err = c.patchVM(func(patcher vmPatcher) error {
+		return patcher.AnnotateVM(job.vm.Namespace, job.vm.Name, map[string]string{AnnotationPingStatus: command.Status})
+	})
+	if err != nil {
+		log.Printf("WARN: failed to annotate VM '%s' in namespace '%s' with ping status: %v", job.vm.Name, job.vm.Namespace, err)
+	}
+}
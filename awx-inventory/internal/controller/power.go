@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// disabledState marks hosts disabled in AWX in the host state cache, so the
+// next sync of the VM writes the host again and re-enables it
+var disabledState [sha256.Size]byte
+
+// stopped reports whether a VM is outside the synced phases. Objects that
+// have no phase, like Services, are always synced.
+func (c *Controller) stopped(vm *kubernetes.VirtualMachine) bool {
+	return len(c.syncPhases) > 0 && vm.Phase != "" && !slices.Contains(c.syncPhases, vm.Phase)
+}
+
+// available reports whether a VM is running and has an address
+func (c *Controller) available(vm *kubernetes.VirtualMachine) bool {
+	return !c.stopped(vm) && ansibleHost(vm) != ""
+}
+
+// handleVMStopped removes the host of a VM outside the synced phases, or
+// disables it in AWX if stopped hosts are kept
+func (c *Controller) handleVMStopped(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	if !c.disableStopped || !c.awxEnabled {
+		log.Printf("VM '%s' in namespace '%s' is %s, removing its host", vm.Name, vm.Namespace, vm.Phase)
+		return c.handleVMRemoved(ctx, vm)
+	}
+	return c.disableHost(ctx, vm)
+}
+
+// disableHost disables the AWX host of an unavailable VM. Hosts are never
+// created for such VMs.
+func (c *Controller) disableHost(ctx context.Context, vm *kubernetes.VirtualMachine) error {
+	if !c.awxEnabled {
+		return nil
+	}
+
+	hostName, exists := c.hostNames.Get(vm.Namespace + "/" + vm.Name)
+	if !exists {
+		hostName = c.hostName(vm)
+	}
+	stateKey := vm.Namespace + "/" + hostName
+	if state, exists := c.hostStates.Get(stateKey); exists && state == disabledState {
+		return nil
+	}
+
+	invID, err := c.lookupInventoryForNamespace(ctx, vm.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory for namespace '%s': %w", vm.Namespace, err)
+	}
+	if invID != 0 {
+		if err := c.awxClient.UpdateHostEnabled(ctx, invID, hostName, false); err != nil {
+			return fmt.Errorf("failed to disable host '%s': %w", hostName, err)
+		}
+		log.Printf("VM '%s' in namespace '%s' is unavailable, disabled host '%s'", vm.Name, vm.Namespace, hostName)
+	}
+	c.hostStates.Add(stateKey, disabledState)
+	return nil
+}
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+const (
+	// AnnotationProvisionJob names the job template launched when the host
+	// of a VM is created, overriding ProvisionJobTemplate. "none" disables it.
+	AnnotationProvisionJob = "awx-inventory.io/provision-job"
+	// AnnotationProvisionJobID is set by the controller to the ID of the
+	// provisioning job of a VM, which is then not launched again
+	AnnotationProvisionJobID = "awx-inventory.io/provision-job-id"
+	// AnnotationProvisionJobStatus is set by the controller to "running"
+	// while the provisioning job is tracked, then to its final status
+	AnnotationProvisionJobStatus = "awx-inventory.io/provision-job-status"
+	// AnnotationDeprovisionJob names the job template launched before the
+	// host of a deleted VM is removed, overriding DeprovisionJobTemplate.
+	// "none" disables it.
+	AnnotationDeprovisionJob = "awx-inventory.io/deprovision-job"
+)
+
+// noProvisioning is cached for VMs whose host existed before they were seen
+const noProvisioning = -1
+
+// provisionTemplate returns the provisioning job template of a VM, empty if none
+func (c *Controller) provisionTemplate(vm *kubernetes.VirtualMachine) string {
+	name := c.provisionJobTemplate
+	if value, ok := vm.Annotations[AnnotationProvisionJob]; ok {
+		name = strings.TrimSpace(value)
+	}
+	if name == "none" {
+		return ""
+	}
+	return name
+}
+
+// deprovisionTemplate returns the deprovisioning job template of a VM, empty if none
+func (c *Controller) deprovisionTemplate(vm *kubernetes.VirtualMachine) string {
+	name := c.deprovisionJobTemplate
+	if value, ok := vm.Annotations[AnnotationDeprovisionJob]; ok {
+		name = strings.TrimSpace(value)
+	}
+	if name == "none" {
+		return ""
+	}
+	return name
+}
+
+// provisionKey identifies a VM across renames of its host
+func provisionKey(vm *kubernetes.VirtualMachine) string {
+	if vm.UID != "" {
+		return vm.UID
+	}
+	return vm.Namespace + "/" + vm.Name
+}
+
+// checkProvisioning marks a VM for provisioning or a ping if its host is
+// about to be created, i.e. it is not in the inventory yet
+func (c *Controller) checkProvisioning(ctx context.Context, invID int, vm *kubernetes.VirtualMachine, hostName string) error {
+	needsJob := c.provisionTemplate(vm) != "" && vm.Annotations[AnnotationProvisionJobID] == ""
+	if !needsJob && !c.needsPing(vm) {
+		return nil
+	}
+	if _, pending := c.provisioning.Get(provisionKey(vm)); pending {
+		return nil
+	}
+
+	host, err := c.lookupHost(ctx, invID, vm.Namespace, hostName)
+	if err != nil {
+		return fmt.Errorf("failed to check host '%s': %w", hostName, err)
+	}
+	jobID := noProvisioning
+	if host == nil {
+		jobID = 0
+	}
+	c.provisioning.Add(provisionKey(vm), jobID)
+	return nil
+}
+
+// provision launches the provisioning job of a VM marked by
+// checkProvisioning, limited to its host, and tracks it until it finished.
+// It is launched once, a failed launch is retried with the event.
+func (c *Controller) provision(ctx context.Context, invID int, vm *kubernetes.VirtualMachine, hostName string) error {
+	key := provisionKey(vm)
+	c.resumeJobTracking(vm, invID, hostName)
+	if jobID, pending := c.provisioning.Get(key); !pending || jobID != 0 || vm.Annotations[AnnotationProvisionJobID] != "" {
+		return nil
+	}
+	template := c.provisionTemplate(vm)
+	if template == "" {
+		c.provisioning.Remove(key)
+		return nil
+	}
+
+	jobID, err := c.launchJob(ctx, template, invID, vm, hostName)
+	if err != nil {
+		return fmt.Errorf("failed to launch provisioning job template '%s': %w", template, err)
+	}
+	log.Printf("Launched provisioning job %d from template '%s' for host '%s'", jobID, template, hostName)
+	c.provisioning.Add(key, jobID)
+
+	c.trackJob(&trackedJob{
+		kind:     jobKindProvision,
+		vm:       vm,
+		template: template,
+		invID:    invID,
+		hostName: hostName,
+		jobID:    jobID,
+		attempt:  1,
+	})
+	c.annotateProvisionJob(vm, jobID, jobStatusRunning)
+	return nil
+}
+
+// annotateProvisionJob records the current provisioning job of a VM
+func (c *Controller) annotateProvisionJob(vm *kubernetes.VirtualMachine, jobID int, status string) {
+	err := c.patchVM(func(patcher vmPatcher) error {
+		return patcher.AnnotateVM(vm.Namespace, vm.Name, map[string]string{
+			AnnotationProvisionJobID:     strconv.Itoa(jobID),
+			AnnotationProvisionJobStatus: status,
+		})
+	})
+	if err != nil {
+		log.Printf("WARN: failed to annotate VM '%s' in namespace '%s' with provisioning job %d: %v", vm.Name, vm.Namespace, jobID, err)
+	}
+}
+
+// deprovision launches the deprovisioning job of a deleted VM against its
+// host and tracks it in the background, so the host is removed once the job
+// finished. It reports whether the job is still running, in which case the
+// host and the finalizer are kept. Only a failed launch is retried with the
+// event, the host is removed whatever the job's outcome.
+func (c *Controller) deprovision(ctx context.Context, vm *kubernetes.VirtualMachine, hostName string) (bool, error) {
+	template := c.deprovisionTemplate(vm)
+	if template == "" || !c.awxEnabled {
+		return false, nil
+	}
+
+	key := provisionKey(vm)
+	if _, launched := c.deprovisioning.Get(key); launched {
+		if c.tracked(jobKindDeprovision, vm) {
+			return true, nil
+		}
+		// The job finished, the host can go
+		c.deprovisioning.Remove(key)
+		return false, nil
+	}
+
+	invID, err := c.lookupInventoryForNamespace(ctx, vm.Namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to get inventory for namespace '%s': %w", vm.Namespace, err)
+	}
+	if invID == 0 {
+		return false, nil
+	}
+
+	// Already removed, there is nothing to run the job against
+	host, err := c.lookupHost(ctx, invID, vm.Namespace, hostName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check host '%s': %w", hostName, err)
+	}
+	if host == nil {
+		return false, nil
+	}
+
+	jobID, err := c.launchJob(ctx, template, invID, vm, hostName)
+	if err != nil {
+		return false, fmt.Errorf("failed to launch deprovisioning job template '%s': %w", template, err)
+	}
+	log.Printf("Launched deprovisioning job %d from template '%s' for host '%s'", jobID, template, hostName)
+	c.deprovisioning.Add(key, jobID)
+	c.trackJob(&trackedJob{
+		kind:     jobKindDeprovision,
+		vm:       vm,
+		template: template,
+		invID:    invID,
+		hostName: hostName,
+		jobID:    jobID,
+		attempt:  1,
+		deadline: time.Now().Add(c.deprovisionTimeout),
+	})
+	return true, nil
+}
+
+// pollDeprovision finishes a deprovisioning job once it succeeded, failed
+// jobRetries times or deprovisionTimeout passed since the first launch
+func (c *Controller) pollDeprovision(ctx context.Context, key string, job *trackedJob) {
+	if time.Now().After(job.deadline) {
+		log.Printf("WARN: deprovisioning job %d of host '%s' did not finish within %v, removing the host anyway", job.jobID, job.hostName, c.deprovisionTimeout)
+		c.recordEvent(job.vm, corev1.EventTypeWarning, EventDeprovisionFailed, "Deprovisioning job %d did not finish within %v", job.jobID, c.deprovisionTimeout)
+		c.finishDeprovision(key, job)
+		return
+	}
+	if !job.retryAt.IsZero() {
+		if time.Now().Before(job.retryAt) {
+			return
+		}
+		c.relaunchJob(ctx, job)
+		return
+	}
+
+	awxJob, err := c.awxClient.GetJob(ctx, job.jobID)
+	if err != nil {
+		log.Printf("WARN: failed to get deprovisioning job %d of host '%s': %v", job.jobID, job.hostName, err)
+		return
+	}
+	if !awxJob.IsFinished() {
+		return
+	}
+	metrics.JobsTotal.WithLabelValues(jobKindDeprovision, awxJob.Status).Inc()
+
+	if awxJob.Status == jobStatusSuccessful {
+		log.Printf("Deprovisioning job %d of host '%s' succeeded", job.jobID, job.hostName)
+		c.recordEvent(job.vm, corev1.EventTypeNormal, EventDeprovisionSucceeded, "Deprovisioning job %d succeeded", job.jobID)
+		c.finishDeprovision(key, job)
+		return
+	}
+	if job.attempt > c.jobRetries {
+		log.Printf("WARN: deprovisioning job %d of host '%s' finished with status '%s', removing the host anyway", job.jobID, job.hostName, awxJob.Status)
+		c.recordEvent(job.vm, corev1.EventTypeWarning, EventDeprovisionFailed, "Deprovisioning job %d finished with status '%s'", job.jobID, awxJob.Status)
+		c.finishDeprovision(key, job)
+		return
+	}
+
+	backoff := c.jobBackoff(job.attempt)
+	if time.Now().Add(backoff).After(job.deadline) {
+		log.Printf("WARN: no time left to retry deprovisioning host '%s' within %v, removing the host anyway", job.hostName, c.deprovisionTimeout)
+		c.recordEvent(job.vm, corev1.EventTypeWarning, EventDeprovisionFailed, "Deprovisioning job %d finished with status '%s'", job.jobID, awxJob.Status)
+		c.finishDeprovision(key, job)
+		return
+	}
+	log.Printf("WARN: deprovisioning job %d of host '%s' finished with status '%s', retrying in %v", job.jobID, job.hostName, awxJob.Status, backoff)
+	c.recordEvent(job.vm, corev1.EventTypeWarning, EventDeprovisionFailed, "Deprovisioning job %d finished with status '%s', retrying in %v", job.jobID, awxJob.Status, backoff)
+	c.jobTracker.mu.Lock()
+	job.retryAt = time.Now().Add(backoff)
+	c.jobTracker.mu.Unlock()
+}
+
+// finishDeprovision stops tracking a deprovisioning job and queues the
+// deleted VM again, so the worker of its namespace removes the host and
+// releases the VM
+func (c *Controller) finishDeprovision(key string, job *trackedJob) {
+	c.removeTrackedJob(key, job)
+
+	vm := job.vm
+	eventType := watch.Deleted
+	if hasFinalizer(vm) {
+		// Still kept by the finalizer, releasing it removes the finalizer
+		eventType = watch.Modified
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetNamespace(vm.Object.Namespace)
+	obj.SetName(vm.Object.Name)
+	obj.SetUID(types.UID(vm.UID))
+	c.enqueue(vmEvent{
+		event:     watch.Event{Type: eventType, Object: obj},
+		obj:       obj,
+		source:    deletedVM{vm},
+		namespace: vm.Namespace,
+		name:      vm.Name,
+	})
+}
+
+// deletedVM is the source of events queued for a deleted VM, which is not
+// read from Kubernetes again
+type deletedVM struct {
+	vm *kubernetes.VirtualMachine
+}
+
+func (d deletedVM) ToHost(*unstructured.Unstructured) *kubernetes.VirtualMachine {
+	return d.vm
+}
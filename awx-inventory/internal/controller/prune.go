@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// runPrune periodically removes empty managed groups and the inventories of
+// deleted namespaces
+func (c *Controller) runPrune(ctx context.Context) {
+	log.Printf("Starting pruning of empty groups and inventories every %v", c.pruneInterval)
+
+	ticker := time.NewTicker(c.pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.prune(ctx); err != nil {
+			log.Printf("ERROR: failed to prune inventories: %v", err)
+		}
+	}
+}
+
+// prune makes a single pruning pass over the managed inventories
+func (c *Controller) prune(ctx context.Context) error {
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	var inventories []awx.Inventory
+	err = c.awxClient.ForEachInventory(ctx, orgID, func(inv awx.Inventory) error {
+		if c.managed(inv.Description) && inv.Kind == "" {
+			inventories = append(inventories, inv)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list inventories: %w", err)
+	}
+
+	prunedGroups, prunedInventories := 0, 0
+	for _, inv := range inventories {
+		namespace := descriptionField(inv.Description, "ns")
+		if namespace != "" && c.k8sClient != nil {
+			exists, err := c.k8sClient.NamespaceExists(namespace)
+			if err != nil {
+				return fmt.Errorf("failed to get namespace '%s': %w", namespace, err)
+			}
+			if !exists {
+				pruned, err := c.pruneInventory(ctx, inv, namespace)
+				if err != nil {
+					return err
+				}
+				if pruned {
+					prunedInventories++
+				}
+				continue
+			}
+		}
+
+		pruned, err := c.pruneGroups(ctx, inv)
+		if err != nil {
+			return err
+		}
+		prunedGroups += pruned
+	}
+
+	if prunedGroups > 0 || prunedInventories > 0 {
+		log.Printf("Pruned %d empty groups and %d inventories", prunedGroups, prunedInventories)
+	}
+	return nil
+}
+
+// pruneInventory deletes the inventory of a deleted namespace unless it holds
+// hosts that were added by hand
+func (c *Controller) pruneInventory(ctx context.Context, inv awx.Inventory, namespace string) (bool, error) {
+	hosts, err := c.awxClient.ListHosts(ctx, inv.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list hosts of inventory '%s': %w", inv.Name, err)
+	}
+	for _, h := range hosts {
+		if !c.managed(h.Description) {
+			log.Printf("WARN: not deleting inventory '%s' of deleted namespace '%s', host '%s' was not created by awx-inventory", inv.Name, namespace, h.Name)
+			return false, nil
+		}
+	}
+
+	log.Printf("Deleting inventory '%s', namespace '%s' no longer exists", inv.Name, namespace)
+	if err := c.awxClient.DeleteInventory(ctx, inv.ID); err != nil {
+		return false, fmt.Errorf("failed to delete inventory '%s': %w", inv.Name, err)
+	}
+	for _, h := range hosts {
+		c.forgetHostState(namespace, h.Name)
+	}
+	c.inventoryCache.Remove(namespace)
+	metrics.Inventories.Set(float64(c.inventoryCache.Len()))
+	return true, nil
+}
+
+// pruneGroups deletes the managed groups of an inventory that have no hosts,
+// and no children for parent groups
+func (c *Controller) pruneGroups(ctx context.Context, inv awx.Inventory) (int, error) {
+	groups, err := c.awxClient.ListGroups(ctx, inv.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list groups of inventory '%s': %w", inv.Name, err)
+	}
+
+	pruned := 0
+	for _, group := range groups {
+		if !c.managed(group.Description) {
+			continue
+		}
+		hosts, err := c.awxClient.ListGroupHosts(ctx, group.ID)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to list hosts of group '%s': %w", group.Name, err)
+		}
+		if len(hosts) > 0 {
+			continue
+		}
+		if _, parent := c.groupParents[group.Name]; parent {
+			children, err := c.awxClient.ListGroupChildren(ctx, group.ID)
+			if err != nil {
+				return pruned, fmt.Errorf("failed to list children of group '%s': %w", group.Name, err)
+			}
+			if len(children) > 0 {
+				continue
+			}
+		}
+
+		log.Printf("Deleting empty group '%s' from inventory '%s'", group.Name, inv.Name)
+		if err := c.awxClient.DeleteGroup(ctx, group.ID); err != nil {
+			return pruned, fmt.Errorf("failed to delete group '%s': %w", group.Name, err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// vmEvent is a VirtualMachine event waiting to be applied
+type vmEvent struct {
+	event     watch.Event
+	obj       *unstructured.Unstructured
+	source    hostSource
+	namespace string
+	name      string
+}
+
+func (e vmEvent) key() string {
+	return e.namespace + "/" + e.name
+}
+
+// newVMEvent returns the event for obj of source, or false if it has no namespace or name
+func newVMEvent(source hostSource, event watch.Event, obj *unstructured.Unstructured) (vmEvent, bool) {
+	// Resources synced into a fixed namespace are renamed by ToHost
+	vm := source.ToHost(obj)
+	if vm.Namespace == "" || vm.Name == "" {
+		return vmEvent{}, false
+	}
+
+	return vmEvent{event: event, obj: obj, source: source, namespace: vm.Namespace, name: vm.Name}, true
+}
+
+// eventQueue is a rate-limited workqueue of VM keys, sharded by namespace.
+// Each shard is drained by one worker, so events of a namespace are applied
+// one at a time while different namespaces proceed in parallel. Only the
+// latest event per VM is kept, and MODIFIED events of a VM synced less than
+// window ago wait for the rest of the window, so bursts of status updates
+// are coalesced into one sync.
+type eventQueue struct {
+	shards []workqueue.RateLimitingInterface
+	window time.Duration
+	// checkpoint saves failed events across restarts, nil if disabled
+	checkpoint *checkpoint
+
+	mu     sync.Mutex
+	latest map[string]vmEvent
+	// When each VM was last synced, if window is set
+	synced map[string]time.Time
+}
+
+func newEventQueue(shards int, window time.Duration) *eventQueue {
+	q := &eventQueue{
+		window: window,
+		latest: make(map[string]vmEvent),
+		synced: make(map[string]time.Time),
+	}
+	for i := 0; i < shards; i++ {
+		q.shards = append(q.shards, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()))
+	}
+	return q
+}
+
+// shard returns the queue of the namespace of key
+func (q *eventQueue) shard(key string) workqueue.RateLimitingInterface {
+	namespace, _, _ := strings.Cut(key, "/")
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return q.shards[h.Sum32()%uint32(len(q.shards))]
+}
+
+// updateDepth publishes the number of queued keys
+func (q *eventQueue) updateDepth() {
+	depth := 0
+	for _, shard := range q.shards {
+		depth += shard.Len()
+	}
+	metrics.QueueDepth.Set(float64(depth))
+}
+
+// add queues an event, replacing any pending event for the same VM
+func (q *eventQueue) add(e vmEvent) {
+	q.mu.Lock()
+	if _, pending := q.latest[e.key()]; pending {
+		metrics.CoalescedEventsTotal.Inc()
+	}
+	q.latest[e.key()] = e
+	delay := q.coalesceDelay(e)
+	q.mu.Unlock()
+	q.checkpoint.update(e)
+
+	if delay > 0 {
+		q.shard(e.key()).AddAfter(e.key(), delay)
+		return
+	}
+	q.shard(e.key()).Add(e.key())
+	q.updateDepth()
+}
+
+// coalesceDelay returns how long a MODIFIED event waits until the window
+// since the last sync of its VM has passed. Other events are applied right
+// away.
+func (q *eventQueue) coalesceDelay(e vmEvent) time.Duration {
+	if q.window <= 0 || e.event.Type != watch.Modified {
+		return 0
+	}
+	last, exists := q.synced[e.key()]
+	if !exists {
+		return 0
+	}
+	return q.window - time.Since(last)
+}
+
+// get blocks until a key of the given shard is ready. The event is nil if it
+// was already applied by an earlier pass of the same key; ok is false once the
+// queue is shut down.
+func (q *eventQueue) get(shard int) (key string, e *vmEvent, ok bool) {
+	item, shutdown := q.shards[shard].Get()
+	if shutdown {
+		return "", nil, false
+	}
+	key = item.(string)
+	q.updateDepth()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pending, exists := q.latest[key]; exists {
+		delete(q.latest, key)
+		e = &pending
+	}
+	return key, e, true
+}
+
+// done finishes processing of key. A failed event is retried with backoff
+// unless a newer event for the same VM arrived meanwhile.
+func (q *eventQueue) done(key string, e *vmEvent, err error) {
+	shard := q.shard(key)
+	defer shard.Done(key)
+
+	if q.window > 0 && e != nil {
+		q.mu.Lock()
+		if e.event.Type == watch.Deleted && err == nil {
+			delete(q.synced, key)
+		} else {
+			q.synced[key] = time.Now()
+		}
+		q.mu.Unlock()
+	}
+
+	if err == nil || e == nil {
+		shard.Forget(key)
+		if e != nil {
+			q.checkpoint.forget(*e)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	if _, newer := q.latest[key]; !newer {
+		q.latest[key] = *e
+		q.checkpoint.track(*e)
+	}
+	q.mu.Unlock()
+	shard.AddRateLimited(key)
+}
+
+func (q *eventQueue) shutDown() {
+	for _, shard := range q.shards {
+		shard.ShutDown()
+	}
+}
+
+// drain stops accepting events and returns once the workers applied the
+// queued ones. Retries and events still waiting for their coalescing window
+// are not queued again, they remain pending.
+func (q *eventQueue) drain() {
+	var wg sync.WaitGroup
+	for _, shard := range q.shards {
+		wg.Add(1)
+		go func(shard workqueue.RateLimitingInterface) {
+			defer wg.Done()
+			shard.ShutDownWithDrain()
+		}(shard)
+	}
+	wg.Wait()
+}
+
+// pending returns the events not applied yet
+func (q *eventQueue) pending() []vmEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := make([]vmEvent, 0, len(q.latest))
+	for _, e := range q.latest {
+		events = append(events, e)
+	}
+	return events
+}
+
+// runWorker applies the events of its queue shard until the queue is shut down
+func (c *Controller) runWorker(ctx context.Context, id int) {
+	worker := c.workers.Worker(id)
+
+	for {
+		key, e, ok := c.queue.get(id)
+		if !ok {
+			return
+		}
+		if e == nil {
+			c.queue.done(key, nil, nil)
+			continue
+		}
+		// Events left when draining was cancelled on shutdown stay pending
+		if ctx.Err() != nil {
+			c.queue.done(key, e, ctx.Err())
+			continue
+		}
+
+		if c.inBlackout() {
+			c.blackout.add(*e)
+			c.queue.done(key, nil, nil)
+			continue
+		}
+
+		err := c.syncEvent(ctx, worker, *e)
+		if err != nil && !retryable(err) {
+			log.Printf("ERROR: failed to sync VM '%s' in namespace '%s', not retrying: %v", e.name, e.namespace, err)
+			err = nil
+		}
+		if err != nil && ctx.Err() == nil {
+			if errors.Is(err, errNotReachable) {
+				log.Printf("VM '%s' in namespace '%s' is not added yet, retrying: %v", e.name, e.namespace, err)
+			} else {
+				log.Printf("ERROR: failed to sync VM '%s' in namespace '%s', retrying: %v", e.name, e.namespace, err)
+			}
+			worker.Retry()
+		}
+		c.queue.done(key, e, err)
+	}
+}
+
+// retryable reports whether applying an event again may succeed. AWX
+// rejecting the payload or denying access does not change on retry, and
+// neither does a panic on the same object.
+func retryable(err error) bool {
+	if errors.Is(err, errPanic) {
+		return false
+	}
+	switch awx.StatusCode(err) {
+	case http.StatusBadRequest, http.StatusForbidden:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// errNotReachable is returned while the host of a new VM does not accept
+// connections yet, so its event is retried with backoff
+var errNotReachable = errors.New("host is not reachable yet")
+
+// readinessProbeConcurrency bounds the probes of startup bulk creation
+const readinessProbeConcurrency = 32
+
+// readinessProbe checks that the host of a VM accepts TCP connections before
+// it is added, so half-booted VMs don't fail playbooks
+type readinessProbe struct {
+	// Port probed unless the host sets ansible_port, e.g. for WinRM
+	port     int
+	timeout  time.Duration
+	retries  int
+	interval time.Duration
+	dialer   net.Dialer
+}
+
+// newReadinessProbe returns the probe, nil if port is 0
+func newReadinessProbe(port int, timeout time.Duration, retries int) *readinessProbe {
+	if port == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	if retries <= 0 {
+		retries = 1
+	}
+	return &readinessProbe{port: port, timeout: timeout, retries: retries, interval: timeout}
+}
+
+// check probes the host, trying up to retries times. It returns an
+// errNotReachable error if the host never accepted a connection.
+func (p *readinessProbe) check(ctx context.Context, hostVars map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+
+	host, _ := hostVars["ansible_host"].(string)
+	address := net.JoinHostPort(host, strconv.Itoa(p.hostPort(hostVars)))
+
+	var err error
+	for attempt := 0; attempt < p.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.interval):
+			}
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		var conn net.Conn
+		conn, err = p.dialer.DialContext(dialCtx, "tcp", address)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s: %v", errNotReachable, address, err)
+}
+
+// hostPort returns ansible_port if the host sets it, the probe port otherwise
+func (p *readinessProbe) hostPort(hostVars map[string]interface{}) int {
+	switch port := hostVars["ansible_port"].(type) {
+	case int:
+		return port
+	case string:
+		if n, err := strconv.Atoi(port); err == nil {
+			return n
+		}
+	}
+	return p.port
+}
+
+// reachable returns the VMs whose hosts accept connections, probing them concurrently
+func (c *Controller) reachable(ctx context.Context, vms []*kubernetes.VirtualMachine) []*kubernetes.VirtualMachine {
+	if c.readiness == nil {
+		return vms
+	}
+
+	ok := make([]bool, len(vms))
+	sem := make(chan struct{}, readinessProbeConcurrency)
+	var wg sync.WaitGroup
+	for i, vm := range vms {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, vm *kubernetes.VirtualMachine) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ok[i] = c.readiness.check(ctx, c.hostVars(vm)) == nil
+		}(i, vm)
+	}
+	wg.Wait()
+
+	var result []*kubernetes.VirtualMachine
+	for i, vm := range vms {
+		if ok[i] {
+			result = append(result, vm)
+		} else {
+			log.Printf("Host of VM '%s' in namespace '%s' is not reachable yet, it is added once it is", vm.Name, vm.Namespace)
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// errPanic marks events whose handling panicked. They are not retried, as
+// the same object would most likely panic again.
+var errPanic = errors.New("panic while handling event")
+
+// handleWatchEvent returns the watch callback of source. A failing or
+// panicking event is logged and skipped, so the watch goes on with the next
+// one.
+func (c *Controller) handleWatchEvent(source hostSource) func(watch.Event, *unstructured.Unstructured) error {
+	return func(event watch.Event, obj *unstructured.Unstructured) error {
+		defer func() {
+			if r := recover(); r != nil {
+				recovered("watch", event.Type, obj, r)
+			}
+		}()
+
+		if err := c.enqueueEvent(source, event, obj); err != nil {
+			log.Printf("ERROR: failed to queue %s event of '%s/%s': %v", event.Type, obj.GetNamespace(), obj.GetName(), err)
+		}
+		return nil
+	}
+}
+
+// applyEvent dispatches an event to its handler, turning a panic into an
+// errPanic error
+func (c *Controller) applyEvent(ctx context.Context, e vmEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered("sync", e.event.Type, e.obj, r)
+		}
+	}()
+	return c.processWatchEvent(ctx, e.source, e.event, e.obj, e.namespace, e.name)
+}
+
+// recovered logs a recovered panic with the object being handled and its
+// stack, and returns it as an errPanic error
+func recovered(stage string, eventType watch.EventType, obj *unstructured.Unstructured, r interface{}) error {
+	metrics.EventPanicsTotal.WithLabelValues(stage).Inc()
+	if obj == nil {
+		obj = &unstructured.Unstructured{}
+	}
+	log.Printf("ERROR: recovered panic handling %s event of %s '%s/%s' (resourceVersion %s): %v\n%s",
+		eventType, obj.GetKind(), obj.GetNamespace(), obj.GetName(), obj.GetResourceVersion(), r, debug.Stack())
+	return fmt.Errorf("%w: %v", errPanic, r)
+}
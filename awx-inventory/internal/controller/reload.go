@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"log"
+	"slices"
+)
+
+// Settings are the parts of Config that can change while the controller runs
+type Settings struct {
+	VMLabelSelector string
+	GroupByClass    bool
+	GroupByNode     bool
+	GroupByZone     bool
+	GroupLabels     []string
+}
+
+// watchRestarter is implemented by sources that can relist all VMs
+type watchRestarter interface {
+	RestartWatch()
+}
+
+// Reload applies new settings. VMs are relisted so that hosts leave groups and
+// inventories they no longer belong to; unchanged hosts are not written again.
+func (c *Controller) Reload(settings Settings) {
+	previous := c.settings.Swap(&settings)
+	if previous.VMLabelSelector == settings.VMLabelSelector &&
+		previous.GroupByClass == settings.GroupByClass &&
+		previous.GroupByNode == settings.GroupByNode &&
+		previous.GroupByZone == settings.GroupByZone &&
+		slices.Equal(previous.GroupLabels, settings.GroupLabels) {
+		log.Printf("Configuration reloaded, no changes")
+		return
+	}
+	log.Printf("Configuration reloaded, relisting VMs")
+	c.previousSettings.Store(previous)
+
+	// Kubernetes sources restart their watch when the selector changes
+	for _, source := range c.vmSources {
+		source.SetLabelSelector(settings.VMLabelSelector)
+		if previous.VMLabelSelector == settings.VMLabelSelector {
+			source.RestartWatch()
+		}
+	}
+	if restarter, ok := c.source.(watchRestarter); ok {
+		restarter.RestartWatch()
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/cache"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// shadow mirrors host writes to a second AWX instance and reports divergences
+type shadow struct {
+	client       AWXClient
+	organization string
+	// Cache of shadow inventory IDs by inventory name
+	mu          sync.Mutex
+	inventories *cache.LRU[string, int]
+	// detected is set once the platform of the shadow AWX was detected
+	detected bool
+}
+
+// platformDetector is implemented by clients of a real AWX, whose API paths
+// depend on the platform
+type platformDetector interface {
+	DetectPlatform(ctx context.Context) (awx.Platform, error)
+}
+
+// newShadow creates a new shadow target
+func newShadow(client AWXClient, organization string, cacheSize int) *shadow {
+	return &shadow{
+		client:       client,
+		organization: organization,
+		inventories:  cache.NewLRU[string, int]("shadow_inventory", cacheSize),
+	}
+}
+
+// inventoryID gets or creates the shadow inventory with the given name
+func (s *shadow) inventoryID(ctx context.Context, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invID, exists := s.inventories.Get(name); exists {
+		return invID, nil
+	}
+	if detector, ok := s.client.(platformDetector); ok && !s.detected {
+		if _, err := detector.DetectPlatform(ctx); err != nil {
+			log.Printf("WARN: failed to detect the platform of the shadow AWX, assuming classic AWX: %v", err)
+		} else {
+			s.detected = true
+		}
+	}
+
+	orgID, err := s.client.GetOrganizationID(ctx, s.organization)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get shadow organization ID: %w", err)
+	}
+
+	invID, err := s.client.GetInventoryID(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get shadow inventory ID: %w", err)
+	}
+
+	if invID == 0 {
+		invID, err = s.client.CreateInventory(ctx, name, managedByMarker, orgID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create shadow inventory: %w", err)
+		}
+	}
+
+	s.inventories.Add(name, invID)
+	return invID, nil
+}
+
+// upsertHost creates or updates the host in the shadow AWX in the background
+func (s *shadow) upsertHost(ctx context.Context, inventoryName, hostName string, hostVars map[string]interface{}, description string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		invID, err := s.inventoryID(ctx, inventoryName)
+		if err == nil {
+			_, err = s.client.CreateOrUpdateHost(ctx, invID, hostName, hostVars, true, description)
+		}
+		result <- err
+	}()
+	return result
+}
+
+// deleteHost deletes the host from the shadow AWX in the background
+func (s *shadow) deleteHost(ctx context.Context, inventoryName, hostName string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		invID, err := s.inventoryID(ctx, inventoryName)
+		if err == nil {
+			err = s.client.DeleteHost(ctx, invID, hostName)
+		}
+		result <- err
+	}()
+	return result
+}
+
+// compareHost compares the outcome and resulting host state of a mirrored write
+func (s *shadow) compareHost(ctx context.Context, primary AWXClient, primaryInvID int, inventoryName, hostName string, primaryErr, shadowErr error) {
+	if (primaryErr == nil) != (shadowErr == nil) {
+		s.diverged("error", inventoryName, hostName, fmt.Sprintf("primary error: %v, shadow error: %v", primaryErr, shadowErr))
+		return
+	}
+	if primaryErr != nil {
+		// Both failed, nothing to compare
+		return
+	}
+
+	shadowInvID, err := s.inventoryID(ctx, inventoryName)
+	if err != nil {
+		log.Printf("WARN: shadow: failed to get inventory '%s': %v", inventoryName, err)
+		return
+	}
+
+	primaryHost, err := primary.GetHost(ctx, primaryInvID, hostName)
+	if err != nil {
+		log.Printf("WARN: shadow: failed to read primary host '%s': %v", hostName, err)
+		return
+	}
+	shadowHost, err := s.client.GetHost(ctx, shadowInvID, hostName)
+	if err != nil {
+		log.Printf("WARN: shadow: failed to read shadow host '%s': %v", hostName, err)
+		return
+	}
+
+	if (primaryHost == nil) != (shadowHost == nil) {
+		s.diverged("presence", inventoryName, hostName, fmt.Sprintf("exists in primary: %t, exists in shadow: %t", primaryHost != nil, shadowHost != nil))
+		return
+	}
+	if primaryHost == nil {
+		return
+	}
+
+	if !sameVariables(primaryHost.Variables, shadowHost.Variables) {
+		s.diverged("variables", inventoryName, hostName, fmt.Sprintf("primary: %s, shadow: %s", primaryHost.Variables, shadowHost.Variables))
+	}
+}
+
+// diverged records a divergence between primary and shadow
+func (s *shadow) diverged(reason, inventoryName, hostName, details string) {
+	metrics.ShadowDivergencesTotal.WithLabelValues(reason).Inc()
+	log.Printf("WARN: shadow divergence (%s) for host '%s' in inventory '%s': %s", reason, hostName, inventoryName, details)
+}
+
+// sameVariables compares two JSON variable blobs semantically
+func sameVariables(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
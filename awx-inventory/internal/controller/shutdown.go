@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// startWorkers starts the workers applying queued events. They use their own
+// context, so syncs in flight when the watch stops are not aborted halfway
+// and can be drained on shutdown.
+func (c *Controller) startWorkers(ctx context.Context) (cancel context.CancelFunc, wg *sync.WaitGroup) {
+	ctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	wg = &sync.WaitGroup{}
+	for i := 0; i < c.workerCount; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c.runWorker(ctx, id)
+		}(i)
+	}
+	return cancel, wg
+}
+
+// drain lets the workers apply the queued events for up to shutdownTimeout
+// once the watch stopped. Syncs still running then are cancelled, and the
+// events not applied are saved to the checkpoint if one is configured.
+func (c *Controller) drain(cancel context.CancelFunc, wg *sync.WaitGroup) {
+	log.Printf("Draining the event queue, waiting up to %v for pending syncs", c.shutdownTimeout)
+	start := time.Now()
+
+	drained := make(chan struct{})
+	go func() {
+		c.queue.drain()
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(c.shutdownTimeout):
+		log.Printf("WARN: event queue not drained within %v, cancelling the running syncs", c.shutdownTimeout)
+		cancel()
+		c.queue.shutDown()
+		<-drained
+	}
+	cancel()
+
+	pending := c.queue.pending()
+	if c.blackout != nil {
+		pending = append(pending, c.blackout.take()...)
+	}
+	if len(pending) == 0 {
+		log.Printf("Event queue drained in %v", time.Since(start).Round(time.Millisecond))
+		return
+	}
+	if c.checkpoint == nil {
+		log.Printf("WARN: %d events were not applied before shutdown", len(pending))
+		return
+	}
+
+	for _, e := range pending {
+		c.checkpoint.track(e)
+	}
+	if err := c.checkpoint.save(); err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	log.Printf("Saved %d events not applied before shutdown to ConfigMap '%s/%s'", len(pending), c.checkpoint.namespace, c.checkpoint.name)
+}
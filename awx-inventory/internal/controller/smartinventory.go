@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// smartGroupPrefix prefixes the groups that hold the hosts of smart inventories
+const smartGroupPrefix = "smart_"
+
+// smartInventory is an AWX smart inventory of the hosts of VMs matching a
+// label selector. The controller keeps those hosts in a group of their own
+// inventory, which the host filter of the smart inventory selects across
+// the organization.
+type smartInventory struct {
+	name     string
+	group    string
+	selector labels.Selector
+}
+
+// newSmartInventories parses the label selectors of smart inventories by name
+func newSmartInventories(selectors map[string]string) ([]smartInventory, error) {
+	var inventories []smartInventory
+	for name, selector := range selectors {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector of smart inventory '%s': %w", name, err)
+		}
+		inventories = append(inventories, smartInventory{
+			name:     name,
+			group:    sanitizeGroupName(smartGroupPrefix + name),
+			selector: parsed,
+		})
+	}
+	sort.Slice(inventories, func(i, j int) bool { return inventories[i].name < inventories[j].name })
+	return inventories, nil
+}
+
+// smartGroups returns the groups of the smart inventories a VM belongs to
+func (c *Controller) smartGroups(vm *kubernetes.VirtualMachine) []string {
+	var groups []string
+	for _, inv := range c.smartInventories {
+		if inv.selector.Matches(labels.Set(vm.Labels)) {
+			groups = append(groups, inv.group)
+		}
+	}
+	return groups
+}
+
+// syncSmartInventories creates the smart inventories, or updates their host
+// filter if it changed
+func (c *Controller) syncSmartInventories(ctx context.Context) error {
+	orgID, err := c.awxClient.GetOrganizationID(ctx, c.organization)
+	if err != nil {
+		return fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	for _, inv := range c.smartInventories {
+		id, err := c.awxClient.CreateOrUpdateSmartInventory(ctx, inv.name, c.managedDescription(), orgID, "groups__name="+inv.group)
+		if err != nil {
+			return fmt.Errorf("failed to sync smart inventory '%s': %w", inv.name, err)
+		}
+		log.Printf("Smart inventory '%s' (ID %d) holds the hosts of VMs matching '%s'", inv.name, id, inv.selector)
+	}
+	return nil
+}
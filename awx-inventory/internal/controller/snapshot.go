@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/snapshot"
+)
+
+// runSnapshots periodically uploads a snapshot of the managed inventories
+func (c *Controller) runSnapshots(ctx context.Context) {
+	log.Printf("Starting inventory snapshots every %v", c.snapshotInterval)
+
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.takeSnapshot(ctx); err != nil {
+			log.Printf("ERROR: failed to take inventory snapshot: %v", err)
+		}
+	}
+}
+
+// takeSnapshot collects and uploads a single snapshot
+func (c *Controller) takeSnapshot(ctx context.Context) error {
+	cached := c.inventoryCache.Items()
+	inventories := make([]snapshot.ManagedInventory, 0, len(cached))
+	for namespace, invID := range cached {
+		inventories = append(inventories, snapshot.ManagedInventory{
+			ID:          invID,
+			Name:        c.inventoryName(namespace),
+			Namespace:   namespace,
+			Description: c.inventoryDescription(namespace),
+		})
+	}
+
+	if len(inventories) == 0 {
+		log.Printf("No managed inventories yet, skipping snapshot")
+		return nil
+	}
+
+	snap, err := snapshot.Collect(ctx, c.awxClient, c.organization, inventories)
+	if err != nil {
+		return err
+	}
+
+	key, err := c.snapshotStore.Save(snap)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Uploaded snapshot of %d inventories to '%s'", len(snap.Inventories), key)
+	return nil
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// hostSource converts the objects of a source to VMs
+type hostSource interface {
+	ToHost(obj *unstructured.Unstructured) *kubernetes.VirtualMachine
+}
+
+// defaultSource converts objects that do not come from a Kubernetes source,
+// e.g. synthetic VMs or events passed to HandleEvent
+func (c *Controller) defaultSource() hostSource {
+	if len(c.vmSources) > 0 {
+		return c.vmSources[0]
+	}
+	return kubernetes.DefaultVMResource
+}
+
+// watch delivers the events of the VM source, or of all Kubernetes sources
+// concurrently, to the workers until ctx is cancelled or a watch fails
+func (c *Controller) watch(ctx context.Context) error {
+	if c.source != nil {
+		source := c.defaultSource()
+		return c.source.WatchVMs(ctx, c.handleWatchEvent(source))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(c.vmSources))
+	for _, source := range c.vmSources {
+		go func(source kubernetes.Source) {
+			errs <- source.WatchVMs(ctx, c.handleWatchEvent(source))
+		}(source)
+	}
+
+	// The first failed watch stops the others
+	err := <-errs
+	cancel()
+	for range c.vmSources[1:] {
+		<-errs
+	}
+	return err
+}
+
+// forEachVM streams the VMs of all Kubernetes sources
+func (c *Controller) forEachVM(ctx context.Context, fn func(*kubernetes.VirtualMachine) error) error {
+	for _, source := range c.vmSources {
+		if err := source.ForEachVM(ctx, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getVM looks a VM up in all Kubernetes sources, returning a NotFound error
+// if none has it
+func (c *Controller) getVM(namespace, name string) (*kubernetes.VirtualMachine, error) {
+	var notFound error
+	for _, source := range c.vmSources {
+		vm, err := source.GetVM(namespace, name)
+		if err == nil {
+			return vm, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		notFound = err
+	}
+	if notFound == nil {
+		return nil, fmt.Errorf("no Kubernetes source to look up VM '%s' in namespace '%s'", name, namespace)
+	}
+	return nil, notFound
+}
+
+// vmPatcher is implemented by sources that can modify their objects
+type vmPatcher interface {
+	AnnotateVM(namespace, name string, annotations map[string]string) error
+	AddVMFinalizer(vm *kubernetes.VirtualMachine, finalizer string) error
+	RemoveVMFinalizer(vm *kubernetes.VirtualMachine, finalizer string) error
+}
+
+// patchVM calls fn with each Kubernetes source that can modify its objects
+// until one does not answer NotFound, i.e. owns the VM
+func (c *Controller) patchVM(fn func(vmPatcher) error) error {
+	for _, source := range c.vmSources {
+		patcher, ok := source.(vmPatcher)
+		if !ok {
+			continue
+		}
+		if err := fn(patcher); !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourcesSynced reports whether the watches of all sources listed all objects
+func (c *Controller) sourcesSynced() bool {
+	if c.source != nil {
+		synced, ok := c.source.(interface{ HasSynced() bool })
+		return !ok || synced.HasSynced()
+	}
+	for _, source := range c.vmSources {
+		if !source.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// hostStateHash fingerprints the variables, groups and description synced to
+// AWX for a host. encoding/json sorts map keys, so equal payloads always
+// produce equal hashes.
+func hostStateHash(hostVars map[string]interface{}, groups []string, description string) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(struct {
+		Vars        map[string]interface{} `json:"vars"`
+		Groups      []string               `json:"groups"`
+		Description string                 `json:"description"`
+	}{hostVars, groups, description})
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("failed to marshal host state: %w", err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+// forgetHostState drops the last synced state so the next event writes the host again
+func (c *Controller) forgetHostState(namespace, hostName string) {
+	c.hostStates.Remove(namespace + "/" + hostName)
+}
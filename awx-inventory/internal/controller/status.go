@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/workers"
+)
+
+// Status is the controller state exposed by the status API
+type Status struct {
+	Organization string          `json:"organization"`
+	Prefix       string          `json:"prefix"`
+	Inventories  map[string]int  `json:"inventories"`
+	LastEventAt  *time.Time      `json:"lastEventAt,omitempty"`
+	LastError    string          `json:"lastError,omitempty"`
+	Workers      []workers.Stats `json:"workers"`
+}
+
+// Status returns a snapshot of the controller state
+func (c *Controller) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := Status{
+		Organization: c.organization,
+		Prefix:       c.prefix,
+		Inventories:  c.inventoryCache.Items(),
+		LastError:    c.lastError,
+		Workers:      c.workers.Stats(),
+	}
+	if !c.lastEventAt.IsZero() {
+		lastEventAt := c.lastEventAt
+		status.LastEventAt = &lastEventAt
+	}
+
+	return status
+}
+
+// StatusHandler serves the controller status as JSON
+func (c *Controller) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// recordResult stores the outcome of the last processed event
+func (c *Controller) recordResult(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastEventAt = time.Now()
+	if err != nil {
+		c.lastError = err.Error()
+	} else {
+		c.lastError = ""
+	}
+}
+
+// recordSuccess updates the dead-man's-switch metrics; empty namespace
+// only bumps the global timestamp
+func (c *Controller) recordSuccess(namespace string) {
+	now := float64(time.Now().Unix())
+	metrics.LastSuccessfulReconcile.Set(now)
+	if namespace != "" {
+		metrics.NamespaceLastSuccessfulReconcile.WithLabelValues(namespace).Set(now)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// AnnotationSyncStatus is set by the controller to the SyncStatus of a VM as JSON
+const AnnotationSyncStatus = "awx-inventory.io/sync-status"
+
+// SyncStatus describes the last sync of a VM to AWX
+type SyncStatus struct {
+	// LastSynced is the time of the last successful sync in RFC 3339 format
+	LastSynced string `json:"lastSynced,omitempty"`
+	Inventory  string `json:"inventory,omitempty"`
+	// HostURL is the AWX UI URL of the host, empty if the ID is unknown
+	HostURL string `json:"hostURL,omitempty"`
+	// LastError is the error of the last sync, empty if it succeeded
+	LastError string `json:"lastError,omitempty"`
+}
+
+// syncStatus returns the SyncStatus the VM is annotated with
+func syncStatus(vm *kubernetes.VirtualMachine) SyncStatus {
+	var status SyncStatus
+	if value := vm.Annotations[AnnotationSyncStatus]; value != "" {
+		_ = json.Unmarshal([]byte(value), &status)
+	}
+	return status
+}
+
+// recordSynced annotates a VM with a successful sync into inventory invID
+func (c *Controller) recordSynced(vm *kubernetes.VirtualMachine, invID, hostID int) {
+	if !c.statusAnnotation {
+		return
+	}
+	status := SyncStatus{
+		LastSynced: time.Now().UTC().Format(time.RFC3339),
+		Inventory:  c.inventoryName(vm.Namespace),
+	}
+	if hostID != 0 {
+		status.HostURL = c.awxClient.HostURL(invID, hostID)
+	}
+	c.annotateSyncStatus(vm, status)
+}
+
+// recordSyncFailed annotates a VM with the error of a failed sync, keeping
+// the details of the last successful one
+func (c *Controller) recordSyncFailed(vm *kubernetes.VirtualMachine, err error) {
+	if !c.statusAnnotation {
+		return
+	}
+	status := syncStatus(vm)
+	status.LastError = err.Error()
+	c.annotateSyncStatus(vm, status)
+}
+
+// annotateSyncStatus patches the status annotation of a VM if it changed.
+// Failures are only logged, the status must not hold up syncing.
+func (c *Controller) annotateSyncStatus(vm *kubernetes.VirtualMachine, status SyncStatus) {
+	data, err := json.Marshal(status)
+	if err != nil || vm.Annotations[AnnotationSyncStatus] == string(data) {
+		return
+	}
+	err = c.patchVM(func(patcher vmPatcher) error {
+		return patcher.AnnotateVM(vm.Namespace, vm.Name, map[string]string{AnnotationSyncStatus: string(data)})
+	})
+	if err != nil {
+		log.Printf("WARN: failed to annotate VM '%s' in namespace '%s' with its sync status: %v", vm.Name, vm.Namespace, err)
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// tokenSetter is implemented by AWX clients whose token can be replaced
+type tokenSetter interface {
+	SetToken(token string)
+}
+
+// awxTokenSetter returns the AWX client as a tokenSetter, looking through
+// the audit log
+func (c *Controller) awxTokenSetter() (tokenSetter, bool) {
+	client := c.awxClient
+	if audited, ok := client.(*auditedClient); ok {
+		client = audited.AWXClient
+	}
+	setter, ok := client.(tokenSetter)
+	return setter, ok
+}
+
+// secretToken returns the AWX token in data, empty if it is missing
+func (c *Controller) secretToken(data map[string][]byte) string {
+	return strings.TrimSpace(string(data[c.tokenSecretKey]))
+}
+
+// loadTokenSecret reads the AWX token from the token Secret
+func (c *Controller) loadTokenSecret() error {
+	setter, ok := c.awxTokenSetter()
+	if !ok {
+		return fmt.Errorf("AWX client %T does not support tokens from a Secret", c.awxClient)
+	}
+	if c.k8sClient == nil {
+		return fmt.Errorf("reading the AWX token from a Secret requires a Kubernetes client")
+	}
+
+	data, err := c.k8sClient.GetSecretData(c.tokenNamespace, c.tokenSecret)
+	if err != nil {
+		return fmt.Errorf("failed to read AWX token Secret '%s': %w", c.tokenSecret, err)
+	}
+	token := c.secretToken(data)
+	if token == "" {
+		return fmt.Errorf("AWX token Secret '%s' has no key '%s'", c.tokenSecret, c.tokenSecretKey)
+	}
+	setter.SetToken(token)
+	c.token = token
+	return nil
+}
+
+// runTokenWatch switches to the new AWX token whenever the token Secret changes
+func (c *Controller) runTokenWatch(ctx context.Context) {
+	setter, _ := c.awxTokenSetter()
+	err := c.k8sClient.WatchSecret(ctx, c.tokenNamespace, c.tokenSecret, func(data map[string][]byte) {
+		token := c.secretToken(data)
+		switch {
+		case token == "":
+			// Keep the previous token while the Secret is being rewritten
+			log.Printf("WARN: AWX token Secret '%s' has no key '%s', keeping the current token", c.tokenSecret, c.tokenSecretKey)
+		case token != c.token:
+			log.Printf("AWX token in Secret '%s' changed, switching to it", c.tokenSecret)
+			setter.SetToken(token)
+			c.token = token
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("WARN: watching AWX token Secret '%s' failed, rotated tokens need a restart: %v", c.tokenSecret, err)
+	}
+}
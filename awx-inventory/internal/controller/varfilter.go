@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces the values of redacted host variables
+const redactedValue = "<redacted>"
+
+// varFilter selects the host variables pushed to AWX. Patterns are globs
+// where * matches any text, including dots and slashes. Nested variables
+// like labels are named "<parent>.<key>", e.g. "labels.app".
+type varFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	// Matched case-insensitively against the key of a variable at any depth
+	redact []*regexp.Regexp
+}
+
+// newVarFilter compiles the patterns, returning nil if there are none
+func newVarFilter(include, exclude, redact []string) *varFilter {
+	if len(include) == 0 && len(exclude) == 0 && len(redact) == 0 {
+		return nil
+	}
+	return &varFilter{
+		include: compileGlobs(include, false),
+		exclude: compileGlobs(exclude, false),
+		redact:  compileGlobs(redact, true),
+	}
+}
+
+func compileGlobs(patterns []string, ignoreCase bool) []*regexp.Regexp {
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		result = append(result, regexp.MustCompile(expr))
+	}
+	return result
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the filtered copy of hostVars. ansible_host is always kept.
+func (f *varFilter) apply(hostVars map[string]interface{}) map[string]interface{} {
+	if f == nil {
+		return hostVars
+	}
+	result := f.filter("", hostVars, len(f.include) == 0)
+	if host, exists := hostVars["ansible_host"]; exists {
+		result["ansible_host"] = host
+	}
+	return result
+}
+
+// filter filters the entries of a map named parent. Entries are included if
+// included is true, i.e. there is no include list or the map matched it.
+func (f *varFilter) filter(parent string, vars map[string]interface{}, included bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range vars {
+		name := key
+		if parent != "" {
+			name = parent + "." + key
+		}
+		if matchesAny(f.exclude, name) {
+			continue
+		}
+		keep := included || matchesAny(f.include, name)
+
+		if matchesAny(f.redact, key) {
+			if keep {
+				result[key] = redactedValue
+			}
+			continue
+		}
+
+		// Nested entries may be included even if their parent is not
+		var nested map[string]interface{}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			nested = value
+		case map[string]string:
+			nested = make(map[string]interface{}, len(value))
+			for k, v := range value {
+				nested[k] = v
+			}
+		}
+		if nested != nil {
+			if filtered := f.filter(name, nested, keep); keep || len(filtered) > 0 {
+				result[key] = filtered
+			}
+			continue
+		}
+
+		if keep {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// AnnotationOS set to "windows" or "linux" overrides OS detection
+const AnnotationOS = "awx-inventory.io/os"
+
+// KubeVirt VM templates record the OS in this annotation and label prefix
+const (
+	kubevirtOSAnnotation     = "vm.kubevirt.io/os"
+	kubevirtOSTemplatePrefix = "os.template.kubevirt.io/"
+)
+
+// windows reports whether a VM runs Windows, judging by AnnotationOS, KubeVirt
+// template metadata or the guest OS reported by the guest agent
+func windows(vm *kubernetes.VirtualMachine) bool {
+	if os := strings.ToLower(strings.TrimSpace(vm.Annotations[AnnotationOS])); os != "" {
+		return os == "windows"
+	}
+	if strings.HasPrefix(vm.Annotations[kubevirtOSAnnotation], "windows") {
+		return true
+	}
+	for key, value := range vm.Labels {
+		if strings.HasPrefix(key, kubevirtOSTemplatePrefix+"win") && value == "true" {
+			return true
+		}
+	}
+	return vm.OS.ID == "mswindows" || strings.Contains(strings.ToLower(vm.OS.Name), "windows")
+}
+
+// winRMVars returns the connection variables of Windows VMs, nil for others
+func (c *Controller) winRMVars(vm *kubernetes.VirtualMachine) map[string]interface{} {
+	if len(c.winRM) == 0 || !windows(vm) {
+		return nil
+	}
+	return c.winRM
+}
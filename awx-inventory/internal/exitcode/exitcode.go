@@ -0,0 +1,38 @@
+package exitcode
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// Exit codes returned by the awx-inventory binary
+const (
+	// OK means a clean exit, including shutdown on SIGTERM/SIGINT
+	OK = 0
+	// Runtime means a fatal error while running
+	Runtime = 1
+	// Config means invalid or missing configuration
+	Config = 2
+	// AWXAuth means AWX rejected the credentials or their permissions
+	AWXAuth = 3
+	// KubernetesRBAC means the Kubernetes API denied access
+	KubernetesRBAC = 4
+)
+
+// For classifies err into an exit code
+func For(err error) int {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return OK
+	case errors.Is(err, awx.ErrUnauthorized), errors.Is(err, awx.ErrForbidden):
+		return AWXAuth
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return KubernetesRBAC
+	default:
+		return Runtime
+	}
+}
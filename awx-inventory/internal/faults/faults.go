@@ -0,0 +1,138 @@
+package faults
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// Config describes faults to inject for resilience testing.
+// The zero value injects nothing.
+type Config struct {
+	// AWXErrorRate is the probability (0..1) of answering an AWX request with HTTP 503
+	AWXErrorRate float64
+	// AWXLatency is the upper bound of random delay added to AWX requests
+	AWXLatency time.Duration
+	// WatchDropRate is the probability (0..1) of dropping a watch event
+	WatchDropRate float64
+	// WatchRestartInterval forces the VM watch to restart this often
+	WatchRestartInterval time.Duration
+}
+
+// FromEnv reads the FAULT_* environment variables
+func FromEnv() (Config, error) {
+	var cfg Config
+	var err error
+
+	if cfg.AWXErrorRate, err = parseRate("FAULT_AWX_ERROR_RATE"); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchDropRate, err = parseRate("FAULT_WATCH_DROP_RATE"); err != nil {
+		return cfg, err
+	}
+	if cfg.AWXLatency, err = parseDuration("FAULT_AWX_LATENCY"); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchRestartInterval, err = parseDuration("FAULT_WATCH_RESTART_INTERVAL"); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Enabled() {
+		log.Printf("WARN: fault injection enabled: %+v", cfg)
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether any fault is configured
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// Transport wraps next with AWX error and latency injection
+func (c Config) Transport(next http.RoundTripper) http.RoundTripper {
+	if c.AWXErrorRate == 0 && c.AWXLatency == 0 {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{cfg: c, next: next}
+}
+
+// DropEvent reports whether the next watch event should be dropped
+func (c Config) DropEvent() bool {
+	if c.WatchDropRate > 0 && rand.Float64() < c.WatchDropRate {
+		metrics.InjectedFaultsTotal.WithLabelValues("watch_drop").Inc()
+		return true
+	}
+	return false
+}
+
+type transport struct {
+	cfg  Config
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.AWXLatency > 0 {
+		metrics.InjectedFaultsTotal.WithLabelValues("awx_latency").Inc()
+		delay := time.Duration(rand.Int63n(int64(t.cfg.AWXLatency)))
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if t.cfg.AWXErrorRate > 0 && rand.Float64() < t.cfg.AWXErrorRate {
+		metrics.InjectedFaultsTotal.WithLabelValues("awx_error").Inc()
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       io.NopCloser(strings.NewReader("injected fault")),
+			Request:    req,
+		}, nil
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func parseRate(key string) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid %s '%s': must be a number between 0 and 1", key, value)
+	}
+	return rate, nil
+}
+
+func parseDuration(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s '%s': must be a positive duration", key, value)
+	}
+	return d, nil
+}
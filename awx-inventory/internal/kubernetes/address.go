@@ -0,0 +1,143 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Address is one of the addresses of a VM
+type Address struct {
+	IP string
+	// Interface is the interface or address type the address belongs to,
+	// e.g. eth0 or InternalIP, empty if unknown
+	Interface string
+}
+
+// AddressPolicy chooses ansible_host among the addresses of a VM. Rules are
+// tried in order and the first address matching a rule wins.
+type AddressPolicy []func(Address) bool
+
+// ParseAddressPolicy parses comma-separated rules: prefer-ipv4, prefer-ipv6,
+// interface:<glob> and cidr:<network>
+func ParseAddressPolicy(value string) (AddressPolicy, error) {
+	var policy AddressPolicy
+	for _, rule := range splitList(value) {
+		kind, arg, _ := strings.Cut(rule, ":")
+		switch kind {
+		case "prefer-ipv4":
+			policy = append(policy, func(a Address) bool {
+				ip := net.ParseIP(a.IP)
+				return ip != nil && ip.To4() != nil
+			})
+		case "prefer-ipv6":
+			policy = append(policy, func(a Address) bool {
+				ip := net.ParseIP(a.IP)
+				return ip != nil && ip.To4() == nil
+			})
+		case "interface":
+			if _, err := path.Match(arg, ""); err != nil || arg == "" {
+				return nil, fmt.Errorf("invalid interface pattern in rule '%s'", rule)
+			}
+			policy = append(policy, func(a Address) bool {
+				matched, _ := path.Match(arg, a.Interface)
+				return matched
+			})
+		case "cidr":
+			_, network, err := net.ParseCIDR(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule '%s': %w", rule, err)
+			}
+			policy = append(policy, func(a Address) bool {
+				ip := net.ParseIP(a.IP)
+				return ip != nil && network.Contains(ip)
+			})
+		default:
+			return nil, fmt.Errorf("unknown address rule '%s', expected prefer-ipv4, prefer-ipv6, interface:<glob> or cidr:<network>", rule)
+		}
+	}
+	return policy, nil
+}
+
+// Select returns the address chosen by the policy, empty if no rule matches
+func (p AddressPolicy) Select(addresses []Address) string {
+	for _, rule := range p {
+		for _, address := range addresses {
+			if rule(address) {
+				return address.IP
+			}
+		}
+	}
+	return ""
+}
+
+// hasAddress reports whether ip is one of addresses
+func hasAddress(addresses []Address, ip string) bool {
+	for _, address := range addresses {
+		if address.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// typedAddresses returns the addresses of a list of {type, address}
+// entries, as in Node and Machine status
+func typedAddresses(entries []interface{}) []Address {
+	var addresses []Address
+	for _, item := range entries {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ip, _ := entry["address"].(string)
+		addressType, _ := entry["type"].(string)
+		if net.ParseIP(ip) != nil {
+			addresses = append(addresses, Address{IP: ip, Interface: addressType})
+		}
+	}
+	return addresses
+}
+
+// interfaceAddresses returns the addresses of KubeVirt status.interfaces
+func interfaceAddresses(obj *unstructured.Unstructured) []Address {
+	var addresses []Address
+	interfaces, _, _ := unstructured.NestedSlice(obj.Object, "status", "interfaces")
+	for _, item := range interfaces {
+		iface, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(iface, "name")
+		ips, _, _ := unstructured.NestedStringSlice(iface, "ipAddresses")
+		if ip, _, _ := unstructured.NestedString(iface, "ipAddress"); ip != "" {
+			ips = append([]string{ip}, ips...)
+		}
+		for _, ip := range ips {
+			if !hasAddress(addresses, ip) {
+				addresses = append(addresses, Address{IP: ip, Interface: name})
+			}
+		}
+	}
+	return addresses
+}
+
+// listedAddresses returns the addresses in a list of strings like
+// spec.clusterIPs, or of {ip} entries if field is set, like status.podIPs
+func listedAddresses(obj *unstructured.Unstructured, field string, fields ...string) []Address {
+	var addresses []Address
+	items, _, _ := unstructured.NestedSlice(obj.Object, fields...)
+	for _, item := range items {
+		ip, _ := item.(string)
+		if entry, ok := item.(map[string]interface{}); ok && field != "" {
+			ip, _ = entry[field].(string)
+		}
+		if net.ParseIP(ip) != nil {
+			addresses = append(addresses, Address{IP: ip})
+		}
+	}
+	return addresses
+}
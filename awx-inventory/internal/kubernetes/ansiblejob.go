@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var ansibleJobGVR = schema.GroupVersionResource{
+	Group:    "awx-inventory.io",
+	Version:  "v1alpha1",
+	Resource: "ansiblejobs",
+}
+
+// AnsibleJob represents an AnsibleJob resource
+type AnsibleJob struct {
+	Name       string
+	Namespace  string
+	Generation int64
+	Created    time.Time
+
+	// Spec
+	JobTemplateName string
+	Limit           string
+	ExtraVars       map[string]interface{}
+	Schedule        string
+
+	Status AnsibleJobStatus
+
+	obj *unstructured.Unstructured
+}
+
+// AnsibleJobStatus mirrors the state of the launched AWX job
+type AnsibleJobStatus struct {
+	Phase              string
+	JobID              int64
+	JobStatus          string
+	JobURL             string
+	Message            string
+	LastLaunchTime     time.Time
+	CompletionTime     time.Time
+	NextScheduleTime   time.Time
+	ObservedGeneration int64
+}
+
+// ListAnsibleJobs lists all AnsibleJob resources
+func (k *Client) ListAnsibleJobs() ([]*AnsibleJob, error) {
+	namespaces := k.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var jobs []*AnsibleJob
+	for _, namespace := range namespaces {
+		list, err := k.client.Resource(ansibleJobGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			jobs = append(jobs, unstructuredToAnsibleJob(&list.Items[i]))
+		}
+	}
+
+	return jobs, nil
+}
+
+// UpdateAnsibleJobStatus writes the status subresource of an AnsibleJob
+func (k *Client) UpdateAnsibleJobStatus(job *AnsibleJob) error {
+	obj := job.obj.DeepCopy()
+
+	status := map[string]interface{}{
+		"phase":              job.Status.Phase,
+		"jobID":              job.Status.JobID,
+		"jobStatus":          job.Status.JobStatus,
+		"jobURL":             job.Status.JobURL,
+		"message":            job.Status.Message,
+		"observedGeneration": job.Status.ObservedGeneration,
+	}
+	setTime(status, "lastLaunchTime", job.Status.LastLaunchTime)
+	setTime(status, "completionTime", job.Status.CompletionTime)
+	setTime(status, "nextScheduleTime", job.Status.NextScheduleTime)
+
+	if err := unstructured.SetNestedMap(obj.Object, status, "status"); err != nil {
+		return err
+	}
+
+	updated, err := k.client.Resource(ansibleJobGVR).Namespace(job.Namespace).UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	job.obj = updated
+	return nil
+}
+
+// unstructuredToAnsibleJob converts unstructured.Unstructured to AnsibleJob
+func unstructuredToAnsibleJob(obj *unstructured.Unstructured) *AnsibleJob {
+	job := &AnsibleJob{
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Generation: obj.GetGeneration(),
+		Created:    obj.GetCreationTimestamp().Time,
+		obj:        obj,
+	}
+
+	job.JobTemplateName, _, _ = unstructured.NestedString(obj.Object, "spec", "jobTemplateName")
+	job.Limit, _, _ = unstructured.NestedString(obj.Object, "spec", "limit")
+	job.Schedule, _, _ = unstructured.NestedString(obj.Object, "spec", "schedule")
+	job.ExtraVars, _, _ = unstructured.NestedMap(obj.Object, "spec", "extraVars")
+
+	job.Status.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	job.Status.JobID, _, _ = unstructured.NestedInt64(obj.Object, "status", "jobID")
+	job.Status.JobStatus, _, _ = unstructured.NestedString(obj.Object, "status", "jobStatus")
+	job.Status.JobURL, _, _ = unstructured.NestedString(obj.Object, "status", "jobURL")
+	job.Status.Message, _, _ = unstructured.NestedString(obj.Object, "status", "message")
+	job.Status.ObservedGeneration, _, _ = unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	job.Status.LastLaunchTime = getTime(obj.Object, "status", "lastLaunchTime")
+	job.Status.CompletionTime = getTime(obj.Object, "status", "completionTime")
+	job.Status.NextScheduleTime = getTime(obj.Object, "status", "nextScheduleTime")
+
+	return job
+}
+
+// getTime reads an RFC 3339 timestamp, returning zero time if missing
+func getTime(obj map[string]interface{}, fields ...string) time.Time {
+	value, found, _ := unstructured.NestedString(obj, fields...)
+	if !found {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// setTime writes an RFC 3339 timestamp, skipping zero time
+func setTime(obj map[string]interface{}, key string, t time.Time) {
+	if !t.IsZero() {
+		obj[key] = t.UTC().Format(time.RFC3339)
+	}
+}
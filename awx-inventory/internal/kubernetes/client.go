@@ -2,26 +2,51 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/faults"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
 )
 
 // Client handles communication with Kubernetes API
 type Client struct {
-	client    dynamic.Interface
-	namespace string
+	client dynamic.Interface
+	// namespaces are the watched namespaces, empty for all
+	namespaces []string
+	resource   VMResource
+	faults     faults.Config
+	// labelSelector restricts listed and watched VMs, empty for all
+	mu            sync.Mutex
+	labelSelector string
+	// restart stops the running informer so a new one picks up the selector
+	restart  chan struct{}
+	watching atomic.Bool
+	// synced is true once the VM informer has listed all VMs
+	synced atomic.Bool
 }
 
-// NewClient creates a new Kubernetes client
-func NewClient(namespace string) (*Client, error) {
+// NewClient creates a new Kubernetes client for the given namespaces, all
+// namespaces if none are given
+func NewClient(namespaces ...string) (*Client, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
@@ -36,10 +61,91 @@ func NewClient(namespace string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	return NewClientForDynamic(client, namespaces...), nil
+}
+
+// NewClientForDynamic creates a client on top of an existing dynamic client,
+// e.g. k8s.io/client-go/dynamic/fake in tests
+func NewClientForDynamic(client dynamic.Interface, namespaces ...string) *Client {
 	return &Client{
-		client:    client,
-		namespace: namespace,
-	}, nil
+		client:     client,
+		namespaces: namespaces,
+		resource:   DefaultVMResource,
+		restart:    make(chan struct{}, 1),
+	}
+}
+
+// SetVMResource changes the watched VirtualMachine resource and the fields
+// read from it. It must be called before VMs are listed or watched.
+func (k *Client) SetVMResource(resource VMResource) {
+	k.resource = resource
+}
+
+// ForResource returns a client for another resource, sharing the connection,
+// namespace, faults and label selector of k
+func (k *Client) ForResource(resource VMResource) *Client {
+	client := NewClientForDynamic(k.client, k.namespaces...)
+	client.resource = resource
+	client.faults = k.faults
+	client.labelSelector = k.selector()
+	return client
+}
+
+// ToHost converts an object delivered by WatchVMs
+func (k *Client) ToHost(obj *unstructured.Unstructured) *VirtualMachine {
+	return k.resource.ToHost(obj)
+}
+
+// GroupPrefixes are the prefixes of the groups the resource puts hosts into
+func (k *Client) GroupPrefixes() []string {
+	return k.resource.GroupPrefixes
+}
+
+// SetFaults configures fault injection for the VM watch
+func (k *Client) SetFaults(cfg faults.Config) {
+	k.faults = cfg
+}
+
+// SetLabelSelector restricts listed and watched VMs to those matching selector.
+// Changing it while VMs are watched restarts the watch.
+func (k *Client) SetLabelSelector(selector string) {
+	k.mu.Lock()
+	changed := k.labelSelector != selector
+	k.labelSelector = selector
+	k.mu.Unlock()
+
+	if changed && k.watching.Load() {
+		k.RestartWatch()
+	}
+}
+
+// RestartWatch relists VMs, delivering every VM again as an ADDED event
+func (k *Client) RestartWatch() {
+	select {
+	case k.restart <- struct{}{}:
+	default:
+	}
+}
+
+// watchedNamespaces returns the namespaces to list and watch, where
+// metav1.NamespaceAll stands for all namespaces
+func (k *Client) watchedNamespaces() []string {
+	if len(k.namespaces) == 0 || k.resource.ClusterScoped {
+		return []string{metav1.NamespaceAll}
+	}
+	return k.namespaces
+}
+
+// watches reports whether objects of namespace are listed and watched
+func (k *Client) watches(namespace string) bool {
+	return len(k.namespaces) == 0 || slices.Contains(k.namespaces, namespace)
+}
+
+// selector returns the current label selector
+func (k *Client) selector() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.labelSelector
 }
 
 // VirtualMachine represents a VirtualMachine resource
@@ -48,22 +154,68 @@ type VirtualMachine struct {
 	Namespace string
 	IP        string
 	Labels    map[string]string
+	// Addresses are all addresses of the VM, including IP
+	Addresses []Address
+	// Annotations holds metadata.annotations, nil if there are none
+	Annotations map[string]string
+	// ClassName is spec.virtualMachineClassName
+	ClassName string
+	// Phase is the power state or lifecycle phase (status.phase), e.g. Running
+	Phase string
+	// NodeName is the node the VM currently runs on (status.nodeName)
+	NodeName string
+	// UserData is inline cloud-init data (spec.provisioning.userData)
+	UserData string
+	// UserDataSecret names the Secret holding cloud-init data (spec.provisioning.userDataRef)
+	UserDataSecret string
+	// Hostname is read from VMResource.HostnamePath, empty if not configured
+	Hostname string
+	// Groups are the AWX groups set by the resource, e.g. node roles
+	Groups []string
+	// Vars are host variables set by the resource
+	Vars map[string]interface{}
+	// CPUCores is the number of virtual CPU cores, 0 if unknown
+	CPUCores int64
+	// Memory is the memory size as a Kubernetes quantity, e.g. "4Gi"
+	Memory string
+	// OS is reported by the guest agent, empty if it is not running
+	OS GuestOS
+	// AgentReady reports whether the guest agent is connected, nil if unknown
+	AgentReady *bool
+	// Kind and UID identify the Kubernetes object the host is synced from
+	Kind string
+	UID  string
+	// Finalizers are metadata.finalizers of the object
+	Finalizers []string
+	// Deleting is true once deletion of the object was requested
+	Deleting bool
+	// Object refers to the Kubernetes object, whose name and namespace can
+	// differ from Name and Namespace
+	Object corev1.ObjectReference
+}
+
+// GuestOS describes the operating system of a VM (status.guestOSInfo)
+type GuestOS struct {
+	ID            string
+	Name          string
+	PrettyName    string
+	Version       string
+	KernelRelease string
 }
 
 // GetVMIP retrieves IP address from VirtualMachine status
 func (k *Client) GetVMIP(namespace, name string) (string, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "virtualization.deckhouse.io",
-		Version:  "v1alpha2",
-		Resource: "virtualmachines",
-	}
+	gvr := k.resource.GVR
 
 	var obj *unstructured.Unstructured
 	var err error
 
-	if k.namespace != "" {
-		obj, err = k.client.Resource(gvr).Namespace(k.namespace).Get(context.TODO(), name, metav1.GetOptions{})
-	} else {
+	switch {
+	case k.resource.ClusterScoped:
+		obj, err = k.client.Resource(gvr).Get(context.TODO(), name, metav1.GetOptions{})
+	case !k.watches(namespace):
+		return "", apierrors.NewNotFound(gvr.GroupResource(), name)
+	default:
 		obj, err = k.client.Resource(gvr).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 	}
 
@@ -71,190 +223,378 @@ func (k *Client) GetVMIP(namespace, name string) (string, error) {
 		return "", err
 	}
 
-	ip, found, err := unstructured.NestedString(obj.Object, "status", "ipAddress")
-	if err != nil || !found {
-		return "", nil
-	}
-
-	return ip, nil
+	return k.resource.ToHost(obj).IP, nil
 }
 
 // GetVM retrieves VirtualMachine resource
 func (k *Client) GetVM(namespace, name string) (*VirtualMachine, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "virtualization.deckhouse.io",
-		Version:  "v1alpha2",
-		Resource: "virtualmachines",
+	obj, err := k.GetVMObject(namespace, name)
+	if err != nil {
+		return nil, err
 	}
 
+	vm := k.resource.ToHost(obj)
+	vm.Name = name
+	vm.Namespace = namespace
+
+	return vm, nil
+}
+
+// GetVMObject retrieves the object of a VM as delivered by WatchVMs
+func (k *Client) GetVMObject(namespace, name string) (*unstructured.Unstructured, error) {
+	gvr := k.resource.GVR
+	objNamespace, objName := k.objectKey(namespace, name)
+
 	var obj *unstructured.Unstructured
 	var err error
 
-	if k.namespace != "" {
-		obj, err = k.client.Resource(gvr).Namespace(k.namespace).Get(context.TODO(), name, metav1.GetOptions{})
-	} else {
-		obj, err = k.client.Resource(gvr).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	switch {
+	case k.resource.ClusterScoped:
+		obj, err = k.client.Resource(gvr).Get(context.TODO(), objName, metav1.GetOptions{})
+	case !k.watches(objNamespace):
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), objName)
+	default:
+		obj, err = k.client.Resource(gvr).Namespace(objNamespace).Get(context.TODO(), objName, metav1.GetOptions{})
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	vm := &VirtualMachine{
-		Name:      name,
-		Namespace: namespace,
-	}
-
-	// Get IP
-	ip, found, _ := unstructured.NestedString(obj.Object, "status", "ipAddress")
-	if found {
-		vm.IP = ip
+	if !k.matches(obj) {
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
 	}
 
-	// Get labels
-	labels, found, _ := unstructured.NestedStringMap(obj.Object, "metadata", "labels")
-	if found {
-		vm.Labels = labels
-	} else {
-		vm.Labels = make(map[string]string)
-	}
+	return obj, nil
+}
 
-	return vm, nil
+// NodeTopology holds the topology labels of a node
+type NodeTopology struct {
+	Zone   string
+	Region string
 }
 
-// UnstructuredToVM converts unstructured.Unstructured to VirtualMachine
-func UnstructuredToVM(obj *unstructured.Unstructured) *VirtualMachine {
-	namespace, found, _ := unstructured.NestedString(obj.Object, "metadata", "namespace")
-	if !found {
-		namespace = ""
+// GetNodeTopology reads the topology.kubernetes.io zone and region labels of a node
+func (k *Client) GetNodeTopology(name string) (*NodeTopology, error) {
+	gvr := schema.GroupVersionResource{
+		Version:  "v1",
+		Resource: "nodes",
 	}
 
-	name, found, _ := unstructured.NestedString(obj.Object, "metadata", "name")
-	if !found {
-		name = ""
+	obj, err := k.client.Resource(gvr).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
 	}
 
-	vm := &VirtualMachine{
-		Name:      name,
-		Namespace: namespace,
-	}
+	labels := obj.GetLabels()
+	return &NodeTopology{
+		Zone:   labels["topology.kubernetes.io/zone"],
+		Region: labels["topology.kubernetes.io/region"],
+	}, nil
+}
 
-	// Get IP
-	ip, found, _ := unstructured.NestedString(obj.Object, "status", "ipAddress")
-	if found {
-		vm.IP = ip
+// GetSecretData retrieves the decoded data of a Secret
+func (k *Client) GetSecretData(namespace, name string) (map[string][]byte, error) {
+	obj, err := k.client.Resource(secretGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
 	}
+	return secretData(obj)
+}
 
-	// Get labels
-	labels, found, _ := unstructured.NestedStringMap(obj.Object, "metadata", "labels")
-	if found {
-		vm.Labels = labels
-	} else {
-		vm.Labels = make(map[string]string)
+// secretData decodes the data of a Secret
+func secretData(obj *unstructured.Unstructured) (map[string][]byte, error) {
+	name := obj.GetName()
+	encoded, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	data := make(map[string][]byte, len(encoded))
+	for key, value := range encoded {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key '%s' of secret '%s': %w", key, name, err)
+		}
+		data[key] = decoded
 	}
 
-	return vm
+	return data, nil
 }
 
-// ListVMs lists all VirtualMachine resources
-func (k *Client) ListVMs() ([]*VirtualMachine, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "virtualization.deckhouse.io",
-		Version:  "v1alpha2",
-		Resource: "virtualmachines",
+// objectKey returns the namespace and name of the object the controller
+// knows as name in namespace, reversing the renaming done by ToHost
+func (k *Client) objectKey(namespace, name string) (string, string) {
+	if k.resource.Namespace == "" || k.resource.ClusterScoped {
+		return namespace, name
 	}
+	// Namespaces cannot contain dots, names can
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:], name[:i]
+	}
+	return namespace, name
+}
 
-	var list *unstructured.UnstructuredList
-	var err error
-
-	if k.namespace != "" {
-		list, err = k.client.Resource(gvr).Namespace(k.namespace).List(context.TODO(), metav1.ListOptions{})
-	} else {
-		list, err = k.client.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+// matches reports whether an object, possibly a tombstone, is synced
+func (k *Client) matches(obj interface{}) bool {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
 	}
+	return k.resource.Match == nil || k.resource.Match(u)
+}
 
+// previousObject returns the object known to the previous informer under the key of obj
+func previousObject(previous map[string]*unstructured.Unstructured, obj interface{}) interface{} {
+	key, err := toolscache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
-		return nil, err
+		return nil
+	}
+	if prev, exists := previous[key]; exists {
+		return prev
 	}
+	return nil
+}
+
+// ListPageSize is the number of VirtualMachines requested per list page
+const ListPageSize = 500
 
+// ListVMs lists all VirtualMachine resources
+func (k *Client) ListVMs() ([]*VirtualMachine, error) {
 	var vms []*VirtualMachine
-	for _, item := range list.Items {
-		namespace, found, _ := unstructured.NestedString(item.Object, "metadata", "namespace")
-		if !found {
-			continue
+	err := k.ForEachVM(context.TODO(), func(vm *VirtualMachine) error {
+		vms = append(vms, vm)
+		return nil
+	})
+	return vms, err
+}
+
+// ForEachVM streams VirtualMachine resources page by page, so memory stays
+// bounded by the page size regardless of how many VMs exist
+func (k *Client) ForEachVM(ctx context.Context, fn func(*VirtualMachine) error) error {
+	return k.ForEachVMObject(ctx, func(obj *unstructured.Unstructured) error {
+		vm := k.resource.ToHost(obj)
+		if vm.Namespace == "" || vm.Name == "" {
+			return nil
 		}
+		return fn(vm)
+	})
+}
 
-		name, found, _ := unstructured.NestedString(item.Object, "metadata", "name")
-		if !found {
-			continue
+// ForEachVMObject streams the objects of the VMs like ForEachVM, as
+// delivered by WatchVMs
+func (k *Client) ForEachVMObject(ctx context.Context, fn func(*unstructured.Unstructured) error) error {
+	for _, namespace := range k.watchedNamespaces() {
+		if err := k.forEachObjectIn(ctx, namespace, fn); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		vm := &VirtualMachine{
-			Name:      name,
-			Namespace: namespace,
+// forEachObjectIn streams the VirtualMachine resources of one namespace, or
+// of all namespaces if namespace is empty
+func (k *Client) forEachObjectIn(ctx context.Context, namespace string, fn func(*unstructured.Unstructured) error) error {
+	gvr := k.resource.GVR
+
+	opts := metav1.ListOptions{Limit: ListPageSize, LabelSelector: k.selector()}
+	for {
+		list, err := k.client.Resource(gvr).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return err
 		}
 
-		// Get IP
-		ip, found, _ := unstructured.NestedString(item.Object, "status", "ipAddress")
-		if found {
-			vm.IP = ip
+		for i := range list.Items {
+			if !k.matches(&list.Items[i]) {
+				continue
+			}
+			if err := fn(&list.Items[i]); err != nil {
+				return err
+			}
 		}
 
-		// Get labels
-		labels, found, _ := unstructured.NestedStringMap(item.Object, "metadata", "labels")
-		if found {
-			vm.Labels = labels
-		} else {
-			vm.Labels = make(map[string]string)
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			return nil
 		}
+	}
+}
 
-		vms = append(vms, vm)
+// WatchVMs runs a shared informer for VirtualMachine resources and passes
+// every add, update and delete to handler. The informer lists existing VMs
+// first, so they are delivered as ADDED events on startup.
+func (k *Client) WatchVMs(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error) error {
+	k.watching.Store(true)
+	defer k.watching.Store(false)
+
+	var known map[string]*unstructured.Unstructured
+	for {
+		var err error
+		if known, err = k.runInformer(ctx, handler, known); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 	}
+}
 
-	return vms, nil
+// HasSynced reports whether the VM watch is established and has listed all VMs
+func (k *Client) HasSynced() bool {
+	return k.synced.Load()
 }
 
-// WatchVMs watches for VirtualMachine resource changes
-func (k *Client) WatchVMs(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error) error {
-	gvr := schema.GroupVersionResource{
-		Group:    "virtualization.deckhouse.io",
-		Version:  "v1alpha2",
-		Resource: "virtualmachines",
+// runInformer runs one informer until ctx is cancelled, access to VMs is
+// denied, or a restart is requested (which returns nil). VMs known to the
+// previous informer but missing from the new list are delivered as DELETED,
+// and the VMs known when it stops are returned for the next informer.
+func (k *Client) runInformer(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error, previous map[string]*unstructured.Unstructured) (map[string]*unstructured.Unstructured, error) {
+	gvr := k.resource.GVR
+
+	informerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// One informer per watched namespace, so no cluster-wide access is needed
+	var factories []dynamicinformer.DynamicSharedInformerFactory
+	var informers []toolscache.SharedIndexInformer
+	for _, namespace := range k.watchedNamespaces() {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(k.client, 0, namespace, func(opts *metav1.ListOptions) {
+			opts.LabelSelector = k.selector()
+		})
+		factories = append(factories, factory)
+		informers = append(informers, factory.ForResource(gvr).Informer())
+	}
+	hasSynced := func() bool {
+		for _, informer := range informers {
+			if !informer.HasSynced() {
+				return false
+			}
+		}
+		return true
 	}
 
-	var watcher watch.Interface
-	var err error
+	deliver := func(eventType watch.EventType, obj interface{}) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+
+		if k.faults.DropEvent() {
+			log.Printf("WARN: fault injection: dropping %s event for '%s/%s'", eventType, u.GetNamespace(), u.GetName())
+			return
+		}
 
-	if k.namespace != "" {
-		watcher, err = k.client.Resource(gvr).Namespace(k.namespace).Watch(ctx, metav1.ListOptions{})
-	} else {
-		watcher, err = k.client.Resource(gvr).Watch(ctx, metav1.ListOptions{})
+		if err := handler(watch.Event{Type: eventType, Object: u}, u); err != nil {
+			log.Printf("ERROR: failed to handle %s event for '%s/%s': %v", eventType, u.GetNamespace(), u.GetName(), err)
+		}
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to start watch: %w", err)
+	handlers := toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			switch {
+			case k.matches(obj):
+				deliver(watch.Added, obj)
+			case k.matches(previousObject(previous, obj)):
+				// Stopped matching while the watch was restarting
+				deliver(watch.Deleted, obj)
+			}
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			switch {
+			case k.matches(obj):
+				deliver(watch.Modified, obj)
+			case k.matches(old):
+				deliver(watch.Deleted, obj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if k.matches(obj) {
+				deliver(watch.Deleted, obj)
+			}
+		},
 	}
-	defer watcher.Stop()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				// Channel closed, restart watch
-				time.Sleep(5 * time.Second)
-				return k.WatchVMs(ctx, handler)
+	// The informer retries failed lists and watches forever; retrying does not fix RBAC
+	denied := make(chan error, 1)
+	watchErrorHandler := func(r *toolscache.Reflector, err error) {
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			select {
+			case denied <- err:
+			default:
 			}
+		}
+		toolscache.DefaultWatchErrorHandler(r, err)
+	}
 
-			obj, ok := event.Object.(*unstructured.Unstructured)
-			if !ok {
-				continue
+	for _, informer := range informers {
+		if _, err := informer.AddEventHandler(handlers); err != nil {
+			return previous, fmt.Errorf("failed to register VM event handler: %w", err)
+		}
+		if err := informer.SetWatchErrorHandler(watchErrorHandler); err != nil {
+			return previous, fmt.Errorf("failed to register VM watch error handler: %w", err)
+		}
+	}
+
+	var forceRestart <-chan time.Time
+	if k.faults.WatchRestartInterval > 0 {
+		timer := time.NewTimer(k.faults.WatchRestartInterval)
+		defer timer.Stop()
+		forceRestart = timer.C
+	}
+
+	for _, factory := range factories {
+		factory.Start(informerCtx.Done())
+	}
+	defer func() {
+		cancel()
+		for _, factory := range factories {
+			factory.Shutdown()
+		}
+		k.synced.Store(false)
+	}()
+
+	// The stores are only complete once synced, until then keep the previous VMs
+	current := func() map[string]*unstructured.Unstructured {
+		if !hasSynced() {
+			return previous
+		}
+		known := make(map[string]*unstructured.Unstructured)
+		for _, informer := range informers {
+			for _, obj := range informer.GetStore().List() {
+				if key, err := toolscache.MetaNamespaceKeyFunc(obj); err == nil {
+					known[key] = obj.(*unstructured.Unstructured)
+				}
 			}
+		}
+		return known
+	}
 
-			if err := handler(event, obj); err != nil {
-				return err
+	go func() {
+		if !toolscache.WaitForCacheSync(informerCtx.Done(), hasSynced) {
+			return
+		}
+		known := current()
+		for key, obj := range previous {
+			if _, exists := known[key]; !exists && k.matches(obj) {
+				deliver(watch.Deleted, obj)
 			}
 		}
+		k.synced.Store(true)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return previous, ctx.Err()
+	case err := <-denied:
+		return previous, fmt.Errorf("failed to watch VMs: %w", err)
+	case <-k.restart:
+		log.Printf("Restarting VM watch with label selector '%s'", k.selector())
+		return current(), nil
+	case <-forceRestart:
+		metrics.InjectedFaultsTotal.WithLabelValues("watch_restart").Inc()
+		log.Printf("WARN: fault injection: forcing watch restart")
+		return current(), nil
 	}
 }
@@ -0,0 +1,230 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestClient returns a client on a fake dynamic client holding objs
+func newTestClient(objs ...runtime.Object) (*Client, *dynfake.FakeDynamicClient) {
+	dyn := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		DefaultVMResource.GVR: "VirtualMachineList",
+	}, objs...)
+	return NewClientForDynamic(dyn), dyn
+}
+
+// testVM returns a Deckhouse VirtualMachine object
+func testVM(namespace, name, ip string) *unstructured.Unstructured {
+	obj := map[string]interface{}{
+		"apiVersion": "virtualization.deckhouse.io/v1alpha2",
+		"kind":       "VirtualMachine",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"app": "web"},
+		},
+	}
+	if ip != "" {
+		obj["status"] = map[string]interface{}{"ipAddress": ip, "phase": "Running"}
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func TestToHost(t *testing.T) {
+	vm := DefaultVMResource.ToHost(testVM("demo", "vm-1", "10.0.0.1"))
+
+	if vm.Namespace != "demo" || vm.Name != "vm-1" || vm.IP != "10.0.0.1" || vm.Phase != "Running" {
+		t.Errorf("unexpected VM %+v", vm)
+	}
+	if !reflect.DeepEqual(vm.Labels, map[string]string{"app": "web"}) {
+		t.Errorf("labels: got %v", vm.Labels)
+	}
+	if !reflect.DeepEqual(vm.Addresses, []Address{{IP: "10.0.0.1"}}) {
+		t.Errorf("addresses: got %v", vm.Addresses)
+	}
+}
+
+func TestToHostWithoutIP(t *testing.T) {
+	vm := DefaultVMResource.ToHost(testVM("demo", "vm-1", ""))
+
+	if vm.Name != "vm-1" || vm.IP != "" || len(vm.Addresses) != 0 {
+		t.Errorf("unexpected VM %+v", vm)
+	}
+}
+
+func TestToHostWithoutMetadata(t *testing.T) {
+	vm := DefaultVMResource.ToHost(&unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":   "VirtualMachine",
+		"status": map[string]interface{}{"ipAddress": "10.0.0.1"},
+	}})
+
+	if vm.Namespace != "" || vm.Name != "" {
+		t.Errorf("got '%s/%s' for an object without metadata", vm.Namespace, vm.Name)
+	}
+	if vm.Labels == nil {
+		t.Error("labels are nil")
+	}
+}
+
+func TestForEachVM(t *testing.T) {
+	client, _ := newTestClient(testVM("demo", "vm-1", "10.0.0.1"), testVM("demo", "vm-2", ""), testVM("other", "vm-1", "10.0.1.1"))
+
+	vms, err := client.ListVMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, vm := range vms {
+		got[vm.Namespace+"/"+vm.Name] = vm.IP
+	}
+	want := map[string]string{"demo/vm-1": "10.0.0.1", "demo/vm-2": "", "other/vm-1": "10.0.1.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
+
+func TestForEachVMInNamespaces(t *testing.T) {
+	_, dyn := newTestClient(testVM("demo", "vm-1", "10.0.0.1"), testVM("other", "vm-1", "10.0.1.1"))
+	client := NewClientForDynamic(dyn, "demo")
+
+	vms, err := client.ListVMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 1 || vms[0].Namespace != "demo" {
+		t.Errorf("listed %v, want only the VM of namespace demo", vms)
+	}
+}
+
+type testEvent struct {
+	eventType watch.EventType
+	name      string
+	ip        string
+}
+
+func TestWatchVMs(t *testing.T) {
+	client, dyn := newTestClient(testVM("demo", "vm-1", "10.0.0.1"))
+	vms := dyn.Resource(DefaultVMResource.GVR).Namespace("demo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan testEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WatchVMs(ctx, func(event watch.Event, obj *unstructured.Unstructured) error {
+			vm := client.ToHost(obj)
+			events <- testEvent{event.Type, vm.Name, vm.IP}
+			return nil
+		})
+	}()
+
+	expect := func(want testEvent) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("got event %+v, want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event, want %+v", want)
+		}
+	}
+
+	// Existing VMs are delivered as ADDED on startup
+	expect(testEvent{watch.Added, "vm-1", "10.0.0.1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("VM watch did not sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := vms.Create(ctx, testVM("demo", "vm-2", ""), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(testEvent{watch.Added, "vm-2", ""})
+
+	if _, err := vms.Update(ctx, testVM("demo", "vm-2", "10.0.0.2"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(testEvent{watch.Modified, "vm-2", "10.0.0.2"})
+
+	if err := vms.Delete(ctx, "vm-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(testEvent{watch.Deleted, "vm-1", "10.0.0.1"})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("WatchVMs returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchVMs did not stop")
+	}
+}
+
+func TestVMFinalizers(t *testing.T) {
+	client, dyn := newTestClient(testVM("demo", "vm-1", "10.0.0.1"))
+	ctx := context.Background()
+	vms := dyn.Resource(DefaultVMResource.GVR).Namespace("demo")
+
+	vm, err := client.GetVM("demo", "vm-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddVMFinalizer(vm, "example.com/first"); err != nil {
+		t.Fatal(err)
+	}
+	if vm, err = client.GetVM("demo", "vm-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddVMFinalizer(vm, "example.com/second"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := vms.Get(ctx, "vm-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finalizers := obj.GetFinalizers(); !reflect.DeepEqual(finalizers, []string{"example.com/first", "example.com/second"}) {
+		t.Fatalf("finalizers: got %v", finalizers)
+	}
+
+	// A stale VM no longer matches the index it removes
+	stale := &VirtualMachine{Namespace: "demo", Name: "vm-1", Finalizers: []string{"example.com/second"}}
+	if err := client.RemoveVMFinalizer(stale, "example.com/second"); err == nil {
+		t.Error("removed a finalizer through a stale VM")
+	}
+
+	if vm, err = client.GetVM("demo", "vm-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveVMFinalizer(vm, "example.com/first"); err != nil {
+		t.Fatal(err)
+	}
+	if obj, err = vms.Get(ctx, "vm-1", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if finalizers := obj.GetFinalizers(); !reflect.DeepEqual(finalizers, []string{"example.com/second"}) {
+		t.Errorf("finalizers after removing one: got %v", finalizers)
+	}
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var configMapGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "configmaps",
+}
+
+// GetConfigMapData returns the data of a ConfigMap, nil if it does not exist
+func (k *Client) GetConfigMapData(namespace, name string) (map[string]string, error) {
+	obj, err := k.client.Resource(configMapGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	return data, nil
+}
+
+// ApplyConfigMap creates the ConfigMap or replaces its data if it changed
+func (k *Client) ApplyConfigMap(namespace, name string, labels, data map[string]string) error {
+	resource := k.client.Resource(configMapGVR).Namespace(namespace)
+
+	obj, err := resource.Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		if err := unstructured.SetNestedStringMap(obj.Object, data, "data"); err != nil {
+			return err
+		}
+		_, err = resource.Create(context.TODO(), obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Missing and empty data are the same, DeepEqual alone tells them apart
+	current, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	if len(current) == len(data) && (len(data) == 0 || reflect.DeepEqual(current, data)) {
+		return nil
+	}
+
+	if err := unstructured.SetNestedStringMap(obj.Object, data, "data"); err != nil {
+		return err
+	}
+	_, err = resource.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	return err
+}
+
+// WatchConfigMaps calls handler with the data of the ConfigMap named name in
+// every watched namespace whenever it is created or changes, and with nil
+// data once it was deleted. It returns when ctx is cancelled or access to
+// ConfigMaps is denied.
+func (k *Client) WatchConfigMaps(ctx context.Context, name string, handler func(namespace string, data map[string]string)) error {
+	tweak := func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}
+	return k.watchNamespaced(ctx, configMapGVR, tweak, func(obj *unstructured.Unstructured, deleted bool) {
+		if obj.GetName() != name {
+			return
+		}
+		if deleted {
+			handler(obj.GetNamespace(), nil)
+			return
+		}
+		data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+		if data == nil {
+			data = map[string]string{}
+		}
+		handler(obj.GetNamespace(), data)
+	})
+}
@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+)
+
+var eventGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "events",
+}
+
+// NewEventRecorder returns a recorder publishing events as component. stop
+// flushes pending events and stops publishing.
+func (k *Client) NewEventRecorder(component string) (recorder record.EventRecorder, stop func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&eventSink{client: k.client})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}), broadcaster.Shutdown
+}
+
+// eventSink writes events with the dynamic client, record.EventSink is
+// usually backed by a typed clientset
+type eventSink struct {
+	client dynamic.Interface
+}
+
+func (s *eventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	obj, err := toUnstructured(event)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.client.Resource(eventGVR).Namespace(event.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(created)
+}
+
+func (s *eventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	obj, err := toUnstructured(event)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.client.Resource(eventGVR).Namespace(event.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(updated)
+}
+
+func (s *eventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	patched, err := s.client.Resource(eventGVR).Namespace(event.Namespace).Patch(context.TODO(), event.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(patched)
+}
+
+// toUnstructured converts an event for the dynamic client
+func toUnstructured(event *corev1.Event) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Event")
+	return obj, nil
+}
+
+// fromUnstructured converts an event returned by the dynamic client
+func fromUnstructured(obj *unstructured.Unstructured) (*corev1.Event, error) {
+	event := &corev1.Event{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,41 @@
+package kubernetes
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// VMLister reads VirtualMachine resources
+type VMLister interface {
+	GetVM(namespace, name string) (*VirtualMachine, error)
+	ForEachVM(ctx context.Context, fn func(*VirtualMachine) error) error
+}
+
+// VMWatcher delivers VirtualMachine events
+type VMWatcher interface {
+	WatchVMs(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error) error
+	HasSynced() bool
+	SetLabelSelector(selector string)
+	RestartWatch()
+}
+
+// Source is one kind of object synced to AWX, e.g. VMs or Nodes
+type Source interface {
+	VMLister
+	VMWatcher
+	// ToHost converts an object delivered by WatchVMs
+	ToHost(obj *unstructured.Unstructured) *VirtualMachine
+	// GetVMObject and ForEachVMObject read the objects delivered by WatchVMs
+	GetVMObject(namespace, name string) (*unstructured.Unstructured, error)
+	ForEachVMObject(ctx context.Context, fn func(*unstructured.Unstructured) error) error
+	// GroupPrefixes are the prefixes of the groups the source puts hosts into
+	GroupPrefixes() []string
+}
+
+var (
+	_ VMLister  = (*Client)(nil)
+	_ VMWatcher = (*Client)(nil)
+	_ Source    = (*Client)(nil)
+)
@@ -0,0 +1,135 @@
+package kubernetes
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var inventorySyncGVR = schema.GroupVersionResource{
+	Group:    "awx-inventory.io",
+	Version:  "v1alpha1",
+	Resource: "awxinventorysyncs",
+}
+
+// AWXInventorySync represents an AWXInventorySync resource, which describes
+// one set of VMs synced into AWX
+type AWXInventorySync struct {
+	Name       string
+	Namespace  string
+	Generation int64
+
+	// Spec.source
+	Namespaces    []string
+	LabelSelector string
+
+	// Spec.awx, the token Secret is in the namespace of the resource
+	AWXURL         string
+	Organization   string
+	TokenSecret    string
+	TokenSecretKey string
+
+	// Spec.inventory
+	InventoryPrefix       string
+	InventoryNameTemplate string
+	SingleInventory       string
+
+	// Spec.groups
+	GroupByClass bool
+	GroupByNode  bool
+	GroupByZone  bool
+	GroupLabels  []string
+
+	// Spec.hostVars
+	HostVarsPrefix    string
+	HostVarsInclude   []string
+	HostVarsExclude   []string
+	HostVarsTemplates map[string]string
+
+	Status AWXInventorySyncStatus
+
+	obj *unstructured.Unstructured
+}
+
+// AWXInventorySyncStatus reports whether the sync of an AWXInventorySync runs
+type AWXInventorySyncStatus struct {
+	Phase              string
+	Message            string
+	ObservedGeneration int64
+}
+
+// ListInventorySyncs lists AWXInventorySync resources in all namespaces
+func (k *Client) ListInventorySyncs() ([]*AWXInventorySync, error) {
+	list, err := k.client.Resource(inventorySyncGVR).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	syncs := make([]*AWXInventorySync, 0, len(list.Items))
+	for i := range list.Items {
+		syncs = append(syncs, unstructuredToInventorySync(&list.Items[i]))
+	}
+	return syncs, nil
+}
+
+// UpdateInventorySyncStatus writes the status subresource of an AWXInventorySync
+func (k *Client) UpdateInventorySyncStatus(sync *AWXInventorySync) error {
+	obj := sync.obj.DeepCopy()
+
+	status := map[string]interface{}{
+		"phase":              sync.Status.Phase,
+		"message":            sync.Status.Message,
+		"observedGeneration": sync.Status.ObservedGeneration,
+	}
+	if err := unstructured.SetNestedMap(obj.Object, status, "status"); err != nil {
+		return err
+	}
+
+	updated, err := k.client.Resource(inventorySyncGVR).Namespace(sync.Namespace).UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	sync.obj = updated
+	return nil
+}
+
+// unstructuredToInventorySync converts unstructured.Unstructured to AWXInventorySync
+func unstructuredToInventorySync(obj *unstructured.Unstructured) *AWXInventorySync {
+	sync := &AWXInventorySync{
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Generation: obj.GetGeneration(),
+		obj:        obj,
+	}
+
+	sync.Namespaces, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "source", "namespaces")
+	sync.LabelSelector, _, _ = unstructured.NestedString(obj.Object, "spec", "source", "labelSelector")
+
+	sync.AWXURL, _, _ = unstructured.NestedString(obj.Object, "spec", "awx", "url")
+	sync.Organization, _, _ = unstructured.NestedString(obj.Object, "spec", "awx", "organization")
+	sync.TokenSecret, _, _ = unstructured.NestedString(obj.Object, "spec", "awx", "tokenSecretRef", "name")
+	sync.TokenSecretKey, _, _ = unstructured.NestedString(obj.Object, "spec", "awx", "tokenSecretRef", "key")
+
+	sync.InventoryPrefix, _, _ = unstructured.NestedString(obj.Object, "spec", "inventory", "prefix")
+	sync.InventoryNameTemplate, _, _ = unstructured.NestedString(obj.Object, "spec", "inventory", "nameTemplate")
+	sync.SingleInventory, _, _ = unstructured.NestedString(obj.Object, "spec", "inventory", "single")
+
+	sync.GroupByClass, _, _ = unstructured.NestedBool(obj.Object, "spec", "groups", "byClass")
+	sync.GroupByNode, _, _ = unstructured.NestedBool(obj.Object, "spec", "groups", "byNode")
+	sync.GroupByZone, _, _ = unstructured.NestedBool(obj.Object, "spec", "groups", "byZone")
+	sync.GroupLabels, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "groups", "labels")
+
+	sync.HostVarsPrefix, _, _ = unstructured.NestedString(obj.Object, "spec", "hostVars", "annotationPrefix")
+	sync.HostVarsInclude, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hostVars", "include")
+	sync.HostVarsExclude, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hostVars", "exclude")
+	sync.HostVarsTemplates, _, _ = unstructured.NestedStringMap(obj.Object, "spec", "hostVars", "templates")
+
+	sync.Status.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	sync.Status.Message, _, _ = unstructured.NestedString(obj.Object, "status", "message")
+	sync.Status.ObservedGeneration, _, _ = unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+
+	return sync
+}
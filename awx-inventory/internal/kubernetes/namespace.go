@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+var namespaceGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "namespaces",
+}
+
+// NamespaceExists reports whether a namespace exists
+func (k *Client) NamespaceExists(name string) (bool, error) {
+	_, err := k.client.Resource(namespaceGVR).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// WatchNamespaceDeletions calls handler with the name of every deleted
+// watched namespace until ctx is cancelled or access to namespaces is denied
+func (k *Client) WatchNamespaceDeletions(ctx context.Context, handler func(name string)) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(k.client, 0)
+	informer := factory.ForResource(namespaceGVR).Informer()
+
+	_, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok && k.watches(u.GetName()) {
+				handler(u.GetName())
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register namespace event handler: %w", err)
+	}
+	return runInformer(ctx, factory, informer, "namespaces")
+}
+
+// runInformer runs the informers of factory until ctx is cancelled or the
+// watch of informer is denied access to resource
+func runInformer(ctx context.Context, factory dynamicinformer.DynamicSharedInformerFactory, informer toolscache.SharedIndexInformer, resource string) error {
+	denied := make(chan error, 1)
+	err := informer.SetWatchErrorHandler(func(r *toolscache.Reflector, err error) {
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			select {
+			case denied <- err:
+			default:
+			}
+		}
+		toolscache.DefaultWatchErrorHandler(r, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register %s watch error handler: %w", resource, err)
+	}
+
+	informerCtx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	factory.Start(informerCtx.Done())
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-denied:
+		return fmt.Errorf("access to %s denied: %w", resource, err)
+	}
+}
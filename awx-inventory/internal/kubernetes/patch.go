@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AnnotateVM sets annotations on the object of a VM with a merge patch.
+// Empty values remove the annotation.
+func (k *Client) AnnotateVM(namespace, name string, annotations map[string]string) error {
+	values := make(map[string]interface{}, len(annotations))
+	for key, value := range annotations {
+		if value == "" {
+			values[key] = nil
+		} else {
+			values[key] = value
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": values},
+	})
+	if err != nil {
+		return err
+	}
+
+	return k.patch(namespace, name, types.MergePatchType, patch)
+}
+
+// patchVM marshals and applies a patch to the object of vm
+func (k *Client) patchVM(vm *VirtualMachine, patchType types.PatchType, patch interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return k.patch(vm.Namespace, vm.Name, patchType, data)
+}
+
+// patch applies a patch to the object the controller knows as name in namespace
+func (k *Client) patch(namespace, name string, patchType types.PatchType, data []byte) error {
+	objNamespace, objName := k.objectKey(namespace, name)
+	resource := k.client.Resource(k.resource.GVR)
+	var err error
+	if k.resource.ClusterScoped {
+		_, err = resource.Patch(context.TODO(), objName, patchType, data, metav1.PatchOptions{})
+	} else {
+		_, err = resource.Namespace(objNamespace).Patch(context.TODO(), objName, patchType, data, metav1.PatchOptions{})
+	}
+	return err
+}
+
+// AddVMFinalizer appends a finalizer to the object of a VM
+func (k *Client) AddVMFinalizer(vm *VirtualMachine, finalizer string) error {
+	op := map[string]interface{}{"op": "add", "path": "/metadata/finalizers/-", "value": finalizer}
+	if len(vm.Finalizers) == 0 {
+		op = map[string]interface{}{"op": "add", "path": "/metadata/finalizers", "value": []string{finalizer}}
+	}
+	return k.patchVM(vm, types.JSONPatchType, []interface{}{op})
+}
+
+// RemoveVMFinalizer removes a finalizer from the object of a VM, failing if
+// the finalizers changed since the VM was read
+func (k *Client) RemoveVMFinalizer(vm *VirtualMachine, finalizer string) error {
+	i := slices.Index(vm.Finalizers, finalizer)
+	if i < 0 {
+		return nil
+	}
+	path := fmt.Sprintf("/metadata/finalizers/%d", i)
+	return k.patchVM(vm, types.JSONPatchType, []interface{}{
+		map[string]interface{}{"op": "test", "path": path, "value": finalizer},
+		map[string]interface{}{"op": "remove", "path": path},
+	})
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ResourceFactory builds the resource of a source from settings looked up
+// with getenv, which returns fallback for unset keys
+type ResourceFactory func(getenv func(key, fallback string) string) (VMResource, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]ResourceFactory
+}{factories: make(map[string]ResourceFactory)}
+
+// RegisterResource makes a source available under name
+func RegisterResource(name string, factory ResourceFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.factories[name] = factory
+}
+
+// NewResource builds the resource of the source registered as name
+func NewResource(name string, getenv func(key, fallback string) string) (VMResource, error) {
+	registry.RLock()
+	factory, exists := registry.factories[name]
+	registry.RUnlock()
+	if !exists {
+		return VMResource{}, fmt.Errorf("unknown source '%s', expected one of %s", name, strings.Join(ResourceNames(), ", "))
+	}
+	resource, err := factory(getenv)
+	if err != nil {
+		return resource, err
+	}
+	if resource.AddressPolicy, err = ParseAddressPolicy(getenv("ADDRESS_POLICY", "")); err != nil {
+		return resource, fmt.Errorf("invalid ADDRESS_POLICY: %w", err)
+	}
+	return resource, nil
+}
+
+// ResourceNames returns the names of the registered sources
+func ResourceNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterResource("kubernetes", func(getenv func(string, string) string) (VMResource, error) {
+		return withVMOverrides(DefaultVMResource, getenv)
+	})
+	RegisterResource("kubevirt", func(getenv func(string, string) string) (VMResource, error) {
+		return withVMOverrides(KubeVirtVMIResource, getenv)
+	})
+	RegisterResource("nodes", func(getenv func(string, string) string) (VMResource, error) {
+		return NodeResource(getenv("NODE_INVENTORY", "nodes"), splitList(getenv("NODE_ADDRESS_TYPES", "InternalIP,ExternalIP"))), nil
+	})
+	RegisterResource("machines", func(getenv func(string, string) string) (VMResource, error) {
+		return MachineResource(splitList(getenv("MACHINE_ADDRESS_TYPES", "InternalIP,ExternalIP"))), nil
+	})
+	RegisterResource("pods", func(getenv func(string, string) string) (VMResource, error) {
+		return PodResource(getenv("EXPOSE_INVENTORY", "exposed")), nil
+	})
+	RegisterResource("services", func(getenv func(string, string) string) (VMResource, error) {
+		return ServiceResource(getenv("EXPOSE_INVENTORY", "exposed")), nil
+	})
+}
+
+// withVMOverrides applies the VM_* settings for other versions of a VM CRD
+func withVMOverrides(resource VMResource, getenv func(string, string) string) (VMResource, error) {
+	resource.GVR.Group = getenv("VM_GROUP", resource.GVR.Group)
+	resource.GVR.Version = getenv("VM_VERSION", resource.GVR.Version)
+	resource.GVR.Resource = getenv("VM_RESOURCE", resource.GVR.Resource)
+
+	var err error
+	if path := getenv("VM_IP_PATH", ""); path != "" {
+		if resource.IPPath, err = ParseFieldPath(path); err != nil {
+			return resource, fmt.Errorf("invalid VM_IP_PATH: %w", err)
+		}
+	}
+	if resource.HostnamePath, err = ParseFieldPath(getenv("VM_HOSTNAME_PATH", "")); err != nil {
+		return resource, fmt.Errorf("invalid VM_HOSTNAME_PATH: %w", err)
+	}
+	return resource, nil
+}
+
+// splitList splits a comma-separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
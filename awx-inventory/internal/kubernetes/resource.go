@@ -0,0 +1,388 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// VMResource locates the VirtualMachine resource and the fields read from it
+type VMResource struct {
+	GVR schema.GroupVersionResource
+	// Convert reads the fields specific to the resource, after name,
+	// namespace, labels and annotations
+	Convert func(obj *unstructured.Unstructured, vm *VirtualMachine)
+	// IPPath is a field holding the VM's IP address, overriding Convert
+	IPPath []string
+	// HostnamePath is a field holding the VM's hostname, empty to use the VM name
+	HostnamePath []string
+	// Namespace, if set, syncs all objects as if they were in this namespace.
+	// Namespaced objects are then named <name>.<namespace>.
+	Namespace     string
+	ClusterScoped bool
+	// Match, if set, limits synced objects to those it accepts. Objects that
+	// stop matching are delivered as deleted.
+	Match func(obj *unstructured.Unstructured) bool
+	// GroupPrefixes are the prefixes of the groups Convert puts VMs into
+	GroupPrefixes []string
+	// AddressPolicy chooses the IP among the addresses, empty to keep the
+	// IP from Convert or IPPath
+	AddressPolicy AddressPolicy
+}
+
+// DefaultVMResource is the Deckhouse virtualization VirtualMachine
+var DefaultVMResource = VMResource{
+	GVR: schema.GroupVersionResource{
+		Group:    "virtualization.deckhouse.io",
+		Version:  "v1alpha2",
+		Resource: "virtualmachines",
+	},
+	Convert: deckhouseVM,
+	IPPath:  []string{"status", "ipAddress"},
+}
+
+// KubeVirtVMIResource is the upstream KubeVirt VirtualMachineInstance
+var KubeVirtVMIResource = VMResource{
+	GVR: schema.GroupVersionResource{
+		Group:    "kubevirt.io",
+		Version:  "v1",
+		Resource: "virtualmachineinstances",
+	},
+	Convert: kubevirtVMI,
+}
+
+// NodeResource returns the resource for Kubernetes Nodes, synced into the
+// inventory of namespace. ansible_host is the first address of the given
+// types, e.g. InternalIP and ExternalIP.
+func NodeResource(namespace string, addressTypes []string) VMResource {
+	return VMResource{
+		GVR: schema.GroupVersionResource{
+			Version:  "v1",
+			Resource: "nodes",
+		},
+		Convert: func(obj *unstructured.Unstructured, vm *VirtualMachine) {
+			vm.NodeName = vm.Name
+			addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+			vm.IP = address(addresses, addressTypes)
+			vm.Addresses = typedAddresses(addresses)
+			vm.Groups = nodeRoleGroups(vm.Labels)
+		},
+		ClusterScoped: true,
+		Namespace:     namespace,
+		GroupPrefixes: []string{"role_"},
+	}
+}
+
+// MachineResource returns the resource for Cluster API Machines. Hosts are
+// named after the node of the machine once it joined its cluster, and
+// ansible_host is the first address of the given types.
+func MachineResource(addressTypes []string) VMResource {
+	return VMResource{
+		GVR: schema.GroupVersionResource{
+			Group:    "cluster.x-k8s.io",
+			Version:  "v1beta1",
+			Resource: "machines",
+		},
+		Convert: func(obj *unstructured.Unstructured, vm *VirtualMachine) {
+			vm.Hostname, _, _ = unstructured.NestedString(obj.Object, "status", "nodeRef", "name")
+			addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+			vm.IP = address(addresses, addressTypes)
+			vm.Addresses = typedAddresses(addresses)
+			if cluster := vm.Labels[machineClusterLabel]; cluster != "" {
+				vm.Groups = append(vm.Groups, "cluster_"+cluster)
+			}
+			if _, controlPlane := vm.Labels[machineControlPlaneLabel]; controlPlane {
+				vm.Groups = append(vm.Groups, "role_control_plane")
+			}
+		},
+		GroupPrefixes: []string{"cluster_", "role_"},
+	}
+}
+
+// AnnotationExpose set to "true" opts a Pod or Service into syncing
+const AnnotationExpose = "awx-inventory.io/expose"
+
+// exposed reports whether a Pod or Service opted into syncing
+func exposed(obj *unstructured.Unstructured) bool {
+	return obj.GetAnnotations()[AnnotationExpose] == "true"
+}
+
+// PodResource returns the resource for Pods annotated with AnnotationExpose,
+// synced into the inventory of namespace. The host variables let Ansible
+// reach the pod with ansible_connection=kubectl.
+func PodResource(namespace string) VMResource {
+	return VMResource{
+		GVR: schema.GroupVersionResource{
+			Version:  "v1",
+			Resource: "pods",
+		},
+		Convert: func(obj *unstructured.Unstructured, vm *VirtualMachine) {
+			vm.IP, _, _ = unstructured.NestedString(obj.Object, "status", "podIP")
+			vm.Addresses = listedAddresses(obj, "ip", "status", "podIPs")
+			vm.NodeName, _, _ = unstructured.NestedString(obj.Object, "spec", "nodeName")
+			vm.Groups = []string{"namespace_" + obj.GetNamespace()}
+			vm.Vars = map[string]interface{}{
+				"ansible_kubectl_namespace": obj.GetNamespace(),
+				"ansible_kubectl_pod":       obj.GetName(),
+			}
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+			if len(containers) > 0 {
+				if container, ok := containers[0].(map[string]interface{}); ok {
+					vm.Vars["ansible_kubectl_container"] = container["name"]
+				}
+			}
+		},
+		Namespace:     namespace,
+		Match:         exposed,
+		GroupPrefixes: []string{"namespace_"},
+	}
+}
+
+// ServiceResource returns the resource for Services annotated with
+// AnnotationExpose, synced into the inventory of namespace with their cluster IP
+func ServiceResource(namespace string) VMResource {
+	return VMResource{
+		GVR: schema.GroupVersionResource{
+			Version:  "v1",
+			Resource: "services",
+		},
+		Convert: func(obj *unstructured.Unstructured, vm *VirtualMachine) {
+			vm.IP, _, _ = unstructured.NestedString(obj.Object, "spec", "clusterIP")
+			if vm.IP == "None" {
+				vm.IP = ""
+			}
+			vm.Addresses = listedAddresses(obj, "", "spec", "clusterIPs")
+			vm.Groups = []string{"namespace_" + obj.GetNamespace()}
+		},
+		Namespace:     namespace,
+		Match:         exposed,
+		GroupPrefixes: []string{"namespace_"},
+	}
+}
+
+// Labels Cluster API sets on Machines
+const (
+	machineClusterLabel      = "cluster.x-k8s.io/cluster-name"
+	machineControlPlaneLabel = "cluster.x-k8s.io/control-plane"
+)
+
+// nodeRoleLabelPrefix marks node role labels like node-role.kubernetes.io/worker
+const nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+// nodeRoleGroups returns a role_<role> group per node role label
+func nodeRoleGroups(labels map[string]string) []string {
+	var groups []string
+	for key := range labels {
+		if role, found := strings.CutPrefix(key, nodeRoleLabelPrefix); found && role != "" {
+			groups = append(groups, "role_"+role)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// guestOS reads status.guestOSInfo, reported by Deckhouse and KubeVirt alike
+func guestOS(obj *unstructured.Unstructured) GuestOS {
+	var info GuestOS
+	info.ID, _, _ = unstructured.NestedString(obj.Object, "status", "guestOSInfo", "id")
+	info.Name, _, _ = unstructured.NestedString(obj.Object, "status", "guestOSInfo", "name")
+	info.PrettyName, _, _ = unstructured.NestedString(obj.Object, "status", "guestOSInfo", "prettyName")
+	info.Version, _, _ = unstructured.NestedString(obj.Object, "status", "guestOSInfo", "version")
+	info.KernelRelease, _, _ = unstructured.NestedString(obj.Object, "status", "guestOSInfo", "kernelRelease")
+	return info
+}
+
+// nestedCount reads a whole number, which is a float64 in objects decoded
+// with encoding/json and an int64 in those returned by client-go
+func nestedCount(obj map[string]interface{}, fields ...string) int64 {
+	value, _, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	switch n := value.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// condition returns whether the status condition of the given type is
+// True, nil if the object has no such condition
+func condition(obj *unstructured.Unstructured, conditionType string) *bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, item := range conditions {
+		entry, ok := item.(map[string]interface{})
+		if !ok || entry["type"] != conditionType {
+			continue
+		}
+		status := entry["status"] == "True"
+		return &status
+	}
+	return nil
+}
+
+// address returns the first address of a list of {type, address} entries
+// with the earliest of the given types
+func address(addresses []interface{}, types []string) string {
+	for _, addressType := range types {
+		for _, item := range addresses {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if entry["type"] == addressType {
+				if value, ok := entry["address"].(string); ok && value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// ParseFieldPath splits a dotted field path like "status.ipAddress"
+func ParseFieldPath(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	fields := strings.Split(path, ".")
+	for _, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("invalid field path '%s'", path)
+		}
+	}
+	return fields, nil
+}
+
+// ToVM converts unstructured.Unstructured to VirtualMachine
+func (r VMResource) ToHost(obj *unstructured.Unstructured) *VirtualMachine {
+	namespace, found, _ := unstructured.NestedString(obj.Object, "metadata", "namespace")
+	if !found {
+		namespace = ""
+	}
+
+	name, found, _ := unstructured.NestedString(obj.Object, "metadata", "name")
+	if !found {
+		name = ""
+	}
+
+	vm := &VirtualMachine{
+		Name:      name,
+		Namespace: namespace,
+	}
+
+	// Get labels
+	labels, found, _ := unstructured.NestedStringMap(obj.Object, "metadata", "labels")
+	if found {
+		vm.Labels = labels
+	} else {
+		vm.Labels = make(map[string]string)
+	}
+
+	vm.Annotations, _, _ = unstructured.NestedStringMap(obj.Object, "metadata", "annotations")
+	vm.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	vm.Kind = obj.GetKind()
+	vm.UID = string(obj.GetUID())
+	vm.Finalizers = obj.GetFinalizers()
+	vm.Deleting = obj.GetDeletionTimestamp() != nil
+	vm.Object = corev1.ObjectReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+	}
+
+	if r.Convert != nil {
+		r.Convert(obj, vm)
+	}
+
+	// Get IP
+	if len(r.IPPath) > 0 {
+		vm.IP, _, _ = unstructured.NestedString(obj.Object, r.IPPath...)
+	}
+
+	// The IP is the first address unless another one is preferred
+	if vm.IP != "" && !hasAddress(vm.Addresses, vm.IP) {
+		vm.Addresses = append([]Address{{IP: vm.IP}}, vm.Addresses...)
+	}
+	if ip := r.AddressPolicy.Select(vm.Addresses); ip != "" {
+		vm.IP = ip
+	}
+
+	if len(r.HostnamePath) > 0 {
+		vm.Hostname, _, _ = unstructured.NestedString(obj.Object, r.HostnamePath...)
+	}
+
+	if r.Namespace != "" {
+		if !r.ClusterScoped {
+			vm.Name += "." + vm.Namespace
+		}
+		vm.Namespace = r.Namespace
+	}
+
+	return vm
+}
+
+// deckhouseVM reads the class, node and provisioning of a Deckhouse VirtualMachine
+func deckhouseVM(obj *unstructured.Unstructured, vm *VirtualMachine) {
+	vm.ClassName, _, _ = unstructured.NestedString(obj.Object, "spec", "virtualMachineClassName")
+	vm.NodeName, _, _ = unstructured.NestedString(obj.Object, "status", "nodeName")
+	vm.UserData, _, _ = unstructured.NestedString(obj.Object, "spec", "provisioning", "userData")
+	if kind, _, _ := unstructured.NestedString(obj.Object, "spec", "provisioning", "userDataRef", "kind"); kind == "Secret" {
+		vm.UserDataSecret, _, _ = unstructured.NestedString(obj.Object, "spec", "provisioning", "userDataRef", "name")
+	}
+	vm.CPUCores = nestedCount(obj.Object, "spec", "cpu", "cores")
+	vm.Memory, _, _ = unstructured.NestedString(obj.Object, "spec", "memory", "size")
+	vm.OS = guestOS(obj)
+	vm.AgentReady = condition(obj, "AgentReady")
+}
+
+// kubevirtVMI reads the IP, node and cloud-init volume of a KubeVirt VirtualMachineInstance
+func kubevirtVMI(obj *unstructured.Unstructured, vm *VirtualMachine) {
+	vm.NodeName, _, _ = unstructured.NestedString(obj.Object, "status", "nodeName")
+
+	// The first interface with an address, usually the pod network
+	vm.Addresses = interfaceAddresses(obj)
+	if len(vm.Addresses) > 0 {
+		vm.IP = vm.Addresses[0].IP
+	}
+
+	// Cores per socket times sockets and threads, each defaulting to 1
+	if cpu, found, _ := unstructured.NestedMap(obj.Object, "spec", "domain", "cpu"); found {
+		vm.CPUCores = 1
+		for _, field := range []string{"cores", "sockets", "threads"} {
+			if n := nestedCount(cpu, field); n > 0 {
+				vm.CPUCores *= n
+			}
+		}
+	}
+	vm.Memory, _, _ = unstructured.NestedString(obj.Object, "spec", "domain", "memory", "guest")
+	if vm.Memory == "" {
+		vm.Memory, _, _ = unstructured.NestedString(obj.Object, "spec", "domain", "resources", "requests", "memory")
+	}
+	vm.OS = guestOS(obj)
+	vm.AgentReady = condition(obj, "AgentConnected")
+
+	volumes, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumes")
+	for _, item := range volumes {
+		volume, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, source := range []string{"cloudInitNoCloud", "cloudInitConfigDrive"} {
+			if _, found := volume[source]; !found {
+				continue
+			}
+			vm.UserData, _, _ = unstructured.NestedString(volume, source, "userData")
+			vm.UserDataSecret, _, _ = unstructured.NestedString(volume, source, "secretRef", "name")
+			if vm.UserDataSecret == "" {
+				vm.UserDataSecret, _, _ = unstructured.NestedString(volume, source, "userDataSecretRef", "name")
+			}
+			return
+		}
+	}
+}
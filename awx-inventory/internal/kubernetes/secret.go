@@ -0,0 +1,126 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+var secretGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "secrets",
+}
+
+// WatchSecret calls handler with the decoded data of a Secret whenever it is
+// created or changes, until ctx is cancelled or access to the Secret is denied.
+// Only this Secret is listed, so list and watch can be limited to its name.
+func (k *Client) WatchSecret(ctx context.Context, namespace, name string, handler func(data map[string][]byte)) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(k.client, 0, namespace, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	})
+	informer := factory.ForResource(secretGVR).Informer()
+
+	changed := func(obj interface{}) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetName() != name {
+			return
+		}
+		data, err := secretData(u)
+		if err != nil {
+			log.Printf("WARN: %v", err)
+			return
+		}
+		handler(data)
+	}
+	_, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: changed,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			changed(newObj)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register secret event handler: %w", err)
+	}
+	return runInformer(ctx, factory, informer, "secrets")
+}
+
+// WatchSecrets calls handler with the decoded data of every Secret matching
+// labelSelector in the watched namespaces whenever it is created or changes,
+// and with nil data once it was deleted or no longer matches. It returns
+// when ctx is cancelled or access to Secrets is denied.
+func (k *Client) WatchSecrets(ctx context.Context, labelSelector string, handler func(namespace, name string, data map[string][]byte)) error {
+	tweak := func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector
+	}
+	return k.watchNamespaced(ctx, secretGVR, tweak, func(obj *unstructured.Unstructured, deleted bool) {
+		if deleted {
+			handler(obj.GetNamespace(), obj.GetName(), nil)
+			return
+		}
+		data, err := secretData(obj)
+		if err != nil {
+			log.Printf("WARN: %v", err)
+			return
+		}
+		handler(obj.GetNamespace(), obj.GetName(), data)
+	})
+}
+
+// watchNamespaced calls handler with every object of gvr listed with tweak
+// in the watched namespaces when it is created, changes or is deleted. The
+// first watch to stop stops all of them.
+func (k *Client) watchNamespaced(ctx context.Context, gvr schema.GroupVersionResource, tweak dynamicinformer.TweakListOptionsFunc, handler func(obj *unstructured.Unstructured, deleted bool)) error {
+	namespaces := k.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stopped := make(chan error, len(namespaces))
+	for _, namespace := range namespaces {
+		go func(namespace string) {
+			stopped <- k.watchNamespace(ctx, gvr, namespace, tweak, handler)
+		}(namespace)
+	}
+	return <-stopped
+}
+
+// watchNamespace runs watchNamespaced for a single namespace
+func (k *Client) watchNamespace(ctx context.Context, gvr schema.GroupVersionResource, namespace string, tweak dynamicinformer.TweakListOptionsFunc, handler func(obj *unstructured.Unstructured, deleted bool)) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(k.client, 0, namespace, tweak)
+	informer := factory.ForResource(gvr).Informer()
+
+	_, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				handler(u, false)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if u, ok := newObj.(*unstructured.Unstructured); ok {
+				handler(u, false)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				handler(u, true)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register %s event handler: %w", gvr.Resource, err)
+	}
+	return runInformer(ctx, factory, informer, gvr.Resource)
+}
@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// EventsTotal counts processed watch events by type
+	EventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_events_total",
+		Help: "Number of VirtualMachine watch events processed.",
+	}, []string{"type"})
+
+	// SyncErrorsTotal counts failed host syncs
+	SyncErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "awx_inventory_sync_errors_total",
+		Help: "Number of failed host syncs to AWX.",
+	})
+
+	// EventPanicsTotal counts VM events whose handling panicked, by stage
+	EventPanicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_event_panics_total",
+		Help: "Number of VirtualMachine events whose handling panicked and was recovered.",
+	}, []string{"stage"})
+
+	// SyncDuration observes the duration of host syncs
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "awx_inventory_sync_duration_seconds",
+		Help:    "Duration of host syncs to AWX.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// Inventories reports the number of cached inventories
+	Inventories = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_inventories",
+		Help: "Number of AWX inventories managed by the controller.",
+	})
+
+	// ShadowDivergencesTotal counts results that differ between primary and shadow AWX
+	ShadowDivergencesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_shadow_divergences_total",
+		Help: "Number of host syncs whose result differs between the primary and shadow AWX.",
+	}, []string{"reason"})
+
+	// InjectedFaultsTotal counts faults injected for resilience testing
+	InjectedFaultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_injected_faults_total",
+		Help: "Number of faults injected for resilience testing.",
+	}, []string{"kind"})
+
+	// CacheSize reports the number of entries per internal cache
+	CacheSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awx_inventory_cache_size",
+		Help: "Number of entries in an internal cache.",
+	}, []string{"cache"})
+
+	// CacheHitsTotal counts cache lookups that found an entry
+	CacheHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_cache_hits_total",
+		Help: "Number of internal cache lookups that found an entry.",
+	}, []string{"cache"})
+
+	// CacheMissesTotal counts cache lookups that found nothing
+	CacheMissesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_cache_misses_total",
+		Help: "Number of internal cache lookups that found nothing.",
+	}, []string{"cache"})
+
+	// CacheEvictionsTotal counts entries evicted to stay within capacity
+	CacheEvictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_cache_evictions_total",
+		Help: "Number of internal cache entries evicted to stay within capacity.",
+	}, []string{"cache"})
+
+	// WorkerBusy reports whether a worker is currently processing an item
+	WorkerBusy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awx_inventory_worker_busy",
+		Help: "Whether a worker is currently processing an item (1) or idle (0).",
+	}, []string{"pool", "worker"})
+
+	// WorkerBusySeconds accumulates time workers spent processing items
+	WorkerBusySeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_worker_busy_seconds_total",
+		Help: "Time a worker spent processing items.",
+	}, []string{"pool", "worker"})
+
+	// WorkerItemsTotal counts items processed per worker
+	WorkerItemsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_worker_items_total",
+		Help: "Number of items processed by a worker.",
+	}, []string{"pool", "worker"})
+
+	// WorkerRetriesTotal counts items a worker scheduled for retry
+	WorkerRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_worker_retries_total",
+		Help: "Number of items a worker scheduled for retry.",
+	}, []string{"pool", "worker"})
+
+	// GoroutineLeakSuspected is 1 while the goroutine count stays above the leak threshold
+	GoroutineLeakSuspected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_goroutine_leak_suspected",
+		Help: "Whether the goroutine count has stayed above the leak threshold (1) or not (0).",
+	})
+
+	// LastSuccessfulReconcile is the Unix time of the last successful sync of any namespace
+	LastSuccessfulReconcile = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_last_successful_reconcile_timestamp_seconds",
+		Help: "Unix time of the last successful reconcile.",
+	})
+
+	// NamespaceLastSuccessfulReconcile is the Unix time of the last successful sync per namespace
+	NamespaceLastSuccessfulReconcile = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awx_inventory_namespace_last_successful_reconcile_timestamp_seconds",
+		Help: "Unix time of the last successful reconcile of a namespace.",
+	}, []string{"namespace"})
+
+	// HostsExpiredTotal counts hosts disabled or removed by the stale host TTL policy
+	HostsExpiredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_hosts_expired_total",
+		Help: "Number of stale hosts disabled or removed by the TTL policy.",
+	}, []string{"action"})
+
+	// BlackoutActive is 1 while a blackout window is open
+	BlackoutActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_blackout_active",
+		Help: "Whether a blackout window is open (1) or not (0).",
+	})
+
+	// DeferredEvents is the number of VM events queued during a blackout window
+	DeferredEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_deferred_events",
+		Help: "Number of VM events queued until the blackout window closes.",
+	})
+
+	// QueueDepth is the number of VMs waiting in the event workqueue
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "awx_inventory_queue_depth",
+		Help: "Number of VMs with events waiting to be applied.",
+	})
+
+	// CoalescedEventsTotal counts VM events replaced by a newer event before being applied
+	CoalescedEventsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "awx_inventory_coalesced_events_total",
+		Help: "Total number of VM events replaced by a newer event of the same VM before being applied.",
+	})
+
+	// SyncSkippedTotal counts host syncs skipped because nothing changed since the last write
+	SyncSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "awx_inventory_sync_skipped_total",
+		Help: "Total number of host syncs skipped because the desired state was unchanged.",
+	})
+
+	// JobsTotal counts finished provisioning and deprovisioning jobs by status
+	JobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_jobs_total",
+		Help: "Number of finished provisioning and deprovisioning jobs.",
+	}, []string{"kind", "status"})
+
+	// JobRetriesTotal counts relaunches of failed provisioning and deprovisioning jobs
+	JobRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_job_retries_total",
+		Help: "Number of failed provisioning and deprovisioning jobs launched again.",
+	}, []string{"kind"})
+
+	// HostPingsTotal counts finished ad hoc pings of new hosts by status
+	HostPingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_host_pings_total",
+		Help: "Number of finished ad hoc pings of new hosts.",
+	}, []string{"status"})
+
+	// AWXRateLimitedTotal counts AWX requests retried after an HTTP 429
+	AWXRateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "awx_inventory_awx_rate_limited_total",
+		Help: "Total number of AWX requests retried because AWX answered 429 Too Many Requests.",
+	})
+
+	// NotificationsTotal counts webhook notifications by event and status
+	NotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "awx_inventory_notifications_total",
+		Help: "Number of webhook notifications by event and status (sent, failed or dropped).",
+	}, []string{"event", "status"})
+
+	// AWXNotModifiedTotal counts AWX GETs answered from the response cache
+	AWXNotModifiedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "awx_inventory_awx_not_modified_total",
+		Help: "Total number of AWX requests answered 304 Not Modified and served from the response cache.",
+	})
+)
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// Events a notification is sent for
+const (
+	HostAdded        = "host_added"
+	HostRemoved      = "host_removed"
+	InventoryCreated = "inventory_created"
+	// SyncFailing is sent once the syncs of a VM failed a number of times in
+	// a row, SyncRecovered when one succeeds again
+	SyncFailing   = "sync_failing"
+	SyncRecovered = "sync_recovered"
+)
+
+// Events lists all events, the default of Config.Events
+var Events = []string{HostAdded, HostRemoved, InventoryCreated, SyncFailing, SyncRecovered}
+
+// Payload formats
+const (
+	// FormatSlack posts {"text": message} as understood by Slack incoming
+	// webhooks and compatible services like Mattermost
+	FormatSlack = "slack"
+	// FormatJSON posts the Event
+	FormatJSON = "json"
+)
+
+const (
+	// queueSize is the number of notifications waiting to be sent before
+	// new ones are dropped
+	queueSize = 100
+	// sendAttempts is how often a notification is sent before it is dropped
+	sendAttempts = 3
+	// retryDelay is the delay before the first retry, doubled after each
+	retryDelay = 2 * time.Second
+)
+
+// Event is a change worth telling a team about
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Namespace string    `json:"namespace,omitempty"`
+	VM        string    `json:"vm,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Inventory string    `json:"inventory,omitempty"`
+	// Hosts is the number of hosts of a HostAdded event for hosts created in bulk
+	Hosts int `json:"hosts,omitempty"`
+	// Failures is the number of syncs of a SyncFailing event that failed in a row
+	Failures int    `json:"failures,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Cluster identifies the controller when several post to one channel
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// Config configures a Notifier
+type Config struct {
+	URL    string
+	Format string
+	// Events are the events to send, all if empty
+	Events []string
+	// Cluster is added to every event and message
+	Cluster string
+	Timeout time.Duration
+}
+
+// Notifier posts events to a webhook. Events are sent in the background, in
+// order, so a slow or unreachable webhook never delays syncs.
+type Notifier struct {
+	url     string
+	format  string
+	cluster string
+	events  map[string]bool
+	client  *http.Client
+	queue   chan Event
+}
+
+// New validates cfg and starts sending
+func New(cfg Config) (*Notifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatSlack
+	case FormatSlack, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown format '%s', expected %s or %s", cfg.Format, FormatSlack, FormatJSON)
+	}
+	if len(cfg.Events) == 0 {
+		cfg.Events = Events
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	n := &Notifier{
+		url:     cfg.URL,
+		format:  cfg.Format,
+		cluster: cfg.Cluster,
+		events:  make(map[string]bool),
+		client:  &http.Client{Timeout: cfg.Timeout},
+		queue:   make(chan Event, queueSize),
+	}
+	for _, event := range cfg.Events {
+		if !known(event) {
+			return nil, fmt.Errorf("unknown event '%s', expected one of %s", event, strings.Join(Events, ", "))
+		}
+		n.events[event] = true
+	}
+
+	go n.run()
+	return n, nil
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether event is sent, false for a nil Notifier
+func (n *Notifier) Enabled(event string) bool {
+	return n != nil && n.events[event]
+}
+
+// Notify queues e unless its event is not selected. A nil Notifier drops it.
+func (n *Notifier) Notify(e Event) {
+	if !n.Enabled(e.Event) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Cluster = n.cluster
+
+	select {
+	case n.queue <- e:
+	default:
+		log.Printf("WARN: notification queue is full, dropping %s notification: %s", e.Event, e.Message)
+		metrics.NotificationsTotal.WithLabelValues(e.Event, "dropped").Inc()
+	}
+}
+
+// run sends queued events until the process exits
+func (n *Notifier) run() {
+	for e := range n.queue {
+		err := n.send(e)
+		for attempt, delay := 1, retryDelay; err != nil && attempt < sendAttempts; attempt, delay = attempt+1, delay*2 {
+			time.Sleep(delay)
+			err = n.send(e)
+		}
+		if err != nil {
+			log.Printf("ERROR: failed to send %s notification: %v", e.Event, err)
+			metrics.NotificationsTotal.WithLabelValues(e.Event, "failed").Inc()
+			continue
+		}
+		metrics.NotificationsTotal.WithLabelValues(e.Event, "sent").Inc()
+	}
+}
+
+// send posts e in the configured format
+func (n *Notifier) send(e Event) error {
+	var payload interface{} = e
+	if n.format == FormatSlack {
+		text := e.Message
+		if e.Cluster != "" {
+			text = fmt.Sprintf("[%s] %s", e.Cluster, text)
+		}
+		payload = map[string]string{"text": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// Webhook URLs hold their secret, keep them out of the log
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+// Package operator runs one inventory controller per AWXInventorySync resource
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/controller"
+	"github.com/fl64/ansible-demo/awx-inventory/internal/kubernetes"
+)
+
+// AWXInventorySync phases
+const (
+	phasePending = "Pending"
+	phaseRunning = "Running"
+	phaseFailed  = "Failed"
+)
+
+// defaultTokenKey is the key of the AWX token in the Secret of a sync
+const defaultTokenKey = "token"
+
+// Client is the Kubernetes API used by the operator
+type Client interface {
+	ListInventorySyncs() ([]*kubernetes.AWXInventorySync, error)
+	UpdateInventorySyncStatus(sync *kubernetes.AWXInventorySync) error
+	GetSecretData(namespace, name string) (map[string][]byte, error)
+}
+
+// Config holds the operator configuration
+type Config struct {
+	Kubernetes Client
+	// Base is the controller configuration the spec of each sync overrides
+	Base controller.Config
+	// Interval is how often AWXInventorySync resources are reconciled
+	Interval time.Duration
+	// NewController creates the controller of a sync, controller.New if nil
+	NewController func(controller.Config) (Runner, error)
+}
+
+// Runner is a controller running a single sync
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Operator starts, restarts and stops the controllers of AWXInventorySync resources
+type Operator struct {
+	k8sClient     Client
+	base          controller.Config
+	interval      time.Duration
+	newController func(controller.Config) (Runner, error)
+
+	mu    sync.Mutex
+	syncs map[string]*runningSync
+	// lastListed is when AWXInventorySyncs were last listed, zero until then
+	lastListed time.Time
+}
+
+// runningSync is the controller of one AWXInventorySync
+type runningSync struct {
+	generation int64
+	cancel     context.CancelFunc
+	done       chan struct{}
+	// err is set before done is closed if the controller stopped on its own
+	err error
+}
+
+// New creates an operator
+func New(cfg Config) *Operator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.NewController == nil {
+		cfg.NewController = func(cfg controller.Config) (Runner, error) {
+			return controller.New(cfg)
+		}
+	}
+	return &Operator{
+		k8sClient:     cfg.Kubernetes,
+		base:          cfg.Base,
+		interval:      cfg.Interval,
+		newController: cfg.NewController,
+		syncs:         make(map[string]*runningSync),
+	}
+}
+
+// Run reconciles AWXInventorySync resources until ctx is done, then stops
+// all controllers
+func (o *Operator) Run(ctx context.Context) error {
+	log.Printf("Starting AWXInventorySync reconciliation every %v", o.interval)
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.reconcile(ctx); err != nil {
+			log.Printf("ERROR: failed to reconcile AWXInventorySyncs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			o.stopAll()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile starts a controller for each new, changed or failed sync and
+// stops those of deleted syncs
+func (o *Operator) reconcile(ctx context.Context) error {
+	syncs, err := o.k8sClient.ListInventorySyncs()
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.lastListed = time.Now()
+	o.mu.Unlock()
+
+	seen := make(map[string]bool, len(syncs))
+	for _, sync := range syncs {
+		key := sync.Namespace + "/" + sync.Name
+		seen[key] = true
+
+		before := sync.Status
+		o.reconcileSync(ctx, key, sync)
+		if sync.Status == before {
+			continue
+		}
+		if err := o.k8sClient.UpdateInventorySyncStatus(sync); err != nil {
+			log.Printf("ERROR: failed to update status of AWXInventorySync '%s' in namespace '%s': %v", sync.Name, sync.Namespace, err)
+		}
+	}
+
+	for key := range o.running() {
+		if !seen[key] {
+			log.Printf("AWXInventorySync '%s' was deleted, stopping its controller", key)
+			o.stop(key)
+		}
+	}
+	return nil
+}
+
+// reconcileSync updates sync.Status in place. A started controller is
+// Pending until it still runs on the next reconciliation.
+func (o *Operator) reconcileSync(ctx context.Context, key string, sync *kubernetes.AWXInventorySync) {
+	o.mu.Lock()
+	running, exists := o.syncs[key]
+	o.mu.Unlock()
+
+	if exists {
+		select {
+		case <-running.done:
+			// Stopped on its own, report the error and start it again
+			o.stop(key)
+			if running.err == nil {
+				return
+			}
+			log.Printf("WARN: controller of AWXInventorySync '%s' stopped: %v", key, running.err)
+			sync.Status.ObservedGeneration = sync.Generation
+			sync.Status.Phase = phaseFailed
+			sync.Status.Message = running.err.Error()
+			if err := o.start(ctx, key, sync); err != nil {
+				sync.Status.Message = err.Error()
+			}
+			return
+		default:
+		}
+
+		if running.generation == sync.Generation {
+			sync.Status.Phase = phaseRunning
+			sync.Status.Message = ""
+			return
+		}
+		log.Printf("AWXInventorySync '%s' changed, restarting its controller", key)
+		o.stop(key)
+	}
+
+	sync.Status.ObservedGeneration = sync.Generation
+	if err := o.start(ctx, key, sync); err != nil {
+		sync.Status.Phase = phaseFailed
+		sync.Status.Message = err.Error()
+		return
+	}
+	sync.Status.Phase = phasePending
+	sync.Status.Message = ""
+}
+
+// start creates and runs the controller of a sync
+func (o *Operator) start(ctx context.Context, key string, sync *kubernetes.AWXInventorySync) error {
+	cfg, err := o.controllerConfig(sync)
+	if err != nil {
+		return err
+	}
+	ctrl, err := o.newController(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create controller: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	running := &runningSync{
+		generation: sync.Generation,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(running.done)
+		err := ctrl.Run(ctx)
+		if ctx.Err() == nil {
+			if err == nil {
+				err = errors.New("controller stopped")
+			}
+			running.err = err
+		}
+	}()
+
+	o.mu.Lock()
+	o.syncs[key] = running
+	o.mu.Unlock()
+	log.Printf("Started controller of AWXInventorySync '%s'", key)
+	return nil
+}
+
+// controllerConfig overrides the base configuration with the spec of a sync
+func (o *Operator) controllerConfig(sync *kubernetes.AWXInventorySync) (controller.Config, error) {
+	cfg := o.base
+
+	if sync.AWXURL != "" {
+		cfg.AWXURL = sync.AWXURL
+	}
+	if sync.TokenSecret != "" {
+		key := sync.TokenSecretKey
+		if key == "" {
+			key = defaultTokenKey
+		}
+		data, err := o.k8sClient.GetSecretData(sync.Namespace, sync.TokenSecret)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read Secret '%s': %w", sync.TokenSecret, err)
+		}
+		if len(data[key]) == 0 {
+			return cfg, fmt.Errorf("no key '%s' in Secret '%s'", key, sync.TokenSecret)
+		}
+		cfg.AWXToken = string(data[key])
+		cfg.AWXTokenFile, cfg.AWXTokenSecret = "", ""
+		cfg.AWXUsername, cfg.AWXPassword = "", ""
+		cfg.AWXOAuthClientID, cfg.AWXOAuthClientSecret = "", ""
+	}
+	if sync.Organization != "" {
+		cfg.Organization = sync.Organization
+	}
+
+	cfg.Namespaces = sync.Namespaces
+	cfg.VMLabelSelector = sync.LabelSelector
+
+	cfg.InventoryPrefix = sync.InventoryPrefix
+	cfg.SingleInventory = sync.SingleInventory
+	cfg.InventoryNameTemplate = nil
+	if sync.InventoryNameTemplate != "" {
+		tmpl, err := newTemplate("inventory_name", sync.InventoryNameTemplate)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid inventory.nameTemplate: %w", err)
+		}
+		cfg.InventoryNameTemplate = tmpl
+	}
+
+	cfg.GroupByClass = sync.GroupByClass
+	cfg.GroupByNode = sync.GroupByNode
+	cfg.GroupByZone = sync.GroupByZone
+	cfg.GroupLabels = sync.GroupLabels
+
+	if sync.HostVarsPrefix != "" {
+		cfg.HostVarsPrefix = sync.HostVarsPrefix
+	}
+	if sync.HostVarsInclude != nil {
+		cfg.HostVarsInclude = sync.HostVarsInclude
+	}
+	if sync.HostVarsExclude != nil {
+		cfg.HostVarsExclude = sync.HostVarsExclude
+	}
+	cfg.HostVarsTemplates = nil
+	for name, text := range sync.HostVarsTemplates {
+		tmpl, err := newTemplate(name, text)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid template of host variable '%s': %w", name, err)
+		}
+		if cfg.HostVarsTemplates == nil {
+			cfg.HostVarsTemplates = make(map[string]*template.Template)
+		}
+		cfg.HostVarsTemplates[name] = tmpl
+	}
+
+	// Process-wide features run once, not per sync
+	cfg.AnsibleJobs = false
+	cfg.SnapshotStore = nil
+	cfg.InventoryMapConfigMap = ""
+	cfg.Backends = nil
+	cfg.DisableAWX = false
+	cfg.Source = nil
+	return cfg, nil
+}
+
+// newTemplate parses a template the way the controller flags are parsed
+func newTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// running returns the keys of the syncs with a controller
+func (o *Operator) running() map[string]bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	keys := make(map[string]bool, len(o.syncs))
+	for key := range o.syncs {
+		keys[key] = true
+	}
+	return keys
+}
+
+// stop stops the controller of a sync and waits for it to return, so two
+// controllers never write the same inventories
+func (o *Operator) stop(key string) {
+	o.mu.Lock()
+	running, exists := o.syncs[key]
+	delete(o.syncs, key)
+	o.mu.Unlock()
+
+	if exists {
+		running.cancel()
+		<-running.done
+	}
+}
+
+// stopAll stops the controllers of all syncs
+func (o *Operator) stopAll() {
+	for key := range o.running() {
+		o.stop(key)
+	}
+}
+
+// HealthHandler serves the liveness probe, failing if AWXInventorySyncs
+// were not listed for three intervals
+func (o *Operator) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.mu.Lock()
+		lastListed := o.lastListed
+		o.mu.Unlock()
+
+		if !lastListed.IsZero() && time.Since(lastListed) > 3*o.interval {
+			http.Error(w, fmt.Sprintf("AWXInventorySyncs last listed %v ago", time.Since(lastListed).Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+// ReadyHandler serves the readiness probe, ready once AWXInventorySyncs were listed
+func (o *Operator) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.mu.Lock()
+		listed := !o.lastListed.IsZero()
+		o.mu.Unlock()
+
+		if !listed {
+			http.Error(w, "AWXInventorySyncs not listed yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
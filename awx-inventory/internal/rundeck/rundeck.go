@@ -0,0 +1,178 @@
+package rundeck
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config configures the Rundeck backend
+type Config struct {
+	URL     string
+	Token   string
+	Project string
+	// SourceIndex is the index of a writable file node source in the project
+	SourceIndex int
+	// SyncInterval is how often pending node changes are pushed
+	SyncInterval time.Duration
+}
+
+// Node is a Rundeck node in the resourcejson format
+type Node map[string]string
+
+// Backend keeps the node set of all VMs and pushes it to a Rundeck node source.
+// Changes are batched: the full set is diffed against the last push and only
+// uploaded when it differs.
+type Backend struct {
+	cfg    Config
+	client *http.Client
+
+	mu    sync.Mutex
+	nodes map[string]Node
+	// lastPushed is the hash of the last uploaded node set
+	lastPushed [sha256.Size]byte
+}
+
+// New creates a new Rundeck backend
+func New(cfg Config) (*Backend, error) {
+	if cfg.URL == "" || cfg.Token == "" || cfg.Project == "" {
+		return nil, fmt.Errorf("Rundeck URL, token and project are required")
+	}
+	if cfg.SourceIndex <= 0 {
+		cfg.SourceIndex = 1
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = 10 * time.Second
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+
+	return &Backend{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		nodes: make(map[string]Node),
+	}, nil
+}
+
+// UpsertHost adds or updates the node for a host
+func (b *Backend) UpsertHost(namespace, hostName string, hostVars map[string]interface{}) error {
+	node := Node{
+		"nodename": nodeName(namespace, hostName),
+		"hostname": fmt.Sprint(hostVars["ansible_host"]),
+	}
+
+	tags := []string{namespace}
+	if labels, ok := hostVars["labels"].(map[string]string); ok {
+		for k, v := range labels {
+			tags = append(tags, k+"="+v)
+		}
+	}
+	sort.Strings(tags)
+	node["tags"] = strings.Join(tags, ",")
+
+	for k, v := range hostVars {
+		if k == "labels" || k == "ansible_host" {
+			continue
+		}
+		switch value := v.(type) {
+		case string:
+			node[k] = value
+		default:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			node[k] = string(data)
+		}
+	}
+
+	b.mu.Lock()
+	b.nodes[node["nodename"]] = node
+	b.mu.Unlock()
+	return nil
+}
+
+// RemoveHost removes the node of a host
+func (b *Backend) RemoveHost(namespace, hostName string) error {
+	b.mu.Lock()
+	delete(b.nodes, nodeName(namespace, hostName))
+	b.mu.Unlock()
+	return nil
+}
+
+// Run pushes node set changes every SyncInterval until ctx is cancelled
+func (b *Backend) Run(ctx context.Context) {
+	log.Printf("Pushing nodes to Rundeck project '%s' every %v", b.cfg.Project, b.cfg.SyncInterval)
+
+	ticker := time.NewTicker(b.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.push(); err != nil {
+			log.Printf("ERROR: failed to push nodes to Rundeck: %v", err)
+		}
+	}
+}
+
+// push uploads the node set if it changed since the last push
+func (b *Backend) push() error {
+	b.mu.Lock()
+	// encoding/json sorts map keys, so equal sets produce equal bytes
+	data, err := json.Marshal(b.nodes)
+	count := len(b.nodes)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(data)
+	if hash == b.lastPushed {
+		return nil
+	}
+
+	urlStr := fmt.Sprintf("%s/api/41/project/%s/source/%d/resources", b.cfg.URL, url.PathEscape(b.cfg.Project), b.cfg.SourceIndex)
+	req, err := http.NewRequest("POST", urlStr, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Rundeck-Auth-Token", b.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	b.lastPushed = hash
+	log.Printf("Pushed %d nodes to Rundeck project '%s'", count, b.cfg.Project)
+	return nil
+}
+
+// nodeName keeps node names unique across namespaces
+func nodeName(namespace, hostName string) string {
+	return hostName + "." + namespace
+}
@@ -0,0 +1,185 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Config configures local playbook execution
+type Config struct {
+	// DataDir is the ansible-runner private data dir
+	DataDir string
+	// ProjectDir holds the playbooks, defaults to DataDir/project
+	ProjectDir string
+	// Playbook is run against each new host, relative to ProjectDir
+	Playbook string
+	// Command is "ansible-runner" or "ansible-playbook"
+	Command string
+}
+
+// Runner renders a local inventory and runs a playbook against new hosts
+type Runner struct {
+	cfg Config
+
+	mu sync.Mutex
+	// hosts by namespace and name
+	hosts map[string]map[string]map[string]interface{}
+	// runMu serializes playbook runs
+	runMu sync.Mutex
+}
+
+// New creates a new runner and its private data dir
+func New(cfg Config) (*Runner, error) {
+	if cfg.Playbook == "" {
+		return nil, fmt.Errorf("playbook is required")
+	}
+	if cfg.Command == "" {
+		cfg.Command = "ansible-runner"
+	}
+	if cfg.Command != "ansible-runner" && cfg.Command != "ansible-playbook" {
+		return nil, fmt.Errorf("unsupported command '%s'", cfg.Command)
+	}
+	if cfg.ProjectDir == "" {
+		cfg.ProjectDir = filepath.Join(cfg.DataDir, "project")
+	}
+
+	for _, dir := range []string{filepath.Join(cfg.DataDir, "inventory"), filepath.Join(cfg.DataDir, "env"), cfg.ProjectDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory '%s': %w", dir, err)
+		}
+	}
+
+	if _, err := exec.LookPath(cfg.Command); err != nil {
+		log.Printf("WARN: '%s' not found in PATH, playbook runs will fail", cfg.Command)
+	}
+
+	return &Runner{
+		cfg:   cfg,
+		hosts: make(map[string]map[string]map[string]interface{}),
+	}, nil
+}
+
+// UpsertHost adds or updates a host in the local inventory. The playbook is
+// run in the background, limited to the host, if the host is new or its
+// ansible_host changed.
+func (r *Runner) UpsertHost(namespace, hostName string, hostVars map[string]interface{}) error {
+	r.mu.Lock()
+	if r.hosts[namespace] == nil {
+		r.hosts[namespace] = make(map[string]map[string]interface{})
+	}
+	previous, existed := r.hosts[namespace][hostName]
+	r.hosts[namespace][hostName] = hostVars
+	err := r.writeInventory()
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if !existed || previous["ansible_host"] != hostVars["ansible_host"] {
+		go r.run(hostName)
+	}
+	return nil
+}
+
+// RemoveHost removes a host from the local inventory
+func (r *Runner) RemoveHost(namespace, hostName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.hosts[namespace][hostName]; !exists {
+		return nil
+	}
+	delete(r.hosts[namespace], hostName)
+	if len(r.hosts[namespace]) == 0 {
+		delete(r.hosts, namespace)
+	}
+	return r.writeInventory()
+}
+
+// inventoryPath is the rendered JSON inventory
+func (r *Runner) inventoryPath() string {
+	return filepath.Join(r.cfg.DataDir, "inventory", "hosts.json")
+}
+
+// writeInventory renders hosts as a JSON inventory with one group per namespace.
+// Callers must hold r.mu.
+func (r *Runner) writeInventory() error {
+	children := make(map[string]interface{}, len(r.hosts))
+	for namespace, hosts := range r.hosts {
+		children[namespace] = map[string]interface{}{
+			"hosts": hosts,
+		}
+	}
+	inventory := map[string]interface{}{
+		"all": map[string]interface{}{
+			"children": children,
+		},
+	}
+
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so a running playbook never reads a partial file
+	tmp := r.inventoryPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.inventoryPath())
+}
+
+// run executes the playbook limited to hostName
+func (r *Runner) run(hostName string) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	var args []string
+	if r.cfg.Command == "ansible-runner" {
+		args = []string{"run", r.cfg.DataDir,
+			"--project-dir", r.cfg.ProjectDir,
+			"--inventory", r.inventoryPath(),
+			"-p", r.cfg.Playbook,
+			"--limit", hostName,
+		}
+	} else {
+		args = []string{"-i", r.inventoryPath(),
+			"--limit", hostName,
+			filepath.Join(r.cfg.ProjectDir, r.cfg.Playbook),
+		}
+	}
+
+	log.Printf("Running '%s' against host '%s'", r.cfg.Playbook, hostName)
+	cmd := exec.Command(r.cfg.Command, args...)
+	cmd.Dir = r.cfg.ProjectDir
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("ERROR: failed to run playbook for host '%s': %v", hostName, err)
+		return
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("ERROR: failed to run playbook for host '%s': %v", hostName, err)
+		return
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		log.Printf("[%s] %s", hostName, scanner.Text())
+	}
+
+	if err := cmd.Wait(); err != nil {
+		log.Printf("ERROR: playbook '%s' failed for host '%s': %v", r.cfg.Playbook, hostName, err)
+		return
+	}
+	log.Printf("Playbook '%s' finished for host '%s'", r.cfg.Playbook, hostName)
+}
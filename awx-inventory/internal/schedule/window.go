@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring period that opens at every match of a schedule
+// and stays open for a fixed duration
+type Window struct {
+	Schedule *Schedule
+	Duration time.Duration
+}
+
+// ParseWindows parses a semicolon-separated list of "<cron>=<duration>"
+// windows, e.g. "0 2 * * *=30m;0 0 * * 6=4h"
+func ParseWindows(spec string) ([]Window, error) {
+	var windows []Window
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid window '%s': expected <cron>=<duration>", item)
+		}
+
+		sched, err := Parse(item[:i])
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(item[i+1:]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window '%s': bad duration", item)
+		}
+
+		windows = append(windows, Window{Schedule: sched, Duration: d})
+	}
+	return windows, nil
+}
+
+// Active reports whether t falls within an occurrence of the window
+func (w Window) Active(t time.Time) bool {
+	start := t.Add(-w.Duration)
+	for m := t.Truncate(time.Minute); m.After(start); m = m.Add(-time.Minute) {
+		if w.Schedule.Matches(m) {
+			return true
+		}
+	}
+	return false
+}
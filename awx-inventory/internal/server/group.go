@@ -0,0 +1,63 @@
+package server
+
+import "strings"
+
+// Disabled is the address value that turns a listener off
+const Disabled = "0"
+
+// Group manages listeners that share TLS and auth options.
+// Endpoints configured with the same address are served by one listener.
+type Group struct {
+	opts    Options
+	servers map[string]*Server
+	order   []string
+}
+
+// NewGroup creates a new listener group
+func NewGroup(opts Options) *Group {
+	return &Group{
+		opts:    opts,
+		servers: make(map[string]*Server),
+	}
+}
+
+// Listener returns the server for addr, creating it if needed.
+// It returns nil if addr is Disabled.
+func (g *Group) Listener(name, addr string) (*Server, error) {
+	if addr == Disabled {
+		return nil, nil
+	}
+
+	if srv, exists := g.servers[addr]; exists {
+		srv.opts.Name = strings.Join([]string{srv.opts.Name, name}, "+")
+		return srv, nil
+	}
+
+	opts := g.opts
+	opts.Name = name
+	opts.Addr = addr
+	srv, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	g.servers[addr] = srv
+	g.order = append(g.order, addr)
+	return srv, nil
+}
+
+// ListenAndServe starts all listeners and returns the first error
+func (g *Group) ListenAndServe() error {
+	errChan := make(chan error, len(g.order))
+	for _, addr := range g.order {
+		srv := g.servers[addr]
+		go func() {
+			errChan <- srv.ListenAndServe()
+		}()
+	}
+
+	if len(g.order) == 0 {
+		return nil
+	}
+	return <-errChan
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configures the HTTP server
+type Options struct {
+	Addr string
+	// Name identifies the listener in logs
+	Name string
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// AuthToken enables bearer-token auth when set
+	AuthToken string
+	// AuthTokenFile is read on every request so mounted Secrets can be rotated
+	AuthTokenFile string
+}
+
+// Server serves metrics, debug and status endpoints
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+}
+
+// New creates a new server
+func New(opts Options) (*Server, error) {
+	if (opts.TLSCertFile == "") != (opts.TLSKeyFile == "") {
+		return nil, fmt.Errorf("both TLS certificate and key files must be set")
+	}
+
+	return &Server{
+		opts: opts,
+		mux:  http.NewServeMux(),
+	}, nil
+}
+
+// Handle registers a handler that requires authentication
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.authenticate(handler))
+}
+
+// HandlePublic registers a handler that is served without authentication
+func (s *Server) HandlePublic(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleDebug registers the pprof handlers under /debug/pprof/
+func (s *Server) HandleDebug() {
+	s.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	s.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	s.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	s.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	s.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+}
+
+// ListenAndServe starts serving requests
+func (s *Server) ListenAndServe() error {
+	srv := &http.Server{
+		Addr:              s.opts.Addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if s.opts.TLSCertFile != "" {
+		log.Printf("Serving %s over HTTPS on %s", s.opts.Name, s.opts.Addr)
+		return srv.ListenAndServeTLS(s.opts.TLSCertFile, s.opts.TLSKeyFile)
+	}
+
+	log.Printf("Serving %s over HTTP on %s", s.opts.Name, s.opts.Addr)
+	return srv.ListenAndServe()
+}
+
+// authenticate wraps handler with bearer-token auth if a token is configured
+func (s *Server) authenticate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected, err := s.token()
+		if err != nil {
+			log.Printf("ERROR: failed to read auth token: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if expected != "" {
+			got, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !bearer || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// token returns the expected bearer token, empty if auth is disabled
+func (s *Server) token() (string, error) {
+	if s.opts.AuthTokenFile != "" {
+		data, err := os.ReadFile(s.opts.AuthTokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return s.opts.AuthToken, nil
+}
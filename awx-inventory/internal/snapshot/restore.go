@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"sigs.k8s.io/yaml"
+)
+
+// RestoreStats summarizes a restore run
+type RestoreStats struct {
+	Inventories int
+	Hosts       int
+	Groups      int
+}
+
+// Restore re-creates the inventories, hosts, groups and variables of a snapshot in AWX.
+// Existing objects are updated in place; objects that are not in the snapshot are left alone.
+// With dryRun set, no changes are made and the planned actions are logged.
+func Restore(ctx context.Context, client Client, snap *Snapshot, dryRun bool) (RestoreStats, error) {
+	var stats RestoreStats
+
+	orgID, err := client.GetOrganizationID(ctx, snap.Organization)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get organization ID: %w", err)
+	}
+
+	for _, inv := range snap.Inventories {
+		invID, err := client.GetInventoryID(ctx, inv.Name)
+		if err != nil {
+			return stats, fmt.Errorf("failed to get inventory '%s': %w", inv.Name, err)
+		}
+
+		if dryRun {
+			action := "update"
+			if invID == 0 {
+				action = "create"
+			}
+			log.Printf("[dry-run] Would %s inventory '%s' with %d hosts and %d groups", action, inv.Name, len(inv.Hosts), len(inv.Groups))
+			stats.Inventories++
+			stats.Hosts += len(inv.Hosts)
+			stats.Groups += len(inv.Groups)
+			continue
+		}
+
+		if invID == 0 {
+			invID, err = client.CreateInventory(ctx, inv.Name, inv.Description, orgID)
+			if err != nil {
+				return stats, fmt.Errorf("failed to create inventory '%s': %w", inv.Name, err)
+			}
+			log.Printf("Created inventory '%s' with ID: %d", inv.Name, invID)
+		}
+
+		if inv.Variables != "" {
+			vars, err := parseVariables(inv.Variables)
+			if err != nil {
+				return stats, fmt.Errorf("failed to parse variables of inventory '%s': %w", inv.Name, err)
+			}
+			if err := client.SetInventoryVariables(ctx, invID, vars); err != nil {
+				return stats, err
+			}
+		}
+		stats.Inventories++
+
+		for _, host := range inv.Hosts {
+			vars, err := parseVariables(host.Variables)
+			if err != nil {
+				return stats, fmt.Errorf("failed to parse variables of host '%s': %w", host.Name, err)
+			}
+			if _, err := client.CreateOrUpdateHost(ctx, invID, host.Name, vars, host.Enabled, host.Description); err != nil {
+				return stats, fmt.Errorf("failed to restore host '%s': %w", host.Name, err)
+			}
+			stats.Hosts++
+		}
+
+		for _, group := range inv.Groups {
+			groupID, err := client.GetOrCreateGroup(ctx, invID, group.Name, group.Description)
+			if err != nil {
+				return stats, fmt.Errorf("failed to restore group '%s': %w", group.Name, err)
+			}
+
+			if group.Variables != "" {
+				vars, err := parseVariables(group.Variables)
+				if err != nil {
+					return stats, fmt.Errorf("failed to parse variables of group '%s': %w", group.Name, err)
+				}
+				if err := client.SetGroupVariables(ctx, groupID, vars); err != nil {
+					return stats, err
+				}
+			}
+
+			for _, hostName := range group.Hosts {
+				hostID, err := client.GetHostID(ctx, invID, hostName)
+				if err != nil || hostID == 0 {
+					log.Printf("WARN: host '%s' of group '%s' not found, skipping membership", hostName, group.Name)
+					continue
+				}
+				if err := client.AddHostToGroup(ctx, groupID, hostID); err != nil {
+					return stats, fmt.Errorf("failed to add host '%s' to group '%s': %w", hostName, group.Name, err)
+				}
+			}
+			stats.Groups++
+		}
+
+		log.Printf("Restored inventory '%s': %d hosts, %d groups", inv.Name, len(inv.Hosts), len(inv.Groups))
+	}
+
+	return stats, nil
+}
+
+// parseVariables parses AWX variables, which may be stored as JSON or YAML
+func parseVariables(data string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	if data == "" {
+		return vars, nil
+	}
+	if err := yaml.Unmarshal([]byte(data), &vars); err != nil {
+		return nil, err
+	}
+	if vars == nil {
+		// An empty YAML document decodes to nil
+		vars = make(map[string]interface{})
+	}
+	return vars, nil
+}
@@ -0,0 +1,213 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/awx"
+)
+
+// Client is the AWX API used to collect and restore snapshots, implemented by *awx.Client
+type Client interface {
+	GetOrganizationID(ctx context.Context, name string) (int, error)
+	GetInventoryID(ctx context.Context, name string) (int, error)
+	CreateInventory(ctx context.Context, name, description string, orgID int) (int, error)
+	GetInventoryVariables(ctx context.Context, invID int) (string, error)
+	SetInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error
+
+	GetHostID(ctx context.Context, invID int, hostName string) (int, error)
+	ForEachHost(ctx context.Context, invID int, fn func(awx.Host) error) error
+	CreateOrUpdateHost(ctx context.Context, invID int, hostName string, hostVars map[string]interface{}, enabled bool, description string) (int, error)
+
+	ListGroups(ctx context.Context, invID int) ([]awx.Group, error)
+	ListGroupHosts(ctx context.Context, groupID int) ([]awx.Host, error)
+	GetOrCreateGroup(ctx context.Context, invID int, groupName, description string) (int, error)
+	SetGroupVariables(ctx context.Context, groupID int, vars map[string]interface{}) error
+	AddHostToGroup(ctx context.Context, groupID, hostID int) error
+}
+
+// Snapshot is a serialized view of the managed AWX inventories
+type Snapshot struct {
+	Timestamp    time.Time   `json:"timestamp"`
+	Organization string      `json:"organization"`
+	Inventories  []Inventory `json:"inventories"`
+}
+
+// Inventory is a snapshot of a single inventory
+type Inventory struct {
+	Name        string  `json:"name"`
+	Namespace   string  `json:"namespace"`
+	Description string  `json:"description,omitempty"`
+	Variables   string  `json:"variables,omitempty"`
+	Hosts       []Host  `json:"hosts"`
+	Groups      []Group `json:"groups"`
+}
+
+// Host is a snapshot of a single host
+type Host struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Variables   string `json:"variables,omitempty"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// Group is a snapshot of a single group and its direct host members
+type Group struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Variables   string   `json:"variables,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`
+}
+
+// ManagedInventory identifies an inventory to include in a snapshot
+type ManagedInventory struct {
+	ID          int
+	Name        string
+	Namespace   string
+	Description string
+}
+
+// Collect reads the state of the given inventories from AWX
+func Collect(ctx context.Context, client Client, organization string, inventories []ManagedInventory) (*Snapshot, error) {
+	snap := &Snapshot{
+		Timestamp:    time.Now().UTC(),
+		Organization: organization,
+	}
+
+	for _, managed := range inventories {
+		inv := Inventory{
+			Name:        managed.Name,
+			Namespace:   managed.Namespace,
+			Description: managed.Description,
+		}
+
+		vars, err := client.GetInventoryVariables(ctx, managed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variables of inventory '%s': %w", managed.Name, err)
+		}
+		inv.Variables = vars
+
+		err = client.ForEachHost(ctx, managed.ID, func(h awx.Host) error {
+			inv.Hosts = append(inv.Hosts, Host{
+				Name:        h.Name,
+				Description: h.Description,
+				Variables:   h.Variables,
+				Enabled:     h.Enabled,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list hosts of inventory '%s': %w", managed.Name, err)
+		}
+
+		groups, err := client.ListGroups(ctx, managed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups of inventory '%s': %w", managed.Name, err)
+		}
+		for _, g := range groups {
+			members, err := client.ListGroupHosts(ctx, g.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list hosts of group '%s': %w", g.Name, err)
+			}
+
+			group := Group{
+				Name:        g.Name,
+				Description: g.Description,
+				Variables:   g.Variables,
+			}
+			for _, m := range members {
+				group.Hosts = append(group.Hosts, m.Name)
+			}
+			sort.Strings(group.Hosts)
+			inv.Groups = append(inv.Groups, group)
+		}
+
+		snap.Inventories = append(snap.Inventories, inv)
+	}
+
+	sort.Slice(snap.Inventories, func(i, j int) bool {
+		return snap.Inventories[i].Name < snap.Inventories[j].Name
+	})
+
+	return snap, nil
+}
+
+// Store keeps snapshots in S3 under a key prefix
+type Store struct {
+	s3     *S3Client
+	prefix string
+	retain int
+}
+
+// NewStore creates a new snapshot store. retain <= 0 keeps every snapshot.
+func NewStore(s3 *S3Client, prefix string, retain int) *Store {
+	return &Store{
+		s3:     s3,
+		prefix: prefix,
+		retain: retain,
+	}
+}
+
+// Save uploads a snapshot and prunes old ones beyond the retention count
+func (s *Store) Save(snap *Snapshot) (string, error) {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	key := s.prefix + "snapshot-" + snap.Timestamp.Format("20060102T150405Z") + ".json"
+	if err := s.s3.PutObject(key, data, "application/json"); err != nil {
+		return "", err
+	}
+
+	if s.retain > 0 {
+		keys, err := s.List()
+		if err != nil {
+			return key, fmt.Errorf("failed to list snapshots for retention: %w", err)
+		}
+		for len(keys) > s.retain {
+			if err := s.s3.DeleteObject(keys[0]); err != nil {
+				return key, fmt.Errorf("failed to delete old snapshot '%s': %w", keys[0], err)
+			}
+			log.Printf("Deleted old snapshot '%s'", keys[0])
+			keys = keys[1:]
+		}
+	}
+
+	return key, nil
+}
+
+// List returns the keys of stored snapshots, oldest first
+func (s *Store) List() ([]string, error) {
+	keys, err := s.s3.ListObjects(s.prefix + "snapshot-")
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".json") {
+			snapshots = append(snapshots, key)
+		}
+	}
+	return snapshots, nil
+}
+
+// Load downloads and parses the snapshot stored under key
+func (s *Store) Load(key string) (*Snapshot, error) {
+	data, err := s.s3.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot '%s': %w", key, err)
+	}
+	return &snap, nil
+}
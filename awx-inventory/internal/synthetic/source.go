@@ -0,0 +1,194 @@
+package synthetic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Config describes the fake VMs to generate
+type Config struct {
+	Count      int
+	Namespaces []string
+	// Templates are rendered with .Index, .Namespace and .IP
+	NameTemplate   string
+	IPTemplate     string
+	LabelTemplates map[string]string
+	// ChurnInterval modifies a random VM this often, 0 disables churn
+	ChurnInterval time.Duration
+}
+
+// Source fabricates VirtualMachine events without a cluster
+type Source struct {
+	cfg    Config
+	name   *template.Template
+	ip     *template.Template
+	labels map[string]*template.Template
+}
+
+// templateData is passed to the name, IP and label templates
+type templateData struct {
+	Index     int
+	Namespace string
+	IP        string
+	Churn     int
+}
+
+var funcs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"mod": func(a, b int) int { return a % b },
+	"div": func(a, b int) int { return a / b },
+}
+
+// NewSource creates a new synthetic source
+func NewSource(cfg Config) (*Source, error) {
+	if cfg.Count <= 0 {
+		return nil, fmt.Errorf("synthetic VM count must be positive")
+	}
+	if len(cfg.Namespaces) == 0 {
+		cfg.Namespaces = []string{"demo"}
+	}
+	if cfg.NameTemplate == "" {
+		cfg.NameTemplate = "vm-{{ .Index }}"
+	}
+	if cfg.IPTemplate == "" {
+		cfg.IPTemplate = "{{ .IP }}"
+	}
+
+	s := &Source{
+		cfg:    cfg,
+		labels: make(map[string]*template.Template),
+	}
+
+	var err error
+	if s.name, err = template.New("name").Funcs(funcs).Parse(cfg.NameTemplate); err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	if s.ip, err = template.New("ip").Funcs(funcs).Parse(cfg.IPTemplate); err != nil {
+		return nil, fmt.Errorf("invalid IP template: %w", err)
+	}
+	for key, text := range cfg.LabelTemplates {
+		if s.labels[key], err = template.New(key).Funcs(funcs).Parse(text); err != nil {
+			return nil, fmt.Errorf("invalid template for label '%s': %w", key, err)
+		}
+	}
+
+	return s, nil
+}
+
+// ParseLabelTemplates parses "key=template,key=template"
+func ParseLabelTemplates(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if value == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		key, text, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label template '%s': expected key=template", pair)
+		}
+		labels[strings.TrimSpace(key)] = text
+	}
+	return labels, nil
+}
+
+// WatchVMs sends an ADDED event for every synthetic VM, then optional churn
+// MODIFIED events, until ctx is cancelled
+func (s *Source) WatchVMs(ctx context.Context, handler func(watch.Event, *unstructured.Unstructured) error) error {
+	log.Printf("Generating %d synthetic VMs in namespaces %v", s.cfg.Count, s.cfg.Namespaces)
+
+	for i := 0; i < s.cfg.Count; i++ {
+		obj, err := s.vm(i, 0)
+		if err != nil {
+			return err
+		}
+		if err := handler(watch.Event{Type: watch.Added, Object: obj}, obj); err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.ChurnInterval <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.cfg.ChurnInterval)
+	defer ticker.Stop()
+
+	for churn := 1; ; churn++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		obj, err := s.vm(rand.Intn(s.cfg.Count), churn)
+		if err != nil {
+			return err
+		}
+		if err := handler(watch.Event{Type: watch.Modified, Object: obj}, obj); err != nil {
+			return err
+		}
+	}
+}
+
+// vm renders the synthetic VM with the given index
+func (s *Source) vm(index, churn int) (*unstructured.Unstructured, error) {
+	data := templateData{
+		Index:     index,
+		Namespace: s.cfg.Namespaces[index%len(s.cfg.Namespaces)],
+		IP:        fmt.Sprintf("10.%d.%d.%d", 200+(index>>16)&0x3f, (index>>8)&0xff, index&0xff),
+		Churn:     churn,
+	}
+
+	name, err := render(s.name, data)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := render(s.ip, data)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]interface{}{
+		"awx-inventory.io/synthetic": "true",
+	}
+	for key, tmpl := range s.labels {
+		value, err := render(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "virtualization.deckhouse.io/v1alpha2",
+			"kind":       "VirtualMachine",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": data.Namespace,
+				"labels":    labels,
+			},
+			"status": map[string]interface{}{
+				"ipAddress": ip,
+			},
+		},
+	}, nil
+}
+
+func render(tmpl *template.Template, data templateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template '%s': %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,41 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// WatchGoroutines flags a suspected goroutine leak when the goroutine count
+// stays more than threshold above the startup baseline for three checks in a row
+func WatchGoroutines(ctx context.Context, interval time.Duration, threshold int) {
+	baseline := runtime.NumGoroutine()
+	exceeded := 0
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		count := runtime.NumGoroutine()
+		if count > baseline+threshold {
+			exceeded++
+		} else {
+			exceeded = 0
+			metrics.GoroutineLeakSuspected.Set(0)
+		}
+
+		if exceeded == 3 {
+			metrics.GoroutineLeakSuspected.Set(1)
+			log.Printf("WARN: possible goroutine leak: %d goroutines, baseline %d, threshold %d", count, baseline, threshold)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package workers
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fl64/ansible-demo/awx-inventory/internal/metrics"
+)
+
+// Pool tracks instrumentation for a set of workers
+type Pool struct {
+	name string
+
+	mu      sync.Mutex
+	workers map[int]*Worker
+}
+
+// Worker records what a single worker goroutine is doing
+type Worker struct {
+	pool *Pool
+	id   string
+
+	mu         sync.Mutex
+	currentKey string
+	startedAt  time.Time
+	items      int64
+	retries    int64
+	busy       time.Duration
+}
+
+// Stats is a point-in-time view of a worker
+type Stats struct {
+	ID          string     `json:"id"`
+	CurrentKey  string     `json:"currentKey,omitempty"`
+	BusySince   *time.Time `json:"busySince,omitempty"`
+	Items       int64      `json:"items"`
+	Retries     int64      `json:"retries"`
+	BusySeconds float64    `json:"busySeconds"`
+}
+
+// NewPool creates a new pool; name labels its metrics
+func NewPool(name string) *Pool {
+	return &Pool{
+		name:    name,
+		workers: make(map[int]*Worker),
+	}
+}
+
+// Worker returns the worker with the given ID, creating it if needed
+func (p *Pool) Worker(id int) *Worker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if w, exists := p.workers[id]; exists {
+		return w
+	}
+
+	w := &Worker{pool: p, id: strconv.Itoa(id)}
+	p.workers[id] = w
+	return w
+}
+
+// Stats returns the state of all workers ordered by ID
+func (p *Pool) Stats() []Stats {
+	p.mu.Lock()
+	ids := make([]int, 0, len(p.workers))
+	for id := range p.workers {
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+
+	sort.Ints(ids)
+	stats := make([]Stats, 0, len(ids))
+	for _, id := range ids {
+		stats = append(stats, p.Worker(id).stats())
+	}
+	return stats
+}
+
+// Begin marks the worker busy with key
+func (w *Worker) Begin(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.currentKey = key
+	w.startedAt = time.Now()
+	metrics.WorkerBusy.WithLabelValues(w.pool.name, w.id).Set(1)
+}
+
+// End marks the worker idle and accounts for the item it processed
+func (w *Worker) End() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	elapsed := time.Since(w.startedAt)
+	w.busy += elapsed
+	w.items++
+	w.currentKey = ""
+	w.startedAt = time.Time{}
+
+	metrics.WorkerBusy.WithLabelValues(w.pool.name, w.id).Set(0)
+	metrics.WorkerBusySeconds.WithLabelValues(w.pool.name, w.id).Add(elapsed.Seconds())
+	metrics.WorkerItemsTotal.WithLabelValues(w.pool.name, w.id).Inc()
+}
+
+// Retry accounts for an item that will be processed again
+func (w *Worker) Retry() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.retries++
+	metrics.WorkerRetriesTotal.WithLabelValues(w.pool.name, w.id).Inc()
+}
+
+func (w *Worker) stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := Stats{
+		ID:          w.id,
+		CurrentKey:  w.currentKey,
+		Items:       w.items,
+		Retries:     w.retries,
+		BusySeconds: w.busy.Seconds(),
+	}
+	if !w.startedAt.IsZero() {
+		since := w.startedAt
+		s.BusySince = &since
+		s.BusySeconds += time.Since(since).Seconds()
+	}
+	return s
+}